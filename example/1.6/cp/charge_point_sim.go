@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	ocpplogging "github.com/lorenzodonini/ocpp-go/logging"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/logging"
 	"github.com/sirupsen/logrus"
 
@@ -26,12 +27,13 @@ const (
 	envVarCACertificate        = "CA_CERTIFICATE_PATH"
 	envVarClientCertificate    = "CLIENT_CERTIFICATE_PATH"
 	envVarClientCertificateKey = "CLIENT_CERTIFICATE_KEY_PATH"
+	envVarFaultProfile         = "FAULT_PROFILE"
 )
 
 var log *logrus.Logger
 
 func setupChargePoint(chargePointID string) ocpp16.ChargePoint {
-	return ocpp16.NewChargePoint(chargePointID, nil, nil)
+	return ocpp16.NewChargePoint(chargePointID, nil, withFaultInjection(ws.NewClient()))
 }
 
 func setupTlsChargePoint(chargePointID string) ocpp16.ChargePoint {
@@ -68,7 +70,21 @@ func setupTlsChargePoint(chargePointID string) ocpp16.ChargePoint {
 		RootCAs:      certPool,
 		Certificates: clientCertificates,
 	})
-	return ocpp16.NewChargePoint(chargePointID, nil, client)
+	return ocpp16.NewChargePoint(chargePointID, nil, withFaultInjection(client))
+}
+
+// Decorates the client with network fault injection, if a fault profile was passed via environment variable.
+func withFaultInjection(client ws.WsClient) ws.WsClient {
+	p, ok := os.LookupEnv(envVarFaultProfile)
+	if !ok {
+		return client
+	}
+	profile, err := ws.ParseFaultProfile(p)
+	if err != nil {
+		log.Fatalf("invalid %v: %v", envVarFaultProfile, err)
+	}
+	log.Infof("injecting network faults with profile %+v", profile)
+	return ws.NewFaultyClient(client, ws.NewFaultInjector(profile))
 }
 
 // exampleRoutine simulates a charge point flow, where
@@ -185,8 +201,8 @@ func main() {
 	chargePoint.SetExtendedTriggerMessageHandler(handler)
 	chargePoint.SetSecurityHandler(handler)
 
-	ocppj.SetLogger(log.WithField("logger", "ocppj"))
-	ws.SetLogger(log.WithField("logger", "websocket"))
+	ocppj.SetLogger(ocpplogging.NewLogrusLogger(log.WithField("logger", "ocppj")))
+	ws.SetLogger(ocpplogging.NewLogrusLogger(log.WithField("logger", "websocket")))
 	// Connects to central system
 	err := chargePoint.Start(csUrl)
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/lorenzodonini/ocpp-go/logging"
 	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
 	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
 	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/localauth"
@@ -28,12 +29,13 @@ const (
 	envVarCACertificate        = "CA_CERTIFICATE_PATH"
 	envVarClientCertificate    = "CLIENT_CERTIFICATE_PATH"
 	envVarClientCertificateKey = "CLIENT_CERTIFICATE_KEY_PATH"
+	envVarFaultProfile         = "FAULT_PROFILE"
 )
 
 var log *logrus.Logger
 
 func setupChargingStation(chargingStationID string) ocpp2.ChargingStation {
-	return ocpp2.NewChargingStation(chargingStationID, nil, nil)
+	return ocpp2.NewChargingStation(chargingStationID, nil, withFaultInjection(ws.NewClient()))
 }
 
 func setupTlsChargingStation(chargingStationID string) ocpp2.ChargingStation {
@@ -70,7 +72,21 @@ func setupTlsChargingStation(chargingStationID string) ocpp2.ChargingStation {
 		RootCAs:      certPool,
 		Certificates: clientCertificates,
 	})
-	return ocpp2.NewChargingStation(chargingStationID, nil, client)
+	return ocpp2.NewChargingStation(chargingStationID, nil, withFaultInjection(client))
+}
+
+// Decorates the client with network fault injection, if a fault profile was passed via environment variable.
+func withFaultInjection(client ws.WsClient) ws.WsClient {
+	p, ok := os.LookupEnv(envVarFaultProfile)
+	if !ok {
+		return client
+	}
+	profile, err := ws.ParseFaultProfile(p)
+	if err != nil {
+		log.Fatalf("invalid %v: %v", envVarFaultProfile, err)
+	}
+	log.Infof("injecting network faults with profile %+v", profile)
+	return ws.NewFaultyClient(client, ws.NewFaultInjector(profile))
 }
 
 // exampleRoutine simulates a charging station flow, where a dummy transaction is started.
@@ -243,7 +259,7 @@ func main() {
 	chargingStation.SetSmartChargingHandler(handler)
 	chargingStation.SetTariffCostHandler(handler)
 	chargingStation.SetTransactionsHandler(handler)
-	ocppj.SetLogger(log)
+	ocppj.SetLogger(logging.NewLogrusLogger(log))
 	// Connects to central system
 	err := chargingStation.Start(csmsUrl)
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/lorenzodonini/ocpp-go/logging"
 	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
 	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
 	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/diagnostics"
@@ -288,7 +289,7 @@ func main() {
 		log.WithField("client", chargingStation.ID()).Info("charging station disconnected")
 		delete(handler.chargingStations, chargingStation.ID())
 	})
-	ocppj.SetLogger(log)
+	ocppj.SetLogger(logging.NewLogrusLogger(log))
 	// Run CSMS
 	log.Infof("starting CSMS on port %v", listenPort)
 	csms.Start(listenPort, "/{ws}")
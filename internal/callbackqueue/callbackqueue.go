@@ -6,24 +6,33 @@ import (
 	"github.com/lorenzodonini/ocpp-go/ocpp"
 )
 
+type callbackEntry struct {
+	requestID string
+	callback  func(confirmation ocpp.Response, err error)
+}
+
 type CallbackQueue struct {
 	callbacksMutex sync.RWMutex
-	callbacks      map[string][]func(confirmation ocpp.Response, err error)
+	callbacks      map[string][]callbackEntry
 }
 
 func New() CallbackQueue {
 	return CallbackQueue{
-		callbacks: make(map[string][]func(confirmation ocpp.Response, err error)),
+		callbacks: make(map[string][]callbackEntry),
 	}
 }
 
-func (cq *CallbackQueue) TryQueue(id string, try func() error, callback func(confirmation ocpp.Response, err error)) error {
+// TryQueue appends a callback to the queue with the given id, then invokes try.
+// The try function sends the request and returns its unique message ID, which is needed by DequeueRequest.
+// If try returns an error, the callback is removed again.
+func (cq *CallbackQueue) TryQueue(id string, try func() (string, error), callback func(confirmation ocpp.Response, err error)) error {
 	cq.callbacksMutex.Lock()
 	defer cq.callbacksMutex.Unlock()
 
-	cq.callbacks[id] = append(cq.callbacks[id], callback)
+	cq.callbacks[id] = append(cq.callbacks[id], callbackEntry{callback: callback})
 
-	if err := try(); err != nil {
+	requestID, err := try()
+	if err != nil {
 		// pop off last element
 		callbacks := cq.callbacks[id]
 		cq.callbacks[id] = callbacks[:len(callbacks)-1]
@@ -34,6 +43,8 @@ func (cq *CallbackQueue) TryQueue(id string, try func() error, callback func(con
 		return err
 	}
 
+	callbacks := cq.callbacks[id]
+	callbacks[len(callbacks)-1].requestID = requestID
 	return nil
 }
 
@@ -50,13 +61,34 @@ func (cq *CallbackQueue) Dequeue(id string) (func(confirmation ocpp.Response, er
 		panic("Internal CallbackQueue inconsistency")
 	}
 
-	callback := callbacks[0]
+	return cq.remove(id, 0), ok
+}
+
+// DequeueRequest removes the callback associated to a specific request, regardless of its position in the queue.
+// The request is identified by its unique message ID.
+// This is needed for requests that are canceled before reaching the front of the queue.
+func (cq *CallbackQueue) DequeueRequest(id string, requestID string) (func(confirmation ocpp.Response, err error), bool) {
+	cq.callbacksMutex.Lock()
+	defer cq.callbacksMutex.Unlock()
+
+	for i, entry := range cq.callbacks[id] {
+		if entry.requestID == requestID {
+			return cq.remove(id, i), true
+		}
+	}
+
+	return nil, false
+}
+
+func (cq *CallbackQueue) remove(id string, i int) func(confirmation ocpp.Response, err error) {
+	callbacks := cq.callbacks[id]
+	callback := callbacks[i].callback
 
 	if len(callbacks) == 1 {
 		delete(cq.callbacks, id)
 	} else {
-		cq.callbacks[id] = callbacks[1:]
+		cq.callbacks[id] = append(callbacks[:i:i], callbacks[i+1:]...)
 	}
 
-	return callback, ok
+	return callback
 }
@@ -0,0 +1,25 @@
+// Package poll contains helpers for waiting on state, which doesn't provide change notifications.
+package poll
+
+import (
+	"context"
+	"time"
+)
+
+// Interval at which conditions are polled.
+const Interval = 20 * time.Millisecond
+
+// Until polls the condition until it is satisfied, or the context is done.
+// If the context is done first, the context error is returned.
+func Until(ctx context.Context, condition func() bool) error {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
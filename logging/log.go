@@ -1,5 +1,11 @@
 package logging
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Logger is the adapter interface that needs to be implemented, if the library should internally print logs.
 //
 // This allows to hook up your logger of choice.
@@ -12,6 +18,99 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 }
 
+// Fields contains key/value pairs, which are attached to a log entry.
+type Fields map[string]interface{}
+
+// Keys of the fields, which the library automatically attaches to its log entries (if available).
+const (
+	FieldClientID  = "clientID"
+	FieldMessageID = "messageId"
+	FieldAction    = "action"
+	FieldDialect   = "dialect"
+)
+
+// StructuredLogger is a Logger, which supports attaching key/value fields to log entries.
+//
+// When passing a StructuredLogger to the library, log entries will carry contextual information
+// (e.g. the ID of the charge point, the message ID and the action), as separate fields.
+// This allows to filter the logs of a single charge point or message exchange.
+//
+// Adapters for logrus and the standard library logger are available, see NewLogrusLogger and NewStdLogger.
+type StructuredLogger interface {
+	Logger
+	// WithFields returns a logger, which attaches the given fields to every log entry,
+	// in addition to the fields that were previously attached to the logger.
+	WithFields(fields Fields) StructuredLogger
+}
+
+// WithFields returns a logger, which attaches the given fields to every log entry.
+//
+// If the passed logger is a StructuredLogger, the fields are attached natively.
+// Otherwise, the fields are appended to every log message, using a key=value format.
+func WithFields(logger Logger, fields Fields) Logger {
+	if len(fields) == 0 {
+		return logger
+	}
+	if structured, ok := logger.(StructuredLogger); ok {
+		return structured.WithFields(fields)
+	}
+	return &fieldsLogger{logger: logger, suffix: formatFields(fields)}
+}
+
+// Formats fields in a key=value format, sorted by key.
+func formatFields(fields Fields) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%v", k, fields[k])
+	}
+	return b.String()
+}
+
+// fieldsLogger decorates a non-structured logger, by appending fields to every log message.
+type fieldsLogger struct {
+	logger Logger
+	suffix string
+}
+
+func (l *fieldsLogger) WithFields(fields Fields) StructuredLogger {
+	if len(fields) == 0 {
+		return l
+	}
+	return &fieldsLogger{logger: l.logger, suffix: l.suffix + " " + formatFields(fields)}
+}
+
+func (l *fieldsLogger) Debug(args ...interface{}) {
+	l.logger.Debug(fmt.Sprint(args...), " ", l.suffix)
+}
+
+func (l *fieldsLogger) Debugf(format string, args ...interface{}) {
+	l.logger.Debugf("%s %s", fmt.Sprintf(format, args...), l.suffix)
+}
+
+func (l *fieldsLogger) Info(args ...interface{}) {
+	l.logger.Info(fmt.Sprint(args...), " ", l.suffix)
+}
+
+func (l *fieldsLogger) Infof(format string, args ...interface{}) {
+	l.logger.Infof("%s %s", fmt.Sprintf(format, args...), l.suffix)
+}
+
+func (l *fieldsLogger) Error(args ...interface{}) {
+	l.logger.Error(fmt.Sprint(args...), " ", l.suffix)
+}
+
+func (l *fieldsLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf("%s %s", fmt.Sprintf(format, args...), l.suffix)
+}
+
 // VoidLogger is an empty implementation of the Logger interface, which doesn't actually process any logs.
 // It may be used as a dummy implementation, if no logs should be visible.
 type VoidLogger struct{}
@@ -22,3 +121,4 @@ func (l *VoidLogger) Info(args ...interface{})                  {}
 func (l *VoidLogger) Infof(format string, args ...interface{})  {}
 func (l *VoidLogger) Error(args ...interface{})                 {}
 func (l *VoidLogger) Errorf(format string, args ...interface{}) {}
+func (l *VoidLogger) WithFields(fields Fields) StructuredLogger { return l }
@@ -0,0 +1,54 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/logging"
+)
+
+func TestWithFieldsPlainLogger(t *testing.T) {
+	var buf bytes.Buffer
+	entry := logrus.New()
+	entry.SetOutput(&buf)
+	entry.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableColors: true})
+	// A logrus logger isn't a StructuredLogger, hence fields are appended to the message
+	logger := logging.WithFields(entry, logging.Fields{logging.FieldMessageID: "1234", logging.FieldClientID: "CP-1"})
+	logger.Infof("received %v", "message")
+	assert.Equal(t, "level=info msg=\"received message clientID=CP-1 messageId=1234\"\n", buf.String())
+	// Without fields, the original logger is returned
+	assert.Equal(t, entry, logging.WithFields(entry, nil))
+}
+
+func TestLogrusLogger(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buf)
+	base.SetFormatter(&logrus.JSONFormatter{})
+	logger := logging.WithFields(logging.NewLogrusLogger(base.WithField("logger", "ocppj")), logging.Fields{logging.FieldClientID: "CP-1"})
+	logger = logging.WithFields(logger, logging.Fields{logging.FieldAction: "Heartbeat"})
+	logger.Infof("received %v", "message")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "received message", entry["msg"])
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "ocppj", entry["logger"])
+	assert.Equal(t, "CP-1", entry[logging.FieldClientID])
+	assert.Equal(t, "Heartbeat", entry[logging.FieldAction])
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	base := log.New(&buf, "", 0)
+	logger := logging.NewStdLogger(base, logging.LevelInfo)
+	logger.Debugf("hidden %v", 1)
+	logger.WithFields(logging.Fields{logging.FieldClientID: "CP-1"}).WithFields(logging.Fields{logging.FieldAction: "Heartbeat"}).Infof("connected %v", 2)
+	logger.Error("failed")
+	assert.Equal(t, "INFO connected 2 clientID=CP-1 action=Heartbeat\nERROR failed\n", buf.String())
+}
@@ -0,0 +1,21 @@
+package logging
+
+import "github.com/sirupsen/logrus"
+
+// logrusLogger adapts a logrus logger to the StructuredLogger interface.
+type logrusLogger struct {
+	logrus.FieldLogger
+}
+
+// NewLogrusLogger wraps a logrus logger (either a *logrus.Logger or a *logrus.Entry),
+// so fields attached by the library are passed to logrus as native fields.
+//
+//	log := logrus.New()
+//	ocppj.SetLogger(logging.NewLogrusLogger(log.WithField("logger", "ocppj")))
+func NewLogrusLogger(logger logrus.FieldLogger) StructuredLogger {
+	return &logrusLogger{FieldLogger: logger}
+}
+
+func (l *logrusLogger) WithFields(fields Fields) StructuredLogger {
+	return &logrusLogger{FieldLogger: l.FieldLogger.WithFields(logrus.Fields(fields))}
+}
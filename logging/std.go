@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+)
+
+// Level is the minimum severity of the entries printed by a standard library logger.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+)
+
+// stdLogger adapts a standard library logger to the StructuredLogger interface.
+type stdLogger struct {
+	logger *log.Logger
+	level  Level
+	fields string
+}
+
+// NewStdLogger wraps a standard library logger. Only entries with at least the given severity are printed.
+//
+// Every entry is prefixed with its severity, while fields attached by the library are appended
+// to the message, using a key=value format:
+//
+//	INFO connected to server clientID=CP-1
+//
+// If logger is nil, the standard logger of the log package is used.
+func NewStdLogger(logger *log.Logger, level Level) StructuredLogger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &stdLogger{logger: logger, level: level}
+}
+
+func (l *stdLogger) WithFields(fields Fields) StructuredLogger {
+	if len(fields) == 0 {
+		return l
+	}
+	merged := formatFields(fields)
+	if l.fields != "" {
+		merged = l.fields + " " + merged
+	}
+	return &stdLogger{logger: l.logger, level: l.level, fields: merged}
+}
+
+func (l *stdLogger) print(level Level, prefix string, message string) {
+	if level < l.level {
+		return
+	}
+	if l.fields != "" {
+		message = message + " " + l.fields
+	}
+	_ = l.logger.Output(3, prefix+" "+message)
+}
+
+func (l *stdLogger) Debug(args ...interface{}) {
+	l.print(LevelDebug, "DEBUG", fmt.Sprint(args...))
+}
+
+func (l *stdLogger) Debugf(format string, args ...interface{}) {
+	l.print(LevelDebug, "DEBUG", fmt.Sprintf(format, args...))
+}
+
+func (l *stdLogger) Info(args ...interface{}) {
+	l.print(LevelInfo, "INFO", fmt.Sprint(args...))
+}
+
+func (l *stdLogger) Infof(format string, args ...interface{}) {
+	l.print(LevelInfo, "INFO", fmt.Sprintf(format, args...))
+}
+
+func (l *stdLogger) Error(args ...interface{}) {
+	l.print(LevelError, "ERROR", fmt.Sprint(args...))
+}
+
+func (l *stdLogger) Errorf(format string, args ...interface{}) {
+	l.print(LevelError, "ERROR", fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,94 @@
+// Contains the Metrics interface, through which the library reports its internal metrics,
+// and a Registry implementation exposing them in the Prometheus text format.
+package metrics
+
+// Labels are name/value pairs, further identifying a metric.
+//
+// Since every distinct combination of label values creates a new time series,
+// the library never uses unbounded values (e.g. client IDs or message IDs) as labels.
+type Labels map[string]string
+
+// Metrics is the adapter interface that needs to be implemented, if the library should report internal metrics.
+//
+// This allows to hook up your metrics system of choice. All methods may be called concurrently
+// and must return quickly, as they are invoked on the hot path of the networking and dispatching layers.
+//
+// A ready-to-use implementation is provided by the Registry.
+type Metrics interface {
+	// IncCounter increments the counter with the given name by one.
+	IncCounter(name string, labels Labels)
+	// SetGauge sets the gauge with the given name to an absolute value.
+	SetGauge(name string, value float64, labels Labels)
+	// AddGauge adds a (potentially negative) delta to the gauge with the given name.
+	AddGauge(name string, delta float64, labels Labels)
+	// ObserveHistogram records a single observation for the histogram with the given name.
+	ObserveHistogram(name string, value float64, labels Labels)
+}
+
+// VoidMetrics is an empty implementation of the Metrics interface, which doesn't actually process any metrics.
+// It is used by default, if no metrics were set.
+type VoidMetrics struct{}
+
+func (m *VoidMetrics) IncCounter(name string, labels Labels)                      {}
+func (m *VoidMetrics) SetGauge(name string, value float64, labels Labels)         {}
+func (m *VoidMetrics) AddGauge(name string, delta float64, labels Labels)         {}
+func (m *VoidMetrics) ObserveHistogram(name string, value float64, labels Labels) {}
+
+// Names of the metrics reported by the library.
+const (
+	// Gauge: number of currently open websocket connections.
+	WsConnections = "ocpp_ws_connections"
+	// Counter: number of websocket connections established successfully.
+	WsConnectionsTotal = "ocpp_ws_connections_total"
+	// Counter: number of incoming websocket connections refused by the server, by reason.
+	WsConnectionsRejectedTotal = "ocpp_ws_connections_rejected_total"
+	// Counter: number of closed websocket connections.
+	WsDisconnectionsTotal = "ocpp_ws_disconnections_total"
+	// Counter: number of reconnection attempts performed by a client.
+	WsReconnectAttemptsTotal = "ocpp_ws_reconnect_attempts_total"
+	// Counter: number of successful reconnections performed by a client.
+	WsReconnectsTotal = "ocpp_ws_reconnects_total"
+	// Counter: number of received websocket messages.
+	WsMessagesReceivedTotal = "ocpp_ws_messages_received_total"
+	// Counter: number of websocket messages written to the network.
+	WsMessagesSentTotal = "ocpp_ws_messages_sent_total"
+	// Counter: number of failed websocket writes.
+	WsWriteErrorsTotal = "ocpp_ws_write_errors_total"
+	// Counter: number of received websocket messages exceeding the maximum message size.
+	WsMessagesTooBigTotal = "ocpp_ws_messages_too_big_total"
+	// Gauge: number of outgoing requests waiting in the dispatcher queues, including pending requests.
+	RequestQueueDepth = "ocpp_request_queue_depth"
+	// Counter: number of requests sent to the other endpoint, by action. Retransmissions are counted as well.
+	RequestsSentTotal = "ocpp_requests_sent_total"
+	// Histogram: time in seconds between sending a request and receiving the response, by action.
+	RequestDurationSeconds = "ocpp_request_duration_seconds"
+	// Counter: number of requests that didn't receive a response in time, by action.
+	RequestTimeoutsTotal = "ocpp_request_timeouts_total"
+	// Counter: number of requests removed from the dispatcher without a response, by action and reason.
+	RequestsCanceledTotal = "ocpp_requests_canceled_total"
+	// Counter: number of OCPP messages that failed payload validation, by direction and error code.
+	// Malformed messages and unsupported features are not counted.
+	ValidationFailuresTotal = "ocpp_validation_failures_total"
+)
+
+// Names of the labels attached to the metrics reported by the library.
+const (
+	// Either RoleClient or RoleServer.
+	LabelRole = "role"
+	// The action (i.e. feature name) of a request.
+	LabelAction = "action"
+	// The reason for a rejected connection or a canceled request.
+	LabelReason = "reason"
+	// Either DirectionInbound or DirectionOutbound.
+	LabelDirection = "direction"
+	// The OCPP error code of a validation failure.
+	LabelCode = "code"
+)
+
+// Values for the role and direction labels.
+const (
+	RoleClient        = "client"
+	RoleServer        = "server"
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
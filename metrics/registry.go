@@ -0,0 +1,300 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the histogram buckets used by a Registry,
+// unless different buckets were set via SetBuckets.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type metricKind int
+
+const (
+	counterKind metricKind = iota
+	gaugeKind
+	histogramKind
+)
+
+func (k metricKind) String() string {
+	switch k {
+	case counterKind:
+		return "counter"
+	case gaugeKind:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+type series struct {
+	labels string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	kind    metricKind
+	buckets []float64
+	series  map[string]*series
+}
+
+// Registry is an in-memory implementation of the Metrics interface, with no external dependencies.
+// All values are kept in memory and can be exposed in the Prometheus text format, via the ServeHTTP method.
+//
+// The registry may be mounted directly on a websocket server:
+//
+//	registry := metrics.NewRegistry()
+//	server := ws.NewServer()
+//	server.SetMetrics(registry)
+//	server.AddHttpHandler("/metrics", registry.ServeHTTP)
+//
+// A metric name is bound to the kind it was first used with (counter, gauge or histogram).
+// Subsequent calls for the same name with a different kind are ignored.
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+	help     map[string]string
+	buckets  map[string][]float64
+}
+
+// NewRegistry creates a new, empty Registry.
+// Help texts for all metrics reported by the library are registered automatically.
+func NewRegistry() *Registry {
+	r := &Registry{
+		families: map[string]*family{},
+		help:     map[string]string{},
+		buckets:  map[string][]float64{},
+	}
+	for name, help := range defaultHelp {
+		r.help[name] = help
+	}
+	return r
+}
+
+var defaultHelp = map[string]string{
+	WsConnections:              "Number of currently open websocket connections.",
+	WsConnectionsTotal:         "Number of websocket connections established successfully.",
+	WsConnectionsRejectedTotal: "Number of incoming websocket connections refused by the server.",
+	WsDisconnectionsTotal:      "Number of closed websocket connections.",
+	WsReconnectAttemptsTotal:   "Number of reconnection attempts performed by a client.",
+	WsReconnectsTotal:          "Number of successful reconnections performed by a client.",
+	WsMessagesReceivedTotal:    "Number of received websocket messages.",
+	WsMessagesSentTotal:        "Number of websocket messages written to the network.",
+	WsWriteErrorsTotal:         "Number of failed websocket writes.",
+	WsMessagesTooBigTotal:      "Number of received websocket messages exceeding the maximum message size.",
+	RequestQueueDepth:          "Number of outgoing requests waiting in the dispatcher queues.",
+	RequestsSentTotal:          "Number of requests sent to the other endpoint.",
+	RequestDurationSeconds:     "Time between sending a request and receiving the response.",
+	RequestTimeoutsTotal:       "Number of requests that didn't receive a response in time.",
+	RequestsCanceledTotal:      "Number of requests removed from the dispatcher without a response.",
+	ValidationFailuresTotal:    "Number of OCPP messages that failed validation.",
+}
+
+// Describe sets the help text for the metric with the given name, which is included in the exposition output.
+func (r *Registry) Describe(name string, help string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.help[name] = help
+}
+
+// SetBuckets sets the upper bounds of the buckets for the histogram with the given name.
+// The buckets need to be set before the first observation, otherwise they are ignored.
+func (r *Registry) SetBuckets(name string, buckets ...float64) {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.buckets[name] = sorted
+}
+
+func (r *Registry) IncCounter(name string, labels Labels) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.getSeries(name, counterKind, labels); s != nil {
+		s.value++
+	}
+}
+
+func (r *Registry) SetGauge(name string, value float64, labels Labels) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.getSeries(name, gaugeKind, labels); s != nil {
+		s.value = value
+	}
+}
+
+func (r *Registry) AddGauge(name string, delta float64, labels Labels) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.getSeries(name, gaugeKind, labels); s != nil {
+		s.value += delta
+	}
+}
+
+func (r *Registry) ObserveHistogram(name string, value float64, labels Labels) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f := r.getFamily(name, histogramKind)
+	if f == nil {
+		return
+	}
+	s := f.getSeries(labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	for i, upperBound := range f.buckets {
+		if value <= upperBound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Returns the family for the given name, creating it if needed.
+// Returns nil if the name is already used by a metric of a different kind.
+func (r *Registry) getFamily(name string, kind metricKind) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: kind, series: map[string]*series{}}
+		if kind == histogramKind {
+			f.buckets = DefaultBuckets
+			if buckets, ok := r.buckets[name]; ok {
+				f.buckets = buckets
+			}
+		}
+		r.families[name] = f
+	} else if f.kind != kind {
+		return nil
+	}
+	return f
+}
+
+func (r *Registry) getSeries(name string, kind metricKind, labels Labels) *series {
+	f := r.getFamily(name, kind)
+	if f == nil {
+		return nil
+	}
+	return f.getSeries(labels)
+}
+
+func (f *family) getSeries(labels Labels) *series {
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(w)
+}
+
+// Write writes all metrics to the given writer, in the Prometheus text exposition format.
+// Metrics are sorted by name and labels, so the output is stable.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	bw := bufio.NewWriter(w)
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		if help, ok := r.help[name]; ok {
+			fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != histogramKind {
+				fmt.Fprintf(bw, "%s%s %s\n", name, wrapLabels(s.labels), formatFloat(s.value))
+				continue
+			}
+			for i, upperBound := range f.buckets {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(s.labels, `le="`+formatFloat(upperBound)+`"`)), s.counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(s.labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, wrapLabels(s.labels), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, wrapLabels(s.labels), s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Formats labels as a sorted, comma-separated list of name="value" pairs.
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(labels[name]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels string, pair string) string {
+	if labels == "" {
+		return pair
+	}
+	return labels + "," + pair
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
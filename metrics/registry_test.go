@@ -0,0 +1,88 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/metrics"
+)
+
+func write(t *testing.T, registry *metrics.Registry) string {
+	var b strings.Builder
+	require.NoError(t, registry.Write(&b))
+	return b.String()
+}
+
+func TestCounter(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.IncCounter("test_total", metrics.Labels{"b": "2", "a": "1"})
+	registry.IncCounter("test_total", metrics.Labels{"a": "1", "b": "2"})
+	registry.IncCounter("test_total", nil)
+	registry.Describe("test_total", "A test counter.")
+	expected := `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total 1
+test_total{a="1",b="2"} 2
+`
+	assert.Equal(t, expected, write(t, registry))
+}
+
+func TestGauge(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.SetGauge(metrics.WsConnections, 5, metrics.Labels{metrics.LabelRole: metrics.RoleServer})
+	registry.AddGauge(metrics.WsConnections, -2, metrics.Labels{metrics.LabelRole: metrics.RoleServer})
+	registry.AddGauge(metrics.WsConnections, 0.5, metrics.Labels{metrics.LabelRole: metrics.RoleClient})
+	output := write(t, registry)
+	assert.Contains(t, output, "# TYPE ocpp_ws_connections gauge\n")
+	assert.Contains(t, output, "ocpp_ws_connections{role=\"client\"} 0.5\n")
+	assert.Contains(t, output, "ocpp_ws_connections{role=\"server\"} 3\n")
+}
+
+func TestHistogram(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.SetBuckets("test_seconds", 1, 0.1)
+	for _, v := range []float64{0.05, 0.5, 0.5, 2} {
+		registry.ObserveHistogram("test_seconds", v, metrics.Labels{"action": "Heartbeat"})
+	}
+	expected := `# TYPE test_seconds histogram
+test_seconds_bucket{action="Heartbeat",le="0.1"} 1
+test_seconds_bucket{action="Heartbeat",le="1"} 3
+test_seconds_bucket{action="Heartbeat",le="+Inf"} 4
+test_seconds_sum{action="Heartbeat"} 3.05
+test_seconds_count{action="Heartbeat"} 4
+`
+	assert.Equal(t, expected, write(t, registry))
+}
+
+func TestKindMismatch(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.IncCounter("test", nil)
+	registry.SetGauge("test", 10, nil)
+	registry.ObserveHistogram("test", 10, nil)
+	assert.Equal(t, "# TYPE test counter\ntest 1\n", write(t, registry))
+}
+
+func TestLabelEscaping(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.IncCounter("test_total", metrics.Labels{"reason": "a \"quoted\"\nvalue\\"})
+	assert.Contains(t, write(t, registry), `test_total{reason="a \"quoted\"\nvalue\\"} 1`)
+}
+
+func TestServeHTTP(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.IncCounter(metrics.WsReconnectsTotal, metrics.Labels{metrics.LabelRole: metrics.RoleClient})
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	expected := `# HELP ocpp_ws_reconnects_total Number of successful reconnections performed by a client.
+# TYPE ocpp_ws_reconnects_total counter
+ocpp_ws_reconnects_total{role="client"} 1
+`
+	assert.Equal(t, expected, recorder.Body.String())
+}
@@ -0,0 +1,153 @@
+// The package contains a server, which is able to handle OCPP 1.6 charge points and OCPP 2.0.1 charging stations
+// on the same listener.
+//
+// The OCPP version is negotiated via websocket sub-protocol during the handshake.
+// Each connection is then routed to the matching OCPP 1.6 central system or OCPP 2.0.1 CSMS.
+package multiversion
+
+import (
+	"context"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	types16 "github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	ocpp2 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
+	types2 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+// ConnectionHandler is invoked for connection events of any supported OCPP version.
+// The dialect parameter contains the OCPP version, which was negotiated with the client.
+type ConnectionHandler func(client ws.Channel, dialect ocpp.Dialect)
+
+// Server accepts connections from both OCPP 1.6 and OCPP 2.0.1 clients on a single websocket server.
+//
+// Create a new server using NewServer, then register the handlers on the version-specific endpoints:
+//
+//	server := multiversion.NewServer(nil)
+//	server.CentralSystem().SetCoreHandler(v16Handler)
+//	server.CSMS().SetProvisioningHandler(v201Handler)
+//	server.SetNewClientHandler(func(client ws.Channel, dialect ocpp.Dialect) {
+//		// handle new client...
+//	})
+//	server.Start(8887, "/{ws}")
+//
+// Requests to a client must be sent via the endpoint matching the version the client connected with.
+type Server struct {
+	mux           *ws.ServerMux
+	centralSystem ocpp16.CentralSystem
+	csms          ocpp2.CSMS
+}
+
+// NewServer creates a new multi-version server on top of the passed websocket server.
+//
+// If no websocket server is passed, a default one is created:
+//
+//	server := NewServer(nil)
+//
+// If you need a TLS server, you may use the following:
+//
+//	server := NewServer(ws.NewTLSServer("certificatePath", "privateKeyPath", tlsConfig))
+//
+// The websocket server must not be used directly after being passed to this function.
+func NewServer(server ws.WsServer) *Server {
+	mux := ws.NewServerMux(server)
+	return &Server{
+		mux:           mux,
+		centralSystem: ocpp16.NewCentralSystem(nil, mux.Route(types16.V16Subprotocol)),
+		csms:          ocpp2.NewCSMS(nil, mux.Route(types2.V201Subprotocol)),
+	}
+}
+
+// Dialect returns the OCPP version associated to a websocket sub-protocol.
+// If the sub-protocol is not supported, 0 is returned.
+func Dialect(subProtocol string) ocpp.Dialect {
+	switch subProtocol {
+	case types16.V16Subprotocol:
+		return ocpp.V16
+	case types2.V201Subprotocol:
+		return ocpp.V2
+	default:
+		return 0
+	}
+}
+
+// Returns the OCPP version negotiated by a client, or 0 if the channel doesn't expose its sub-protocol.
+func channelDialect(client ws.Channel) ocpp.Dialect {
+	if channel, ok := client.(ws.SubProtocolChannel); ok {
+		return Dialect(channel.SubProtocol())
+	}
+	return 0
+}
+
+// CentralSystem returns the endpoint handling OCPP 1.6 charge points.
+func (s *Server) CentralSystem() ocpp16.CentralSystem {
+	return s.centralSystem
+}
+
+// CSMS returns the endpoint handling OCPP 2.0.1 charging stations.
+func (s *Server) CSMS() ocpp2.CSMS {
+	return s.csms
+}
+
+// SetNewClientHandler registers a handler for new incoming connections of any OCPP version.
+// The handler is invoked after the handler registered on the version-specific endpoint (if any).
+func (s *Server) SetNewClientHandler(handler ConnectionHandler) {
+	s.mux.SetNewClientHandler(func(client ws.Channel) {
+		handler(client, channelDialect(client))
+	})
+}
+
+// SetDisconnectedClientHandler registers a handler for disconnections of clients of any OCPP version.
+// The handler is invoked after the handler registered on the version-specific endpoint (if any).
+func (s *Server) SetDisconnectedClientHandler(handler ConnectionHandler) {
+	s.mux.SetDisconnectedClientHandler(func(client ws.Channel) {
+		handler(client, channelDialect(client))
+	})
+}
+
+// Start starts both endpoints and runs the shared websocket server on the specified port and URL.
+//
+// The function blocks forever, so it is suggested to wrap it in a goroutine.
+func (s *Server) Start(listenPort int, listenPath string) {
+	// Endpoints only start their dispatchers, since the listener is owned by the mux
+	s.centralSystem.Start(listenPort, listenPath)
+	s.csms.Start(listenPort, listenPath)
+	s.mux.Start(listenPort, listenPath)
+}
+
+// Stop stops both endpoints, clearing all pending requests, and shuts down the shared websocket server.
+func (s *Server) Stop() {
+	s.centralSystem.Stop()
+	s.csms.Stop()
+	s.mux.Stop()
+}
+
+// Shutdown gracefully shuts down both endpoints, then the shared websocket server:
+//
+// - new outgoing requests are refused by both endpoints, while queued and pending requests are completed
+//
+// - new incoming requests are rejected, while responses to the ones in progress are sent
+//
+// - connections are closed with a CloseGoingAway code, so clients may reconnect
+//
+// If the context is done before, remaining connections are forcefully closed and the context error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	errC := make(chan error, 2)
+	go func() {
+		errC <- s.centralSystem.Shutdown(ctx)
+	}()
+	go func() {
+		errC <- s.csms.Shutdown(ctx)
+	}()
+	var err error
+	for i := 0; i < 2; i++ {
+		if endpointErr := <-errC; endpointErr != nil && err == nil {
+			err = endpointErr
+		}
+	}
+	if muxErr := s.mux.Shutdown(ctx); muxErr != nil && err == nil {
+		err = muxErr
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package multiversion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	types16 "github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	ocpp2 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
+	types2 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+const (
+	serverPort = 8887
+	serverPath = "/ws/{id}"
+	serverURL  = "ws://localhost:8887/ws"
+)
+
+type coreHandler struct {
+	core.CentralSystemHandler
+	heartbeatC chan string
+}
+
+func (h *coreHandler) OnHeartbeat(chargePointId string, request *core.HeartbeatRequest) (*core.HeartbeatConfirmation, error) {
+	h.heartbeatC <- chargePointId
+	return core.NewHeartbeatConfirmation(types16.NewDateTime(time.Now())), nil
+}
+
+type availabilityHandler struct {
+	availability.CSMSHandler
+	heartbeatC chan string
+}
+
+func (h *availabilityHandler) OnHeartbeat(chargingStationID string, request *availability.HeartbeatRequest) (*availability.HeartbeatResponse, error) {
+	h.heartbeatC <- chargingStationID
+	return availability.NewHeartbeatResponse(*types2.NewDateTime(time.Now())), nil
+}
+
+func TestDialect(t *testing.T) {
+	assert.Equal(t, ocpp.V16, Dialect(types16.V16Subprotocol))
+	assert.Equal(t, ocpp.V2, Dialect(types2.V201Subprotocol))
+	assert.Equal(t, ocpp.Dialect(0), Dialect("ocpp2.0"))
+}
+
+func TestMultiVersionServer(t *testing.T) {
+	server := NewServer(nil)
+	heartbeatC := make(chan string, 2)
+	server.CentralSystem().SetCoreHandler(&coreHandler{heartbeatC: heartbeatC})
+	server.CSMS().SetAvailabilityHandler(&availabilityHandler{heartbeatC: heartbeatC})
+	connectedC := make(chan ocpp.Dialect, 2)
+	disconnectedC := make(chan ocpp.Dialect, 2)
+	server.SetNewClientHandler(func(client ws.Channel, dialect ocpp.Dialect) {
+		connectedC <- dialect
+	})
+	server.SetDisconnectedClientHandler(func(client ws.Channel, dialect ocpp.Dialect) {
+		disconnectedC <- dialect
+	})
+	go server.Start(serverPort, serverPath)
+	defer server.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	// Connect a 1.6 charge point
+	chargePoint := ocpp16.NewChargePoint("cp0001", nil, nil)
+	err := chargePoint.Start(serverURL)
+	require.NoError(t, err)
+	assert.Equal(t, ocpp.V16, <-connectedC)
+	_, err = chargePoint.Heartbeat()
+	require.NoError(t, err)
+	assert.Equal(t, "cp0001", <-heartbeatC)
+
+	// Connect a 2.0.1 charging station
+	chargingStation := ocpp2.NewChargingStation("cs0001", nil, nil)
+	err = chargingStation.Start(serverURL)
+	require.NoError(t, err)
+	assert.Equal(t, ocpp.V2, <-connectedC)
+	_, err = chargingStation.Heartbeat()
+	require.NoError(t, err)
+	assert.Equal(t, "cs0001", <-heartbeatC)
+
+	// Disconnect both
+	chargePoint.Stop()
+	assert.Equal(t, ocpp.V16, <-disconnectedC)
+	chargingStation.Stop()
+	assert.Equal(t, ocpp.V2, <-disconnectedC)
+}
+
+func TestMultiVersionServerShutdown(t *testing.T) {
+	server := NewServer(nil)
+	server.CentralSystem().SetCoreHandler(&coreHandler{heartbeatC: make(chan string, 1)})
+	disconnectedC := make(chan ocpp.Dialect, 1)
+	server.SetDisconnectedClientHandler(func(client ws.Channel, dialect ocpp.Dialect) {
+		disconnectedC <- dialect
+	})
+	go server.Start(serverPort, serverPath)
+	time.Sleep(200 * time.Millisecond)
+
+	chargePoint := ocpp16.NewChargePoint("cp0001", nil, nil)
+	err := chargePoint.Start(serverURL)
+	require.NoError(t, err)
+	defer chargePoint.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	require.NoError(t, err)
+	// Connection was closed by the server
+	assert.Equal(t, ocpp.V16, <-disconnectedC)
+	// Both endpoints refuse new requests
+	err = server.CentralSystem().SendRequestAsync("cp0001", core.NewClearCacheRequest(), func(response ocpp.Response, err error) {})
+	assert.Error(t, err)
+	err = server.CSMS().SendRequestAsync("cs0001", availability.NewChangeAvailabilityRequest(availability.OperationalStatusOperative), func(response ocpp.Response, err error) {})
+	assert.Error(t, err)
+}
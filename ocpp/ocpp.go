@@ -121,3 +121,14 @@ const (
 	V16
 	V2
 )
+
+func (d Dialect) String() string {
+	switch d {
+	case V16:
+		return "ocpp1.6"
+	case V2:
+		return "ocpp2.0.1"
+	default:
+		return "unknown"
+	}
+}
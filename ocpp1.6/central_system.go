@@ -1,7 +1,10 @@
 package ocpp16
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"reflect"
 
 	"github.com/lorenzodonini/ocpp-go/internal/callbackqueue"
@@ -37,6 +40,8 @@ type centralSystem struct {
 	errC                  chan error
 }
 
+var _ CentralSystemCtx = (*centralSystem)(nil)
+
 func newCentralSystem(server *ocppj.Server) centralSystem {
 	if server == nil {
 		panic("server must not be nil")
@@ -62,6 +67,10 @@ func (cs *centralSystem) Errors() <-chan error {
 }
 
 func (cs *centralSystem) ChangeAvailability(clientId string, callback func(confirmation *core.ChangeAvailabilityConfirmation, err error), connectorId int, availabilityType core.AvailabilityType, props ...func(request *core.ChangeAvailabilityRequest)) error {
+	return cs.ChangeAvailabilityCtx(context.Background(), clientId, callback, connectorId, availabilityType, props...)
+}
+
+func (cs *centralSystem) ChangeAvailabilityCtx(ctx context.Context, clientId string, callback func(confirmation *core.ChangeAvailabilityConfirmation, err error), connectorId int, availabilityType core.AvailabilityType, props ...func(request *core.ChangeAvailabilityRequest)) error {
 	request := core.NewChangeAvailabilityRequest(connectorId, availabilityType)
 	for _, fn := range props {
 		fn(request)
@@ -73,10 +82,14 @@ func (cs *centralSystem) ChangeAvailability(clientId string, callback func(confi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) ChangeConfiguration(clientId string, callback func(confirmation *core.ChangeConfigurationConfirmation, err error), key string, value string, props ...func(request *core.ChangeConfigurationRequest)) error {
+	return cs.ChangeConfigurationCtx(context.Background(), clientId, callback, key, value, props...)
+}
+
+func (cs *centralSystem) ChangeConfigurationCtx(ctx context.Context, clientId string, callback func(confirmation *core.ChangeConfigurationConfirmation, err error), key string, value string, props ...func(request *core.ChangeConfigurationRequest)) error {
 	request := core.NewChangeConfigurationRequest(key, value)
 	for _, fn := range props {
 		fn(request)
@@ -88,10 +101,14 @@ func (cs *centralSystem) ChangeConfiguration(clientId string, callback func(conf
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) ClearCache(clientId string, callback func(confirmation *core.ClearCacheConfirmation, err error), props ...func(*core.ClearCacheRequest)) error {
+	return cs.ClearCacheCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *centralSystem) ClearCacheCtx(ctx context.Context, clientId string, callback func(confirmation *core.ClearCacheConfirmation, err error), props ...func(*core.ClearCacheRequest)) error {
 	request := core.NewClearCacheRequest()
 	for _, fn := range props {
 		fn(request)
@@ -103,10 +120,14 @@ func (cs *centralSystem) ClearCache(clientId string, callback func(confirmation
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) DataTransfer(clientId string, callback func(confirmation *core.DataTransferConfirmation, err error), vendorId string, props ...func(request *core.DataTransferRequest)) error {
+	return cs.DataTransferCtx(context.Background(), clientId, callback, vendorId, props...)
+}
+
+func (cs *centralSystem) DataTransferCtx(ctx context.Context, clientId string, callback func(confirmation *core.DataTransferConfirmation, err error), vendorId string, props ...func(request *core.DataTransferRequest)) error {
 	request := core.NewDataTransferRequest(vendorId)
 	for _, fn := range props {
 		fn(request)
@@ -118,10 +139,14 @@ func (cs *centralSystem) DataTransfer(clientId string, callback func(confirmatio
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) GetConfiguration(clientId string, callback func(confirmation *core.GetConfigurationConfirmation, err error), keys []string, props ...func(request *core.GetConfigurationRequest)) error {
+	return cs.GetConfigurationCtx(context.Background(), clientId, callback, keys, props...)
+}
+
+func (cs *centralSystem) GetConfigurationCtx(ctx context.Context, clientId string, callback func(confirmation *core.GetConfigurationConfirmation, err error), keys []string, props ...func(request *core.GetConfigurationRequest)) error {
 	request := core.NewGetConfigurationRequest(keys)
 	for _, fn := range props {
 		fn(request)
@@ -133,10 +158,14 @@ func (cs *centralSystem) GetConfiguration(clientId string, callback func(confirm
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) RemoteStartTransaction(clientId string, callback func(*core.RemoteStartTransactionConfirmation, error), idTag string, props ...func(*core.RemoteStartTransactionRequest)) error {
+	return cs.RemoteStartTransactionCtx(context.Background(), clientId, callback, idTag, props...)
+}
+
+func (cs *centralSystem) RemoteStartTransactionCtx(ctx context.Context, clientId string, callback func(*core.RemoteStartTransactionConfirmation, error), idTag string, props ...func(*core.RemoteStartTransactionRequest)) error {
 	request := core.NewRemoteStartTransactionRequest(idTag)
 	for _, fn := range props {
 		fn(request)
@@ -148,10 +177,14 @@ func (cs *centralSystem) RemoteStartTransaction(clientId string, callback func(*
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) RemoteStopTransaction(clientId string, callback func(*core.RemoteStopTransactionConfirmation, error), transactionId int, props ...func(request *core.RemoteStopTransactionRequest)) error {
+	return cs.RemoteStopTransactionCtx(context.Background(), clientId, callback, transactionId, props...)
+}
+
+func (cs *centralSystem) RemoteStopTransactionCtx(ctx context.Context, clientId string, callback func(*core.RemoteStopTransactionConfirmation, error), transactionId int, props ...func(request *core.RemoteStopTransactionRequest)) error {
 	request := core.NewRemoteStopTransactionRequest(transactionId)
 	for _, fn := range props {
 		fn(request)
@@ -163,10 +196,14 @@ func (cs *centralSystem) RemoteStopTransaction(clientId string, callback func(*c
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) Reset(clientId string, callback func(*core.ResetConfirmation, error), resetType core.ResetType, props ...func(request *core.ResetRequest)) error {
+	return cs.ResetCtx(context.Background(), clientId, callback, resetType, props...)
+}
+
+func (cs *centralSystem) ResetCtx(ctx context.Context, clientId string, callback func(*core.ResetConfirmation, error), resetType core.ResetType, props ...func(request *core.ResetRequest)) error {
 	request := core.NewResetRequest(resetType)
 	for _, fn := range props {
 		fn(request)
@@ -178,10 +215,14 @@ func (cs *centralSystem) Reset(clientId string, callback func(*core.ResetConfirm
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) UnlockConnector(clientId string, callback func(*core.UnlockConnectorConfirmation, error), connectorId int, props ...func(*core.UnlockConnectorRequest)) error {
+	return cs.UnlockConnectorCtx(context.Background(), clientId, callback, connectorId, props...)
+}
+
+func (cs *centralSystem) UnlockConnectorCtx(ctx context.Context, clientId string, callback func(*core.UnlockConnectorConfirmation, error), connectorId int, props ...func(*core.UnlockConnectorRequest)) error {
 	request := core.NewUnlockConnectorRequest(connectorId)
 	for _, fn := range props {
 		fn(request)
@@ -193,10 +234,14 @@ func (cs *centralSystem) UnlockConnector(clientId string, callback func(*core.Un
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) GetLocalListVersion(clientId string, callback func(*localauth.GetLocalListVersionConfirmation, error), props ...func(request *localauth.GetLocalListVersionRequest)) error {
+	return cs.GetLocalListVersionCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *centralSystem) GetLocalListVersionCtx(ctx context.Context, clientId string, callback func(*localauth.GetLocalListVersionConfirmation, error), props ...func(request *localauth.GetLocalListVersionRequest)) error {
 	request := localauth.NewGetLocalListVersionRequest()
 	for _, fn := range props {
 		fn(request)
@@ -208,10 +253,14 @@ func (cs *centralSystem) GetLocalListVersion(clientId string, callback func(*loc
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) SendLocalList(clientId string, callback func(*localauth.SendLocalListConfirmation, error), version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) error {
+	return cs.SendLocalListCtx(context.Background(), clientId, callback, version, updateType, props...)
+}
+
+func (cs *centralSystem) SendLocalListCtx(ctx context.Context, clientId string, callback func(*localauth.SendLocalListConfirmation, error), version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) error {
 	request := localauth.NewSendLocalListRequest(version, updateType)
 	for _, fn := range props {
 		fn(request)
@@ -223,10 +272,14 @@ func (cs *centralSystem) SendLocalList(clientId string, callback func(*localauth
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) GetDiagnostics(clientId string, callback func(*firmware.GetDiagnosticsConfirmation, error), location string, props ...func(request *firmware.GetDiagnosticsRequest)) error {
+	return cs.GetDiagnosticsCtx(context.Background(), clientId, callback, location, props...)
+}
+
+func (cs *centralSystem) GetDiagnosticsCtx(ctx context.Context, clientId string, callback func(*firmware.GetDiagnosticsConfirmation, error), location string, props ...func(request *firmware.GetDiagnosticsRequest)) error {
 	request := firmware.NewGetDiagnosticsRequest(location)
 	for _, fn := range props {
 		fn(request)
@@ -238,10 +291,14 @@ func (cs *centralSystem) GetDiagnostics(clientId string, callback func(*firmware
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) UpdateFirmware(clientId string, callback func(*firmware.UpdateFirmwareConfirmation, error), location string, retrieveDate *types.DateTime, props ...func(request *firmware.UpdateFirmwareRequest)) error {
+	return cs.UpdateFirmwareCtx(context.Background(), clientId, callback, location, retrieveDate, props...)
+}
+
+func (cs *centralSystem) UpdateFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.UpdateFirmwareConfirmation, error), location string, retrieveDate *types.DateTime, props ...func(request *firmware.UpdateFirmwareRequest)) error {
 	request := firmware.NewUpdateFirmwareRequest(location, retrieveDate)
 	for _, fn := range props {
 		fn(request)
@@ -253,10 +310,14 @@ func (cs *centralSystem) UpdateFirmware(clientId string, callback func(*firmware
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) ReserveNow(clientId string, callback func(*reservation.ReserveNowConfirmation, error), connectorId int, expiryDate *types.DateTime, idTag string, reservationId int, props ...func(request *reservation.ReserveNowRequest)) error {
+	return cs.ReserveNowCtx(context.Background(), clientId, callback, connectorId, expiryDate, idTag, reservationId, props...)
+}
+
+func (cs *centralSystem) ReserveNowCtx(ctx context.Context, clientId string, callback func(*reservation.ReserveNowConfirmation, error), connectorId int, expiryDate *types.DateTime, idTag string, reservationId int, props ...func(request *reservation.ReserveNowRequest)) error {
 	request := reservation.NewReserveNowRequest(connectorId, expiryDate, idTag, reservationId)
 	for _, fn := range props {
 		fn(request)
@@ -268,10 +329,14 @@ func (cs *centralSystem) ReserveNow(clientId string, callback func(*reservation.
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) CancelReservation(clientId string, callback func(*reservation.CancelReservationConfirmation, error), reservationId int, props ...func(request *reservation.CancelReservationRequest)) error {
+	return cs.CancelReservationCtx(context.Background(), clientId, callback, reservationId, props...)
+}
+
+func (cs *centralSystem) CancelReservationCtx(ctx context.Context, clientId string, callback func(*reservation.CancelReservationConfirmation, error), reservationId int, props ...func(request *reservation.CancelReservationRequest)) error {
 	request := reservation.NewCancelReservationRequest(reservationId)
 	for _, fn := range props {
 		fn(request)
@@ -283,10 +348,14 @@ func (cs *centralSystem) CancelReservation(clientId string, callback func(*reser
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) TriggerMessage(clientId string, callback func(*remotetrigger.TriggerMessageConfirmation, error), requestedMessage remotetrigger.MessageTrigger, props ...func(request *remotetrigger.TriggerMessageRequest)) error {
+	return cs.TriggerMessageCtx(context.Background(), clientId, callback, requestedMessage, props...)
+}
+
+func (cs *centralSystem) TriggerMessageCtx(ctx context.Context, clientId string, callback func(*remotetrigger.TriggerMessageConfirmation, error), requestedMessage remotetrigger.MessageTrigger, props ...func(request *remotetrigger.TriggerMessageRequest)) error {
 	request := remotetrigger.NewTriggerMessageRequest(requestedMessage)
 	for _, fn := range props {
 		fn(request)
@@ -298,10 +367,14 @@ func (cs *centralSystem) TriggerMessage(clientId string, callback func(*remotetr
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) SetChargingProfile(clientId string, callback func(*smartcharging.SetChargingProfileConfirmation, error), connectorId int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) error {
+	return cs.SetChargingProfileCtx(context.Background(), clientId, callback, connectorId, chargingProfile, props...)
+}
+
+func (cs *centralSystem) SetChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.SetChargingProfileConfirmation, error), connectorId int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) error {
 	request := smartcharging.NewSetChargingProfileRequest(connectorId, chargingProfile)
 	for _, fn := range props {
 		fn(request)
@@ -313,10 +386,14 @@ func (cs *centralSystem) SetChargingProfile(clientId string, callback func(*smar
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) ClearChargingProfile(clientId string, callback func(*smartcharging.ClearChargingProfileConfirmation, error), props ...func(request *smartcharging.ClearChargingProfileRequest)) error {
+	return cs.ClearChargingProfileCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *centralSystem) ClearChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.ClearChargingProfileConfirmation, error), props ...func(request *smartcharging.ClearChargingProfileRequest)) error {
 	request := smartcharging.NewClearChargingProfileRequest()
 	for _, fn := range props {
 		fn(request)
@@ -328,10 +405,14 @@ func (cs *centralSystem) ClearChargingProfile(clientId string, callback func(*sm
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) GetCompositeSchedule(clientId string, callback func(*smartcharging.GetCompositeScheduleConfirmation, error), connectorId int, duration int, props ...func(request *smartcharging.GetCompositeScheduleRequest)) error {
+	return cs.GetCompositeScheduleCtx(context.Background(), clientId, callback, connectorId, duration, props...)
+}
+
+func (cs *centralSystem) GetCompositeScheduleCtx(ctx context.Context, clientId string, callback func(*smartcharging.GetCompositeScheduleConfirmation, error), connectorId int, duration int, props ...func(request *smartcharging.GetCompositeScheduleRequest)) error {
 	request := smartcharging.NewGetCompositeScheduleRequest(connectorId, duration)
 	for _, fn := range props {
 		fn(request)
@@ -343,10 +424,14 @@ func (cs *centralSystem) GetCompositeSchedule(clientId string, callback func(*sm
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) TriggerMessageExtended(clientId string, callback func(*extendedtriggermessage.ExtendedTriggerMessageResponse, error), requestedMessage extendedtriggermessage.ExtendedTriggerMessageType, props ...func(request *extendedtriggermessage.ExtendedTriggerMessageRequest)) error {
+	return cs.TriggerMessageExtendedCtx(context.Background(), clientId, callback, requestedMessage, props...)
+}
+
+func (cs *centralSystem) TriggerMessageExtendedCtx(ctx context.Context, clientId string, callback func(*extendedtriggermessage.ExtendedTriggerMessageResponse, error), requestedMessage extendedtriggermessage.ExtendedTriggerMessageType, props ...func(request *extendedtriggermessage.ExtendedTriggerMessageRequest)) error {
 	request := extendedtriggermessage.NewExtendedTriggerMessageRequest(requestedMessage)
 	for _, fn := range props {
 		fn(request)
@@ -358,11 +443,15 @@ func (cs *centralSystem) TriggerMessageExtended(clientId string, callback func(*
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 
 }
 
 func (cs *centralSystem) CertificateSigned(clientId string, callback func(*security.CertificateSignedResponse, error), csr string, props ...func(request *security.CertificateSignedRequest)) error {
+	return cs.CertificateSignedCtx(context.Background(), clientId, callback, csr, props...)
+}
+
+func (cs *centralSystem) CertificateSignedCtx(ctx context.Context, clientId string, callback func(*security.CertificateSignedResponse, error), csr string, props ...func(request *security.CertificateSignedRequest)) error {
 	request := security.NewCertificateSignedRequest(csr)
 	for _, fn := range props {
 		fn(request)
@@ -374,10 +463,14 @@ func (cs *centralSystem) CertificateSigned(clientId string, callback func(*secur
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) SignedUpdateFirmware(clientId string, callback func(*securefirmware.SignedUpdateFirmwareResponse, error), requestId int, firmware securefirmware.Firmware, props ...func(request *securefirmware.SignedUpdateFirmwareRequest)) error {
+	return cs.SignedUpdateFirmwareCtx(context.Background(), clientId, callback, requestId, firmware, props...)
+}
+
+func (cs *centralSystem) SignedUpdateFirmwareCtx(ctx context.Context, clientId string, callback func(*securefirmware.SignedUpdateFirmwareResponse, error), requestId int, firmware securefirmware.Firmware, props ...func(request *securefirmware.SignedUpdateFirmwareRequest)) error {
 	request := securefirmware.NewSignedUpdateFirmwareRequest(requestId, firmware)
 	for _, fn := range props {
 		fn(request)
@@ -389,10 +482,14 @@ func (cs *centralSystem) SignedUpdateFirmware(clientId string, callback func(*se
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) GetInstalledCertificateIds(clientId string, callback func(*certificates.GetInstalledCertificateIdsResponse, error), certificateType types.CertificateUse, props ...func(request *certificates.GetInstalledCertificateIdsRequest)) error {
+	return cs.GetInstalledCertificateIdsCtx(context.Background(), clientId, callback, certificateType, props...)
+}
+
+func (cs *centralSystem) GetInstalledCertificateIdsCtx(ctx context.Context, clientId string, callback func(*certificates.GetInstalledCertificateIdsResponse, error), certificateType types.CertificateUse, props ...func(request *certificates.GetInstalledCertificateIdsRequest)) error {
 	request := certificates.NewGetInstalledCertificateIdsRequest(certificateType)
 	for _, fn := range props {
 		fn(request)
@@ -404,10 +501,14 @@ func (cs *centralSystem) GetInstalledCertificateIds(clientId string, callback fu
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) InstallCertificate(clientId string, callback func(*certificates.InstallCertificateResponse, error), certificateType types.CertificateUse, certificate string, props ...func(request *certificates.InstallCertificateRequest)) error {
+	return cs.InstallCertificateCtx(context.Background(), clientId, callback, certificateType, certificate, props...)
+}
+
+func (cs *centralSystem) InstallCertificateCtx(ctx context.Context, clientId string, callback func(*certificates.InstallCertificateResponse, error), certificateType types.CertificateUse, certificate string, props ...func(request *certificates.InstallCertificateRequest)) error {
 	request := certificates.NewInstallCertificateRequest(certificateType, certificate)
 	for _, fn := range props {
 		fn(request)
@@ -419,10 +520,14 @@ func (cs *centralSystem) InstallCertificate(clientId string, callback func(*cert
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) DeleteCertificate(clientId string, callback func(*certificates.DeleteCertificateResponse, error), certificateHashData types.CertificateHashData, props ...func(request *certificates.DeleteCertificateRequest)) error {
+	return cs.DeleteCertificateCtx(context.Background(), clientId, callback, certificateHashData, props...)
+}
+
+func (cs *centralSystem) DeleteCertificateCtx(ctx context.Context, clientId string, callback func(*certificates.DeleteCertificateResponse, error), certificateHashData types.CertificateHashData, props ...func(request *certificates.DeleteCertificateRequest)) error {
 	request := certificates.NewDeleteCertificateRequest(certificateHashData)
 	for _, fn := range props {
 		fn(request)
@@ -434,10 +539,14 @@ func (cs *centralSystem) DeleteCertificate(clientId string, callback func(*certi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) GetLog(clientId string, callback func(*logging.GetLogResponse, error), logType logging.LogType, requestID int, logParameters logging.LogParameters, props ...func(request *logging.GetLogRequest)) error {
+	return cs.GetLogCtx(context.Background(), clientId, callback, logType, requestID, logParameters, props...)
+}
+
+func (cs *centralSystem) GetLogCtx(ctx context.Context, clientId string, callback func(*logging.GetLogResponse, error), logType logging.LogType, requestID int, logParameters logging.LogParameters, props ...func(request *logging.GetLogRequest)) error {
 	request := logging.NewGetLogRequest(logType, requestID, logParameters)
 	for _, fn := range props {
 		fn(request)
@@ -449,7 +558,7 @@ func (cs *centralSystem) GetLog(clientId string, callback func(*logging.GetLogRe
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *centralSystem) SetSecurityHandler(handler security.CentralSystemHandler) {
@@ -509,6 +618,10 @@ func (cs *centralSystem) SetChargePointDisconnectedHandler(handler ChargePointCo
 }
 
 func (cs *centralSystem) SendRequestAsync(clientId string, request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
+	return cs.SendRequestAsyncCtx(context.Background(), clientId, request, callback)
+}
+
+func (cs *centralSystem) SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cs.server.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on central system (missing profile), cannot send request", featureName)
@@ -530,8 +643,8 @@ func (cs *centralSystem) SendRequestAsync(clientId string, request ocpp.Request,
 		return fmt.Errorf("unsupported action %v on central system, cannot send request", featureName)
 	}
 
-	send := func() error {
-		return cs.server.SendRequest(clientId, request)
+	send := func() (string, error) {
+		return cs.server.SendRequestCtx(ctx, clientId, request)
 	}
 	return cs.callbackQueue.TryQueue(clientId, send, callback)
 }
@@ -541,10 +654,26 @@ func (cs *centralSystem) Start(listenPort int, listenPath string) {
 	cs.server.Start(listenPort, listenPath)
 }
 
+func (cs *centralSystem) Serve(listener net.Listener) {
+	cs.server.Serve(listener)
+}
+
+func (cs *centralSystem) Handler() http.Handler {
+	return cs.server.Handler()
+}
+
 func (cs *centralSystem) Stop() {
 	cs.server.Stop()
 }
 
+func (cs *centralSystem) Shutdown(ctx context.Context) error {
+	return cs.server.Shutdown(ctx)
+}
+
+func (cs *centralSystem) ConnectionInfo() map[string]ocppj.ConnectionInfo {
+	return cs.server.ConnectionInfo()
+}
+
 func (cs *centralSystem) sendResponse(chargePointId string, confirmation ocpp.Response, err error, requestId string) {
 	if err != nil {
 		// Send error response
@@ -714,8 +843,9 @@ func (cs *centralSystem) handleIncomingError(chargePoint ChargePointConnection,
 	}
 }
 
-func (cs *centralSystem) handleCanceledRequest(chargePointID string, request ocpp.Request, err *ocpp.Error) {
-	if callback, ok := cs.callbackQueue.Dequeue(chargePointID); ok {
+func (cs *centralSystem) handleCanceledRequest(chargePointID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+	// The canceled request may not be at the front of the queue (e.g. if its context was canceled)
+	if callback, ok := cs.callbackQueue.DequeueRequest(chargePointID, requestID); ok {
 		// Execute in separate goroutine, so the caller goroutine is available
 		go callback(nil, err)
 	} else {
@@ -1,6 +1,7 @@
 package ocpp16
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -41,16 +42,30 @@ type chargePoint struct {
 	errC                          chan error // external error channel
 }
 
+var _ ChargePointCtx = (*chargePoint)(nil)
+
 func (cp *chargePoint) error(err error) {
 	if cp.errC != nil {
 		cp.errC <- err
 	}
 }
 
-// Callback invoked whenever a queued request is canceled, due to timeout.
+// Callback invoked whenever a queued request is canceled, due to timeout or because its context is done.
 // By default, the callback returns a GenericError to the caller, who sent the original request.
-func (cp *chargePoint) onRequestTimeout(_ string, _ ocpp.Request, err *ocpp.Error) {
-	cp.errorHandler <- err
+func (cp *chargePoint) onRequestTimeout(requestID string, request ocpp.Request, err *ocpp.Error) {
+	// The canceled request may not be at the front of the queue (e.g. if its context was canceled)
+	if callback, ok := cp.callbacks.DequeueRequest("main", requestID); ok {
+		// Execute in separate goroutine, so the caller goroutine is available
+		go callback(nil, err)
+	} else {
+		cp.error(fmt.Errorf("no handler available for canceled request %s: %w", request.GetFeatureName(), err))
+	}
+}
+
+// Callback invoked for every request restored from a persistent queue, when starting the client.
+// The original caller isn't available anymore, so the response to the request is discarded.
+func (cp *chargePoint) onRequestRestored(requestID string, request ocpp.Request) {
+	_ = cp.callbacks.TryQueue("main", func() (string, error) { return requestID, nil }, func(response ocpp.Response, err error) {})
 }
 
 // Errors returns a channel for error messages. If it doesn't exist it es created.
@@ -62,11 +77,15 @@ func (cp *chargePoint) Errors() <-chan error {
 }
 
 func (cp *chargePoint) BootNotification(chargePointModel string, chargePointVendor string, props ...func(request *core.BootNotificationRequest)) (*core.BootNotificationConfirmation, error) {
+	return cp.BootNotificationCtx(context.Background(), chargePointModel, chargePointVendor, props...)
+}
+
+func (cp *chargePoint) BootNotificationCtx(ctx context.Context, chargePointModel string, chargePointVendor string, props ...func(request *core.BootNotificationRequest)) (*core.BootNotificationConfirmation, error) {
 	request := core.NewBootNotificationRequest(chargePointModel, chargePointVendor)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -75,11 +94,15 @@ func (cp *chargePoint) BootNotification(chargePointModel string, chargePointVend
 }
 
 func (cp *chargePoint) Authorize(idTag string, props ...func(request *core.AuthorizeRequest)) (*core.AuthorizeConfirmation, error) {
+	return cp.AuthorizeCtx(context.Background(), idTag, props...)
+}
+
+func (cp *chargePoint) AuthorizeCtx(ctx context.Context, idTag string, props ...func(request *core.AuthorizeRequest)) (*core.AuthorizeConfirmation, error) {
 	request := core.NewAuthorizationRequest(idTag)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -88,11 +111,15 @@ func (cp *chargePoint) Authorize(idTag string, props ...func(request *core.Autho
 }
 
 func (cp *chargePoint) DataTransfer(vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error) {
+	return cp.DataTransferCtx(context.Background(), vendorId, props...)
+}
+
+func (cp *chargePoint) DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error) {
 	request := core.NewDataTransferRequest(vendorId)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -101,11 +128,15 @@ func (cp *chargePoint) DataTransfer(vendorId string, props ...func(request *core
 }
 
 func (cp *chargePoint) Heartbeat(props ...func(request *core.HeartbeatRequest)) (*core.HeartbeatConfirmation, error) {
+	return cp.HeartbeatCtx(context.Background(), props...)
+}
+
+func (cp *chargePoint) HeartbeatCtx(ctx context.Context, props ...func(request *core.HeartbeatRequest)) (*core.HeartbeatConfirmation, error) {
 	request := core.NewHeartbeatRequest()
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -114,11 +145,15 @@ func (cp *chargePoint) Heartbeat(props ...func(request *core.HeartbeatRequest))
 }
 
 func (cp *chargePoint) MeterValues(connectorId int, meterValues []types.MeterValue, props ...func(request *core.MeterValuesRequest)) (*core.MeterValuesConfirmation, error) {
+	return cp.MeterValuesCtx(context.Background(), connectorId, meterValues, props...)
+}
+
+func (cp *chargePoint) MeterValuesCtx(ctx context.Context, connectorId int, meterValues []types.MeterValue, props ...func(request *core.MeterValuesRequest)) (*core.MeterValuesConfirmation, error) {
 	request := core.NewMeterValuesRequest(connectorId, meterValues)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -127,11 +162,15 @@ func (cp *chargePoint) MeterValues(connectorId int, meterValues []types.MeterVal
 }
 
 func (cp *chargePoint) StartTransaction(connectorId int, idTag string, meterStart int, timestamp *types.DateTime, props ...func(request *core.StartTransactionRequest)) (*core.StartTransactionConfirmation, error) {
+	return cp.StartTransactionCtx(context.Background(), connectorId, idTag, meterStart, timestamp, props...)
+}
+
+func (cp *chargePoint) StartTransactionCtx(ctx context.Context, connectorId int, idTag string, meterStart int, timestamp *types.DateTime, props ...func(request *core.StartTransactionRequest)) (*core.StartTransactionConfirmation, error) {
 	request := core.NewStartTransactionRequest(connectorId, idTag, meterStart, timestamp)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -140,11 +179,15 @@ func (cp *chargePoint) StartTransaction(connectorId int, idTag string, meterStar
 }
 
 func (cp *chargePoint) StopTransaction(meterStop int, timestamp *types.DateTime, transactionId int, props ...func(request *core.StopTransactionRequest)) (*core.StopTransactionConfirmation, error) {
+	return cp.StopTransactionCtx(context.Background(), meterStop, timestamp, transactionId, props...)
+}
+
+func (cp *chargePoint) StopTransactionCtx(ctx context.Context, meterStop int, timestamp *types.DateTime, transactionId int, props ...func(request *core.StopTransactionRequest)) (*core.StopTransactionConfirmation, error) {
 	request := core.NewStopTransactionRequest(meterStop, timestamp, transactionId)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -153,11 +196,15 @@ func (cp *chargePoint) StopTransaction(meterStop int, timestamp *types.DateTime,
 }
 
 func (cp *chargePoint) StatusNotification(connectorId int, errorCode core.ChargePointErrorCode, status core.ChargePointStatus, props ...func(request *core.StatusNotificationRequest)) (*core.StatusNotificationConfirmation, error) {
+	return cp.StatusNotificationCtx(context.Background(), connectorId, errorCode, status, props...)
+}
+
+func (cp *chargePoint) StatusNotificationCtx(ctx context.Context, connectorId int, errorCode core.ChargePointErrorCode, status core.ChargePointStatus, props ...func(request *core.StatusNotificationRequest)) (*core.StatusNotificationConfirmation, error) {
 	request := core.NewStatusNotificationRequest(connectorId, errorCode, status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -166,11 +213,15 @@ func (cp *chargePoint) StatusNotification(connectorId int, errorCode core.Charge
 }
 
 func (cp *chargePoint) DiagnosticsStatusNotification(status firmware.DiagnosticsStatus, props ...func(request *firmware.DiagnosticsStatusNotificationRequest)) (*firmware.DiagnosticsStatusNotificationConfirmation, error) {
+	return cp.DiagnosticsStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cp *chargePoint) DiagnosticsStatusNotificationCtx(ctx context.Context, status firmware.DiagnosticsStatus, props ...func(request *firmware.DiagnosticsStatusNotificationRequest)) (*firmware.DiagnosticsStatusNotificationConfirmation, error) {
 	request := firmware.NewDiagnosticsStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -179,11 +230,15 @@ func (cp *chargePoint) DiagnosticsStatusNotification(status firmware.Diagnostics
 }
 
 func (cp *chargePoint) FirmwareStatusNotification(status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationConfirmation, error) {
+	return cp.FirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cp *chargePoint) FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationConfirmation, error) {
 	request := firmware.NewFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -192,11 +247,15 @@ func (cp *chargePoint) FirmwareStatusNotification(status firmware.FirmwareStatus
 }
 
 func (cp *chargePoint) SecurityEventNotification(typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
+	return cp.SecurityEventNotificationCtx(context.Background(), typ, timestamp, props...)
+}
+
+func (cp *chargePoint) SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
 	request := security.NewSecurityEventNotificationRequest(typ, timestamp)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -204,11 +263,15 @@ func (cp *chargePoint) SecurityEventNotification(typ string, timestamp *types.Da
 }
 
 func (cp *chargePoint) SignCertificate(CSR string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
+	return cp.SignCertificateCtx(context.Background(), CSR, props...)
+}
+
+func (cp *chargePoint) SignCertificateCtx(ctx context.Context, CSR string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
 	request := security.NewSignCertificateRequest(CSR)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -216,11 +279,15 @@ func (cp *chargePoint) SignCertificate(CSR string, props ...func(request *securi
 }
 
 func (cp *chargePoint) SignedUpdateFirmwareStatusNotification(status securefirmware.FirmwareStatus, props ...func(request *securefirmware.SignedFirmwareStatusNotificationRequest)) (*securefirmware.SignedFirmwareStatusNotificationResponse, error) {
+	return cp.SignedUpdateFirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cp *chargePoint) SignedUpdateFirmwareStatusNotificationCtx(ctx context.Context, status securefirmware.FirmwareStatus, props ...func(request *securefirmware.SignedFirmwareStatusNotificationRequest)) (*securefirmware.SignedFirmwareStatusNotificationResponse, error) {
 	request := securefirmware.NewFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -228,11 +295,15 @@ func (cp *chargePoint) SignedUpdateFirmwareStatusNotification(status securefirmw
 }
 
 func (cp *chargePoint) LogStatusNotification(status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error) {
+	return cp.LogStatusNotificationCtx(context.Background(), status, requestId, props...)
+}
+
+func (cp *chargePoint) LogStatusNotificationCtx(ctx context.Context, status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error) {
 	request := logging.NewLogStatusNotificationRequest(status, requestId)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -284,6 +355,10 @@ func (cp *chargePoint) SetCertificateHandler(handler certificates.ChargePointHan
 }
 
 func (cp *chargePoint) SendRequest(request ocpp.Request) (ocpp.Response, error) {
+	return cp.SendRequestCtx(context.Background(), request)
+}
+
+func (cp *chargePoint) SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error) {
 	featureName := request.GetFeatureName()
 	if _, found := cp.client.GetProfileForFeature(featureName); !found {
 		return nil, fmt.Errorf("feature %v is unsupported on charge point (missing profile), cannot send request", featureName)
@@ -296,8 +371,8 @@ func (cp *chargePoint) SendRequest(request ocpp.Request) (ocpp.Response, error)
 	}
 	// Create channel and pass it to a callback function, for retrieving asynchronous response
 	asyncResponseC := make(chan asyncResponse, 1)
-	send := func() error {
-		return cp.client.SendRequest(request)
+	send := func() (string, error) {
+		return cp.client.SendRequestCtx(ctx, request)
 	}
 	err := cp.callbacks.TryQueue("main", send, func(confirmation ocpp.Response, err error) {
 		asyncResponseC <- asyncResponse{r: confirmation, e: err}
@@ -313,10 +388,16 @@ func (cp *chargePoint) SendRequest(request ocpp.Request) (ocpp.Response, error)
 		return asyncResult.r, asyncResult.e
 	case <-cp.stopC:
 		return nil, fmt.Errorf("client stopped while waiting for response to %v", request.GetFeatureName())
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
 func (cp *chargePoint) SendRequestAsync(request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
+	return cp.SendRequestAsyncCtx(context.Background(), request, callback)
+}
+
+func (cp *chargePoint) SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cp.client.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on charge point (missing profile), cannot send request", featureName)
@@ -332,8 +413,8 @@ func (cp *chargePoint) SendRequestAsync(request ocpp.Request, callback func(conf
 		return fmt.Errorf("unsupported action %v on charge point, cannot send request", featureName)
 	}
 	// Response will be retrieved asynchronously via asyncHandler
-	send := func() error {
-		return cp.client.SendRequest(request)
+	send := func() (string, error) {
+		return cp.client.SendRequestCtx(ctx, request)
 	}
 	err := cp.callbacks.TryQueue("main", send, callback)
 	return err
@@ -0,0 +1,28 @@
+package ocpp16
+
+import (
+	"fmt"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// NewOfflinePolicy creates an offline policy for OCPP 1.6 charge points, which may be passed to
+// ocppj.DefaultClientDispatcher.SetOfflinePolicy.
+//
+// While the charge point is offline:
+//   - transaction-related messages (StartTransaction, StopTransaction and MeterValues) are kept
+//   - StatusNotification requests are coalesced per connector, so only the latest status is sent
+//   - Heartbeat requests are dropped, since they are stale by the time the charge point reconnects
+//
+// All other requests are kept. The returned policy may be customized further.
+func NewOfflinePolicy() *ocppj.OfflinePolicy {
+	policy := ocppj.NewOfflinePolicy(ocppj.OfflineKeep)
+	policy.Keep(core.StartTransactionFeatureName, core.StopTransactionFeatureName, core.MeterValuesFeatureName)
+	policy.Drop(core.HeartbeatFeatureName)
+	policy.Coalesce(core.StatusNotificationFeatureName, func(request ocpp.Request) string {
+		return fmt.Sprintf("%v", request.(*core.StatusNotificationRequest).ConnectorId)
+	})
+	return policy
+}
@@ -0,0 +1,21 @@
+package ocpp16
+
+import (
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// TransactionMessageFeatures contains the transaction-related messages, to which the TransactionMessageAttempts
+// and TransactionMessageRetryInterval configuration keys apply.
+var TransactionMessageFeatures = []string{core.StartTransactionFeatureName, core.StopTransactionFeatureName, core.MeterValuesFeatureName}
+
+// SetTransactionRetryPolicy configures the dispatcher of a charge point to retransmit transaction-related messages
+// (StartTransaction, StopTransaction and MeterValues), if they couldn't be delivered or the central system failed to process them.
+//
+// The attempts and retryInterval parameters correspond to the TransactionMessageAttempts and
+// TransactionMessageRetryInterval configuration keys.
+func SetTransactionRetryPolicy(dispatcher *ocppj.DefaultClientDispatcher, attempts int, retryInterval time.Duration) {
+	dispatcher.SetRetryPolicy(ocppj.NewRetryPolicy(attempts, retryInterval), TransactionMessageFeatures...)
+}
@@ -2,8 +2,10 @@
 package ocpp16
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
+	"net/http"
 
 	"github.com/lorenzodonini/ocpp-go/internal/callbackqueue"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
@@ -23,6 +25,8 @@ import (
 	"github.com/lorenzodonini/ocpp-go/ws"
 )
 
+// Further details of a connection, e.g. the verified client identity or the tenant,
+// are available via the optional interfaces of the ws package (see ws.IdentityChannel and ws.TenantChannel).
 type ChargePointConnection interface {
 	ID() string
 	RemoteAddr() net.Addr
@@ -134,6 +138,38 @@ type ChargePoint interface {
 	Errors() <-chan error
 }
 
+// ChargePointCtx extends a ChargePoint with context-aware variants of its methods.
+// Once ctx is done, a request that is still queued is removed from the outgoing queue,
+// while a request that was already sent is treated as timed out.
+// In both cases, an error is returned to the caller.
+//
+// The charge point returned by NewChargePoint implements this interface:
+//
+//	chargePoint := ocpp16.NewChargePoint("cp1", nil, nil).(ocpp16.ChargePointCtx)
+type ChargePointCtx interface {
+	ChargePoint
+	BootNotificationCtx(ctx context.Context, chargePointModel string, chargePointVendor string, props ...func(request *core.BootNotificationRequest)) (*core.BootNotificationConfirmation, error)
+	AuthorizeCtx(ctx context.Context, idTag string, props ...func(request *core.AuthorizeRequest)) (*core.AuthorizeConfirmation, error)
+	DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error)
+	HeartbeatCtx(ctx context.Context, props ...func(request *core.HeartbeatRequest)) (*core.HeartbeatConfirmation, error)
+	MeterValuesCtx(ctx context.Context, connectorId int, meterValues []types.MeterValue, props ...func(request *core.MeterValuesRequest)) (*core.MeterValuesConfirmation, error)
+	StartTransactionCtx(ctx context.Context, connectorId int, idTag string, meterStart int, timestamp *types.DateTime, props ...func(request *core.StartTransactionRequest)) (*core.StartTransactionConfirmation, error)
+	StopTransactionCtx(ctx context.Context, meterStop int, timestamp *types.DateTime, transactionId int, props ...func(request *core.StopTransactionRequest)) (*core.StopTransactionConfirmation, error)
+	StatusNotificationCtx(ctx context.Context, connectorId int, errorCode core.ChargePointErrorCode, status core.ChargePointStatus, props ...func(request *core.StatusNotificationRequest)) (*core.StatusNotificationConfirmation, error)
+	DiagnosticsStatusNotificationCtx(ctx context.Context, status firmware.DiagnosticsStatus, props ...func(request *firmware.DiagnosticsStatusNotificationRequest)) (*firmware.DiagnosticsStatusNotificationConfirmation, error)
+	FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationConfirmation, error)
+	SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error)
+	SignCertificateCtx(ctx context.Context, CSR string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error)
+	SignedUpdateFirmwareStatusNotificationCtx(ctx context.Context, status securefirmware.FirmwareStatus, props ...func(request *securefirmware.SignedFirmwareStatusNotificationRequest)) (*securefirmware.SignedFirmwareStatusNotificationResponse, error)
+	LogStatusNotificationCtx(ctx context.Context, status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error)
+	// Same as SendRequest, but returns as soon as the passed context is done.
+	// If the request wasn't sent yet, it is removed from the outgoing queue.
+	SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error)
+	// Same as SendRequestAsync, but the request is canceled once the passed context is done.
+	// The callback is then invoked with an error.
+	SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(confirmation ocpp.Response, protoError error)) error
+}
+
 // Creates a new OCPP 1.6 charge point client.
 // The id parameter is required to uniquely identify the charge point.
 //
@@ -196,6 +232,7 @@ func NewChargePoint(id string, endpoint *ocppj.Client, client ws.WsClient) Charg
 
 	// Callback invoked by dispatcher, whenever a queued request is canceled, due to timeout.
 	endpoint.SetOnRequestCanceled(cp.onRequestTimeout)
+	endpoint.SetOnRequestRestored(cp.onRequestRestored)
 
 	cp.client.SetResponseHandler(func(confirmation ocpp.Response, requestId string) {
 		cp.confirmationHandler <- confirmation
@@ -321,12 +358,74 @@ type CentralSystem interface {
 
 	// The function blocks forever, so it is suggested to wrap it in a goroutine, in case other functionality needs to be executed on the main program thread.
 	Start(listenPort int, listenPath string)
+	// Starts running the central system on a caller-provided listener, e.g. a unix socket.
+	// All incoming requests are treated as charge point connections, the charge point ID being the final element of the URL path.
+	//
+	// The function blocks forever, so it is suggested to wrap it in a goroutine.
+	Serve(listener net.Listener)
+	// Starts the central system without listening for incoming connections, and returns an http.Handler instead.
+	// The handler may be mounted on an existing router, e.g. to share a port with other HTTP APIs:
+	//
+	//	router.Handle("/ocpp/{id}", server.Handler())
+	//
+	// The final element of the URL path is used as charge point ID.
+	Handler() http.Handler
 	// Stops the central system, clearing all pending requests.
 	Stop()
+	// Gracefully shuts down the central system: new connections and outgoing requests are refused,
+	// while pending requests are completed. Connections are then closed with a CloseGoingAway code,
+	// so charge points may reconnect to another central system instance.
+	//
+	// If the context is done before, remaining connections are forcefully closed and the context error is returned.
+	Shutdown(ctx context.Context) error
+	// ConnectionInfo returns health information about all currently connected charge points, mapped by charge point ID.
+	// This includes connection statistics (see ws.ConnectionStats) and the amount of pending requests.
+	ConnectionInfo() map[string]ocppj.ConnectionInfo
 	// Errors returns a channel for error messages. If it doesn't exist it es created.
 	Errors() <-chan error
 }
 
+// CentralSystemCtx extends a CentralSystem with context-aware variants of its methods.
+// Once ctx is done, a request that is still queued is removed from the outgoing queue,
+// while a request that was already sent is treated as timed out.
+// In both cases, an error is returned to the caller.
+//
+// The central system returned by NewCentralSystem implements this interface:
+//
+//	centralSystem := ocpp16.NewCentralSystem(nil, nil).(ocpp16.CentralSystemCtx)
+type CentralSystemCtx interface {
+	CentralSystem
+	ChangeAvailabilityCtx(ctx context.Context, clientId string, callback func(*core.ChangeAvailabilityConfirmation, error), connectorId int, availabilityType core.AvailabilityType, props ...func(*core.ChangeAvailabilityRequest)) error
+	ChangeConfigurationCtx(ctx context.Context, clientId string, callback func(*core.ChangeConfigurationConfirmation, error), key string, value string, props ...func(*core.ChangeConfigurationRequest)) error
+	ClearCacheCtx(ctx context.Context, clientId string, callback func(*core.ClearCacheConfirmation, error), props ...func(*core.ClearCacheRequest)) error
+	DataTransferCtx(ctx context.Context, clientId string, callback func(*core.DataTransferConfirmation, error), vendorId string, props ...func(*core.DataTransferRequest)) error
+	GetConfigurationCtx(ctx context.Context, clientId string, callback func(*core.GetConfigurationConfirmation, error), keys []string, props ...func(*core.GetConfigurationRequest)) error
+	RemoteStartTransactionCtx(ctx context.Context, clientId string, callback func(*core.RemoteStartTransactionConfirmation, error), idTag string, props ...func(*core.RemoteStartTransactionRequest)) error
+	RemoteStopTransactionCtx(ctx context.Context, clientId string, callback func(*core.RemoteStopTransactionConfirmation, error), transactionId int, props ...func(request *core.RemoteStopTransactionRequest)) error
+	ResetCtx(ctx context.Context, clientId string, callback func(*core.ResetConfirmation, error), resetType core.ResetType, props ...func(*core.ResetRequest)) error
+	UnlockConnectorCtx(ctx context.Context, clientId string, callback func(*core.UnlockConnectorConfirmation, error), connectorId int, props ...func(*core.UnlockConnectorRequest)) error
+	GetLocalListVersionCtx(ctx context.Context, clientId string, callback func(*localauth.GetLocalListVersionConfirmation, error), props ...func(request *localauth.GetLocalListVersionRequest)) error
+	SendLocalListCtx(ctx context.Context, clientId string, callback func(*localauth.SendLocalListConfirmation, error), version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) error
+	GetDiagnosticsCtx(ctx context.Context, clientId string, callback func(*firmware.GetDiagnosticsConfirmation, error), location string, props ...func(request *firmware.GetDiagnosticsRequest)) error
+	UpdateFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.UpdateFirmwareConfirmation, error), location string, retrieveDate *types.DateTime, props ...func(request *firmware.UpdateFirmwareRequest)) error
+	ReserveNowCtx(ctx context.Context, clientId string, callback func(*reservation.ReserveNowConfirmation, error), connectorId int, expiryDate *types.DateTime, idTag string, reservationId int, props ...func(request *reservation.ReserveNowRequest)) error
+	CancelReservationCtx(ctx context.Context, clientId string, callback func(*reservation.CancelReservationConfirmation, error), reservationId int, props ...func(request *reservation.CancelReservationRequest)) error
+	TriggerMessageCtx(ctx context.Context, clientId string, callback func(*remotetrigger.TriggerMessageConfirmation, error), requestedMessage remotetrigger.MessageTrigger, props ...func(request *remotetrigger.TriggerMessageRequest)) error
+	SetChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.SetChargingProfileConfirmation, error), connectorId int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) error
+	ClearChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.ClearChargingProfileConfirmation, error), props ...func(request *smartcharging.ClearChargingProfileRequest)) error
+	GetCompositeScheduleCtx(ctx context.Context, clientId string, callback func(*smartcharging.GetCompositeScheduleConfirmation, error), connectorId int, duration int, props ...func(request *smartcharging.GetCompositeScheduleRequest)) error
+	TriggerMessageExtendedCtx(ctx context.Context, clientId string, callback func(*extendedtriggermessage.ExtendedTriggerMessageResponse, error), requestedMessage extendedtriggermessage.ExtendedTriggerMessageType, props ...func(request *extendedtriggermessage.ExtendedTriggerMessageRequest)) error
+	CertificateSignedCtx(ctx context.Context, clientId string, callback func(*security.CertificateSignedResponse, error), csr string, props ...func(request *security.CertificateSignedRequest)) error
+	SignedUpdateFirmwareCtx(ctx context.Context, clientId string, callback func(*securefirmware.SignedUpdateFirmwareResponse, error), requestId int, firmware securefirmware.Firmware, props ...func(request *securefirmware.SignedUpdateFirmwareRequest)) error
+	GetInstalledCertificateIdsCtx(ctx context.Context, clientId string, callback func(*certificates.GetInstalledCertificateIdsResponse, error), certificateType types.CertificateUse, props ...func(request *certificates.GetInstalledCertificateIdsRequest)) error
+	InstallCertificateCtx(ctx context.Context, clientId string, callback func(*certificates.InstallCertificateResponse, error), certificateType types.CertificateUse, certificate string, props ...func(request *certificates.InstallCertificateRequest)) error
+	DeleteCertificateCtx(ctx context.Context, clientId string, callback func(*certificates.DeleteCertificateResponse, error), certificateHashData types.CertificateHashData, props ...func(request *certificates.DeleteCertificateRequest)) error
+	GetLogCtx(ctx context.Context, clientId string, callback func(*logging.GetLogResponse, error), logType logging.LogType, requestID int, logParameters logging.LogParameters, props ...func(request *logging.GetLogRequest)) error
+	// Same as SendRequestAsync, but the request is canceled once the passed context is done.
+	// The callback is then invoked with an error.
+	SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(ocpp.Response, error)) error
+}
+
 // Creates a new OCPP 1.6 central system.
 //
 // The endpoint and server parameters may be omitted, in order to use a default configuration:
@@ -370,7 +469,7 @@ func NewCentralSystem(endpoint *ocppj.Server, server ws.WsServer) CentralSystem
 		cs.handleIncomingError(client, err, details)
 	})
 	cs.server.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
-		cs.handleCanceledRequest(clientID, request, err)
+		cs.handleCanceledRequest(clientID, requestID, request, err)
 	})
 	return &cs
 }
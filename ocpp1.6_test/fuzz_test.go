@@ -0,0 +1,106 @@
+//go:build go1.18
+// +build go1.18
+
+package ocpp16_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/certificates"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/extendedtriggermessage"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/logging"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/reservation"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/securefirmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/security"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/smartcharging"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+var fuzzProfiles = []*ocpp.Profile{
+	core.Profile,
+	localauth.Profile,
+	firmware.Profile,
+	reservation.Profile,
+	remotetrigger.Profile,
+	smartcharging.Profile,
+	logging.Profile,
+	security.Profile,
+	extendedtriggermessage.Profile,
+	certificates.Profile,
+	securefirmware.Profile,
+}
+
+// Returns the features of all profiles, sorted by name, so that fuzz inputs always refer to the same feature.
+func fuzzFeatures() []ocpp.Feature {
+	var features []ocpp.Feature
+	for _, profile := range fuzzProfiles {
+		for _, feature := range profile.Features {
+			features = append(features, feature)
+		}
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].GetFeatureName() < features[j].GetFeatureName()
+	})
+	return features
+}
+
+// Fuzzes the JSON decoding and validation of every request and response type.
+// The payload is wrapped in a Call or CallResult message, for the feature at index, and parsed like an incoming message.
+func FuzzFeatures(f *testing.F) {
+	features := fuzzFeatures()
+	for i, feature := range features {
+		request, _ := json.Marshal(reflect.New(feature.GetRequestType()).Interface())
+		response, _ := json.Marshal(reflect.New(feature.GetResponseType()).Interface())
+		f.Add(uint16(i), false, []byte("{}"))
+		f.Add(uint16(i), false, request)
+		f.Add(uint16(i), true, []byte("{}"))
+		f.Add(uint16(i), true, response)
+	}
+	f.Fuzz(func(t *testing.T, index uint16, isResponse bool, payload []byte) {
+		feature := features[int(index)%len(features)]
+		endpoint := ocppj.Endpoint{}
+		for _, profile := range fuzzProfiles {
+			endpoint.AddProfile(profile)
+		}
+		endpoint.SetDialect(ocpp.V16)
+		state := ocppj.NewClientState()
+		var data string
+		if isResponse {
+			request := reflect.New(feature.GetRequestType()).Interface().(ocpp.Request)
+			state.AddPendingRequest("1234", request)
+			data = fmt.Sprintf(`[3,"1234",%s]`, payload)
+		} else {
+			data = fmt.Sprintf(`[2,"1234","%s",%s]`, feature.GetFeatureName(), payload)
+		}
+		parsedJson, err := ocppj.ParseRawJsonMessage([]byte(data))
+		if err != nil {
+			return
+		}
+		message, err := endpoint.ParseMessage(parsedJson, state)
+		if err != nil {
+			_, ok := err.(*ocpp.Error)
+			require.True(t, ok, "unexpected error type %T", err)
+			return
+		}
+		require.NotNil(t, message)
+		if isResponse {
+			require.IsType(t, &ocppj.CallResult{}, message)
+			assert.Equal(t, feature.GetResponseType(), reflect.TypeOf(message.(*ocppj.CallResult).Payload).Elem())
+		} else {
+			require.IsType(t, &ocppj.Call{}, message)
+			assert.Equal(t, feature.GetRequestType(), reflect.TypeOf(message.(*ocppj.Call).Payload).Elem())
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package ocpp16_test
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
 	"github.com/stretchr/testify/mock"
@@ -57,6 +59,27 @@ func (suite *OcppV16TestSuite) TestHeartbeatE2EMocked() {
 	assertDateTimeEquality(t, *currentTime, *confirmation.CurrentTime)
 }
 
+func (suite *OcppV16TestSuite) TestHeartbeatContextTimeout() {
+	t := suite.T()
+	wsId := "test_id"
+	messageId := defaultMessageId
+	wsUrl := "someUrl"
+	requestJson := fmt.Sprintf(`[2,"%v","%v",{}]`, messageId, core.HeartbeatFeatureName)
+	channel := NewMockWebSocket(wsId)
+	// The request never reaches the central system, hence no response is received
+	setupDefaultCentralSystemHandlers(suite, nil, expectedCentralSystemOptions{clientId: wsId, forwardWrittenMessage: false})
+	setupDefaultChargePointHandlers(suite, nil, expectedChargePointOptions{serverUrl: wsUrl, clientId: wsId, createChannelOnStart: true, channel: channel, rawWrittenMessage: []byte(requestJson), forwardWrittenMessage: false})
+	// Run Test
+	suite.centralSystem.Start(8887, "somePath")
+	err := suite.chargePoint.Start(wsUrl)
+	require.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	confirmation, err := suite.chargePoint.(ocpp16.ChargePointCtx).HeartbeatCtx(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Nil(t, confirmation)
+}
+
 func (suite *OcppV16TestSuite) TestHeartbeatInvalidEndpoint() {
 	messageId := defaultMessageId
 	heartbeatRequest := core.NewHeartbeatRequest()
@@ -0,0 +1,51 @@
+package ocpp16_test
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+func (suite *OcppV16TestSuite) TestMemoryTransport() {
+	t := suite.T()
+	wsId := "test_id"
+	currentTime := types.NewDateTime(time.Now())
+	server := ws.NewMemoryServer()
+	centralSystem := ocpp16.NewCentralSystem(nil, server)
+	handler := &MockCentralSystemCoreListener{}
+	handler.On("OnBootNotification", wsId, mock.Anything).Return(core.NewBootNotificationConfirmation(currentTime, 60, core.RegistrationStatusAccepted), nil)
+	centralSystem.SetCoreHandler(handler)
+	connectedC := make(chan string, 2)
+	centralSystem.SetNewChargePointHandler(func(chargePoint ocpp16.ChargePointConnection) {
+		connectedC <- chargePoint.ID()
+	})
+	go centralSystem.Start(8887, "/{ws}")
+	defer centralSystem.Stop()
+	chargePoint := ocpp16.NewChargePoint(wsId, nil, ws.NewMemoryClient(server))
+	require.NoError(t, chargePoint.Start("ws://localhost:8887"))
+	defer chargePoint.Stop()
+	assert.Equal(t, wsId, <-connectedC)
+	confirmation, err := chargePoint.BootNotification("model1", "vendor1")
+	require.NoError(t, err)
+	assert.Equal(t, core.RegistrationStatusAccepted, confirmation.Status)
+	// Simulate a network failure, the charge point reconnects automatically
+	require.NoError(t, server.DropConnection(wsId))
+	select {
+	case id := <-connectedC:
+		assert.Equal(t, wsId, id)
+	case <-time.After(time.Second):
+		t.Fatal("charge point didn't reconnect")
+	}
+	assert.Eventually(t, chargePoint.IsConnected, time.Second, 10*time.Millisecond)
+	confirmation, err = chargePoint.BootNotification("model1", "vendor1")
+	require.NoError(t, err)
+	assert.Equal(t, core.RegistrationStatusAccepted, confirmation.Status)
+	handler.AssertNumberOfCalls(t, "OnBootNotification", 2)
+}
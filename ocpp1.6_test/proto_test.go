@@ -1,11 +1,15 @@
 package ocpp16_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
 	"github.com/lorenzodonini/ocpp-go/ocppj"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -159,3 +163,171 @@ func (suite *OcppV16TestSuite) TestCentralSystemSendResponseError() {
 func (suite *OcppV16TestSuite) TestErrorCodes() {
 	suite.Equal(ocppj.FormatViolationV16, ocppj.FormatErrorType(suite.ocppjCentralSystem))
 }
+
+func (suite *OcppV16TestSuite) TestOfflinePolicy() {
+	t := suite.T()
+	policy := ocpp16.NewOfflinePolicy()
+	action, _ := policy.Classify(core.NewStartTransactionRequest(1, "tag", 0, types.NewDateTime(time.Now())))
+	assert.Equal(t, ocppj.OfflineKeep, action)
+	action, _ = policy.Classify(core.NewHeartbeatRequest())
+	assert.Equal(t, ocppj.OfflineDrop, action)
+	action, key1 := policy.Classify(core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusCharging))
+	assert.Equal(t, ocppj.OfflineCoalesce, action)
+	_, key2 := policy.Classify(core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusFinishing))
+	assert.Equal(t, key1, key2)
+	_, key3 := policy.Classify(core.NewStatusNotificationRequest(2, core.NoError, core.ChargePointStatusCharging))
+	assert.NotEqual(t, key1, key3)
+}
+
+func (suite *OcppV16TestSuite) TestChargePointCancelRequestSentTwice() {
+	t := suite.T()
+	messageIDs := []string{"1", "2"}
+	suite.messageIdGenerator.generator = func() string {
+		id := messageIDs[0]
+		messageIDs = messageIDs[1:]
+		return id
+	}
+	writeC := make(chan []byte, 2)
+	suite.mockWsClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockWsClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- args.Get(0).([]byte)
+	})
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	// The same request instance is sent twice
+	request := core.NewHeartbeatRequest()
+	firstC := make(chan error, 1)
+	secondC := make(chan error, 1)
+	err = suite.chargePoint.SendRequestAsync(request, func(confirmation ocpp.Response, err error) {
+		firstC <- err
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = suite.chargePoint.(ocpp16.ChargePointCtx).SendRequestAsyncCtx(ctx, request, func(confirmation ocpp.Response, err error) {
+		secondC <- err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`[2,"1","%v",{}]`, core.HeartbeatFeatureName), string(<-writeC))
+	// Canceling the queued request only invokes its own callback
+	cancel()
+	select {
+	case err = <-secondC:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("callback of the canceled request wasn't invoked")
+	}
+	assert.Len(t, firstC, 0)
+	// The response to the first request is delivered to the first callback
+	currentTime := types.NewDateTime(time.Now())
+	err = suite.mockWsClient.MessageHandler([]byte(fmt.Sprintf(`[3,"1",{"currentTime":"%v"}]`, currentTime.FormatTimestamp())))
+	require.NoError(t, err)
+	select {
+	case err = <-firstC:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("callback of the first request wasn't invoked")
+	}
+}
+
+func (suite *OcppV16TestSuite) TestChargePointShortCircuitedRequest() {
+	t := suite.T()
+	messageIDs := []string{"1", "2"}
+	suite.messageIdGenerator.generator = func() string {
+		id := messageIDs[0]
+		messageIDs = messageIDs[1:]
+		return id
+	}
+	// The first request is short-circuited
+	suite.ocppjChargePoint.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			if envelope.Direction == ocppj.Outbound && envelope.Message.GetUniqueId() == "1" {
+				return nil
+			}
+			return next(envelope)
+		}
+	})
+	writeC := make(chan []byte, 1)
+	suite.mockWsClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockWsClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- args.Get(0).([]byte)
+	})
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	_, err = suite.chargePoint.Heartbeat()
+	require.ErrorIs(t, err, ocppj.ErrShortCircuited)
+	// The response to the second request is delivered to its own callback
+	resultC := make(chan error, 1)
+	err = suite.chargePoint.SendRequestAsync(core.NewHeartbeatRequest(), func(confirmation ocpp.Response, err error) {
+		resultC <- err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`[2,"2","%v",{}]`, core.HeartbeatFeatureName), string(<-writeC))
+	currentTime := types.NewDateTime(time.Now())
+	err = suite.mockWsClient.MessageHandler([]byte(fmt.Sprintf(`[3,"2",{"currentTime":"%v"}]`, currentTime.FormatTimestamp())))
+	require.NoError(t, err)
+	select {
+	case err = <-resultC:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("callback of the second request wasn't invoked")
+	}
+}
+
+func (suite *OcppV16TestSuite) TestChargePointShortCircuitedResponse() {
+	t := suite.T()
+	messageIDs := []string{"1", "2"}
+	suite.messageIdGenerator.generator = func() string {
+		id := messageIDs[0]
+		messageIDs = messageIDs[1:]
+		return id
+	}
+	// The response to the first request is short-circuited
+	suite.ocppjChargePoint.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			if envelope.Direction == ocppj.Inbound && envelope.Message.GetUniqueId() == "1" {
+				return nil
+			}
+			return next(envelope)
+		}
+	})
+	writeC := make(chan []byte, 2)
+	suite.mockWsClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockWsClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- args.Get(0).([]byte)
+	})
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	firstC := make(chan error, 1)
+	secondC := make(chan error, 1)
+	err = suite.chargePoint.SendRequestAsync(core.NewHeartbeatRequest(), func(confirmation ocpp.Response, err error) {
+		firstC <- err
+	})
+	require.NoError(t, err)
+	err = suite.chargePoint.SendRequestAsync(core.NewHeartbeatRequest(), func(confirmation ocpp.Response, err error) {
+		secondC <- err
+	})
+	require.NoError(t, err)
+	currentTime := types.NewDateTime(time.Now())
+	// The first callback is notified, even though its response was dropped
+	assert.Equal(t, fmt.Sprintf(`[2,"1","%v",{}]`, core.HeartbeatFeatureName), string(<-writeC))
+	err = suite.mockWsClient.MessageHandler([]byte(fmt.Sprintf(`[3,"1",{"currentTime":"%v"}]`, currentTime.FormatTimestamp())))
+	require.NoError(t, err)
+	select {
+	case err = <-firstC:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("callback of the first request wasn't invoked")
+	}
+	// The response to the second request is delivered to the second callback
+	assert.Equal(t, fmt.Sprintf(`[2,"2","%v",{}]`, core.HeartbeatFeatureName), string(<-writeC))
+	err = suite.mockWsClient.MessageHandler([]byte(fmt.Sprintf(`[3,"2",{"currentTime":"%v"}]`, currentTime.FormatTimestamp())))
+	require.NoError(t, err)
+	select {
+	case err = <-secondC:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("callback of the second request wasn't invoked")
+	}
+	assert.Len(t, firstC, 0)
+}
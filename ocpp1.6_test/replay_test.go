@@ -0,0 +1,104 @@
+package ocpp16_test
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+func (suite *OcppV16TestSuite) TestRecordAndReplay() {
+	t := suite.T()
+	wsId := "test_id"
+	bootConf := core.NewBootNotificationConfirmation(types.NewDateTime(time.Now()), 60, core.RegistrationStatusAccepted)
+	// The central system changes the availability of every charge point, after it booted
+	newCentralSystem := func(server ws.WsServer, recorder ocppj.Recorder) (ocpp16.CentralSystem, chan *core.ChangeAvailabilityConfirmation) {
+		endpoint := ocppj.NewServer(server, nil, nil, core.Profile)
+		endpoint.SetRecorder(recorder)
+		centralSystem := ocpp16.NewCentralSystem(endpoint, server)
+		confC := make(chan *core.ChangeAvailabilityConfirmation, 1)
+		handler := &MockCentralSystemCoreListener{}
+		handler.On("OnBootNotification", wsId, mock.Anything).Return(bootConf, nil).Run(func(args mock.Arguments) {
+			go func() {
+				err := centralSystem.ChangeAvailability(wsId, func(confirmation *core.ChangeAvailabilityConfirmation, err error) {
+					assert.NoError(t, err)
+					confC <- confirmation
+				}, 1, core.AvailabilityTypeInoperative)
+				assert.NoError(t, err)
+			}()
+		})
+		centralSystem.SetCoreHandler(handler)
+		return centralSystem, confC
+	}
+	newChargePoint := func(server *ws.MemoryServer) (ocpp16.ChargePoint, *MockChargePointCoreListener) {
+		chargePoint := ocpp16.NewChargePoint(wsId, nil, ws.NewMemoryClient(server))
+		handler := &MockChargePointCoreListener{}
+		handler.On("OnChangeAvailability", mock.Anything).Return(core.NewChangeAvailabilityConfirmation(core.AvailabilityStatusAccepted), nil)
+		chargePoint.SetCoreHandler(handler)
+		return chargePoint, handler
+	}
+	// Record the conversation on the central system
+	buffer := &bytes.Buffer{}
+	server := ws.NewMemoryServer()
+	centralSystem, confC := newCentralSystem(server, ocppj.NewJSONLRecorder(buffer))
+	go centralSystem.Start(8887, "/{ws}")
+	chargePoint, _ := newChargePoint(server)
+	require.NoError(t, chargePoint.Start("ws://localhost:8887"))
+	_, err := chargePoint.BootNotification("model1", "vendor1")
+	require.NoError(t, err)
+	assert.Equal(t, core.AvailabilityStatusAccepted, (<-confC).Status)
+	chargePoint.Stop()
+	centralSystem.Stop()
+	frames, err := ocppj.ReadFrames(buffer)
+	require.NoError(t, err)
+	require.Len(t, frames, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Replay the charge point frames against a new central system
+	server = ws.NewMemoryServer()
+	centralSystem, confC = newCentralSystem(server, nil)
+	go centralSystem.Start(8887, "/{ws}")
+	defer centralSystem.Stop()
+	replayer := ocppj.NewClientReplayer(frames, "ws://localhost:8887", func(clientID string) ws.WsClient {
+		return ws.NewMemoryClient(server)
+	})
+	transcript, err := replayer.Replay(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, core.AvailabilityStatusAccepted, (<-confC).Status)
+	require.Len(t, transcript, 4)
+	assert.Equal(t, frames[0].Data, transcript[0].Data)
+	for _, frame := range transcript {
+		assert.Equal(t, wsId, frame.ClientID)
+		assert.Equal(t, "ocpp1.6", frame.Dialect)
+		assert.Equal(t, "client", frame.Role)
+	}
+
+	// Replay the central system frames against a new charge point
+	server = ws.NewMemoryServer()
+	replayer = ocppj.NewServerReplayer(frames, server)
+	go server.Start(8887, "/{ws}")
+	defer server.Stop()
+	resultC := make(chan error, 1)
+	go func() {
+		_, err := replayer.Replay(ctx)
+		resultC <- err
+	}()
+	chargePoint, handler := newChargePoint(server)
+	require.NoError(t, chargePoint.Start("ws://localhost:8887"))
+	defer chargePoint.Stop()
+	confirmation, err := chargePoint.BootNotification("model1", "vendor1")
+	require.NoError(t, err)
+	assert.Equal(t, core.RegistrationStatusAccepted, confirmation.Status)
+	require.NoError(t, <-resultC)
+	handler.AssertCalled(t, "OnChangeAvailability", mock.Anything)
+}
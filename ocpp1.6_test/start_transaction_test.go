@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
 	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -99,3 +102,45 @@ func (suite *OcppV16TestSuite) TestStartTransactionInvalidEndpoint() {
 	requestJson := fmt.Sprintf(`[2,"%v","%v",{"connectorId":%v,"idTag":"%v","meterStart":%v,"reservationId":%v,"timestamp":"%v"}]`, messageId, core.StartTransactionFeatureName, connectorId, idTag, meterStart, reservationId, timestamp.FormatTimestamp())
 	testUnsupportedRequestFromCentralSystem(suite, authorizeRequest, requestJson, messageId)
 }
+
+func (suite *OcppV16TestSuite) TestStartTransactionRetriedAfterCallError() {
+	t := suite.T()
+	messageId := defaultMessageId
+	retryInterval := 200 * time.Millisecond
+	ocpp16.SetTransactionRetryPolicy(suite.clientDispatcher.(*ocppj.DefaultClientDispatcher), 2, retryInterval)
+	writeC := make(chan []byte, 2)
+	suite.mockWsClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockWsClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- args.Get(0).([]byte)
+	})
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	resultC := make(chan *core.StartTransactionConfirmation, 1)
+	err = suite.chargePoint.SendRequestAsync(core.NewStartTransactionRequest(1, "tag1", 100, types.NewDateTime(time.Now())), func(confirmation ocpp.Response, err error) {
+		require.NoError(t, err)
+		resultC <- confirmation.(*core.StartTransactionConfirmation)
+	})
+	require.NoError(t, err)
+	request := <-writeC
+	// The central system fails to process the request
+	sentAt := time.Now()
+	err = suite.mockWsClient.MessageHandler([]byte(fmt.Sprintf(`[4,"%v","InternalError","",{}]`, messageId)))
+	require.NoError(t, err)
+	// The request is re-sent after the retry interval, without notifying the caller
+	select {
+	case retried := <-writeC:
+		assert.Equal(t, request, retried)
+		assert.GreaterOrEqual(t, time.Since(sentAt), retryInterval)
+	case <-time.After(time.Second):
+		t.Fatal("request wasn't retransmitted")
+	}
+	assert.Len(t, resultC, 0)
+	err = suite.mockWsClient.MessageHandler([]byte(fmt.Sprintf(`[3,"%v",{"idTagInfo":{"status":"%v"},"transactionId":16}]`, messageId, types.AuthorizationStatusAccepted)))
+	require.NoError(t, err)
+	select {
+	case confirmation := <-resultC:
+		assert.Equal(t, 16, confirmation.TransactionId)
+	case <-time.After(time.Second):
+		t.Fatal("callback wasn't invoked")
+	}
+}
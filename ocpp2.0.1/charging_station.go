@@ -1,6 +1,7 @@
 package ocpp2
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -51,12 +52,20 @@ type chargingStation struct {
 	errC                 chan error // external error channel
 }
 
+var _ ChargingStationCtx = (*chargingStation)(nil)
+
 func (cs *chargingStation) error(err error) {
 	if cs.errC != nil {
 		cs.errC <- err
 	}
 }
 
+// Callback invoked for every request restored from a persistent queue, when starting the client.
+// The original caller isn't available anymore, so the response to the request is discarded.
+func (cs *chargingStation) onRequestRestored(requestID string, request ocpp.Request) {
+	_ = cs.callbacks.TryQueue("main", func() (string, error) { return requestID, nil }, func(response ocpp.Response, err error) {})
+}
+
 // Errors returns a channel for error messages. If it doesn't exist it es created.
 func (cs *chargingStation) Errors() <-chan error {
 	if cs.errC == nil {
@@ -65,18 +74,28 @@ func (cs *chargingStation) Errors() <-chan error {
 	return cs.errC
 }
 
-// Callback invoked whenever a queued request is canceled, due to timeout.
+// Callback invoked whenever a queued request is canceled, due to timeout or because its context is done.
 // By default, the callback returns a GenericError to the caller, who sent the original request.
-func (cs *chargingStation) onRequestTimeout(_ string, _ ocpp.Request, err *ocpp.Error) {
-	cs.errorHandler <- err
+func (cs *chargingStation) onRequestTimeout(requestID string, request ocpp.Request, err *ocpp.Error) {
+	// The canceled request may not be at the front of the queue (e.g. if its context was canceled)
+	if callback, ok := cs.callbacks.DequeueRequest("main", requestID); ok {
+		// Execute in separate goroutine, so the caller goroutine is available
+		go callback(nil, err)
+	} else {
+		cs.error(fmt.Errorf("no callback available for canceled request %s: %w", request.GetFeatureName(), err))
+	}
 }
 
 func (cs *chargingStation) BootNotification(reason provisioning.BootReason, model string, vendor string, props ...func(request *provisioning.BootNotificationRequest)) (*provisioning.BootNotificationResponse, error) {
+	return cs.BootNotificationCtx(context.Background(), reason, model, vendor, props...)
+}
+
+func (cs *chargingStation) BootNotificationCtx(ctx context.Context, reason provisioning.BootReason, model string, vendor string, props ...func(request *provisioning.BootNotificationRequest)) (*provisioning.BootNotificationResponse, error) {
 	request := provisioning.NewBootNotificationRequest(reason, model, vendor)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -85,11 +104,15 @@ func (cs *chargingStation) BootNotification(reason provisioning.BootReason, mode
 }
 
 func (cs *chargingStation) Authorize(idToken string, tokenType types.IdTokenType, props ...func(request *authorization.AuthorizeRequest)) (*authorization.AuthorizeResponse, error) {
+	return cs.AuthorizeCtx(context.Background(), idToken, tokenType, props...)
+}
+
+func (cs *chargingStation) AuthorizeCtx(ctx context.Context, idToken string, tokenType types.IdTokenType, props ...func(request *authorization.AuthorizeRequest)) (*authorization.AuthorizeResponse, error) {
 	request := authorization.NewAuthorizationRequest(idToken, tokenType)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -98,11 +121,15 @@ func (cs *chargingStation) Authorize(idToken string, tokenType types.IdTokenType
 }
 
 func (cs *chargingStation) ClearedChargingLimit(chargingLimitSource types.ChargingLimitSourceType, props ...func(request *smartcharging.ClearedChargingLimitRequest)) (*smartcharging.ClearedChargingLimitResponse, error) {
+	return cs.ClearedChargingLimitCtx(context.Background(), chargingLimitSource, props...)
+}
+
+func (cs *chargingStation) ClearedChargingLimitCtx(ctx context.Context, chargingLimitSource types.ChargingLimitSourceType, props ...func(request *smartcharging.ClearedChargingLimitRequest)) (*smartcharging.ClearedChargingLimitResponse, error) {
 	request := smartcharging.NewClearedChargingLimitRequest(chargingLimitSource)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -111,11 +138,15 @@ func (cs *chargingStation) ClearedChargingLimit(chargingLimitSource types.Chargi
 }
 
 func (cs *chargingStation) DataTransfer(vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error) {
+	return cs.DataTransferCtx(context.Background(), vendorId, props...)
+}
+
+func (cs *chargingStation) DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error) {
 	request := data.NewDataTransferRequest(vendorId)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -124,11 +155,15 @@ func (cs *chargingStation) DataTransfer(vendorId string, props ...func(request *
 }
 
 func (cs *chargingStation) FirmwareStatusNotification(status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationResponse, error) {
+	return cs.FirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cs *chargingStation) FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationResponse, error) {
 	request := firmware.NewFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -137,11 +172,15 @@ func (cs *chargingStation) FirmwareStatusNotification(status firmware.FirmwareSt
 }
 
 func (cs *chargingStation) Get15118EVCertificate(schemaVersion string, action iso15118.CertificateAction, exiRequest string, props ...func(request *iso15118.Get15118EVCertificateRequest)) (*iso15118.Get15118EVCertificateResponse, error) {
+	return cs.Get15118EVCertificateCtx(context.Background(), schemaVersion, action, exiRequest, props...)
+}
+
+func (cs *chargingStation) Get15118EVCertificateCtx(ctx context.Context, schemaVersion string, action iso15118.CertificateAction, exiRequest string, props ...func(request *iso15118.Get15118EVCertificateRequest)) (*iso15118.Get15118EVCertificateResponse, error) {
 	request := iso15118.NewGet15118EVCertificateRequest(schemaVersion, action, exiRequest)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -150,11 +189,15 @@ func (cs *chargingStation) Get15118EVCertificate(schemaVersion string, action is
 }
 
 func (cs *chargingStation) GetCertificateStatus(ocspRequestData types.OCSPRequestDataType, props ...func(request *iso15118.GetCertificateStatusRequest)) (*iso15118.GetCertificateStatusResponse, error) {
+	return cs.GetCertificateStatusCtx(context.Background(), ocspRequestData, props...)
+}
+
+func (cs *chargingStation) GetCertificateStatusCtx(ctx context.Context, ocspRequestData types.OCSPRequestDataType, props ...func(request *iso15118.GetCertificateStatusRequest)) (*iso15118.GetCertificateStatusResponse, error) {
 	request := iso15118.NewGetCertificateStatusRequest(ocspRequestData)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -163,11 +206,15 @@ func (cs *chargingStation) GetCertificateStatus(ocspRequestData types.OCSPReques
 }
 
 func (cs *chargingStation) Heartbeat(props ...func(request *availability.HeartbeatRequest)) (*availability.HeartbeatResponse, error) {
+	return cs.HeartbeatCtx(context.Background(), props...)
+}
+
+func (cs *chargingStation) HeartbeatCtx(ctx context.Context, props ...func(request *availability.HeartbeatRequest)) (*availability.HeartbeatResponse, error) {
 	request := availability.NewHeartbeatRequest()
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -176,11 +223,15 @@ func (cs *chargingStation) Heartbeat(props ...func(request *availability.Heartbe
 }
 
 func (cs *chargingStation) LogStatusNotification(status diagnostics.UploadLogStatus, requestID int, props ...func(request *diagnostics.LogStatusNotificationRequest)) (*diagnostics.LogStatusNotificationResponse, error) {
+	return cs.LogStatusNotificationCtx(context.Background(), status, requestID, props...)
+}
+
+func (cs *chargingStation) LogStatusNotificationCtx(ctx context.Context, status diagnostics.UploadLogStatus, requestID int, props ...func(request *diagnostics.LogStatusNotificationRequest)) (*diagnostics.LogStatusNotificationResponse, error) {
 	request := diagnostics.NewLogStatusNotificationRequest(status, requestID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -189,11 +240,15 @@ func (cs *chargingStation) LogStatusNotification(status diagnostics.UploadLogSta
 }
 
 func (cs *chargingStation) MeterValues(evseID int, meterValues []types.MeterValue, props ...func(request *meter.MeterValuesRequest)) (*meter.MeterValuesResponse, error) {
+	return cs.MeterValuesCtx(context.Background(), evseID, meterValues, props...)
+}
+
+func (cs *chargingStation) MeterValuesCtx(ctx context.Context, evseID int, meterValues []types.MeterValue, props ...func(request *meter.MeterValuesRequest)) (*meter.MeterValuesResponse, error) {
 	request := meter.NewMeterValuesRequest(evseID, meterValues)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -202,11 +257,15 @@ func (cs *chargingStation) MeterValues(evseID int, meterValues []types.MeterValu
 }
 
 func (cs *chargingStation) NotifyChargingLimit(chargingLimit smartcharging.ChargingLimit, props ...func(request *smartcharging.NotifyChargingLimitRequest)) (*smartcharging.NotifyChargingLimitResponse, error) {
+	return cs.NotifyChargingLimitCtx(context.Background(), chargingLimit, props...)
+}
+
+func (cs *chargingStation) NotifyChargingLimitCtx(ctx context.Context, chargingLimit smartcharging.ChargingLimit, props ...func(request *smartcharging.NotifyChargingLimitRequest)) (*smartcharging.NotifyChargingLimitResponse, error) {
 	request := smartcharging.NewNotifyChargingLimitRequest(chargingLimit)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -215,11 +274,15 @@ func (cs *chargingStation) NotifyChargingLimit(chargingLimit smartcharging.Charg
 }
 
 func (cs *chargingStation) NotifyCustomerInformation(data string, seqNo int, generatedAt types.DateTime, requestID int, props ...func(request *diagnostics.NotifyCustomerInformationRequest)) (*diagnostics.NotifyCustomerInformationResponse, error) {
+	return cs.NotifyCustomerInformationCtx(context.Background(), data, seqNo, generatedAt, requestID, props...)
+}
+
+func (cs *chargingStation) NotifyCustomerInformationCtx(ctx context.Context, data string, seqNo int, generatedAt types.DateTime, requestID int, props ...func(request *diagnostics.NotifyCustomerInformationRequest)) (*diagnostics.NotifyCustomerInformationResponse, error) {
 	request := diagnostics.NewNotifyCustomerInformationRequest(data, seqNo, generatedAt, requestID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -228,11 +291,15 @@ func (cs *chargingStation) NotifyCustomerInformation(data string, seqNo int, gen
 }
 
 func (cs *chargingStation) NotifyDisplayMessages(requestID int, props ...func(request *display.NotifyDisplayMessagesRequest)) (*display.NotifyDisplayMessagesResponse, error) {
+	return cs.NotifyDisplayMessagesCtx(context.Background(), requestID, props...)
+}
+
+func (cs *chargingStation) NotifyDisplayMessagesCtx(ctx context.Context, requestID int, props ...func(request *display.NotifyDisplayMessagesRequest)) (*display.NotifyDisplayMessagesResponse, error) {
 	request := display.NewNotifyDisplayMessagesRequest(requestID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -241,11 +308,15 @@ func (cs *chargingStation) NotifyDisplayMessages(requestID int, props ...func(re
 }
 
 func (cs *chargingStation) NotifyEVChargingNeeds(evseID int, chargingNeeds smartcharging.ChargingNeeds, props ...func(request *smartcharging.NotifyEVChargingNeedsRequest)) (*smartcharging.NotifyEVChargingNeedsResponse, error) {
+	return cs.NotifyEVChargingNeedsCtx(context.Background(), evseID, chargingNeeds, props...)
+}
+
+func (cs *chargingStation) NotifyEVChargingNeedsCtx(ctx context.Context, evseID int, chargingNeeds smartcharging.ChargingNeeds, props ...func(request *smartcharging.NotifyEVChargingNeedsRequest)) (*smartcharging.NotifyEVChargingNeedsResponse, error) {
 	request := smartcharging.NewNotifyEVChargingNeedsRequest(evseID, chargingNeeds)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -254,11 +325,15 @@ func (cs *chargingStation) NotifyEVChargingNeeds(evseID int, chargingNeeds smart
 }
 
 func (cs *chargingStation) NotifyEVChargingSchedule(timeBase *types.DateTime, evseID int, schedule types.ChargingSchedule, props ...func(request *smartcharging.NotifyEVChargingScheduleRequest)) (*smartcharging.NotifyEVChargingScheduleResponse, error) {
+	return cs.NotifyEVChargingScheduleCtx(context.Background(), timeBase, evseID, schedule, props...)
+}
+
+func (cs *chargingStation) NotifyEVChargingScheduleCtx(ctx context.Context, timeBase *types.DateTime, evseID int, schedule types.ChargingSchedule, props ...func(request *smartcharging.NotifyEVChargingScheduleRequest)) (*smartcharging.NotifyEVChargingScheduleResponse, error) {
 	request := smartcharging.NewNotifyEVChargingScheduleRequest(timeBase, evseID, schedule)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -267,11 +342,15 @@ func (cs *chargingStation) NotifyEVChargingSchedule(timeBase *types.DateTime, ev
 }
 
 func (cs *chargingStation) NotifyEvent(generatedAt *types.DateTime, seqNo int, eventData []diagnostics.EventData, props ...func(request *diagnostics.NotifyEventRequest)) (*diagnostics.NotifyEventResponse, error) {
+	return cs.NotifyEventCtx(context.Background(), generatedAt, seqNo, eventData, props...)
+}
+
+func (cs *chargingStation) NotifyEventCtx(ctx context.Context, generatedAt *types.DateTime, seqNo int, eventData []diagnostics.EventData, props ...func(request *diagnostics.NotifyEventRequest)) (*diagnostics.NotifyEventResponse, error) {
 	request := diagnostics.NewNotifyEventRequest(generatedAt, seqNo, eventData)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -280,11 +359,15 @@ func (cs *chargingStation) NotifyEvent(generatedAt *types.DateTime, seqNo int, e
 }
 
 func (cs *chargingStation) NotifyMonitoringReport(requestID int, seqNo int, generatedAt *types.DateTime, monitorData []diagnostics.MonitoringData, props ...func(request *diagnostics.NotifyMonitoringReportRequest)) (*diagnostics.NotifyMonitoringReportResponse, error) {
+	return cs.NotifyMonitoringReportCtx(context.Background(), requestID, seqNo, generatedAt, monitorData, props...)
+}
+
+func (cs *chargingStation) NotifyMonitoringReportCtx(ctx context.Context, requestID int, seqNo int, generatedAt *types.DateTime, monitorData []diagnostics.MonitoringData, props ...func(request *diagnostics.NotifyMonitoringReportRequest)) (*diagnostics.NotifyMonitoringReportResponse, error) {
 	request := diagnostics.NewNotifyMonitoringReportRequest(requestID, seqNo, generatedAt, monitorData)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -293,11 +376,15 @@ func (cs *chargingStation) NotifyMonitoringReport(requestID int, seqNo int, gene
 }
 
 func (cs *chargingStation) NotifyReport(requestID int, generatedAt *types.DateTime, seqNo int, props ...func(request *provisioning.NotifyReportRequest)) (*provisioning.NotifyReportResponse, error) {
+	return cs.NotifyReportCtx(context.Background(), requestID, generatedAt, seqNo, props...)
+}
+
+func (cs *chargingStation) NotifyReportCtx(ctx context.Context, requestID int, generatedAt *types.DateTime, seqNo int, props ...func(request *provisioning.NotifyReportRequest)) (*provisioning.NotifyReportResponse, error) {
 	request := provisioning.NewNotifyReportRequest(requestID, generatedAt, seqNo)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -306,11 +393,15 @@ func (cs *chargingStation) NotifyReport(requestID int, generatedAt *types.DateTi
 }
 
 func (cs *chargingStation) PublishFirmwareStatusNotification(status firmware.PublishFirmwareStatus, props ...func(request *firmware.PublishFirmwareStatusNotificationRequest)) (*firmware.PublishFirmwareStatusNotificationResponse, error) {
+	return cs.PublishFirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cs *chargingStation) PublishFirmwareStatusNotificationCtx(ctx context.Context, status firmware.PublishFirmwareStatus, props ...func(request *firmware.PublishFirmwareStatusNotificationRequest)) (*firmware.PublishFirmwareStatusNotificationResponse, error) {
 	request := firmware.NewPublishFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -319,11 +410,15 @@ func (cs *chargingStation) PublishFirmwareStatusNotification(status firmware.Pub
 }
 
 func (cs *chargingStation) ReportChargingProfiles(requestID int, chargingLimitSource types.ChargingLimitSourceType, evseID int, chargingProfile []types.ChargingProfile, props ...func(request *smartcharging.ReportChargingProfilesRequest)) (*smartcharging.ReportChargingProfilesResponse, error) {
+	return cs.ReportChargingProfilesCtx(context.Background(), requestID, chargingLimitSource, evseID, chargingProfile, props...)
+}
+
+func (cs *chargingStation) ReportChargingProfilesCtx(ctx context.Context, requestID int, chargingLimitSource types.ChargingLimitSourceType, evseID int, chargingProfile []types.ChargingProfile, props ...func(request *smartcharging.ReportChargingProfilesRequest)) (*smartcharging.ReportChargingProfilesResponse, error) {
 	request := smartcharging.NewReportChargingProfilesRequest(requestID, chargingLimitSource, evseID, chargingProfile)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -332,11 +427,15 @@ func (cs *chargingStation) ReportChargingProfiles(requestID int, chargingLimitSo
 }
 
 func (cs *chargingStation) ReservationStatusUpdate(reservationID int, status reservation.ReservationUpdateStatus, props ...func(request *reservation.ReservationStatusUpdateRequest)) (*reservation.ReservationStatusUpdateResponse, error) {
+	return cs.ReservationStatusUpdateCtx(context.Background(), reservationID, status, props...)
+}
+
+func (cs *chargingStation) ReservationStatusUpdateCtx(ctx context.Context, reservationID int, status reservation.ReservationUpdateStatus, props ...func(request *reservation.ReservationStatusUpdateRequest)) (*reservation.ReservationStatusUpdateResponse, error) {
 	request := reservation.NewReservationStatusUpdateRequest(reservationID, status)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -345,11 +444,15 @@ func (cs *chargingStation) ReservationStatusUpdate(reservationID int, status res
 }
 
 func (cs *chargingStation) SecurityEventNotification(typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
+	return cs.SecurityEventNotificationCtx(context.Background(), typ, timestamp, props...)
+}
+
+func (cs *chargingStation) SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
 	request := security.NewSecurityEventNotificationRequest(typ, timestamp)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -358,11 +461,15 @@ func (cs *chargingStation) SecurityEventNotification(typ string, timestamp *type
 }
 
 func (cs *chargingStation) SignCertificate(csr string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
+	return cs.SignCertificateCtx(context.Background(), csr, props...)
+}
+
+func (cs *chargingStation) SignCertificateCtx(ctx context.Context, csr string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
 	request := security.NewSignCertificateRequest(csr)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -371,11 +478,15 @@ func (cs *chargingStation) SignCertificate(csr string, props ...func(request *se
 }
 
 func (cs *chargingStation) StatusNotification(timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error) {
+	return cs.StatusNotificationCtx(context.Background(), timestamp, status, evseID, connectorID, props...)
+}
+
+func (cs *chargingStation) StatusNotificationCtx(ctx context.Context, timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error) {
 	request := availability.NewStatusNotificationRequest(timestamp, status, evseID, connectorID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -384,11 +495,15 @@ func (cs *chargingStation) StatusNotification(timestamp *types.DateTime, status
 }
 
 func (cs *chargingStation) TransactionEvent(t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error) {
+	return cs.TransactionEventCtx(context.Background(), t, timestamp, reason, seqNo, info, props...)
+}
+
+func (cs *chargingStation) TransactionEventCtx(ctx context.Context, t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error) {
 	request := transactions.NewTransactionEventRequest(t, timestamp, reason, seqNo, info)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -461,6 +576,10 @@ func (cs *chargingStation) SetDataHandler(handler data.ChargingStationHandler) {
 }
 
 func (cs *chargingStation) SendRequest(request ocpp.Request) (ocpp.Response, error) {
+	return cs.SendRequestCtx(context.Background(), request)
+}
+
+func (cs *chargingStation) SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error) {
 	featureName := request.GetFeatureName()
 	if _, found := cs.client.GetProfileForFeature(featureName); !found {
 		return nil, fmt.Errorf("feature %v is unsupported on charging station (missing profile), cannot send request", featureName)
@@ -473,8 +592,8 @@ func (cs *chargingStation) SendRequest(request ocpp.Request) (ocpp.Response, err
 	}
 	// Create channel and pass it to a callback function, for retrieving asynchronous response
 	asyncResponseC := make(chan asyncResponse, 1)
-	send := func() error {
-		return cs.client.SendRequest(request)
+	send := func() (string, error) {
+		return cs.client.SendRequestCtx(ctx, request)
 	}
 	err := cs.callbacks.TryQueue("main", send, func(confirmation ocpp.Response, err error) {
 		asyncResponseC <- asyncResponse{r: confirmation, e: err}
@@ -482,14 +601,22 @@ func (cs *chargingStation) SendRequest(request ocpp.Request) (ocpp.Response, err
 	if err != nil {
 		return nil, err
 	}
-	asyncResult, ok := <-asyncResponseC
-	if !ok {
-		return nil, fmt.Errorf("internal error while receiving result for %v request", request.GetFeatureName())
+	select {
+	case asyncResult, ok := <-asyncResponseC:
+		if !ok {
+			return nil, fmt.Errorf("internal error while receiving result for %v request", request.GetFeatureName())
+		}
+		return asyncResult.r, asyncResult.e
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return asyncResult.r, asyncResult.e
 }
 
 func (cs *chargingStation) SendRequestAsync(request ocpp.Request, callback func(response ocpp.Response, err error)) error {
+	return cs.SendRequestAsyncCtx(context.Background(), request, callback)
+}
+
+func (cs *chargingStation) SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(response ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cs.client.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on charging station (missing profile), cannot send request", featureName)
@@ -525,8 +652,8 @@ func (cs *chargingStation) SendRequestAsync(request ocpp.Request, callback func(
 		return fmt.Errorf("unsupported action %v on charging station, cannot send request", featureName)
 	}
 	// Response will be retrieved asynchronously via asyncHandler
-	send := func() error {
-		return cs.client.SendRequest(request)
+	send := func() (string, error) {
+		return cs.client.SendRequestCtx(ctx, request)
 	}
 	err := cs.callbacks.TryQueue("main", send, callback)
 	return err
@@ -1,7 +1,10 @@
 package ocpp2
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"reflect"
 
 	"github.com/lorenzodonini/ocpp-go/internal/callbackqueue"
@@ -49,6 +52,8 @@ type csms struct {
 	errC                 chan error
 }
 
+var _ CSMSCtx = (*csms)(nil)
+
 func newCSMS(server *ocppj.Server) csms {
 	if server == nil {
 		panic("server must not be nil")
@@ -74,6 +79,10 @@ func (cs *csms) Errors() <-chan error {
 }
 
 func (cs *csms) CancelReservation(clientId string, callback func(*reservation.CancelReservationResponse, error), reservationId int, props ...func(request *reservation.CancelReservationRequest)) error {
+	return cs.CancelReservationCtx(context.Background(), clientId, callback, reservationId, props...)
+}
+
+func (cs *csms) CancelReservationCtx(ctx context.Context, clientId string, callback func(*reservation.CancelReservationResponse, error), reservationId int, props ...func(request *reservation.CancelReservationRequest)) error {
 	request := reservation.NewCancelReservationRequest(reservationId)
 	for _, fn := range props {
 		fn(request)
@@ -85,10 +94,14 @@ func (cs *csms) CancelReservation(clientId string, callback func(*reservation.Ca
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) CertificateSigned(clientId string, callback func(*security.CertificateSignedResponse, error), certificateChain string, props ...func(*security.CertificateSignedRequest)) error {
+	return cs.CertificateSignedCtx(context.Background(), clientId, callback, certificateChain, props...)
+}
+
+func (cs *csms) CertificateSignedCtx(ctx context.Context, clientId string, callback func(*security.CertificateSignedResponse, error), certificateChain string, props ...func(*security.CertificateSignedRequest)) error {
 	request := security.NewCertificateSignedRequest(certificateChain)
 	for _, fn := range props {
 		fn(request)
@@ -100,10 +113,14 @@ func (cs *csms) CertificateSigned(clientId string, callback func(*security.Certi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) ChangeAvailability(clientId string, callback func(*availability.ChangeAvailabilityResponse, error), operationalStatus availability.OperationalStatus, props ...func(request *availability.ChangeAvailabilityRequest)) error {
+	return cs.ChangeAvailabilityCtx(context.Background(), clientId, callback, operationalStatus, props...)
+}
+
+func (cs *csms) ChangeAvailabilityCtx(ctx context.Context, clientId string, callback func(*availability.ChangeAvailabilityResponse, error), operationalStatus availability.OperationalStatus, props ...func(request *availability.ChangeAvailabilityRequest)) error {
 	request := availability.NewChangeAvailabilityRequest(operationalStatus)
 	for _, fn := range props {
 		fn(request)
@@ -115,10 +132,14 @@ func (cs *csms) ChangeAvailability(clientId string, callback func(*availability.
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) ClearCache(clientId string, callback func(*authorization.ClearCacheResponse, error), props ...func(*authorization.ClearCacheRequest)) error {
+	return cs.ClearCacheCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) ClearCacheCtx(ctx context.Context, clientId string, callback func(*authorization.ClearCacheResponse, error), props ...func(*authorization.ClearCacheRequest)) error {
 	request := authorization.NewClearCacheRequest()
 	for _, fn := range props {
 		fn(request)
@@ -130,10 +151,14 @@ func (cs *csms) ClearCache(clientId string, callback func(*authorization.ClearCa
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) ClearChargingProfile(clientId string, callback func(*smartcharging.ClearChargingProfileResponse, error), props ...func(request *smartcharging.ClearChargingProfileRequest)) error {
+	return cs.ClearChargingProfileCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) ClearChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.ClearChargingProfileResponse, error), props ...func(request *smartcharging.ClearChargingProfileRequest)) error {
 	request := smartcharging.NewClearChargingProfileRequest()
 	for _, fn := range props {
 		fn(request)
@@ -145,10 +170,14 @@ func (cs *csms) ClearChargingProfile(clientId string, callback func(*smartchargi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) ClearDisplay(clientId string, callback func(*display.ClearDisplayResponse, error), id int, props ...func(*display.ClearDisplayRequest)) error {
+	return cs.ClearDisplayCtx(context.Background(), clientId, callback, id, props...)
+}
+
+func (cs *csms) ClearDisplayCtx(ctx context.Context, clientId string, callback func(*display.ClearDisplayResponse, error), id int, props ...func(*display.ClearDisplayRequest)) error {
 	request := display.NewClearDisplayRequest(id)
 	for _, fn := range props {
 		fn(request)
@@ -160,10 +189,14 @@ func (cs *csms) ClearDisplay(clientId string, callback func(*display.ClearDispla
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) ClearVariableMonitoring(clientId string, callback func(*diagnostics.ClearVariableMonitoringResponse, error), id []int, props ...func(*diagnostics.ClearVariableMonitoringRequest)) error {
+	return cs.ClearVariableMonitoringCtx(context.Background(), clientId, callback, id, props...)
+}
+
+func (cs *csms) ClearVariableMonitoringCtx(ctx context.Context, clientId string, callback func(*diagnostics.ClearVariableMonitoringResponse, error), id []int, props ...func(*diagnostics.ClearVariableMonitoringRequest)) error {
 	request := diagnostics.NewClearVariableMonitoringRequest(id)
 	for _, fn := range props {
 		fn(request)
@@ -175,10 +208,14 @@ func (cs *csms) ClearVariableMonitoring(clientId string, callback func(*diagnost
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) CostUpdated(clientId string, callback func(*tariffcost.CostUpdatedResponse, error), totalCost float64, transactionId string, props ...func(*tariffcost.CostUpdatedRequest)) error {
+	return cs.CostUpdatedCtx(context.Background(), clientId, callback, totalCost, transactionId, props...)
+}
+
+func (cs *csms) CostUpdatedCtx(ctx context.Context, clientId string, callback func(*tariffcost.CostUpdatedResponse, error), totalCost float64, transactionId string, props ...func(*tariffcost.CostUpdatedRequest)) error {
 	request := tariffcost.NewCostUpdatedRequest(totalCost, transactionId)
 	for _, fn := range props {
 		fn(request)
@@ -190,10 +227,14 @@ func (cs *csms) CostUpdated(clientId string, callback func(*tariffcost.CostUpdat
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) CustomerInformation(clientId string, callback func(*diagnostics.CustomerInformationResponse, error), requestId int, report bool, clear bool, props ...func(*diagnostics.CustomerInformationRequest)) error {
+	return cs.CustomerInformationCtx(context.Background(), clientId, callback, requestId, report, clear, props...)
+}
+
+func (cs *csms) CustomerInformationCtx(ctx context.Context, clientId string, callback func(*diagnostics.CustomerInformationResponse, error), requestId int, report bool, clear bool, props ...func(*diagnostics.CustomerInformationRequest)) error {
 	request := diagnostics.NewCustomerInformationRequest(requestId, report, clear)
 	for _, fn := range props {
 		fn(request)
@@ -205,10 +246,14 @@ func (cs *csms) CustomerInformation(clientId string, callback func(*diagnostics.
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) DataTransfer(clientId string, callback func(*data.DataTransferResponse, error), vendorId string, props ...func(request *data.DataTransferRequest)) error {
+	return cs.DataTransferCtx(context.Background(), clientId, callback, vendorId, props...)
+}
+
+func (cs *csms) DataTransferCtx(ctx context.Context, clientId string, callback func(*data.DataTransferResponse, error), vendorId string, props ...func(request *data.DataTransferRequest)) error {
 	request := data.NewDataTransferRequest(vendorId)
 	for _, fn := range props {
 		fn(request)
@@ -220,10 +265,14 @@ func (cs *csms) DataTransfer(clientId string, callback func(*data.DataTransferRe
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) DeleteCertificate(clientId string, callback func(*iso15118.DeleteCertificateResponse, error), data types.CertificateHashData, props ...func(*iso15118.DeleteCertificateRequest)) error {
+	return cs.DeleteCertificateCtx(context.Background(), clientId, callback, data, props...)
+}
+
+func (cs *csms) DeleteCertificateCtx(ctx context.Context, clientId string, callback func(*iso15118.DeleteCertificateResponse, error), data types.CertificateHashData, props ...func(*iso15118.DeleteCertificateRequest)) error {
 	request := iso15118.NewDeleteCertificateRequest(data)
 	for _, fn := range props {
 		fn(request)
@@ -235,10 +284,14 @@ func (cs *csms) DeleteCertificate(clientId string, callback func(*iso15118.Delet
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetBaseReport(clientId string, callback func(*provisioning.GetBaseReportResponse, error), requestId int, reportBase provisioning.ReportBaseType, props ...func(*provisioning.GetBaseReportRequest)) error {
+	return cs.GetBaseReportCtx(context.Background(), clientId, callback, requestId, reportBase, props...)
+}
+
+func (cs *csms) GetBaseReportCtx(ctx context.Context, clientId string, callback func(*provisioning.GetBaseReportResponse, error), requestId int, reportBase provisioning.ReportBaseType, props ...func(*provisioning.GetBaseReportRequest)) error {
 	request := provisioning.NewGetBaseReportRequest(requestId, reportBase)
 	for _, fn := range props {
 		fn(request)
@@ -250,10 +303,14 @@ func (cs *csms) GetBaseReport(clientId string, callback func(*provisioning.GetBa
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetChargingProfiles(clientId string, callback func(*smartcharging.GetChargingProfilesResponse, error), chargingProfile smartcharging.ChargingProfileCriterion, props ...func(*smartcharging.GetChargingProfilesRequest)) error {
+	return cs.GetChargingProfilesCtx(context.Background(), clientId, callback, chargingProfile, props...)
+}
+
+func (cs *csms) GetChargingProfilesCtx(ctx context.Context, clientId string, callback func(*smartcharging.GetChargingProfilesResponse, error), chargingProfile smartcharging.ChargingProfileCriterion, props ...func(*smartcharging.GetChargingProfilesRequest)) error {
 	request := smartcharging.NewGetChargingProfilesRequest(chargingProfile)
 	for _, fn := range props {
 		fn(request)
@@ -265,10 +322,14 @@ func (cs *csms) GetChargingProfiles(clientId string, callback func(*smartchargin
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetCompositeSchedule(clientId string, callback func(*smartcharging.GetCompositeScheduleResponse, error), duration int, evseId int, props ...func(*smartcharging.GetCompositeScheduleRequest)) error {
+	return cs.GetCompositeScheduleCtx(context.Background(), clientId, callback, duration, evseId, props...)
+}
+
+func (cs *csms) GetCompositeScheduleCtx(ctx context.Context, clientId string, callback func(*smartcharging.GetCompositeScheduleResponse, error), duration int, evseId int, props ...func(*smartcharging.GetCompositeScheduleRequest)) error {
 	request := smartcharging.NewGetCompositeScheduleRequest(duration, evseId)
 	for _, fn := range props {
 		fn(request)
@@ -280,10 +341,14 @@ func (cs *csms) GetCompositeSchedule(clientId string, callback func(*smartchargi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetDisplayMessages(clientId string, callback func(*display.GetDisplayMessagesResponse, error), requestId int, props ...func(*display.GetDisplayMessagesRequest)) error {
+	return cs.GetDisplayMessagesCtx(context.Background(), clientId, callback, requestId, props...)
+}
+
+func (cs *csms) GetDisplayMessagesCtx(ctx context.Context, clientId string, callback func(*display.GetDisplayMessagesResponse, error), requestId int, props ...func(*display.GetDisplayMessagesRequest)) error {
 	request := display.NewGetDisplayMessagesRequest(requestId)
 	for _, fn := range props {
 		fn(request)
@@ -295,10 +360,14 @@ func (cs *csms) GetDisplayMessages(clientId string, callback func(*display.GetDi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetInstalledCertificateIds(clientId string, callback func(*iso15118.GetInstalledCertificateIdsResponse, error), props ...func(*iso15118.GetInstalledCertificateIdsRequest)) error {
+	return cs.GetInstalledCertificateIdsCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) GetInstalledCertificateIdsCtx(ctx context.Context, clientId string, callback func(*iso15118.GetInstalledCertificateIdsResponse, error), props ...func(*iso15118.GetInstalledCertificateIdsRequest)) error {
 	request := iso15118.NewGetInstalledCertificateIdsRequest()
 	for _, fn := range props {
 		fn(request)
@@ -310,10 +379,14 @@ func (cs *csms) GetInstalledCertificateIds(clientId string, callback func(*iso15
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetLocalListVersion(clientId string, callback func(*localauth.GetLocalListVersionResponse, error), props ...func(*localauth.GetLocalListVersionRequest)) error {
+	return cs.GetLocalListVersionCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) GetLocalListVersionCtx(ctx context.Context, clientId string, callback func(*localauth.GetLocalListVersionResponse, error), props ...func(*localauth.GetLocalListVersionRequest)) error {
 	request := localauth.NewGetLocalListVersionRequest()
 	for _, fn := range props {
 		fn(request)
@@ -325,10 +398,14 @@ func (cs *csms) GetLocalListVersion(clientId string, callback func(*localauth.Ge
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetLog(clientId string, callback func(*diagnostics.GetLogResponse, error), logType diagnostics.LogType, requestID int, logParameters diagnostics.LogParameters, props ...func(*diagnostics.GetLogRequest)) error {
+	return cs.GetLogCtx(context.Background(), clientId, callback, logType, requestID, logParameters, props...)
+}
+
+func (cs *csms) GetLogCtx(ctx context.Context, clientId string, callback func(*diagnostics.GetLogResponse, error), logType diagnostics.LogType, requestID int, logParameters diagnostics.LogParameters, props ...func(*diagnostics.GetLogRequest)) error {
 	request := diagnostics.NewGetLogRequest(logType, requestID, logParameters)
 	for _, fn := range props {
 		fn(request)
@@ -340,10 +417,14 @@ func (cs *csms) GetLog(clientId string, callback func(*diagnostics.GetLogRespons
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetMonitoringReport(clientId string, callback func(*diagnostics.GetMonitoringReportResponse, error), props ...func(*diagnostics.GetMonitoringReportRequest)) error {
+	return cs.GetMonitoringReportCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) GetMonitoringReportCtx(ctx context.Context, clientId string, callback func(*diagnostics.GetMonitoringReportResponse, error), props ...func(*diagnostics.GetMonitoringReportRequest)) error {
 	request := diagnostics.NewGetMonitoringReportRequest()
 	for _, fn := range props {
 		fn(request)
@@ -355,10 +436,14 @@ func (cs *csms) GetMonitoringReport(clientId string, callback func(*diagnostics.
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetReport(clientId string, callback func(*provisioning.GetReportResponse, error), props ...func(*provisioning.GetReportRequest)) error {
+	return cs.GetReportCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) GetReportCtx(ctx context.Context, clientId string, callback func(*provisioning.GetReportResponse, error), props ...func(*provisioning.GetReportRequest)) error {
 	request := provisioning.NewGetReportRequest()
 	for _, fn := range props {
 		fn(request)
@@ -370,10 +455,14 @@ func (cs *csms) GetReport(clientId string, callback func(*provisioning.GetReport
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetTransactionStatus(clientId string, callback func(*transactions.GetTransactionStatusResponse, error), props ...func(*transactions.GetTransactionStatusRequest)) error {
+	return cs.GetTransactionStatusCtx(context.Background(), clientId, callback, props...)
+}
+
+func (cs *csms) GetTransactionStatusCtx(ctx context.Context, clientId string, callback func(*transactions.GetTransactionStatusResponse, error), props ...func(*transactions.GetTransactionStatusRequest)) error {
 	request := transactions.NewGetTransactionStatusRequest()
 	for _, fn := range props {
 		fn(request)
@@ -385,10 +474,14 @@ func (cs *csms) GetTransactionStatus(clientId string, callback func(*transaction
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) GetVariables(clientId string, callback func(*provisioning.GetVariablesResponse, error), variableData []provisioning.GetVariableData, props ...func(*provisioning.GetVariablesRequest)) error {
+	return cs.GetVariablesCtx(context.Background(), clientId, callback, variableData, props...)
+}
+
+func (cs *csms) GetVariablesCtx(ctx context.Context, clientId string, callback func(*provisioning.GetVariablesResponse, error), variableData []provisioning.GetVariableData, props ...func(*provisioning.GetVariablesRequest)) error {
 	request := provisioning.NewGetVariablesRequest(variableData)
 	for _, fn := range props {
 		fn(request)
@@ -400,10 +493,14 @@ func (cs *csms) GetVariables(clientId string, callback func(*provisioning.GetVar
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) InstallCertificate(clientId string, callback func(*iso15118.InstallCertificateResponse, error), certificateType types.CertificateUse, certificate string, props ...func(*iso15118.InstallCertificateRequest)) error {
+	return cs.InstallCertificateCtx(context.Background(), clientId, callback, certificateType, certificate, props...)
+}
+
+func (cs *csms) InstallCertificateCtx(ctx context.Context, clientId string, callback func(*iso15118.InstallCertificateResponse, error), certificateType types.CertificateUse, certificate string, props ...func(*iso15118.InstallCertificateRequest)) error {
 	request := iso15118.NewInstallCertificateRequest(certificateType, certificate)
 	for _, fn := range props {
 		fn(request)
@@ -415,10 +512,14 @@ func (cs *csms) InstallCertificate(clientId string, callback func(*iso15118.Inst
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) PublishFirmware(clientId string, callback func(*firmware.PublishFirmwareResponse, error), location string, checksum string, requestID int, props ...func(request *firmware.PublishFirmwareRequest)) error {
+	return cs.PublishFirmwareCtx(context.Background(), clientId, callback, location, checksum, requestID, props...)
+}
+
+func (cs *csms) PublishFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.PublishFirmwareResponse, error), location string, checksum string, requestID int, props ...func(request *firmware.PublishFirmwareRequest)) error {
 	request := firmware.NewPublishFirmwareRequest(location, checksum, requestID)
 	for _, fn := range props {
 		fn(request)
@@ -430,10 +531,14 @@ func (cs *csms) PublishFirmware(clientId string, callback func(*firmware.Publish
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) RequestStartTransaction(clientId string, callback func(*remotecontrol.RequestStartTransactionResponse, error), remoteStartID int, IdToken types.IdToken, props ...func(request *remotecontrol.RequestStartTransactionRequest)) error {
+	return cs.RequestStartTransactionCtx(context.Background(), clientId, callback, remoteStartID, IdToken, props...)
+}
+
+func (cs *csms) RequestStartTransactionCtx(ctx context.Context, clientId string, callback func(*remotecontrol.RequestStartTransactionResponse, error), remoteStartID int, IdToken types.IdToken, props ...func(request *remotecontrol.RequestStartTransactionRequest)) error {
 	request := remotecontrol.NewRequestStartTransactionRequest(remoteStartID, IdToken)
 	for _, fn := range props {
 		fn(request)
@@ -445,10 +550,14 @@ func (cs *csms) RequestStartTransaction(clientId string, callback func(*remoteco
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) RequestStopTransaction(clientId string, callback func(*remotecontrol.RequestStopTransactionResponse, error), transactionID string, props ...func(request *remotecontrol.RequestStopTransactionRequest)) error {
+	return cs.RequestStopTransactionCtx(context.Background(), clientId, callback, transactionID, props...)
+}
+
+func (cs *csms) RequestStopTransactionCtx(ctx context.Context, clientId string, callback func(*remotecontrol.RequestStopTransactionResponse, error), transactionID string, props ...func(request *remotecontrol.RequestStopTransactionRequest)) error {
 	request := remotecontrol.NewRequestStopTransactionRequest(transactionID)
 	for _, fn := range props {
 		fn(request)
@@ -460,10 +569,14 @@ func (cs *csms) RequestStopTransaction(clientId string, callback func(*remotecon
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) ReserveNow(clientId string, callback func(*reservation.ReserveNowResponse, error), id int, expiryDateTime *types.DateTime, idToken types.IdToken, props ...func(request *reservation.ReserveNowRequest)) error {
+	return cs.ReserveNowCtx(context.Background(), clientId, callback, id, expiryDateTime, idToken, props...)
+}
+
+func (cs *csms) ReserveNowCtx(ctx context.Context, clientId string, callback func(*reservation.ReserveNowResponse, error), id int, expiryDateTime *types.DateTime, idToken types.IdToken, props ...func(request *reservation.ReserveNowRequest)) error {
 	request := reservation.NewReserveNowRequest(id, expiryDateTime, idToken)
 	for _, fn := range props {
 		fn(request)
@@ -475,10 +588,14 @@ func (cs *csms) ReserveNow(clientId string, callback func(*reservation.ReserveNo
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) Reset(clientId string, callback func(*provisioning.ResetResponse, error), t provisioning.ResetType, props ...func(request *provisioning.ResetRequest)) error {
+	return cs.ResetCtx(context.Background(), clientId, callback, t, props...)
+}
+
+func (cs *csms) ResetCtx(ctx context.Context, clientId string, callback func(*provisioning.ResetResponse, error), t provisioning.ResetType, props ...func(request *provisioning.ResetRequest)) error {
 	request := provisioning.NewResetRequest(t)
 	for _, fn := range props {
 		fn(request)
@@ -490,10 +607,14 @@ func (cs *csms) Reset(clientId string, callback func(*provisioning.ResetResponse
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SendLocalList(clientId string, callback func(*localauth.SendLocalListResponse, error), version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) error {
+	return cs.SendLocalListCtx(context.Background(), clientId, callback, version, updateType, props...)
+}
+
+func (cs *csms) SendLocalListCtx(ctx context.Context, clientId string, callback func(*localauth.SendLocalListResponse, error), version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) error {
 	request := localauth.NewSendLocalListRequest(version, updateType)
 	for _, fn := range props {
 		fn(request)
@@ -505,10 +626,14 @@ func (cs *csms) SendLocalList(clientId string, callback func(*localauth.SendLoca
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetChargingProfile(clientId string, callback func(*smartcharging.SetChargingProfileResponse, error), evseID int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) error {
+	return cs.SetChargingProfileCtx(context.Background(), clientId, callback, evseID, chargingProfile, props...)
+}
+
+func (cs *csms) SetChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.SetChargingProfileResponse, error), evseID int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) error {
 	request := smartcharging.NewSetChargingProfileRequest(evseID, chargingProfile)
 	for _, fn := range props {
 		fn(request)
@@ -520,10 +645,14 @@ func (cs *csms) SetChargingProfile(clientId string, callback func(*smartcharging
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetDisplayMessage(clientId string, callback func(*display.SetDisplayMessageResponse, error), message display.MessageInfo, props ...func(request *display.SetDisplayMessageRequest)) error {
+	return cs.SetDisplayMessageCtx(context.Background(), clientId, callback, message, props...)
+}
+
+func (cs *csms) SetDisplayMessageCtx(ctx context.Context, clientId string, callback func(*display.SetDisplayMessageResponse, error), message display.MessageInfo, props ...func(request *display.SetDisplayMessageRequest)) error {
 	request := display.NewSetDisplayMessageRequest(message)
 	for _, fn := range props {
 		fn(request)
@@ -535,10 +664,14 @@ func (cs *csms) SetDisplayMessage(clientId string, callback func(*display.SetDis
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetMonitoringBase(clientId string, callback func(*diagnostics.SetMonitoringBaseResponse, error), monitoringBase diagnostics.MonitoringBase, props ...func(request *diagnostics.SetMonitoringBaseRequest)) error {
+	return cs.SetMonitoringBaseCtx(context.Background(), clientId, callback, monitoringBase, props...)
+}
+
+func (cs *csms) SetMonitoringBaseCtx(ctx context.Context, clientId string, callback func(*diagnostics.SetMonitoringBaseResponse, error), monitoringBase diagnostics.MonitoringBase, props ...func(request *diagnostics.SetMonitoringBaseRequest)) error {
 	request := diagnostics.NewSetMonitoringBaseRequest(monitoringBase)
 	for _, fn := range props {
 		fn(request)
@@ -550,10 +683,14 @@ func (cs *csms) SetMonitoringBase(clientId string, callback func(*diagnostics.Se
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetMonitoringLevel(clientId string, callback func(*diagnostics.SetMonitoringLevelResponse, error), severity int, props ...func(request *diagnostics.SetMonitoringLevelRequest)) error {
+	return cs.SetMonitoringLevelCtx(context.Background(), clientId, callback, severity, props...)
+}
+
+func (cs *csms) SetMonitoringLevelCtx(ctx context.Context, clientId string, callback func(*diagnostics.SetMonitoringLevelResponse, error), severity int, props ...func(request *diagnostics.SetMonitoringLevelRequest)) error {
 	request := diagnostics.NewSetMonitoringLevelRequest(severity)
 	for _, fn := range props {
 		fn(request)
@@ -565,10 +702,14 @@ func (cs *csms) SetMonitoringLevel(clientId string, callback func(*diagnostics.S
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetNetworkProfile(clientId string, callback func(*provisioning.SetNetworkProfileResponse, error), configurationSlot int, connectionData provisioning.NetworkConnectionProfile, props ...func(request *provisioning.SetNetworkProfileRequest)) error {
+	return cs.SetNetworkProfileCtx(context.Background(), clientId, callback, configurationSlot, connectionData, props...)
+}
+
+func (cs *csms) SetNetworkProfileCtx(ctx context.Context, clientId string, callback func(*provisioning.SetNetworkProfileResponse, error), configurationSlot int, connectionData provisioning.NetworkConnectionProfile, props ...func(request *provisioning.SetNetworkProfileRequest)) error {
 	request := provisioning.NewSetNetworkProfileRequest(configurationSlot, connectionData)
 	for _, fn := range props {
 		fn(request)
@@ -580,10 +721,14 @@ func (cs *csms) SetNetworkProfile(clientId string, callback func(*provisioning.S
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetVariableMonitoring(clientId string, callback func(*diagnostics.SetVariableMonitoringResponse, error), data []diagnostics.SetMonitoringData, props ...func(request *diagnostics.SetVariableMonitoringRequest)) error {
+	return cs.SetVariableMonitoringCtx(context.Background(), clientId, callback, data, props...)
+}
+
+func (cs *csms) SetVariableMonitoringCtx(ctx context.Context, clientId string, callback func(*diagnostics.SetVariableMonitoringResponse, error), data []diagnostics.SetMonitoringData, props ...func(request *diagnostics.SetVariableMonitoringRequest)) error {
 	request := diagnostics.NewSetVariableMonitoringRequest(data)
 	for _, fn := range props {
 		fn(request)
@@ -595,10 +740,14 @@ func (cs *csms) SetVariableMonitoring(clientId string, callback func(*diagnostic
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetVariables(clientId string, callback func(*provisioning.SetVariablesResponse, error), data []provisioning.SetVariableData, props ...func(request *provisioning.SetVariablesRequest)) error {
+	return cs.SetVariablesCtx(context.Background(), clientId, callback, data, props...)
+}
+
+func (cs *csms) SetVariablesCtx(ctx context.Context, clientId string, callback func(*provisioning.SetVariablesResponse, error), data []provisioning.SetVariableData, props ...func(request *provisioning.SetVariablesRequest)) error {
 	request := provisioning.NewSetVariablesRequest(data)
 	for _, fn := range props {
 		fn(request)
@@ -610,10 +759,14 @@ func (cs *csms) SetVariables(clientId string, callback func(*provisioning.SetVar
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) TriggerMessage(clientId string, callback func(*remotecontrol.TriggerMessageResponse, error), requestedMessage remotecontrol.MessageTrigger, props ...func(request *remotecontrol.TriggerMessageRequest)) error {
+	return cs.TriggerMessageCtx(context.Background(), clientId, callback, requestedMessage, props...)
+}
+
+func (cs *csms) TriggerMessageCtx(ctx context.Context, clientId string, callback func(*remotecontrol.TriggerMessageResponse, error), requestedMessage remotecontrol.MessageTrigger, props ...func(request *remotecontrol.TriggerMessageRequest)) error {
 	request := remotecontrol.NewTriggerMessageRequest(requestedMessage)
 	for _, fn := range props {
 		fn(request)
@@ -625,10 +778,14 @@ func (cs *csms) TriggerMessage(clientId string, callback func(*remotecontrol.Tri
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) UnlockConnector(clientId string, callback func(*remotecontrol.UnlockConnectorResponse, error), evseID int, connectorID int, props ...func(request *remotecontrol.UnlockConnectorRequest)) error {
+	return cs.UnlockConnectorCtx(context.Background(), clientId, callback, evseID, connectorID, props...)
+}
+
+func (cs *csms) UnlockConnectorCtx(ctx context.Context, clientId string, callback func(*remotecontrol.UnlockConnectorResponse, error), evseID int, connectorID int, props ...func(request *remotecontrol.UnlockConnectorRequest)) error {
 	request := remotecontrol.NewUnlockConnectorRequest(evseID, connectorID)
 	for _, fn := range props {
 		fn(request)
@@ -640,10 +797,14 @@ func (cs *csms) UnlockConnector(clientId string, callback func(*remotecontrol.Un
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) UnpublishFirmware(clientId string, callback func(*firmware.UnpublishFirmwareResponse, error), checksum string, props ...func(request *firmware.UnpublishFirmwareRequest)) error {
+	return cs.UnpublishFirmwareCtx(context.Background(), clientId, callback, checksum, props...)
+}
+
+func (cs *csms) UnpublishFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.UnpublishFirmwareResponse, error), checksum string, props ...func(request *firmware.UnpublishFirmwareRequest)) error {
 	request := firmware.NewUnpublishFirmwareRequest(checksum)
 	for _, fn := range props {
 		fn(request)
@@ -655,10 +816,14 @@ func (cs *csms) UnpublishFirmware(clientId string, callback func(*firmware.Unpub
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) UpdateFirmware(clientId string, callback func(*firmware.UpdateFirmwareResponse, error), requestID int, f firmware.Firmware, props ...func(request *firmware.UpdateFirmwareRequest)) error {
+	return cs.UpdateFirmwareCtx(context.Background(), clientId, callback, requestID, f, props...)
+}
+
+func (cs *csms) UpdateFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.UpdateFirmwareResponse, error), requestID int, f firmware.Firmware, props ...func(request *firmware.UpdateFirmwareRequest)) error {
 	request := firmware.NewUpdateFirmwareRequest(requestID, f)
 	for _, fn := range props {
 		fn(request)
@@ -670,7 +835,7 @@ func (cs *csms) UpdateFirmware(clientId string, callback func(*firmware.UpdateFi
 			callback(nil, protoError)
 		}
 	}
-	return cs.SendRequestAsync(clientId, request, genericCallback)
+	return cs.SendRequestAsyncCtx(ctx, clientId, request, genericCallback)
 }
 
 func (cs *csms) SetSecurityHandler(handler security.CSMSHandler) {
@@ -758,6 +923,10 @@ func (cs *csms) SetChargingStationDisconnectedHandler(handler ChargingStationCon
 }
 
 func (cs *csms) SendRequestAsync(clientId string, request ocpp.Request, callback func(response ocpp.Response, err error)) error {
+	return cs.SendRequestAsyncCtx(context.Background(), clientId, request, callback)
+}
+
+func (cs *csms) SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(response ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cs.server.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on CSMS (missing profile), cannot send request", featureName)
@@ -808,8 +977,8 @@ func (cs *csms) SendRequestAsync(clientId string, request ocpp.Request, callback
 		return fmt.Errorf("unsupported action %v on CSMS, cannot send request", featureName)
 	}
 
-	send := func() error {
-		return cs.server.SendRequest(clientId, request)
+	send := func() (string, error) {
+		return cs.server.SendRequestCtx(ctx, clientId, request)
 	}
 	return cs.callbackQueue.TryQueue(clientId, send, callback)
 }
@@ -819,10 +988,26 @@ func (cs *csms) Start(listenPort int, listenPath string) {
 	cs.server.Start(listenPort, listenPath)
 }
 
+func (cs *csms) Serve(listener net.Listener) {
+	cs.server.Serve(listener)
+}
+
+func (cs *csms) Handler() http.Handler {
+	return cs.server.Handler()
+}
+
 func (cs *csms) Stop() {
 	cs.server.Stop()
 }
 
+func (cs *csms) Shutdown(ctx context.Context) error {
+	return cs.server.Shutdown(ctx)
+}
+
+func (cs *csms) ConnectionInfo() map[string]ocppj.ConnectionInfo {
+	return cs.server.ConnectionInfo()
+}
+
 func (cs *csms) sendResponse(chargingStationID string, response ocpp.Response, err error, requestId string) {
 	if err != nil {
 		// Send error response
@@ -1037,8 +1222,9 @@ func (cs *csms) handleIncomingError(chargingStation ChargingStationConnection, e
 	}
 }
 
-func (cs *csms) handleCanceledRequest(chargePointID string, request ocpp.Request, err *ocpp.Error) {
-	if callback, ok := cs.callbackQueue.Dequeue(chargePointID); ok {
+func (cs *csms) handleCanceledRequest(chargePointID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+	// The canceled request may not be at the front of the queue (e.g. if its context was canceled)
+	if callback, ok := cs.callbackQueue.DequeueRequest(chargePointID, requestID); ok {
 		// Execute in separate goroutine, so the caller goroutine is available
 		go callback(nil, err)
 	} else {
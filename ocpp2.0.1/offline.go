@@ -0,0 +1,31 @@
+package ocpp2
+
+import (
+	"fmt"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/meter"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/transactions"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// NewOfflinePolicy creates an offline policy for OCPP 2.0.1 charging stations, which may be passed to
+// ocppj.DefaultClientDispatcher.SetOfflinePolicy.
+//
+// While the charging station is offline:
+//   - TransactionEvent and MeterValues requests are kept
+//   - StatusNotification requests are coalesced per EVSE and connector, so only the latest status is sent
+//   - Heartbeat requests are dropped, since they are stale by the time the charging station reconnects
+//
+// All other requests are kept. The returned policy may be customized further.
+func NewOfflinePolicy() *ocppj.OfflinePolicy {
+	policy := ocppj.NewOfflinePolicy(ocppj.OfflineKeep)
+	policy.Keep(transactions.TransactionEventFeatureName, meter.MeterValuesFeatureName)
+	policy.Drop(availability.HeartbeatFeatureName)
+	policy.Coalesce(availability.StatusNotificationFeatureName, func(request ocpp.Request) string {
+		r := request.(*availability.StatusNotificationRequest)
+		return fmt.Sprintf("%v/%v", r.EvseID, r.ConnectorID)
+	})
+	return policy
+}
@@ -0,0 +1,21 @@
+package ocpp2
+
+import (
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/transactions"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// TransactionMessageFeatures contains the transaction-related messages, to which the MessageAttemptsTransactionEvent
+// and MessageAttemptIntervalTransactionEvent configuration variables apply.
+var TransactionMessageFeatures = []string{transactions.TransactionEventFeatureName}
+
+// SetTransactionRetryPolicy configures the dispatcher of a charging station to retransmit TransactionEvent messages,
+// if they couldn't be delivered or the CSMS failed to process them.
+//
+// The attempts and retryInterval parameters correspond to the MessageAttemptsTransactionEvent and
+// MessageAttemptIntervalTransactionEvent configuration variables.
+func SetTransactionRetryPolicy(dispatcher *ocppj.DefaultClientDispatcher, attempts int, retryInterval time.Duration) {
+	dispatcher.SetRetryPolicy(ocppj.NewRetryPolicy(attempts, retryInterval), TransactionMessageFeatures...)
+}
@@ -2,8 +2,10 @@
 package ocpp2
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
+	"net/http"
 
 	"github.com/lorenzodonini/ocpp-go/internal/callbackqueue"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
@@ -28,6 +30,8 @@ import (
 	"github.com/lorenzodonini/ocpp-go/ws"
 )
 
+// Further details of a connection, e.g. the verified client identity or the tenant,
+// are available via the optional interfaces of the ws package (see ws.IdentityChannel and ws.TenantChannel).
 type ChargingStationConnection interface {
 	ID() string
 	RemoteAddr() net.Addr
@@ -113,6 +117,7 @@ type ChargingStation interface {
 	StatusNotification(timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error)
 	// Sends information to the CSMS about a transaction, used for billing purposes.
 	TransactionEvent(t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error)
+
 	// Registers a handler for incoming security profile messages
 	SetSecurityHandler(handler security.ChargingStationHandler)
 	// Registers a handler for incoming provisioning profile messages
@@ -183,6 +188,49 @@ type ChargingStation interface {
 	Errors() <-chan error
 }
 
+// ChargingStationCtx extends a ChargingStation with context-aware variants of its methods.
+// Once ctx is done, a request that is still queued is removed from the outgoing queue,
+// while a request that was already sent is treated as timed out.
+// In both cases, an error is returned to the caller.
+//
+// The charging station returned by NewChargingStation implements this interface:
+//
+//	chargingStation := ocpp2.NewChargingStation("cs1", nil, nil).(ocpp2.ChargingStationCtx)
+type ChargingStationCtx interface {
+	ChargingStation
+	BootNotificationCtx(ctx context.Context, reason provisioning.BootReason, model string, chargePointVendor string, props ...func(request *provisioning.BootNotificationRequest)) (*provisioning.BootNotificationResponse, error)
+	AuthorizeCtx(ctx context.Context, idToken string, tokenType types.IdTokenType, props ...func(request *authorization.AuthorizeRequest)) (*authorization.AuthorizeResponse, error)
+	ClearedChargingLimitCtx(ctx context.Context, chargingLimitSource types.ChargingLimitSourceType, props ...func(request *smartcharging.ClearedChargingLimitRequest)) (*smartcharging.ClearedChargingLimitResponse, error)
+	DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error)
+	FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationResponse, error)
+	Get15118EVCertificateCtx(ctx context.Context, schemaVersion string, action iso15118.CertificateAction, exiRequest string, props ...func(request *iso15118.Get15118EVCertificateRequest)) (*iso15118.Get15118EVCertificateResponse, error)
+	GetCertificateStatusCtx(ctx context.Context, ocspRequestData types.OCSPRequestDataType, props ...func(request *iso15118.GetCertificateStatusRequest)) (*iso15118.GetCertificateStatusResponse, error)
+	HeartbeatCtx(ctx context.Context, props ...func(request *availability.HeartbeatRequest)) (*availability.HeartbeatResponse, error)
+	LogStatusNotificationCtx(ctx context.Context, status diagnostics.UploadLogStatus, requestID int, props ...func(request *diagnostics.LogStatusNotificationRequest)) (*diagnostics.LogStatusNotificationResponse, error)
+	MeterValuesCtx(ctx context.Context, evseID int, meterValues []types.MeterValue, props ...func(request *meter.MeterValuesRequest)) (*meter.MeterValuesResponse, error)
+	NotifyChargingLimitCtx(ctx context.Context, chargingLimit smartcharging.ChargingLimit, props ...func(request *smartcharging.NotifyChargingLimitRequest)) (*smartcharging.NotifyChargingLimitResponse, error)
+	NotifyCustomerInformationCtx(ctx context.Context, data string, seqNo int, generatedAt types.DateTime, requestID int, props ...func(request *diagnostics.NotifyCustomerInformationRequest)) (*diagnostics.NotifyCustomerInformationResponse, error)
+	NotifyDisplayMessagesCtx(ctx context.Context, requestID int, props ...func(request *display.NotifyDisplayMessagesRequest)) (*display.NotifyDisplayMessagesResponse, error)
+	NotifyEVChargingNeedsCtx(ctx context.Context, evseID int, chargingNeeds smartcharging.ChargingNeeds, props ...func(request *smartcharging.NotifyEVChargingNeedsRequest)) (*smartcharging.NotifyEVChargingNeedsResponse, error)
+	NotifyEVChargingScheduleCtx(ctx context.Context, timeBase *types.DateTime, evseID int, schedule types.ChargingSchedule, props ...func(request *smartcharging.NotifyEVChargingScheduleRequest)) (*smartcharging.NotifyEVChargingScheduleResponse, error)
+	NotifyEventCtx(ctx context.Context, generatedAt *types.DateTime, seqNo int, eventData []diagnostics.EventData, props ...func(request *diagnostics.NotifyEventRequest)) (*diagnostics.NotifyEventResponse, error)
+	NotifyMonitoringReportCtx(ctx context.Context, requestID int, seqNo int, generatedAt *types.DateTime, monitorData []diagnostics.MonitoringData, props ...func(request *diagnostics.NotifyMonitoringReportRequest)) (*diagnostics.NotifyMonitoringReportResponse, error)
+	NotifyReportCtx(ctx context.Context, requestID int, generatedAt *types.DateTime, seqNo int, props ...func(request *provisioning.NotifyReportRequest)) (*provisioning.NotifyReportResponse, error)
+	PublishFirmwareStatusNotificationCtx(ctx context.Context, status firmware.PublishFirmwareStatus, props ...func(request *firmware.PublishFirmwareStatusNotificationRequest)) (*firmware.PublishFirmwareStatusNotificationResponse, error)
+	ReportChargingProfilesCtx(ctx context.Context, requestID int, chargingLimitSource types.ChargingLimitSourceType, evseID int, chargingProfile []types.ChargingProfile, props ...func(request *smartcharging.ReportChargingProfilesRequest)) (*smartcharging.ReportChargingProfilesResponse, error)
+	ReservationStatusUpdateCtx(ctx context.Context, reservationID int, status reservation.ReservationUpdateStatus, props ...func(request *reservation.ReservationStatusUpdateRequest)) (*reservation.ReservationStatusUpdateResponse, error)
+	SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error)
+	SignCertificateCtx(ctx context.Context, csr string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error)
+	StatusNotificationCtx(ctx context.Context, timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error)
+	TransactionEventCtx(ctx context.Context, t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error)
+	// Same as SendRequest, but returns as soon as the passed context is done.
+	// If the request wasn't sent yet, it is removed from the outgoing queue.
+	SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error)
+	// Same as SendRequestAsync, but the request is canceled once the passed context is done.
+	// The callback is then invoked with an error.
+	SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(confirmation ocpp.Response, protoError error)) error
+}
+
 // Creates a new OCPP 2.0 charging station client.
 // The id parameter is required to uniquely identify the charge point.
 //
@@ -229,6 +277,7 @@ func NewChargingStation(id string, endpoint *ocppj.Client, client ws.WsClient) C
 
 	// Callback invoked by dispatcher, whenever a queued request is canceled, due to timeout.
 	endpoint.SetOnRequestCanceled(cs.onRequestTimeout)
+	endpoint.SetOnRequestRestored(cs.onRequestRestored)
 
 	cs.client.SetResponseHandler(func(confirmation ocpp.Response, requestId string) {
 		cs.responseHandler <- confirmation
@@ -397,12 +446,88 @@ type CSMS interface {
 
 	// The function blocks forever, so it is suggested to wrap it in a goroutine, in case other functionality needs to be executed on the main program thread.
 	Start(listenPort int, listenPath string)
+	// Starts running the CSMS on a caller-provided listener, e.g. a unix socket.
+	// All incoming requests are treated as charging station connections, the charging station ID being the final element of the URL path.
+	//
+	// The function blocks forever, so it is suggested to wrap it in a goroutine.
+	Serve(listener net.Listener)
+	// Starts the CSMS without listening for incoming connections, and returns an http.Handler instead.
+	// The handler may be mounted on an existing router, e.g. to share a port with other HTTP APIs:
+	//
+	//	router.Handle("/ocpp/{id}", server.Handler())
+	//
+	// The final element of the URL path is used as charging station ID.
+	Handler() http.Handler
 	// Stops the CSMS, clearing all pending requests.
 	Stop()
+	// Gracefully shuts down the CSMS: new connections and outgoing requests are refused,
+	// while pending requests are completed. Connections are then closed with a CloseGoingAway code,
+	// so charging stations may reconnect to another CSMS instance.
+	//
+	// If the context is done before, remaining connections are forcefully closed and the context error is returned.
+	Shutdown(ctx context.Context) error
+	// ConnectionInfo returns health information about all currently connected charging stations, mapped by charging station ID.
+	// This includes connection statistics (see ws.ConnectionStats) and the amount of pending requests.
+	ConnectionInfo() map[string]ocppj.ConnectionInfo
 	// Errors returns a channel for error messages. If it doesn't exist it es created.
 	Errors() <-chan error
 }
 
+// CSMSCtx extends a CSMS with context-aware variants of its methods.
+// Once ctx is done, a request that is still queued is removed from the outgoing queue,
+// while a request that was already sent is treated as timed out.
+// In both cases, an error is returned to the caller.
+//
+// The CSMS returned by NewCSMS implements this interface:
+//
+//	csms := ocpp2.NewCSMS(nil, nil).(ocpp2.CSMSCtx)
+type CSMSCtx interface {
+	CSMS
+	CancelReservationCtx(ctx context.Context, clientId string, callback func(*reservation.CancelReservationResponse, error), reservationId int, props ...func(*reservation.CancelReservationRequest)) error
+	CertificateSignedCtx(ctx context.Context, clientId string, callback func(*security.CertificateSignedResponse, error), CertificateSigned string, props ...func(*security.CertificateSignedRequest)) error
+	ChangeAvailabilityCtx(ctx context.Context, clientId string, callback func(*availability.ChangeAvailabilityResponse, error), operationalStatus availability.OperationalStatus, props ...func(*availability.ChangeAvailabilityRequest)) error
+	ClearCacheCtx(ctx context.Context, clientId string, callback func(*authorization.ClearCacheResponse, error), props ...func(*authorization.ClearCacheRequest)) error
+	ClearChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.ClearChargingProfileResponse, error), props ...func(request *smartcharging.ClearChargingProfileRequest)) error
+	ClearDisplayCtx(ctx context.Context, clientId string, callback func(*display.ClearDisplayResponse, error), id int, props ...func(*display.ClearDisplayRequest)) error
+	ClearVariableMonitoringCtx(ctx context.Context, clientId string, callback func(*diagnostics.ClearVariableMonitoringResponse, error), id []int, props ...func(*diagnostics.ClearVariableMonitoringRequest)) error
+	CostUpdatedCtx(ctx context.Context, clientId string, callback func(*tariffcost.CostUpdatedResponse, error), totalCost float64, transactionId string, props ...func(*tariffcost.CostUpdatedRequest)) error
+	CustomerInformationCtx(ctx context.Context, clientId string, callback func(*diagnostics.CustomerInformationResponse, error), requestId int, report bool, clear bool, props ...func(*diagnostics.CustomerInformationRequest)) error
+	DataTransferCtx(ctx context.Context, clientId string, callback func(*data.DataTransferResponse, error), vendorId string, props ...func(*data.DataTransferRequest)) error
+	DeleteCertificateCtx(ctx context.Context, clientId string, callback func(*iso15118.DeleteCertificateResponse, error), data types.CertificateHashData, props ...func(*iso15118.DeleteCertificateRequest)) error
+	GetBaseReportCtx(ctx context.Context, clientId string, callback func(*provisioning.GetBaseReportResponse, error), requestId int, reportBase provisioning.ReportBaseType, props ...func(*provisioning.GetBaseReportRequest)) error
+	GetChargingProfilesCtx(ctx context.Context, clientId string, callback func(*smartcharging.GetChargingProfilesResponse, error), chargingProfile smartcharging.ChargingProfileCriterion, props ...func(*smartcharging.GetChargingProfilesRequest)) error
+	GetCompositeScheduleCtx(ctx context.Context, clientId string, callback func(*smartcharging.GetCompositeScheduleResponse, error), duration int, evseId int, props ...func(*smartcharging.GetCompositeScheduleRequest)) error
+	GetDisplayMessagesCtx(ctx context.Context, clientId string, callback func(*display.GetDisplayMessagesResponse, error), requestId int, props ...func(*display.GetDisplayMessagesRequest)) error
+	GetInstalledCertificateIdsCtx(ctx context.Context, clientId string, callback func(*iso15118.GetInstalledCertificateIdsResponse, error), props ...func(*iso15118.GetInstalledCertificateIdsRequest)) error
+	GetLocalListVersionCtx(ctx context.Context, clientId string, callback func(*localauth.GetLocalListVersionResponse, error), props ...func(*localauth.GetLocalListVersionRequest)) error
+	GetLogCtx(ctx context.Context, clientId string, callback func(*diagnostics.GetLogResponse, error), logType diagnostics.LogType, requestID int, logParameters diagnostics.LogParameters, props ...func(*diagnostics.GetLogRequest)) error
+	GetMonitoringReportCtx(ctx context.Context, clientId string, callback func(*diagnostics.GetMonitoringReportResponse, error), props ...func(*diagnostics.GetMonitoringReportRequest)) error
+	GetReportCtx(ctx context.Context, clientId string, callback func(*provisioning.GetReportResponse, error), props ...func(*provisioning.GetReportRequest)) error
+	GetTransactionStatusCtx(ctx context.Context, clientId string, callback func(*transactions.GetTransactionStatusResponse, error), props ...func(*transactions.GetTransactionStatusRequest)) error
+	GetVariablesCtx(ctx context.Context, clientId string, callback func(*provisioning.GetVariablesResponse, error), variableData []provisioning.GetVariableData, props ...func(*provisioning.GetVariablesRequest)) error
+	InstallCertificateCtx(ctx context.Context, clientId string, callback func(*iso15118.InstallCertificateResponse, error), certificateType types.CertificateUse, certificate string, props ...func(*iso15118.InstallCertificateRequest)) error
+	PublishFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.PublishFirmwareResponse, error), location string, checksum string, requestID int, props ...func(request *firmware.PublishFirmwareRequest)) error
+	RequestStartTransactionCtx(ctx context.Context, clientId string, callback func(*remotecontrol.RequestStartTransactionResponse, error), remoteStartID int, IdToken types.IdToken, props ...func(request *remotecontrol.RequestStartTransactionRequest)) error
+	RequestStopTransactionCtx(ctx context.Context, clientId string, callback func(*remotecontrol.RequestStopTransactionResponse, error), transactionID string, props ...func(request *remotecontrol.RequestStopTransactionRequest)) error
+	ReserveNowCtx(ctx context.Context, clientId string, callback func(*reservation.ReserveNowResponse, error), id int, expiryDateTime *types.DateTime, idToken types.IdToken, props ...func(request *reservation.ReserveNowRequest)) error
+	ResetCtx(ctx context.Context, clientId string, callback func(*provisioning.ResetResponse, error), t provisioning.ResetType, props ...func(request *provisioning.ResetRequest)) error
+	SendLocalListCtx(ctx context.Context, clientId string, callback func(*localauth.SendLocalListResponse, error), version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) error
+	SetChargingProfileCtx(ctx context.Context, clientId string, callback func(*smartcharging.SetChargingProfileResponse, error), evseID int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) error
+	SetDisplayMessageCtx(ctx context.Context, clientId string, callback func(*display.SetDisplayMessageResponse, error), message display.MessageInfo, props ...func(request *display.SetDisplayMessageRequest)) error
+	SetMonitoringBaseCtx(ctx context.Context, clientId string, callback func(*diagnostics.SetMonitoringBaseResponse, error), monitoringBase diagnostics.MonitoringBase, props ...func(request *diagnostics.SetMonitoringBaseRequest)) error
+	SetMonitoringLevelCtx(ctx context.Context, clientId string, callback func(*diagnostics.SetMonitoringLevelResponse, error), severity int, props ...func(request *diagnostics.SetMonitoringLevelRequest)) error
+	SetNetworkProfileCtx(ctx context.Context, clientId string, callback func(*provisioning.SetNetworkProfileResponse, error), configurationSlot int, connectionData provisioning.NetworkConnectionProfile, props ...func(request *provisioning.SetNetworkProfileRequest)) error
+	SetVariableMonitoringCtx(ctx context.Context, clientId string, callback func(*diagnostics.SetVariableMonitoringResponse, error), data []diagnostics.SetMonitoringData, props ...func(request *diagnostics.SetVariableMonitoringRequest)) error
+	SetVariablesCtx(ctx context.Context, clientId string, callback func(*provisioning.SetVariablesResponse, error), data []provisioning.SetVariableData, props ...func(request *provisioning.SetVariablesRequest)) error
+	TriggerMessageCtx(ctx context.Context, clientId string, callback func(*remotecontrol.TriggerMessageResponse, error), requestedMessage remotecontrol.MessageTrigger, props ...func(request *remotecontrol.TriggerMessageRequest)) error
+	UnlockConnectorCtx(ctx context.Context, clientId string, callback func(*remotecontrol.UnlockConnectorResponse, error), evseID int, connectorID int, props ...func(request *remotecontrol.UnlockConnectorRequest)) error
+	UnpublishFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.UnpublishFirmwareResponse, error), checksum string, props ...func(request *firmware.UnpublishFirmwareRequest)) error
+	UpdateFirmwareCtx(ctx context.Context, clientId string, callback func(*firmware.UpdateFirmwareResponse, error), requestID int, firmware firmware.Firmware, props ...func(request *firmware.UpdateFirmwareRequest)) error
+	// Same as SendRequestAsync, but the request is canceled once the passed context is done.
+	// The callback is then invoked with an error.
+	SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(ocpp.Response, error)) error
+}
+
 // Creates a new OCPP 2.0 CSMS.
 //
 // The endpoint and client parameters may be omitted, in order to use a default configuration:
@@ -451,7 +576,7 @@ func NewCSMS(endpoint *ocppj.Server, server ws.WsServer) CSMS {
 		cs.handleIncomingError(client, err, details)
 	})
 	cs.server.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
-		cs.handleCanceledRequest(clientID, request, err)
+		cs.handleCanceledRequest(clientID, requestID, request, err)
 	})
 	return &cs
 }
@@ -0,0 +1,116 @@
+//go:build go1.18
+// +build go1.18
+
+package ocpp2_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/authorization"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/data"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/diagnostics"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/display"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/iso15118"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/meter"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/provisioning"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/remotecontrol"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/reservation"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/security"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/smartcharging"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/tariffcost"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/transactions"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+var fuzzProfiles = []*ocpp.Profile{
+	authorization.Profile,
+	availability.Profile,
+	data.Profile,
+	diagnostics.Profile,
+	display.Profile,
+	firmware.Profile,
+	iso15118.Profile,
+	localauth.Profile,
+	meter.Profile,
+	provisioning.Profile,
+	remotecontrol.Profile,
+	reservation.Profile,
+	security.Profile,
+	smartcharging.Profile,
+	tariffcost.Profile,
+	transactions.Profile,
+}
+
+// Returns the features of all profiles, sorted by name, so that fuzz inputs always refer to the same feature.
+func fuzzFeatures() []ocpp.Feature {
+	var features []ocpp.Feature
+	for _, profile := range fuzzProfiles {
+		for _, feature := range profile.Features {
+			features = append(features, feature)
+		}
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].GetFeatureName() < features[j].GetFeatureName()
+	})
+	return features
+}
+
+// Fuzzes the JSON decoding and validation of every request and response type.
+// The payload is wrapped in a Call or CallResult message, for the feature at index, and parsed like an incoming message.
+func FuzzFeatures(f *testing.F) {
+	features := fuzzFeatures()
+	for i, feature := range features {
+		request, _ := json.Marshal(reflect.New(feature.GetRequestType()).Interface())
+		response, _ := json.Marshal(reflect.New(feature.GetResponseType()).Interface())
+		f.Add(uint16(i), false, []byte("{}"))
+		f.Add(uint16(i), false, request)
+		f.Add(uint16(i), true, []byte("{}"))
+		f.Add(uint16(i), true, response)
+	}
+	f.Fuzz(func(t *testing.T, index uint16, isResponse bool, payload []byte) {
+		feature := features[int(index)%len(features)]
+		endpoint := ocppj.Endpoint{}
+		for _, profile := range fuzzProfiles {
+			endpoint.AddProfile(profile)
+		}
+		endpoint.SetDialect(ocpp.V2)
+		state := ocppj.NewClientState()
+		var data string
+		if isResponse {
+			request := reflect.New(feature.GetRequestType()).Interface().(ocpp.Request)
+			state.AddPendingRequest("1234", request)
+			data = fmt.Sprintf(`[3,"1234",%s]`, payload)
+		} else {
+			data = fmt.Sprintf(`[2,"1234","%s",%s]`, feature.GetFeatureName(), payload)
+		}
+		parsedJson, err := ocppj.ParseRawJsonMessage([]byte(data))
+		if err != nil {
+			return
+		}
+		message, err := endpoint.ParseMessage(parsedJson, state)
+		if err != nil {
+			_, ok := err.(*ocpp.Error)
+			require.True(t, ok, "unexpected error type %T", err)
+			return
+		}
+		require.NotNil(t, message)
+		if isResponse {
+			require.IsType(t, &ocppj.CallResult{}, message)
+			assert.Equal(t, feature.GetResponseType(), reflect.TypeOf(message.(*ocppj.CallResult).Payload).Elem())
+		} else {
+			require.IsType(t, &ocppj.Call{}, message)
+			assert.Equal(t, feature.GetRequestType(), reflect.TypeOf(message.(*ocppj.Call).Payload).Elem())
+		}
+	})
+}
@@ -1,9 +1,13 @@
 package ocppj_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,6 +15,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/lorenzodonini/ocpp-go/metrics"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/lorenzodonini/ocpp-go/ocppj"
 	"github.com/lorenzodonini/ocpp-go/ws"
@@ -27,6 +32,27 @@ func (suite *OcppJTestSuite) TestServerStart() {
 	assert.True(suite.T(), suite.serverDispatcher.IsRunning())
 }
 
+func (suite *OcppJTestSuite) TestServerHandlerNotSupported() {
+	// The mocked websocket server cannot be used as HTTP handler or on a custom listener
+	assert.Nil(suite.T(), suite.centralSystem.Handler())
+	suite.centralSystem.Serve(nil)
+	assert.False(suite.T(), suite.serverDispatcher.IsRunning())
+}
+
+func (suite *OcppJTestSuite) TestServerHandler() {
+	t := suite.T()
+	wsServer := ws.NewServer()
+	server := ocppj.NewServer(wsServer, nil, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	handler := server.Handler()
+	require.NotNil(t, handler)
+	assert.Same(t, wsServer, handler)
+	// Server is ready for sending requests
+	err := server.SendRequest("1234", newMockRequest("someValue"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no client 1234 exists")
+	server.Stop()
+}
+
 func (suite *OcppJTestSuite) TestServerNotStartedError() {
 	t := suite.T()
 	mockChargePointId := "1234"
@@ -405,6 +431,73 @@ func (suite *OcppJTestSuite) TestCentralSystemNewClientHandler() {
 	assert.True(t, ok)
 }
 
+func (suite *OcppJTestSuite) TestCentralSystemReplacedClientRequestInFlight() {
+	t := suite.T()
+	mockClientID := "1234"
+	writeC := make(chan string, 2)
+	canceledC := make(chan string, 1)
+	suite.centralSystem.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		assert.Equal(t, mockClientID, clientID)
+		assert.Equal(t, "request1", request.(*MockRequest).MockValue)
+		canceledC <- requestID
+	})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockClientID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(1).([]byte))
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(NewMockWebSocket(mockClientID))
+	err := suite.centralSystem.SendRequest(mockClientID, newMockRequest("request1"))
+	require.NoError(t, err)
+	err = suite.centralSystem.SendRequest(mockClientID, newMockRequest("request2"))
+	require.NoError(t, err)
+	// The first request is in flight on the existing connection
+	call := ParseCall(&suite.centralSystem.Endpoint, suite.centralSystem.RequestState.GetClientState(mockClientID), <-writeC, t)
+	require.NotNil(t, call)
+	// A new connection replaces the existing one, without a disconnection
+	suite.mockServer.NewClientHandler(NewMockWebSocket(mockClientID))
+	// The request in flight is canceled, since its response was lost with the replaced connection
+	select {
+	case requestID := <-canceledC:
+		assert.Equal(t, call.UniqueId, requestID)
+	case <-time.After(time.Second):
+		t.Fatal("request in flight wasn't canceled")
+	}
+	// Queued requests are retained and sent via the new connection
+	select {
+	case data := <-writeC:
+		assert.Contains(t, data, "request2")
+	case <-time.After(time.Second):
+		t.Fatal("queued request wasn't sent")
+	}
+	q, ok := suite.serverRequestMap.Get(mockClientID)
+	require.True(t, ok)
+	assert.Equal(t, 1, q.Size())
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemConnectionInfo() {
+	t := suite.T()
+	mockClientID := "1234"
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockClientID, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "somePath")
+	assert.Empty(t, suite.centralSystem.ConnectionInfo())
+	channel := NewMockWebSocket(mockClientID)
+	suite.mockServer.NewClientHandler(channel)
+	err := suite.centralSystem.SendRequest(mockClientID, newMockRequest("request1"))
+	require.NoError(t, err)
+	err = suite.centralSystem.SendRequest(mockClientID, newMockRequest("request2"))
+	require.NoError(t, err)
+	info := suite.centralSystem.ConnectionInfo()
+	require.Len(t, info, 1)
+	clientInfo, ok := info[mockClientID]
+	require.True(t, ok)
+	assert.Equal(t, 2, clientInfo.PendingRequests)
+	// Disconnected clients are removed
+	suite.mockServer.DisconnectedClientHandler(channel)
+	assert.Empty(t, suite.centralSystem.ConnectionInfo())
+}
+
 func (suite *OcppJTestSuite) TestCentralSystemDisconnectedHandler() {
 	t := suite.T()
 	mockClientID := "1234"
@@ -749,3 +842,367 @@ func (suite *OcppJTestSuite) TestServerRequestFlow() {
 	q, _ = suite.serverRequestMap.Get(mockChargePoint2)
 	assert.True(t, q.IsEmpty())
 }
+
+func (suite *OcppJTestSuite) TestServerTracing() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	tracer := NewMockTracer()
+	suite.centralSystem.SetTracer(tracer)
+	writeC := make(chan string, 1)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Run(func(args mock.Arguments) {
+		data := args.Get(1).([]byte)
+		state := suite.centralSystem.RequestState.GetClientState(mockChargePointId)
+		call := ParseCall(&suite.centralSystem.Endpoint, state, string(data), t)
+		require.NotNil(t, call)
+		writeC <- call.UniqueId
+	}).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("mockValue"))
+	require.NoError(t, err)
+	span := <-tracer.SpanC
+	requestID := <-writeC
+	assert.Equal(t, mockChargePointId, span.Attributes[ocppj.AttributeClientID])
+	assert.Equal(t, requestID, span.Attributes[ocppj.AttributeUniqueID])
+	// Span is ended with the error code of the received CallError
+	callError := fmt.Sprintf(`[4,"%v","%v","%v",{}]`, requestID, ocppj.NotSupported, "unsupported")
+	err = suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(callError))
+	require.NoError(t, err)
+	assert.True(t, span.Ended)
+	require.NotNil(t, span.Err)
+	assert.Equal(t, ocppj.NotSupported, span.Err.Code)
+	assert.Equal(t, string(ocppj.NotSupported), span.Attributes[ocppj.AttributeErrorCode])
+	assert.Eventually(t, func() bool {
+		return reflect.DeepEqual([]string{ocppj.EventQueued, ocppj.EventSent}, span.GetEvents())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (suite *OcppJTestSuite) TestServerTracingClientDisconnected() {
+	t := suite.T()
+	// Client IDs sharing a prefix must not affect each other's spans
+	mockChargePointId := "1234"
+	otherChargePointId := "1234/5678"
+	tracer := NewMockTracer()
+	suite.centralSystem.SetTracer(tracer)
+	writeC := make(chan string, 2)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- args.String(0)
+	}).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	channel := NewMockWebSocket(mockChargePointId)
+	otherChannel := NewMockWebSocket(otherChargePointId)
+	suite.mockServer.NewClientHandler(channel)
+	suite.mockServer.NewClientHandler(otherChannel)
+	err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("mockValue"))
+	require.NoError(t, err)
+	span := <-tracer.SpanC
+	<-writeC
+	err = suite.centralSystem.SendRequest(otherChargePointId, newMockRequest("mockValue"))
+	require.NoError(t, err)
+	otherSpan := <-tracer.SpanC
+	<-writeC
+	// Only the spans of the disconnected client are ended
+	suite.mockServer.DisconnectedClientHandler(channel)
+	assert.Eventually(t, func() bool {
+		span.mutex.Lock()
+		defer span.mutex.Unlock()
+		return span.Ended
+	}, time.Second, 10*time.Millisecond)
+	otherSpan.mutex.Lock()
+	defer otherSpan.mutex.Unlock()
+	assert.False(t, otherSpan.Ended)
+}
+
+func (suite *OcppJTestSuite) TestServerValidationFailureMetrics() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	mockChargePoint := NewMockWebSocket(mockChargePointId)
+	registry := metrics.NewRegistry()
+	suite.centralSystem.SetMetrics(registry)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	// Malformed incoming messages and unsupported outgoing responses are not counted
+	malformed := fmt.Sprintf(`[2,"1234","%v",{"mockValue":1234}]`, MockFeatureName)
+	_ = suite.mockServer.MessageHandler(mockChargePoint, []byte(malformed))
+	err := suite.centralSystem.SendResponse(mockChargePointId, "1234", &MockUnsupportedResponse{MockValue: "someValue"})
+	require.Error(t, err)
+	// Incoming and outgoing messages failing validation are counted
+	invalid := fmt.Sprintf(`[2,"5678","%v",{"mockValue":"%v"}]`, MockFeatureName, "someTooLongValue")
+	_ = suite.mockServer.MessageHandler(mockChargePoint, []byte(invalid))
+	err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest(""))
+	require.Error(t, err)
+	var b strings.Builder
+	require.NoError(t, registry.Write(&b))
+	output := b.String()
+	assert.Contains(t, output, `ocpp_validation_failures_total{code="PropertyConstraintViolation",direction="inbound",role="server"} 1`)
+	assert.Contains(t, output, `ocpp_validation_failures_total{code="OccurrenceConstraintViolation",direction="outbound",role="server"} 1`)
+	assert.NotContains(t, output, string(ocppj.FormatErrorType(suite.centralSystem)))
+	assert.NotContains(t, output, string(ocppj.GenericError))
+	assert.NotContains(t, output, string(ocppj.NotSupported))
+}
+
+// ----------------- Middleware tests -----------------
+
+func (suite *OcppJTestSuite) TestServerMiddlewareRejectsInboundResponse() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	suite.centralSystem.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			if envelope.Direction == ocppj.Inbound {
+				assert.Equal(t, mockChargePointId, envelope.ClientID)
+				return ocpp.NewError(ocppj.SecurityError, "unexpected response", "")
+			}
+			return next(envelope)
+		}
+	})
+	suite.centralSystem.SetResponseHandler(func(client ws.Channel, response ocpp.Response, requestId string) {
+		t.Fail()
+	})
+	errorC := make(chan *ocpp.Error, 1)
+	suite.centralSystem.SetErrorHandler(func(client ws.Channel, err *ocpp.Error, details interface{}) {
+		assert.Equal(t, mockChargePointId, client.ID())
+		errorC <- err
+	})
+	writeC := make(chan string, 1)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Run(func(args mock.Arguments) {
+		data := args.Get(1).([]byte)
+		state := suite.centralSystem.RequestState.GetClientState(mockChargePointId)
+		call := ParseCall(&suite.centralSystem.Endpoint, state, string(data), t)
+		require.NotNil(t, call)
+		writeC <- call.UniqueId
+	}).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("mockValue"))
+	require.NoError(t, err)
+	requestID := <-writeC
+	callResult := fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, requestID)
+	err = suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(callResult))
+	require.NoError(t, err)
+	ocppErr := <-errorC
+	assert.Equal(t, ocppj.SecurityError, ocppErr.Code)
+	assert.Equal(t, requestID, ocppErr.MessageId)
+	// The pending request was completed nonetheless
+	assert.False(t, suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+}
+
+// ----------------- Shutdown tests -----------------
+
+func (suite *OcppJTestSuite) TestServerShutdownWaitsForPendingRequests() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	writeC := make(chan string, 1)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Stop").Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Run(func(args mock.Arguments) {
+		data := args.Get(1).([]byte)
+		state := suite.centralSystem.RequestState.GetClientState(mockChargePointId)
+		call := ParseCall(&suite.centralSystem.Endpoint, state, string(data), t)
+		require.NotNil(t, call)
+		writeC <- call.UniqueId
+	}).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("mockValue"))
+	require.NoError(t, err)
+	requestID := <-writeC
+	// Shutdown waits for the pending request
+	shutdownC := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		shutdownC <- suite.centralSystem.Shutdown(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("mockValue"))
+	assert.EqualError(t, err, "ocppj server is shutting down, couldn't send request")
+	select {
+	case <-shutdownC:
+		t.Fatal("shutdown completed before pending request")
+	default:
+	}
+	callResult := fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, requestID)
+	err = suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(callResult))
+	require.NoError(t, err)
+	err = <-shutdownC
+	assert.NoError(t, err)
+	assert.False(t, suite.serverDispatcher.IsRunning())
+	suite.mockServer.AssertCalled(t, "Stop")
+}
+
+func (suite *OcppJTestSuite) TestServerShutdownRejectsIncomingRequests() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	writeC := make(chan []byte, 1)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		t.Fatal("request handler should not be invoked while shutting down")
+	})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Stop").Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- args.Get(1).([]byte)
+	}).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("mockValue"))
+	require.NoError(t, err)
+	state := suite.centralSystem.RequestState.GetClientState(mockChargePointId)
+	call := ParseCall(&suite.centralSystem.Endpoint, state, string(<-writeC), t)
+	require.NotNil(t, call)
+	// Shutdown waits for the pending request
+	shutdownC := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		shutdownC <- suite.centralSystem.Shutdown(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// A new incoming request is rejected right away
+	err = suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(mockRequest))
+	require.NoError(t, err)
+	expectedError := fmt.Sprintf(`[4,"%v","%v","server is shutting down",{}]`, mockUniqueId, ocppj.InternalError)
+	assert.Equal(t, expectedError, string(<-writeC))
+	callResult := fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, call.UniqueId)
+	err = suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(callResult))
+	require.NoError(t, err)
+	err = <-shutdownC
+	assert.NoError(t, err)
+}
+
+func (suite *OcppJTestSuite) TestServerShutdownWaitsForIncomingRequests() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Stop").Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(mockRequest))
+	require.NoError(t, err)
+	// No response was sent before the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = suite.centralSystem.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	suite.mockServer.AssertCalled(t, "Stop")
+}
+
+func (suite *OcppJTestSuite) TestServerShutdownAfterResponse() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			err := suite.centralSystem.SendResponse(client.ID(), requestId, newMockConfirmation("someValue"))
+			assert.NoError(t, err)
+		}()
+	})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Stop").Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(mockRequest))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = suite.centralSystem.Shutdown(ctx)
+	require.NoError(t, err)
+	// The response was written before stopping the server
+	suite.mockServer.AssertNumberOfCalls(t, "Write", 1)
+	suite.mockServer.AssertCalled(t, "Stop")
+}
+
+func (suite *OcppJTestSuite) TestServerShutdownAfterShortCircuitedResponse() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	suite.centralSystem.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			if envelope.Direction == ocppj.Outbound {
+				return nil
+			}
+			return next(envelope)
+		}
+	})
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		err := suite.centralSystem.SendResponse(client.ID(), requestId, newMockConfirmation("someValue"))
+		assert.NoError(t, err)
+	})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Stop").Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	err := suite.mockServer.MessageHandler(NewMockWebSocket(mockChargePointId), []byte(mockRequest))
+	require.NoError(t, err)
+	// The request was handled, even though the response was never written
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err = suite.centralSystem.Shutdown(ctx)
+	require.NoError(t, err)
+	suite.mockServer.AssertNotCalled(t, "Write", mockChargePointId, mock.Anything)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemRecorder() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	buffer := &bytes.Buffer{}
+	suite.centralSystem.SetRecorder(ocppj.NewJSONLRecorder(buffer))
+	suite.centralSystem.SetRequestHandler(func(chargePoint ws.Channel, request ocpp.Request, requestId string, action string) {
+		err := suite.centralSystem.SendResponse(chargePoint.ID(), requestId, newMockConfirmation("someValue"))
+		assert.NoError(t, err)
+	})
+	writtenC := make(chan []byte, 2)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writtenC <- args.Get(1).([]byte)
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	channel := NewMockWebSocket(mockChargePointId)
+	suite.mockServer.NewClientHandler(channel)
+	// Incoming request and outgoing response
+	err := suite.mockServer.MessageHandler(channel, []byte(mockRequest))
+	require.NoError(t, err)
+	response := <-writtenC
+	// Outgoing request, sent by the dispatcher
+	err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("request"))
+	require.NoError(t, err)
+	request := <-writtenC
+	frames, err := ocppj.ReadFrames(buffer)
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+	expected := []struct {
+		direction ocppj.MessageDirection
+		data      string
+	}{
+		{ocppj.Inbound, mockRequest},
+		{ocppj.Outbound, string(response)},
+		{ocppj.Outbound, string(request)},
+	}
+	for i, frame := range frames {
+		assert.Equal(t, expected[i].direction, frame.Direction)
+		assert.Equal(t, expected[i].data, frame.Data)
+		assert.Equal(t, mockChargePointId, frame.ClientID)
+		assert.Equal(t, "ocpp1.6", frame.Dialect)
+		assert.Equal(t, "server", frame.Role)
+		assert.False(t, frame.Timestamp.IsZero())
+	}
+	assert.False(t, frames[1].Timestamp.Before(frames[0].Timestamp))
+	assert.False(t, frames[2].Timestamp.Before(frames[1].Timestamp))
+}
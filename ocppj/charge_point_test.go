@@ -1,8 +1,10 @@
 package ocppj_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"sync"
 	"time"
@@ -824,3 +826,283 @@ func (suite *OcppJTestSuite) TestStopDisconnectedClient() {
 	assert.True(t, suite.clientDispatcher.IsPaused())
 	assert.False(t, suite.chargePoint.IsConnected())
 }
+
+func (suite *OcppJTestSuite) TestClientTracing() {
+	t := suite.T()
+	tracer := NewMockTracer()
+	suite.chargePoint.SetTracer(tracer)
+	writeC := make(chan string, 1)
+	canceledC := make(chan bool, 1)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		data := args.Get(0).([]byte)
+		call := ParseCall(&suite.chargePoint.Endpoint, suite.chargePoint.RequestState, string(data), t)
+		require.NotNil(t, call)
+		writeC <- call.UniqueId
+	}).Return(nil)
+	suite.chargePoint.SetOnRequestCanceled(func(requestId string, request ocpp.Request, err *ocpp.Error) {
+		canceledC <- true
+	})
+	suite.clientDispatcher.SetTimeout(500 * time.Millisecond)
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	// Span is ended once the response is received
+	err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	require.NoError(t, err)
+	span := <-tracer.SpanC
+	requestID := <-writeC
+	assert.Equal(t, MockFeatureName, span.Name)
+	assert.Equal(t, MockFeatureName, span.Attributes[ocppj.AttributeAction])
+	assert.Equal(t, requestID, span.Attributes[ocppj.AttributeUniqueID])
+	assert.Equal(t, "mock_id", span.Attributes[ocppj.AttributeClientID])
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, requestID)))
+	require.NoError(t, err)
+	assert.True(t, span.Ended)
+	assert.Nil(t, span.Err)
+	assert.Eventually(t, func() bool {
+		return reflect.DeepEqual([]string{ocppj.EventQueued, ocppj.EventSent}, span.GetEvents())
+	}, time.Second, 10*time.Millisecond)
+	// Span is ended with an error after a timeout
+	err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	require.NoError(t, err)
+	span = <-tracer.SpanC
+	<-writeC
+	<-canceledC
+	assert.True(t, span.Ended)
+	require.NotNil(t, span.Err)
+	assert.Equal(t, string(ocppj.GenericError), span.Attributes[ocppj.AttributeErrorCode])
+}
+
+func (suite *OcppJTestSuite) TestClientKeepsDispatcherCancelHandler() {
+	t := suite.T()
+	canceledC := make(chan string, 1)
+	// Handler is set on the dispatcher, before creating the client
+	dispatcher := ocppj.NewDefaultClientDispatcher(ocppj.NewFIFOClientQueue(queueCapacity))
+	dispatcher.SetOnRequestCanceled(func(requestID string, request ocpp.Request, err *ocpp.Error) {
+		canceledC <- requestID
+	})
+	dispatcher.SetTimeout(100 * time.Millisecond)
+	client := ocppj.NewClient("mock_id", suite.mockClient, dispatcher, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	tracer := NewMockTracer()
+	client.SetTracer(tracer)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	suite.mockClient.On("Stop").Return(nil)
+	suite.mockClient.On("IsConnected").Return(false)
+	err := client.Start("someUrl")
+	require.NoError(t, err)
+	defer client.Stop()
+	err = client.SendRequest(newMockRequest("somevalue"))
+	require.NoError(t, err)
+	span := <-tracer.SpanC
+	// Request times out: the original handler is invoked and the span is ended
+	select {
+	case requestID := <-canceledC:
+		assert.Equal(t, span.Attributes[ocppj.AttributeUniqueID], requestID)
+	case <-time.After(time.Second):
+		t.Fatal("cancel handler of the dispatcher wasn't invoked")
+	}
+	assert.True(t, span.Ended)
+	require.NotNil(t, span.Err)
+}
+
+func (suite *OcppJTestSuite) TestClientRetryPolicyCallError() {
+	t := suite.T()
+	suite.clientDispatcher.(*ocppj.DefaultClientDispatcher).SetRetryPolicy(ocppj.NewRetryPolicy(2, 50*time.Millisecond), MockFeatureName)
+	writeC := make(chan string, 2)
+	errorC := make(chan *ocpp.Error, 1)
+	suite.chargePoint.SetErrorHandler(func(err *ocpp.Error, details interface{}) {
+		errorC <- err
+	})
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(0).([]byte))
+	})
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	require.NoError(t, err)
+	call := ParseCall(&suite.chargePoint.Endpoint, suite.chargePoint.RequestState, <-writeC, t)
+	require.NotNil(t, call)
+	callError := fmt.Sprintf(`[4,"%v","%v","error",{}]`, call.UniqueId, ocppj.InternalError)
+	// First CALLERROR triggers a retransmission
+	err = suite.mockClient.MessageHandler([]byte(callError))
+	require.NoError(t, err)
+	select {
+	case <-writeC:
+	case <-time.After(time.Second):
+		t.Fatal("request wasn't retransmitted")
+	}
+	assert.Len(t, errorC, 0)
+	// Once all attempts failed, the error is delivered
+	err = suite.mockClient.MessageHandler([]byte(callError))
+	require.NoError(t, err)
+	ocppErr := <-errorC
+	assert.Equal(t, ocppj.InternalError, ocppErr.Code)
+	assert.True(t, suite.clientRequestQueue.IsEmpty())
+}
+
+// ----------------- Middleware tests -----------------
+
+func (suite *OcppJTestSuite) TestClientMiddlewareOrder() {
+	t := suite.T()
+	var invocations []string
+	newMiddleware := func(name string) ocppj.Middleware {
+		return func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+			return func(envelope *ocppj.Envelope) *ocpp.Error {
+				invocations = append(invocations, fmt.Sprintf("%v-%v", name, envelope.Direction))
+				assert.Equal(t, "mock_id", envelope.ClientID)
+				return next(envelope)
+			}
+		}
+	}
+	suite.chargePoint.AddMiddleware(newMiddleware("first"), newMiddleware("second"))
+	suite.chargePoint.SetRequestHandler(func(request ocpp.Request, requestId string, action string) {
+		invocations = append(invocations, "handler")
+	})
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[2,"1234","%v",{"mockValue":"someValue"}]`, MockFeatureName)))
+	require.NoError(t, err)
+	err = suite.chargePoint.SendResponse("1234", newMockConfirmation("someValue"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first-inbound", "second-inbound", "handler", "first-outbound", "second-outbound"}, invocations)
+}
+
+func (suite *OcppJTestSuite) TestClientMiddlewareMutatesInboundCall() {
+	t := suite.T()
+	suite.chargePoint.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			if call, ok := envelope.Message.(*ocppj.Call); ok {
+				call.Payload.(*MockRequest).MockValue = "fixedValue"
+			}
+			return next(envelope)
+		}
+	})
+	requestC := make(chan string, 1)
+	suite.chargePoint.SetRequestHandler(func(request ocpp.Request, requestId string, action string) {
+		requestC <- request.(*MockRequest).MockValue
+	})
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[2,"1234","%v",{"mockValue":"someValue"}]`, MockFeatureName)))
+	require.NoError(t, err)
+	assert.Equal(t, "fixedValue", <-requestC)
+}
+
+func (suite *OcppJTestSuite) TestClientMiddlewareRejectsInboundCall() {
+	t := suite.T()
+	suite.chargePoint.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			if envelope.Direction == ocppj.Inbound {
+				return ocpp.NewError(ocppj.SecurityError, "access denied", "")
+			}
+			return next(envelope)
+		}
+	})
+	suite.chargePoint.SetRequestHandler(func(request ocpp.Request, requestId string, action string) {
+		t.Fail()
+	})
+	writeC := make(chan []byte, 1)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- args.Get(0).([]byte)
+	}).Return(nil)
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[2,"1234","%v",{"mockValue":"someValue"}]`, MockFeatureName)))
+	require.NoError(t, err)
+	expectedCallError := fmt.Sprintf(`[4,"1234","%v","access denied",{}]`, ocppj.SecurityError)
+	assert.Equal(t, expectedCallError, string(<-writeC))
+}
+
+func (suite *OcppJTestSuite) TestClientMiddlewareOutbound() {
+	t := suite.T()
+	suite.chargePoint.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(envelope *ocppj.Envelope) *ocpp.Error {
+			call, ok := envelope.Message.(*ocppj.Call)
+			require.True(t, ok)
+			switch call.Payload.(*MockRequest).MockValue {
+			case "reject":
+				return ocpp.NewError(ocppj.SecurityError, "not allowed", "")
+			case "skip":
+				return nil
+			}
+			call.Payload.(*MockRequest).MockValue = "mutated"
+			return next(envelope)
+		}
+	})
+	writeC := make(chan string, 1)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(0).([]byte))
+	}).Return(nil)
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	// Rejected request is returned to the caller
+	err = suite.chargePoint.SendRequest(newMockRequest("reject"))
+	require.Error(t, err)
+	ocppErr, ok := err.(*ocpp.Error)
+	require.True(t, ok)
+	assert.Equal(t, ocppj.SecurityError, ocppErr.Code)
+	assert.NotEmpty(t, ocppErr.MessageId)
+	// Short-circuited request is dropped
+	err = suite.chargePoint.SendRequest(newMockRequest("skip"))
+	assert.ErrorIs(t, err, ocppj.ErrShortCircuited)
+	assert.True(t, suite.clientRequestQueue.IsEmpty())
+	// Modified request is sent
+	err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	require.NoError(t, err)
+	call := ParseCall(&suite.chargePoint.Endpoint, suite.chargePoint.RequestState, <-writeC, t)
+	assert.Equal(t, "mutated", call.Payload.(*MockRequest).MockValue)
+}
+
+func (suite *OcppJTestSuite) TestChargePointRecorder() {
+	t := suite.T()
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	buffer := &bytes.Buffer{}
+	suite.chargePoint.SetRecorder(ocppj.NewJSONLRecorder(buffer))
+	suite.chargePoint.SetRequestHandler(func(request ocpp.Request, requestId string, action string) {
+		err := suite.chargePoint.SendError(requestId, ocppj.GenericError, "error", nil)
+		assert.NoError(t, err)
+	})
+	writtenC := make(chan []byte, 2)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writtenC <- args.Get(0).([]byte)
+	})
+	err := suite.chargePoint.Start("somePath")
+	require.NoError(t, err)
+	// Outgoing request, sent by the dispatcher
+	err = suite.chargePoint.SendRequest(newMockRequest("request"))
+	require.NoError(t, err)
+	request := <-writtenC
+	// Incoming request, answered with an error
+	err = suite.mockClient.MessageHandler([]byte(mockRequest))
+	require.NoError(t, err)
+	callError := <-writtenC
+	frames, err := ocppj.ReadFrames(buffer)
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+	assert.Equal(t, ocppj.Outbound, frames[0].Direction)
+	assert.Equal(t, string(request), frames[0].Data)
+	assert.Equal(t, ocppj.Inbound, frames[1].Direction)
+	assert.Equal(t, mockRequest, frames[1].Data)
+	assert.Equal(t, ocppj.Outbound, frames[2].Direction)
+	assert.Equal(t, string(callError), frames[2].Data)
+	for _, frame := range frames {
+		assert.Equal(t, "mock_id", frame.ClientID)
+		assert.Equal(t, "ocpp1.6", frame.Dialect)
+		assert.Equal(t, "client", frame.Role)
+	}
+	// Disabling the recorder
+	suite.chargePoint.SetRecorder(nil)
+	err = suite.chargePoint.SendError(mockUniqueId, ocppj.GenericError, "error", nil)
+	require.NoError(t, err)
+	<-writtenC
+	assert.Equal(t, 0, buffer.Len())
+}
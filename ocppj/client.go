@@ -1,10 +1,13 @@
 package ocppj
 
 import (
+	"context"
 	"fmt"
 
 	"gopkg.in/go-playground/validator.v9"
 
+	"github.com/lorenzodonini/ocpp-go/logging"
+	"github.com/lorenzodonini/ocpp-go/metrics"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/lorenzodonini/ocpp-go/ws"
 )
@@ -20,8 +23,15 @@ type Client struct {
 	errorHandler          func(err *ocpp.Error, details interface{})
 	onDisconnectedHandler func(err error)
 	onReconnectedHandler  func()
+	onRequestRestored     func(requestId string, request ocpp.Request)
+	onRequestCanceled     func(requestId string, request ocpp.Request, err *ocpp.Error)
+	restored              bool
 	invalidMessageHook    func(err *ocpp.Error, rawMessage string, parsedFields []interface{}) *ocpp.Error
 	dispatcher            ClientDispatcher
+	metrics               metrics.Metrics
+	tracer                Tracer
+	recorder              Recorder
+	spans                 spanMap
 	RequestState          ClientState
 }
 
@@ -51,7 +61,14 @@ func NewClient(id string, wsClient ws.WsClient, dispatcher ClientDispatcher, sta
 	}
 	dispatcher.SetNetworkClient(wsClient)
 	dispatcher.SetPendingRequestState(stateHandler)
-	return &Client{Endpoint: endpoint, client: wsClient, Id: id, dispatcher: dispatcher, RequestState: stateHandler}
+	c := &Client{Endpoint: endpoint, client: wsClient, Id: id, dispatcher: dispatcher, RequestState: stateHandler, metrics: &metrics.VoidMetrics{}, tracer: &VoidTracer{}}
+	// Spans of canceled requests need to be ended, even if no handler is registered
+	if observer, ok := dispatcher.(clientCancelObserver); ok {
+		observer.setCancelObserver(func(requestID string, err *ocpp.Error) {
+			c.spans.end(spanKey{requestID: requestID}, err)
+		})
+	}
+	return c
 }
 
 // Registers a handler for incoming requests.
@@ -95,9 +112,77 @@ func (c *Client) SetOnReconnectedHandler(handler func()) {
 	c.onReconnectedHandler = handler
 }
 
+// Registers the handler to be called for every request restored from a PersistentRequestQueue, when starting the client.
+// Restored requests are sent before any new request, and the handler is invoked in the same order.
+func (c *Client) SetOnRequestRestored(handler func(requestId string, request ocpp.Request)) {
+	c.onRequestRestored = handler
+}
+
 // Registers the handler to be called on timeout.
+//
+// The spans of canceled requests are ended before invoking the handler.
+// Dispatchers other than DefaultClientDispatcher only end the spans once a handler is registered.
 func (c *Client) SetOnRequestCanceled(handler func(requestId string, request ocpp.Request, err *ocpp.Error)) {
-	c.dispatcher.SetOnRequestCanceled(handler)
+	c.onRequestCanceled = handler
+	if _, ok := c.dispatcher.(clientCancelObserver); ok {
+		c.dispatcher.SetOnRequestCanceled(handler)
+		return
+	}
+	c.dispatcher.SetOnRequestCanceled(func(requestId string, request ocpp.Request, err *ocpp.Error) {
+		c.spans.end(spanKey{requestID: requestId}, err)
+		if handler != nil {
+			handler(requestId, request, err)
+		}
+	})
+}
+
+// Sets the Tracer, which opens a span for every outgoing request.
+// By default, a VoidTracer is used.
+//
+// This function must be called before starting the client.
+func (c *Client) SetTracer(tracer Tracer) {
+	c.tracer = tracer
+}
+
+// Sets the Metrics implementation, which the endpoint reports validation failures to.
+// The metrics are forwarded to the dispatcher and to the websocket client as well,
+// if they report metrics (e.g. DefaultClientDispatcher and ws.Client do).
+//
+// This function must be called before starting the client.
+func (c *Client) SetMetrics(m metrics.Metrics) {
+	c.metrics = m
+	if setter, ok := c.dispatcher.(metricsSetter); ok {
+		setter.SetMetrics(m)
+	}
+	if setter, ok := c.client.(metricsSetter); ok {
+		setter.SetMetrics(m)
+	}
+}
+
+// Reports a failed validation of a message, if the error was caused by one.
+func (c *Client) countValidationFailure(direction string, err error) {
+	if labels, ok := validationLabels(metrics.RoleClient, direction, err); ok {
+		c.metrics.IncCounter(metrics.ValidationFailuresTotal, labels)
+	}
+}
+
+// Sets a custom Logger implementation for this client only.
+// The logger is forwarded to the dispatcher and to the websocket client, if these support it.
+// Passing nil restores the package-level loggers.
+//
+// This function must be called before starting the client.
+func (c *Client) SetLogger(logger logging.Logger) {
+	c.Endpoint.SetLogger(logger)
+	// The dispatcher and websocket client aren't aware of the client ID, so it is attached to the logger upfront
+	if logger != nil {
+		logger = withFields(logger, c.Id, "", "")
+	}
+	if setter, ok := c.dispatcher.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+	if setter, ok := c.client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
 }
 
 // Connects to the given serverURL and starts running the I/O loop for the underlying connection.
@@ -108,12 +193,18 @@ func (c *Client) SetOnRequestCanceled(handler func(requestId string, request ocp
 // In case of disconnection, the client handles re-connection automatically.
 // The client will attempt to re-connect to the server forever, until it is stopped by invoking the Stop method.
 //
-// An error may be returned, if establishing the connection failed.
+// If the dispatcher is backed by a PersistentRequestQueue, previously persisted requests are restored
+// and will be sent before any new request.
+//
+// An error may be returned, if establishing the connection or restoring persisted requests failed.
 func (c *Client) Start(serverURL string) error {
 	// Set internal message handler
 	c.client.SetMessageHandler(c.ocppMessageHandler)
 	c.client.SetDisconnectedHandler(c.onDisconnected)
 	c.client.SetReconnectedHandler(c.onReconnected)
+	if err := c.restoreRequests(); err != nil {
+		return err
+	}
 	// Connect & run
 	fullUrl := fmt.Sprintf("%v/%v", serverURL, c.Id)
 	err := c.client.Start(fullUrl)
@@ -128,12 +219,55 @@ func (c *Client) StartWithRetries(serverURL string) {
 	c.client.SetMessageHandler(c.ocppMessageHandler)
 	c.client.SetDisconnectedHandler(c.onDisconnected)
 	c.client.SetReconnectedHandler(c.onReconnected)
+	if err := c.restoreRequests(); err != nil {
+		c.logWith(c.Id, "", "").Error(err)
+	}
 	// Connect & run
 	fullUrl := fmt.Sprintf("%v/%v", serverURL, c.Id)
 	c.client.StartWithRetries(fullUrl)
 	c.dispatcher.Start()
 }
 
+// Re-hydrates persisted requests, if the dispatcher is backed by a PersistentRequestQueue.
+// Requests are restored only once, until the client is stopped again.
+func (c *Client) restoreRequests() error {
+	if c.restored {
+		return nil
+	}
+	r, ok := c.dispatcher.(requestRestorer)
+	if !ok {
+		return nil
+	}
+	restored, err := r.restoreRequests(c.decodeCall)
+	if err != nil {
+		return fmt.Errorf("couldn't restore persisted requests: %w", err)
+	}
+	c.restored = true
+	for _, bundle := range restored {
+		if c.onRequestRestored != nil {
+			c.onRequestRestored(bundle.Call.UniqueId, bundle.Call.Payload)
+		}
+	}
+	return nil
+}
+
+// Parses a raw, previously serialized OCPP Call message.
+func (c *Client) decodeCall(data []byte) (*Call, error) {
+	parsedJson, err := ParseRawJsonMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	message, err := c.ParseMessage(parsedJson, c.RequestState)
+	if err != nil {
+		return nil, err
+	}
+	call, ok := message.(*Call)
+	if !ok {
+		return nil, fmt.Errorf("invalid message type %T, expected Call", message)
+	}
+	return call, nil
+}
+
 // Stops the client.
 // The underlying I/O loop is stopped and all pending requests are cleared.
 func (c *Client) Stop() {
@@ -150,6 +284,9 @@ func (c *Client) Stop() {
 	if c.dispatcher.IsRunning() {
 		c.dispatcher.Stop()
 	}
+	c.spans.endAll(ocpp.NewError(GenericError, "client stopped", ""))
+	// Persisted requests are restored again on the next start
+	c.restored = false
 	// Wait for websocket to be cleaned up
 	<-cleanupC
 }
@@ -172,24 +309,46 @@ func (c *Client) IsConnected() bool {
 //
 // - the output queue is full
 func (c *Client) SendRequest(request ocpp.Request) error {
+	_, err := c.SendRequestCtx(context.Background(), request)
+	return err
+}
+
+// Sends an OCPP Request to the server, same as SendRequest.
+// The passed context is attached to the request: once the context is done,
+// the request is removed from the queue or, if it was already sent, treated as timed out.
+// In both cases, the request canceled handler is invoked.
+//
+// Returns the unique ID of the enqueued request, which is passed to the response, error and request canceled handlers.
+func (c *Client) SendRequestCtx(ctx context.Context, request ocpp.Request) (string, error) {
 	if !c.dispatcher.IsRunning() {
-		return fmt.Errorf("ocppj client is not started, couldn't send request")
+		return "", fmt.Errorf("ocppj client is not started, couldn't send request")
 	}
 	call, err := c.CreateCall(request)
 	if err != nil {
-		return err
+		c.countValidationFailure(metrics.DirectionOutbound, err)
+		return "", err
 	}
-	jsonMessage, err := call.MarshalJSON()
+	message, err := c.interceptOutbound(c.Id, call)
 	if err != nil {
-		return err
+		return "", err
+	} else if message == nil {
+		return "", ErrShortCircuited
 	}
+	call = message.(*Call)
+	jsonMessage, err := c.marshalMessage(call)
+	if err != nil {
+		return "", err
+	}
+	ctx, span := startCallSpan(c.tracer, ctx, c.Id, call)
+	c.spans.add(spanKey{requestID: call.UniqueId}, span)
 	// Message will be processed by dispatcher. A dedicated mechanism allows to delegate the message queue handling.
-	if err = c.dispatcher.SendRequest(RequestBundle{Call: call, Data: jsonMessage}); err != nil {
-		log.Errorf("error dispatching request [%s, %s]: %v", call.UniqueId, call.Action, err)
-		return err
+	if err = c.dispatcher.SendRequest(RequestBundle{Call: call, Data: jsonMessage, Context: ctx, span: span}); err != nil {
+		c.logWith(c.Id, call.UniqueId, call.Action).Errorf("error dispatching request [%s, %s]: %v", call.UniqueId, call.Action, err)
+		c.spans.end(spanKey{requestID: call.UniqueId}, ocpp.NewError(GenericError, err.Error(), call.UniqueId))
+		return "", err
 	}
-	log.Debugf("enqueued CALL [%s, %s]", call.UniqueId, call.Action)
-	return nil
+	c.logWith(c.Id, call.UniqueId, call.Action).Debugf("enqueued CALL [%s, %s]", call.UniqueId, call.Action)
+	return call.UniqueId, nil
 }
 
 // Sends an OCPP Response to the server.
@@ -205,18 +364,25 @@ func (c *Client) SendRequest(request ocpp.Request) error {
 func (c *Client) SendResponse(requestId string, response ocpp.Response) error {
 	callResult, err := c.CreateCallResult(response, requestId)
 	if err != nil {
+		c.countValidationFailure(metrics.DirectionOutbound, err)
+		return err
+	}
+	message, err := c.interceptOutbound(c.Id, callResult)
+	if err != nil || message == nil {
 		return err
 	}
-	jsonMessage, err := callResult.MarshalJSON()
+	callResult = message.(*CallResult)
+	jsonMessage, err := c.marshalMessage(callResult)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	c.record(Outbound, jsonMessage)
 	if err = c.client.Write(jsonMessage); err != nil {
-		log.Errorf("error sending response [%s]: %v", callResult.GetUniqueId(), err)
+		c.logWith(c.Id, requestId, response.GetFeatureName()).Errorf("error sending response [%s]: %v", callResult.GetUniqueId(), err)
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
-	log.Debugf("sent CALL RESULT [%s]", callResult.GetUniqueId())
-	log.Debugf("sent JSON message to server: %s", string(jsonMessage))
+	c.logWith(c.Id, requestId, response.GetFeatureName()).Debugf("sent CALL RESULT [%s]", callResult.GetUniqueId())
+	c.logWith(c.Id, requestId, response.GetFeatureName()).Debugf("sent JSON message to server: %s", string(jsonMessage))
 	return nil
 }
 
@@ -233,29 +399,42 @@ func (c *Client) SendError(requestId string, errorCode ocpp.ErrorCode, descripti
 	if err != nil {
 		return err
 	}
-	jsonMessage, err := callError.MarshalJSON()
+	message, err := c.interceptOutbound(c.Id, callError)
+	if err != nil || message == nil {
+		return err
+	}
+	callError = message.(*CallError)
+	jsonMessage, err := c.marshalMessage(callError)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	c.record(Outbound, jsonMessage)
 	if err = c.client.Write(jsonMessage); err != nil {
-		log.Errorf("error sending response error [%s]: %v", callError.UniqueId, err)
+		c.logWith(c.Id, requestId, "").Errorf("error sending response error [%s]: %v", callError.UniqueId, err)
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
-	log.Debugf("sent CALL ERROR [%s]", callError.UniqueId)
-	log.Debugf("sent JSON message to server: %s", string(jsonMessage))
+	c.logWith(c.Id, requestId, "").Debugf("sent CALL ERROR [%s]", callError.UniqueId)
+	c.logWith(c.Id, requestId, "").Debugf("sent JSON message to server: %s", string(jsonMessage))
 	return nil
 }
 
 func (c *Client) ocppMessageHandler(data []byte) error {
+	c.record(Inbound, data)
 	parsedJson, err := ParseRawJsonMessage(data)
 	if err != nil {
-		log.Error(err)
+		c.logWith(c.Id, "", "").Error(err)
 		return err
 	}
-	log.Debugf("received JSON message from server: %s", string(data))
-	message, err := c.ParseMessage(parsedJson, c.RequestState)
+	c.logWith(c.Id, "", "").Debugf("received JSON message from server: %s", string(data))
+	message, err := c.parseMessage(parsedJson, c.RequestState)
 	if err != nil {
-		ocppErr := err.(*ocpp.Error)
+		c.countValidationFailure(metrics.DirectionInbound, err)
+		err = unwrapValidationError(err)
+		ocppErr, ok := err.(*ocpp.Error)
+		if !ok {
+			// Parsing errors are expected to be OCPP errors, but a malformed message must never crash the endpoint
+			ocppErr = ocpp.NewError(GenericError, err.Error(), "")
+		}
 		messageID := ocppErr.MessageId
 		// Support ad-hoc callback for invalid message handling
 		if c.invalidMessageHook != nil {
@@ -274,30 +453,83 @@ func (c *Client) ocppMessageHandler(data []byte) error {
 				return err2
 			}
 		}
-		log.Error(err)
+		c.logWith(c.Id, ocppErr.MessageId, "").Error(err)
 		return err
 	}
 	if message != nil {
-		switch message.GetMessageTypeId() {
-		case CALL:
-			call := message.(*Call)
-			log.Debugf("handling incoming CALL [%s, %s]", call.UniqueId, call.Action)
+		handled, ocppErr := c.intercept(&Envelope{Direction: Inbound, ClientID: c.Id, Message: message}, c.handleMessage)
+		if !handled {
+			return c.handleInterceptedMessage(message, ocppErr)
+		}
+		if ocppErr != nil {
+			return ocppErr
+		}
+	}
+	return nil
+}
+
+// Handles an inbound message, after it passed the middleware chain.
+func (c *Client) handleMessage(envelope *Envelope) *ocpp.Error {
+	switch envelope.Message.GetMessageTypeId() {
+	case CALL:
+		call := envelope.Message.(*Call)
+		c.logWith(c.Id, call.UniqueId, call.Action).Debugf("handling incoming CALL [%s, %s]", call.UniqueId, call.Action)
+		if c.requestHandler != nil {
 			c.requestHandler(call.Payload, call.UniqueId, call.Action)
-		case CALL_RESULT:
-			callResult := message.(*CallResult)
-			log.Debugf("handling incoming CALL RESULT [%s]", callResult.UniqueId)
-			c.dispatcher.CompleteRequest(callResult.GetUniqueId()) // Remove current request from queue and send next one
-			if c.responseHandler != nil {
-				c.responseHandler(callResult.Payload, callResult.UniqueId)
-			}
-		case CALL_ERROR:
-			callError := message.(*CallError)
-			log.Debugf("handling incoming CALL ERROR [%s]", callError.UniqueId)
-			c.dispatcher.CompleteRequest(callError.GetUniqueId()) // Remove current request from queue and send next one
-			if c.errorHandler != nil {
-				c.errorHandler(ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId), callError.ErrorDetails)
-			}
 		}
+	case CALL_RESULT:
+		callResult := envelope.Message.(*CallResult)
+		c.logWith(c.Id, callResult.UniqueId, callResult.Payload.GetFeatureName()).Debugf("handling incoming CALL RESULT [%s]", callResult.UniqueId)
+		c.dispatcher.CompleteRequest(callResult.GetUniqueId()) // Remove current request from queue and send next one
+		c.spans.end(spanKey{requestID: callResult.UniqueId}, nil)
+		if c.responseHandler != nil {
+			c.responseHandler(callResult.Payload, callResult.UniqueId)
+		}
+	case CALL_ERROR:
+		callError := envelope.Message.(*CallError)
+		c.logWith(c.Id, callError.UniqueId, "").Debugf("handling incoming CALL ERROR [%s]", callError.UniqueId)
+		ocppErr := ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId)
+		if retrier, ok := c.dispatcher.(callErrorRetrier); ok && retrier.retryOnError(callError.UniqueId, ocppErr) {
+			// Request is retransmitted, the error is only reported once all attempts failed
+			return nil
+		}
+		c.dispatcher.CompleteRequest(callError.GetUniqueId()) // Remove current request from queue and send next one
+		c.spans.end(spanKey{requestID: callError.UniqueId}, ocppErr)
+		if c.errorHandler != nil {
+			c.errorHandler(ocppErr, callError.ErrorDetails)
+		}
+	}
+	return nil
+}
+
+// Handles an inbound message, which was rejected or short-circuited by a middleware.
+func (c *Client) handleInterceptedMessage(message Message, err *ocpp.Error) error {
+	requestID := message.GetUniqueId()
+	if message.GetMessageTypeId() == CALL {
+		if err == nil {
+			c.logWith(c.Id, requestID, "").Debugf("incoming CALL [%s] short-circuited by middleware", requestID)
+			return nil
+		}
+		c.logWith(c.Id, requestID, "").Infof("incoming CALL [%s] rejected by middleware: %v", requestID, err)
+		return c.SendError(requestID, err.Code, err.Description, nil)
+	}
+	// The pending request is completed in any case, so the next request may be sent
+	request, _ := c.RequestState.GetPendingRequest(requestID)
+	c.dispatcher.CompleteRequest(requestID)
+	if err == nil {
+		c.logWith(c.Id, requestID, "").Debugf("incoming response [%s] short-circuited by middleware", requestID)
+		// No response will be delivered, hence the request is treated as canceled
+		cancelErr := ocpp.NewError(GenericError, "response short-circuited by middleware", requestID)
+		c.spans.end(spanKey{requestID: requestID}, cancelErr)
+		if c.onRequestCanceled != nil && request != nil {
+			c.onRequestCanceled(requestID, request, cancelErr)
+		}
+		return nil
+	}
+	c.spans.end(spanKey{requestID: requestID}, err)
+	c.logWith(c.Id, requestID, "").Infof("incoming response [%s] rejected by middleware: %v", requestID, err)
+	if c.errorHandler != nil {
+		c.errorHandler(err, nil)
 	}
 	return nil
 }
@@ -310,7 +542,7 @@ func (c *Client) ocppMessageHandler(data []byte) error {
 // The method will, however, only attempt to send a default error once.
 // If this operation fails, the other endpoint may still starve.
 func (c *Client) HandleFailedResponseError(requestID string, err error, featureName string) {
-	log.Debugf("handling error for failed response [%s]", requestID)
+	c.logWith(c.Id, requestID, featureName).Debugf("handling error for failed response [%s]", requestID)
 	var responseErr *ocpp.Error
 	// There's several possible errors: invalid profile, invalid payload or send error
 	switch err.(type) {
@@ -330,7 +562,7 @@ func (c *Client) HandleFailedResponseError(requestID string, err error, featureN
 }
 
 func (c *Client) onDisconnected(err error) {
-	log.Error("disconnected from server", err)
+	c.logWith(c.Id, "", "").Error("disconnected from server", err)
 	c.dispatcher.Pause()
 	if c.onDisconnectedHandler != nil {
 		c.onDisconnectedHandler(err)
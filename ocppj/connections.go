@@ -0,0 +1,91 @@
+package ocppj
+
+import (
+	"sync"
+
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+// ConnectionInfo contains health information about a client connected to a server endpoint.
+type ConnectionInfo struct {
+	ws.ConnectionStats
+	// Number of outgoing requests to the client, which are either queued or waiting for a response.
+	PendingRequests int
+}
+
+// requestCounter is implemented by dispatchers, which can report the amount of outgoing requests for a client.
+type requestCounter interface {
+	PendingRequests(clientID string) int
+}
+
+// PendingRequests returns the amount of requests for a client, which are either queued or waiting for a response.
+func (d *DefaultServerDispatcher) PendingRequests(clientID string) int {
+	q, ok := d.queueMap.Get(clientID)
+	if !ok {
+		return 0
+	}
+	return q.Size()
+}
+
+// replacementObserver is implemented by dispatchers, which need to know when the connection of a client is replaced
+// by a new connection with the same ID (see ws.ReplaceExistingConnection).
+type replacementObserver interface {
+	clientReplaced(clientID string)
+}
+
+// channelMap keeps track of the channels of connected clients.
+// Access is thread-safe.
+type channelMap struct {
+	channels map[string]ws.Channel
+	mutex    sync.RWMutex
+}
+
+// Adds the channel. Returns true, if it replaced an existing channel with the same ID.
+func (m *channelMap) add(channel ws.Channel) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.channels == nil {
+		m.channels = map[string]ws.Channel{}
+	}
+	_, replaced := m.channels[channel.ID()]
+	m.channels[channel.ID()] = channel
+	return replaced
+}
+
+// Removes the channel, unless it was replaced by a newer channel with the same ID.
+func (m *channelMap) remove(channel ws.Channel) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.channels[channel.ID()] == channel {
+		delete(m.channels, channel.ID())
+	}
+}
+
+func (m *channelMap) all() []ws.Channel {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	channels := make([]ws.Channel, 0, len(m.channels))
+	for _, channel := range m.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// ConnectionInfo returns health information about all currently connected clients, mapped by client ID.
+//
+// The amount of pending requests is only available if the dispatcher supports it (e.g. DefaultServerDispatcher).
+func (s *Server) ConnectionInfo() map[string]ConnectionInfo {
+	counter, _ := s.dispatcher.(requestCounter)
+	info := map[string]ConnectionInfo{}
+	for _, channel := range s.channels.all() {
+		clientInfo := ConnectionInfo{}
+		if statsChannel, ok := channel.(ws.StatsChannel); ok {
+			clientInfo.ConnectionStats = statsChannel.Stats()
+		}
+		if counter != nil {
+			clientInfo.PendingRequests = counter.PendingRequests(channel.ID())
+		}
+		info[channel.ID()] = clientInfo
+	}
+	return info
+}
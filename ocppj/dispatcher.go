@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lorenzodonini/ocpp-go/logging"
+	"github.com/lorenzodonini/ocpp-go/metrics"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/lorenzodonini/ocpp-go/ws"
 )
@@ -38,6 +41,10 @@ type ClientDispatcher interface {
 	// Dispatches a request. Depending on the implementation, this may first queue a request
 	// and process it later, asynchronously, or write it directly to the networking layer.
 	//
+	// If the request carries a context, the request is canceled as soon as the context is done:
+	// a queued request is removed from the queue, while a pending request is treated as timed out.
+	// In both cases, the OnRequestCanceled callback is invoked.
+	//
 	// If no network client was set, or the request couldn't be processed, an error is returned.
 	SendRequest(req RequestBundle) error
 	// Notifies the dispatcher that a request has been completed (i.e. a response was received).
@@ -81,6 +88,28 @@ type pendingRequest struct {
 	request ocpp.Request
 }
 
+// canceledContext is used internally for notifying a dispatcher, that the context of a request is done.
+type canceledContext struct {
+	clientID  string
+	requestID string
+	err       error
+}
+
+func contextCanceledError(requestID string, err error) *ocpp.Error {
+	return ocpp.NewError(GenericError, fmt.Sprintf("Request canceled: %v", err), requestID)
+}
+
+func hasContext(req RequestBundle) bool {
+	return req.Context != nil && req.Context.Done() != nil
+}
+
+func matchRequest(requestID string) func(element interface{}) bool {
+	return func(element interface{}) bool {
+		bundle, ok := element.(RequestBundle)
+		return ok && bundle.Call.UniqueId == requestID
+	}
+}
+
 // DefaultClientDispatcher is a default implementation of the ClientDispatcher interface.
 //
 // The dispatcher implements the ClientState as well for simplicity.
@@ -89,13 +118,26 @@ type DefaultClientDispatcher struct {
 	requestQueue        RequestQueue
 	requestChannel      chan bool
 	readyForDispatch    chan bool
+	canceledC           chan canceledContext
+	callErrorC          chan failedRequest
+	stoppedC            chan struct{}
 	pendingRequestState ClientState
 	network             ws.WsClient
 	mutex               sync.RWMutex
 	onRequestCancel     func(requestID string, request ocpp.Request, err *ocpp.Error)
+	cancelObserver      func(requestID string, err *ocpp.Error)
 	timer               *time.Timer
 	paused              bool
 	timeout             time.Duration
+	retryPolicies       map[string]RetryPolicy
+	offlinePolicy       *OfflinePolicy
+	metrics             metrics.Metrics
+	latency             *requestLatency
+	logger              logging.Logger
+	// State of the request at the front of the queue, only accessed by the messagePump
+	attemptsID string
+	attempts   int
+	retrying   bool
 }
 
 const (
@@ -111,13 +153,93 @@ func NewDefaultClientDispatcher(queue RequestQueue) *DefaultClientDispatcher {
 		readyForDispatch:    make(chan bool, 1),
 		pendingRequestState: NewClientState(),
 		timeout:             defaultMessageTimeout,
+		retryPolicies:       map[string]RetryPolicy{},
+		metrics:             &metrics.VoidMetrics{},
+		latency:             newRequestLatency(),
+	}
+}
+
+// SetRetryPolicy sets the retransmission policy for requests with the given feature names.
+// Failed requests without a retry policy are canceled right away.
+//
+// To retry transaction-related messages as required by OCPP 1.6, you may use ocpp16.SetTransactionRetryPolicy,
+// or configure the features explicitly:
+//
+//	dispatcher.SetRetryPolicy(ocppj.NewRetryPolicy(3, 30*time.Second),
+//		core.StartTransactionFeatureName, core.StopTransactionFeatureName, core.MeterValuesFeatureName)
+func (d *DefaultClientDispatcher) SetRetryPolicy(policy RetryPolicy, featureNames ...string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, featureName := range featureNames {
+		d.retryPolicies[featureName] = policy
 	}
 }
 
+// SetOfflinePolicy sets the policy for requests, which are sent while the dispatcher is paused (i.e. the client is offline).
+// Pass nil to queue all requests while offline, which is the default behavior.
+//
+// Depending on the policy, a request sent while offline is either queued, rejected with an error,
+// or replaces a previously queued request. Replaced requests are canceled via the OnRequestCanceled callback.
+//
+// Requests which were already queued when the dispatcher is paused are classified as well, both when pausing
+// and when resuming, so that the backlog sent after reconnecting is compacted.
+// A request which was transmitted already is never dropped or replaced.
+func (d *DefaultClientDispatcher) SetOfflinePolicy(policy *OfflinePolicy) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.offlinePolicy = policy
+}
+
+// SetMetrics sets the Metrics implementation, which the dispatcher reports queue depth,
+// request latency, timeouts and cancellations to. By default, a VoidMetrics is used.
+//
+// This function must be called before starting the dispatcher.
+func (d *DefaultClientDispatcher) SetMetrics(m metrics.Metrics) {
+	d.metrics = m
+}
+
+// SetLogger sets a custom Logger implementation for this dispatcher only.
+// Passing nil restores the package-level logger.
+func (d *DefaultClientDispatcher) SetLogger(logger logging.Logger) {
+	d.logger = logger
+}
+
+func (d *DefaultClientDispatcher) getLogger() logging.Logger {
+	if d.logger != nil {
+		return d.logger
+	}
+	return log
+}
+
+func (d *DefaultClientDispatcher) reportQueueDepth() {
+	d.metrics.SetGauge(metrics.RequestQueueDepth, float64(d.requestQueue.Size()), clientLabels)
+}
+
+func (d *DefaultClientDispatcher) getRetryPolicy(featureName string) (RetryPolicy, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	policy, ok := d.retryPolicies[featureName]
+	return policy, ok
+}
+
 func (d *DefaultClientDispatcher) SetOnRequestCanceled(cb func(requestID string, request ocpp.Request, err *ocpp.Error)) {
 	d.onRequestCancel = cb
 }
 
+func (d *DefaultClientDispatcher) setCancelObserver(observer func(requestID string, err *ocpp.Error)) {
+	d.cancelObserver = observer
+}
+
+// Notifies the cancel observer and the onRequestCancel callback, if set, of a canceled request.
+func (d *DefaultClientDispatcher) requestCanceled(requestID string, request ocpp.Request, err *ocpp.Error) {
+	if d.cancelObserver != nil {
+		d.cancelObserver(requestID, err)
+	}
+	if d.onRequestCancel != nil {
+		d.onRequestCancel(requestID, request, err)
+	}
+}
+
 func (d *DefaultClientDispatcher) SetTimeout(timeout time.Duration) {
 	d.timeout = timeout
 }
@@ -126,10 +248,27 @@ func (d *DefaultClientDispatcher) Start() {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 	d.requestChannel = make(chan bool, 1)
+	d.canceledC = make(chan canceledContext, 10)
+	d.callErrorC = make(chan failedRequest)
+	d.stoppedC = make(chan struct{})
 	d.timer = time.NewTimer(defaultTimeoutTick) // Default to 24 hours tick
+	if !d.requestQueue.IsEmpty() {
+		// Requests were queued before starting (e.g. restored from a persistent queue)
+		d.requestChannel <- true
+	}
 	go d.messagePump()
 }
 
+// Restores the requests persisted by the request queue, if it is a PersistentRequestQueue.
+// Returns nil if the queue doesn't support persistence.
+func (d *DefaultClientDispatcher) restoreRequests(decode func(data []byte) (*Call, error)) ([]RequestBundle, error) {
+	q, ok := d.requestQueue.(PersistentRequestQueue)
+	if !ok {
+		return nil, nil
+	}
+	return q.Restore(decode)
+}
+
 func (d *DefaultClientDispatcher) IsRunning() bool {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
@@ -146,6 +285,7 @@ func (d *DefaultClientDispatcher) Stop() {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 	close(d.requestChannel)
+	close(d.stoppedC)
 	// TODO: clear pending requests?
 }
 
@@ -161,15 +301,179 @@ func (d *DefaultClientDispatcher) SendRequest(req RequestBundle) error {
 	if d.network == nil {
 		return fmt.Errorf("cannot SendRequest, no network client was set")
 	}
+	d.mutex.RLock()
+	policy := d.offlinePolicy
+	offline := d.paused
+	d.mutex.RUnlock()
+	action, key := OfflineKeep, ""
+	if offline && policy != nil {
+		action, key = policy.Classify(req.Call.Payload)
+	}
+	if action == OfflineDrop {
+		withFields(d.getLogger(), "", req.Call.UniqueId, req.Call.Action).Infof("dropping request %v while offline", req.Call.UniqueId)
+		d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleClient, req.Call.Action, "dropped"))
+		return fmt.Errorf("client is offline, %v request dropped", req.Call.Action)
+	}
+	if hasContext(req) {
+		req.done = make(chan struct{})
+	}
+	// The request is queued while holding the lock, so the dispatcher can't be stopped in the meantime
+	d.mutex.RLock()
+	if d.isStopped() {
+		d.mutex.RUnlock()
+		return fmt.Errorf("cannot SendRequest, dispatcher was stopped")
+	}
+	var superseded interface{}
+	if action == OfflineCoalesce {
+		superseded = d.removeCoalesced(policy, key)
+	}
 	if err := d.requestQueue.Push(req); err != nil {
+		d.mutex.RUnlock()
 		return err
 	}
-	d.mutex.RLock()
-	d.requestChannel <- true
+	req.traceEvent(EventQueued)
+	d.reportQueueDepth()
+	// Not started yet: the request is dispatched as soon as the dispatcher is started.
+	// Its context is not watched, since there is no message pump to notify.
+	if d.stoppedC != nil {
+		d.requestChannel <- true
+		if req.done != nil {
+			go d.watchContext(req, d.stoppedC)
+		}
+	}
 	d.mutex.RUnlock()
+	if bundle, ok := superseded.(RequestBundle); ok {
+		d.supersedeRequest(bundle, req.Call.UniqueId)
+	}
 	return nil
 }
 
+// Returns true if the dispatcher was stopped and wasn't restarted since.
+// Returns false if the dispatcher was never started. Must be invoked while holding the mutex.
+func (d *DefaultClientDispatcher) isStopped() bool {
+	select {
+	case <-d.stoppedC:
+		return true
+	default:
+		return false
+	}
+}
+
+// supersedeRequest cancels a request, which was removed from the queue in favor of a newer request.
+func (d *DefaultClientDispatcher) supersedeRequest(bundle RequestBundle, newRequestID string) {
+	bundle.complete()
+	withFields(d.getLogger(), "", bundle.Call.UniqueId, bundle.Call.Action).Infof("request %v superseded by %v while offline", bundle.Call.UniqueId, newRequestID)
+	d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleClient, bundle.Call.Action, "superseded"))
+	// The caller may be holding locks, which are needed by the callback
+	go d.requestCanceled(bundle.Call.UniqueId, bundle.Call.Payload,
+		ocpp.NewError(GenericError, fmt.Sprintf("Request superseded by %v", newRequestID), bundle.Call.UniqueId))
+}
+
+// removeCoalesced removes the first queued request with the given coalescing key.
+// The request at the front of the queue is only removed, if it wasn't sent yet.
+func (d *DefaultClientDispatcher) removeCoalesced(policy *OfflinePolicy, key string) interface{} {
+	queue, ok := d.requestQueue.(removableQueue)
+	if !ok {
+		return nil
+	}
+	head := true
+	return queue.Remove(func(element interface{}) bool {
+		bundle, ok := element.(RequestBundle)
+		if !ok {
+			return false
+		}
+		if head {
+			head = false
+			if d.headSent(bundle) {
+				return false
+			}
+		}
+		action, k := policy.Classify(bundle.Call.Payload)
+		return action == OfflineCoalesce && k == key
+	})
+}
+
+// headSent returns true if the request at the front of the queue was already transmitted at least once.
+// Such a request may not be removed from the queue anymore, since a response to it may still be received.
+func (d *DefaultClientDispatcher) headSent(bundle RequestBundle) bool {
+	if _, pending := d.pendingRequestState.GetPendingRequest(bundle.Call.UniqueId); pending {
+		return true
+	}
+	// Request may be waiting for retransmission
+	return d.attemptsID == bundle.Call.UniqueId
+}
+
+// reclassifyQueue applies the offline policy to all queued requests, as if they had been sent while offline.
+// Requests to be dropped are canceled, while coalesced requests are replaced by the most recent request with the same key.
+// If skipHead is set, the request at the front of the queue is left untouched.
+//
+// Must be invoked while holding the mutex.
+func (d *DefaultClientDispatcher) reclassifyQueue(skipHead bool) {
+	policy := d.offlinePolicy
+	queue, ok := d.requestQueue.(removableQueue)
+	if policy == nil || !ok {
+		return
+	}
+	// Collect all queued requests, without removing any
+	var bundles []RequestBundle
+	queue.Remove(func(element interface{}) bool {
+		if bundle, ok := element.(RequestBundle); ok {
+			bundles = append(bundles, bundle)
+		}
+		return false
+	})
+	if skipHead && len(bundles) > 0 {
+		bundles = bundles[1:]
+	}
+	actions := make([]OfflineAction, len(bundles))
+	keys := make([]string, len(bundles))
+	latest := map[string]string{}
+	for i, bundle := range bundles {
+		actions[i], keys[i] = policy.Classify(bundle.Call.Payload)
+		if actions[i] == OfflineCoalesce {
+			latest[keys[i]] = bundle.Call.UniqueId
+		}
+	}
+	for i, bundle := range bundles {
+		requestID := bundle.Call.UniqueId
+		if actions[i] == OfflineDrop {
+			if queue.Remove(matchRequest(requestID)) != nil {
+				d.dropQueuedRequest(bundle)
+			}
+		} else if actions[i] == OfflineCoalesce && latest[keys[i]] != requestID {
+			if queue.Remove(matchRequest(requestID)) != nil {
+				d.supersedeRequest(bundle, latest[keys[i]])
+			}
+		}
+	}
+	d.reportQueueDepth()
+}
+
+// dropQueuedRequest cancels a request, which was removed from the queue because of the offline policy.
+func (d *DefaultClientDispatcher) dropQueuedRequest(bundle RequestBundle) {
+	bundle.complete()
+	withFields(d.getLogger(), "", bundle.Call.UniqueId, bundle.Call.Action).Infof("dropping queued request %v while offline", bundle.Call.UniqueId)
+	d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleClient, bundle.Call.Action, "dropped"))
+	// The caller may be holding locks, which are needed by the callback
+	go d.requestCanceled(bundle.Call.UniqueId, bundle.Call.Payload,
+		ocpp.NewError(GenericError, "Request dropped while offline", bundle.Call.UniqueId))
+}
+
+// watchContext waits for the context of a request to be done, then notifies the messagePump.
+// The routine returns as soon as the request leaves the queue or the dispatcher is stopped.
+func (d *DefaultClientDispatcher) watchContext(req RequestBundle, stoppedC chan struct{}) {
+	select {
+	case <-req.Context.Done():
+		select {
+		case d.canceledC <- canceledContext{requestID: req.Call.UniqueId, err: req.Context.Err()}:
+		case <-req.done:
+		case <-stoppedC:
+		}
+	case <-req.done:
+	case <-stoppedC:
+	}
+}
+
 func (d *DefaultClientDispatcher) messagePump() {
 	rdy := true // Ready to transmit at the beginning
 
@@ -184,7 +488,11 @@ func (d *DefaultClientDispatcher) messagePump() {
 		case _, ok := <-reqChan():
 			// New request was posted
 			if !ok {
-				d.requestQueue.Init()
+				// Persisted requests are kept, so they may be sent after a restart
+				if _, persistent := d.requestQueue.(PersistentRequestQueue); !persistent {
+					d.requestQueue.Init()
+					d.reportQueueDepth()
+				}
 				d.mutex.Lock()
 				d.requestChannel = nil
 				d.mutex.Unlock()
@@ -196,17 +504,26 @@ func (d *DefaultClientDispatcher) messagePump() {
 				continue
 			}
 			if d.pendingRequestState.HasPendingRequest() {
-				// Current request timed out. Removing request and triggering cancel callback
+				// Current request timed out. Retransmitting or removing request
 				el := d.requestQueue.Peek()
 				bundle, _ := el.(RequestBundle)
-				d.CompleteRequest(bundle.Call.UniqueId)
-				if d.onRequestCancel != nil {
-					d.onRequestCancel(bundle.Call.UniqueId, bundle.Call.Payload,
-						ocpp.NewError(GenericError, "Request timed out", bundle.Call.UniqueId))
-				}
+				d.metrics.IncCounter(metrics.RequestTimeoutsTotal, actionLabels(metrics.RoleClient, bundle.Call.Action))
+				d.timer.Reset(d.requestFailed(bundle, ocpp.NewError(GenericError, "Request timed out", bundle.Call.UniqueId)))
+				continue
+			}
+			if d.retrying {
+				// Retry interval elapsed, retransmitting current request
+				d.retrying = false
+				rdy = true
 			}
 			// No request is currently pending -> set timer to high number
 			d.timer.Reset(defaultTimeoutTick)
+		case canceled := <-d.canceledC:
+			// Context of a request is done
+			d.cancelRequest(canceled.requestID, canceled.err)
+		case failed := <-d.callErrorC:
+			// Pending request was answered with a CALLERROR
+			failed.retryC <- d.retryFailedRequest(failed.requestID, failed.err)
 		case rdy = <-d.readyForDispatch:
 			// Ready flag set, keep going
 		}
@@ -219,35 +536,160 @@ func (d *DefaultClientDispatcher) messagePump() {
 
 		// Only dispatch request if able to send and request queue isn't empty
 		if rdy && !d.requestQueue.IsEmpty() {
-			d.dispatchNextRequest()
+			next := d.dispatchNextRequest()
 			rdy = false
 			// Set timer
 			if !d.timer.Stop() {
 				<-d.timer.C
 			}
-			d.timer.Reset(d.timeout)
+			d.timer.Reset(next)
 		}
 	}
 }
 
-func (d *DefaultClientDispatcher) dispatchNextRequest() {
+// dispatchNextRequest sends the request at the front of the queue.
+// Returns the duration after which the messagePump needs to be woken up.
+func (d *DefaultClientDispatcher) dispatchNextRequest() time.Duration {
 	// Get first element in queue
 	el := d.requestQueue.Peek()
 	bundle, _ := el.(RequestBundle)
+	for bundle.Context != nil && bundle.Context.Err() != nil {
+		// Context is done, but the request couldn't be removed from the queue before (see removableQueue)
+		d.requestQueue.Pop()
+		bundle.complete()
+		d.reportQueueDepth()
+		d.requestContextDone(bundle.Call.UniqueId, bundle, bundle.Context.Err())
+		if d.requestQueue.IsEmpty() {
+			return defaultTimeoutTick
+		}
+		bundle, _ = d.requestQueue.Peek().(RequestBundle)
+	}
 	jsonMessage := bundle.Data
+	if bundle.Call.UniqueId != d.attemptsID {
+		d.attemptsID = bundle.Call.UniqueId
+		d.attempts = 0
+	}
+	d.attempts++
+	d.retrying = false
 	d.pendingRequestState.AddPendingRequest(bundle.Call.UniqueId, bundle.Call.Payload)
 	// Attempt to send over network
 	err := d.network.Write(jsonMessage)
 	if err != nil {
-		// TODO: handle retransmission instead of skipping request altogether
-		d.CompleteRequest(bundle.Call.GetUniqueId())
-		if d.onRequestCancel != nil {
-			d.onRequestCancel(bundle.Call.UniqueId, bundle.Call.Payload,
-				ocpp.NewError(InternalError, err.Error(), bundle.Call.UniqueId))
+		return d.requestFailed(bundle, ocpp.NewError(InternalError, err.Error(), bundle.Call.UniqueId))
+	}
+	d.latency.start(bundle.Call.UniqueId)
+	d.metrics.IncCounter(metrics.RequestsSentTotal, actionLabels(metrics.RoleClient, bundle.Call.Action))
+	bundle.traceEvent(EventSent)
+	withFields(d.getLogger(), "", bundle.Call.UniqueId, bundle.Call.Action).Infof("dispatched request %s to server", bundle.Call.UniqueId)
+	withFields(d.getLogger(), "", bundle.Call.UniqueId, bundle.Call.Action).Debugf("sent JSON message to server: %s", string(jsonMessage))
+	return d.timeout
+}
+
+// requestFailed handles a failed transmission of the request at the front of the queue.
+// If the retry policy for the request allows it, the request is kept and retransmitted later.
+// Otherwise the request is removed from the queue and the onRequestCancel callback is invoked.
+//
+// Returns the duration after which the messagePump needs to be woken up.
+func (d *DefaultClientDispatcher) requestFailed(bundle RequestBundle, err *ocpp.Error) time.Duration {
+	requestID := bundle.Call.UniqueId
+	// No response was received, so the request doesn't count towards the latency
+	d.latency.stop(requestID)
+	policy, ok := d.getRetryPolicy(bundle.Call.Action)
+	if ok && d.attemptsID == requestID && d.attempts < policy.MaxAttempts {
+		d.pendingRequestState.DeletePendingRequest(requestID)
+		d.retrying = true
+		interval := policy.backoff(d.attempts)
+		bundle.traceEvent(EventRetry)
+		withFields(d.getLogger(), "", requestID, bundle.Call.Action).Infof("request %v failed (attempt %v/%v): %v, retrying in %v", requestID, d.attempts, policy.MaxAttempts, err.Description, interval)
+		return interval
+	}
+	d.retrying = false
+	d.CompleteRequest(requestID)
+	d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleClient, bundle.Call.Action, "failed"))
+	d.requestCanceled(requestID, bundle.Call.Payload, err)
+	return defaultTimeoutTick
+}
+
+// retryOnError is invoked when the pending request was answered with a CALLERROR.
+// If the retry policy for the request allows it, the request is retransmitted later and true is returned.
+// Otherwise the request needs to be completed by the caller, as for any other response.
+func (d *DefaultClientDispatcher) retryOnError(requestID string, err *ocpp.Error) bool {
+	d.mutex.RLock()
+	callErrorC := d.callErrorC
+	stoppedC := d.stoppedC
+	d.mutex.RUnlock()
+	if callErrorC == nil {
+		return false
+	}
+	failed := failedRequest{requestID: requestID, err: err, retryC: make(chan bool, 1)}
+	select {
+	case callErrorC <- failed:
+		return <-failed.retryC
+	case <-stoppedC:
+		return false
+	}
+}
+
+// retryFailedRequest schedules the retransmission of the pending request, after it was answered with a CALLERROR.
+// Returns false if the request has no retry policy, or if all attempts were used up.
+func (d *DefaultClientDispatcher) retryFailedRequest(requestID string, err *ocpp.Error) bool {
+	if _, isPending := d.pendingRequestState.GetPendingRequest(requestID); !isPending {
+		return false
+	}
+	bundle, ok := d.requestQueue.Peek().(RequestBundle)
+	if !ok || bundle.Call == nil || bundle.Call.UniqueId != requestID {
+		return false
+	}
+	policy, ok := d.getRetryPolicy(bundle.Call.Action)
+	if !ok || d.attemptsID != requestID || d.attempts >= policy.MaxAttempts {
+		return false
+	}
+	next := d.requestFailed(bundle, err)
+	if !d.timer.Stop() {
+		<-d.timer.C
+	}
+	d.timer.Reset(next)
+	return true
+}
+
+// cancelRequest removes a request from the queue, after its context was done.
+// A request that was already sent is completed as if it timed out.
+func (d *DefaultClientDispatcher) cancelRequest(requestID string, err error) {
+	var bundle RequestBundle
+	if _, isPending := d.pendingRequestState.GetPendingRequest(requestID); isPending {
+		bundle, _ = d.requestQueue.Peek().(RequestBundle)
+		d.latency.stop(requestID)
+		d.CompleteRequest(requestID)
+	} else {
+		queue, ok := d.requestQueue.(removableQueue)
+		if !ok {
+			// Request is canceled once it reaches the front of the queue
+			return
+		}
+		el := queue.Remove(matchRequest(requestID))
+		if el == nil {
+			// Request was already completed
+			return
+		}
+		d.reportQueueDepth()
+		bundle, _ = el.(RequestBundle)
+		if d.retrying && d.attemptsID == requestID {
+			// Request was waiting for retransmission, the next request may be sent right away
+			d.retrying = false
+			select {
+			case d.readyForDispatch <- true:
+			default:
+			}
 		}
 	}
-	log.Infof("dispatched request %s to server", bundle.Call.UniqueId)
-	log.Debugf("sent JSON message to server: %s", string(jsonMessage))
+	d.requestContextDone(requestID, bundle, err)
+}
+
+// requestContextDone notifies about a request, which was removed from the queue because its context is done.
+func (d *DefaultClientDispatcher) requestContextDone(requestID string, bundle RequestBundle, err error) {
+	withFields(d.getLogger(), "", requestID, bundle.Call.Action).Infof("request %v canceled: %v", requestID, err)
+	d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleClient, bundle.Call.Action, "context"))
+	d.requestCanceled(requestID, bundle.Call.Payload, contextCanceledError(requestID, err))
 }
 
 func (d *DefaultClientDispatcher) Pause() {
@@ -258,10 +700,15 @@ func (d *DefaultClientDispatcher) Pause() {
 	}
 	d.timer.Reset(defaultTimeoutTick)
 	d.paused = true
+	// The request at the front of the queue may be in flight, while the connection drops
+	d.reclassifyQueue(true)
 }
 
 func (d *DefaultClientDispatcher) Resume() {
 	d.mutex.Lock()
+	// No request is dispatched while paused, so the front of the queue may be reclassified as well
+	head, _ := d.requestQueue.Peek().(RequestBundle)
+	d.reclassifyQueue(head.Call != nil && d.headSent(head))
 	d.paused = false
 	d.mutex.Unlock()
 	if d.pendingRequestState.HasPendingRequest() {
@@ -276,17 +723,22 @@ func (d *DefaultClientDispatcher) Resume() {
 func (d *DefaultClientDispatcher) CompleteRequest(requestId string) {
 	el := d.requestQueue.Peek()
 	if el == nil {
-		log.Errorf("attempting to pop front of queue, but queue is empty")
+		withFields(d.getLogger(), "", requestId, "").Errorf("attempting to pop front of queue, but queue is empty")
 		return
 	}
 	bundle, _ := el.(RequestBundle)
 	if bundle.Call.UniqueId != requestId {
-		log.Errorf("internal state mismatch: received response for %v but expected response for %v", requestId, bundle.Call.UniqueId)
+		withFields(d.getLogger(), "", requestId, "").Errorf("internal state mismatch: received response for %v but expected response for %v", requestId, bundle.Call.UniqueId)
 		return
 	}
 	d.requestQueue.Pop()
+	bundle.complete()
 	d.pendingRequestState.DeletePendingRequest(requestId)
-	log.Debugf("removed request %v from front of queue", bundle.Call.UniqueId)
+	d.reportQueueDepth()
+	if elapsed, ok := d.latency.stop(requestId); ok {
+		d.metrics.ObserveHistogram(metrics.RequestDurationSeconds, elapsed.Seconds(), actionLabels(metrics.RoleClient, bundle.Call.Action))
+	}
+	withFields(d.getLogger(), "", bundle.Call.UniqueId, bundle.Call.Action).Debugf("removed request %v from front of queue", bundle.Call.UniqueId)
 	// Signal that next message in queue may be sent
 	d.readyForDispatch <- true
 }
@@ -317,6 +769,10 @@ type ServerDispatcher interface {
 	// Dispatches a request for a specific client. Depending on the implementation, this may first queue
 	// a request and process it later (asynchronously), or write it directly to the networking layer.
 	//
+	// If the request carries a context, the request is canceled as soon as the context is done:
+	// a queued request is removed from the client's queue, while a pending request is treated as timed out.
+	// In both cases, the OnRequestCanceled callback is invoked.
+	//
 	// If no network server was set, or the request couldn't be processed, an error is returned.
 	SendRequest(clientID string, req RequestBundle) error
 	// Notifies the dispatcher that a request has been completed (i.e. a response was received),
@@ -368,11 +824,20 @@ type DefaultServerDispatcher struct {
 	pendingRequestState ServerState
 	timeout             time.Duration
 	timerC              chan string
+	canceledC           chan canceledContext
+	replacedC           chan string
 	running             bool
 	stoppedC            chan struct{}
 	onRequestCancel     CanceledRequestHandler
+	cancelObserver      func(clientID string, requestID string, err *ocpp.Error)
 	network             ws.WsServer
 	mutex               sync.RWMutex
+	metrics             metrics.Metrics
+	latency             *requestLatency
+	queued              int64
+	drainedC            chan struct{} // closed once no requests are queued anymore, created by Drain
+	drainMutex          sync.Mutex
+	logger              logging.Logger
 }
 
 // Handler function to be invoked when a request gets canceled (either due to timeout or to other external factors).
@@ -395,6 +860,8 @@ func NewDefaultServerDispatcher(queueMap ServerQueueMap) *DefaultServerDispatche
 		requestChannel:   nil,
 		readyForDispatch: make(chan string, 1),
 		timeout:          defaultMessageTimeout,
+		metrics:          &metrics.VoidMetrics{},
+		latency:          newRequestLatency(),
 	}
 	d.pendingRequestState = NewServerState(&d.mutex)
 	return d
@@ -405,6 +872,8 @@ func (d *DefaultServerDispatcher) Start() {
 	defer d.mutex.Unlock()
 	d.requestChannel = make(chan string, 20)
 	d.timerC = make(chan string, 10)
+	d.canceledC = make(chan canceledContext, 10)
+	d.replacedC = make(chan string, 10)
 	d.stoppedC = make(chan struct{}, 1)
 	d.running = true
 	go d.messagePump()
@@ -419,10 +888,74 @@ func (d *DefaultServerDispatcher) IsRunning() bool {
 func (d *DefaultServerDispatcher) Stop() {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
+	if !d.running {
+		return
+	}
 	d.running = false
 	close(d.stoppedC)
 }
 
+// Drain waits until all queued and pending requests were completed, either by receiving a response,
+// or by being canceled. Requests sent in the meantime are waited for as well.
+//
+// If the passed context is done before, the context error is returned.
+func (d *DefaultServerDispatcher) Drain(ctx context.Context) error {
+	d.drainMutex.Lock()
+	if atomic.LoadInt64(&d.queued) == 0 {
+		d.drainMutex.Unlock()
+		return nil
+	}
+	if d.drainedC == nil {
+		d.drainedC = make(chan struct{})
+	}
+	drainedC := d.drainedC
+	d.drainMutex.Unlock()
+	select {
+	case <-drainedC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetMetrics sets the Metrics implementation, which the dispatcher reports queue depth,
+// request latency, timeouts and cancellations to. By default, a VoidMetrics is used.
+//
+// The reported queue depth is the total amount of queued requests, across all clients.
+//
+// This function must be called before starting the dispatcher.
+func (d *DefaultServerDispatcher) SetMetrics(m metrics.Metrics) {
+	d.metrics = m
+}
+
+// SetLogger sets a custom Logger implementation for this dispatcher only.
+// Passing nil restores the package-level logger.
+func (d *DefaultServerDispatcher) SetLogger(logger logging.Logger) {
+	d.logger = logger
+}
+
+func (d *DefaultServerDispatcher) getLogger() logging.Logger {
+	if d.logger != nil {
+		return d.logger
+	}
+	return log
+}
+
+// Updates the total amount of queued requests by the given delta, and reports it.
+func (d *DefaultServerDispatcher) addQueued(delta int) {
+	queued := atomic.AddInt64(&d.queued, int64(delta))
+	d.metrics.SetGauge(metrics.RequestQueueDepth, float64(queued), serverLabels)
+	if queued == 0 {
+		d.drainMutex.Lock()
+		// Requests may have been queued again in the meantime
+		if d.drainedC != nil && atomic.LoadInt64(&d.queued) == 0 {
+			close(d.drainedC)
+			d.drainedC = nil
+		}
+		d.drainMutex.Unlock()
+	}
+}
+
 func (d *DefaultServerDispatcher) SetTimeout(timeout time.Duration) {
 	d.timeout = timeout
 }
@@ -434,6 +967,9 @@ func (d *DefaultServerDispatcher) CreateClient(clientID string) {
 }
 
 func (d *DefaultServerDispatcher) DeleteClient(clientID string) {
+	if q, ok := d.queueMap.Get(clientID); ok {
+		d.addQueued(-q.Size())
+	}
 	d.queueMap.Remove(clientID)
 	if d.IsRunning() {
 		d.mutex.RLock()
@@ -442,6 +978,16 @@ func (d *DefaultServerDispatcher) DeleteClient(clientID string) {
 	}
 }
 
+// Notifies the messagePump, that the connection of a client was replaced by a new connection.
+// The request in flight to the client, if any, is canceled, since its response was lost with the replaced connection.
+func (d *DefaultServerDispatcher) clientReplaced(clientID string) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.running {
+		d.replacedC <- clientID
+	}
+}
+
 func (d *DefaultServerDispatcher) SetNetworkServer(server ws.WsServer) {
 	d.network = server
 }
@@ -450,6 +996,20 @@ func (d *DefaultServerDispatcher) SetOnRequestCanceled(cb CanceledRequestHandler
 	d.onRequestCancel = cb
 }
 
+func (d *DefaultServerDispatcher) setCancelObserver(observer func(clientID string, requestID string, err *ocpp.Error)) {
+	d.cancelObserver = observer
+}
+
+// Notifies the cancel observer and the onRequestCancel callback, if set, of a canceled request.
+func (d *DefaultServerDispatcher) requestCanceled(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+	if d.cancelObserver != nil {
+		d.cancelObserver(clientID, requestID, err)
+	}
+	if d.onRequestCancel != nil {
+		d.onRequestCancel(clientID, requestID, request, err)
+	}
+}
+
 func (d *DefaultServerDispatcher) SetPendingRequestState(state ServerState) {
 	d.pendingRequestState = state
 }
@@ -462,15 +1022,38 @@ func (d *DefaultServerDispatcher) SendRequest(clientID string, req RequestBundle
 	if !ok {
 		return fmt.Errorf("cannot send request %s, no client %s exists", req.Call.UniqueId, clientID)
 	}
+	if hasContext(req) {
+		req.done = make(chan struct{})
+	}
 	if err := q.Push(req); err != nil {
 		return err
 	}
+	req.traceEvent(EventQueued)
+	d.addQueued(1)
 	d.mutex.RLock()
 	d.requestChannel <- clientID
+	if req.done != nil {
+		go d.watchContext(clientID, req, d.stoppedC)
+	}
 	d.mutex.RUnlock()
 	return nil
 }
 
+// watchContext waits for the context of a request to be done, then notifies the messagePump.
+// The routine returns as soon as the request leaves the queue or the dispatcher is stopped.
+func (d *DefaultServerDispatcher) watchContext(clientID string, req RequestBundle, stoppedC chan struct{}) {
+	select {
+	case <-req.Context.Done():
+		select {
+		case d.canceledC <- canceledContext{clientID: clientID, requestID: req.Call.UniqueId, err: req.Context.Err()}:
+		case <-req.done:
+		case <-stoppedC:
+		}
+	case <-req.done:
+	case <-stoppedC:
+	}
+}
+
 // requestPump processes new outgoing requests for each client and makes sure they are processed sequentially.
 // This method is executed by a dedicated coroutine as soon as the server is started and runs indefinitely.
 func (d *DefaultServerDispatcher) messagePump() {
@@ -493,7 +1076,9 @@ func (d *DefaultServerDispatcher) messagePump() {
 		case <-d.stoppedC:
 			// Server was stopped
 			d.queueMap.Init()
-			log.Info("stopped processing requests")
+			atomic.StoreInt64(&d.queued, 0)
+			d.metrics.SetGauge(metrics.RequestQueueDepth, 0, serverLabels)
+			d.getLogger().Info("stopped processing requests")
 			return
 		case clientID = <-reqChan():
 			// Check whether there is a request queue for the specified client
@@ -523,7 +1108,7 @@ func (d *DefaultServerDispatcher) messagePump() {
 				continue
 			}
 			// Canceling timeout context
-			log.Debugf("timeout for client %v, canceling message", clientID)
+			withFields(d.getLogger(), clientID, "", "").Debugf("timeout for client %v, canceling message", clientID)
 			clientCtx = clientContextMap[clientID]
 			if clientCtx.isActive() {
 				clientCtx.cancel()
@@ -533,13 +1118,49 @@ func (d *DefaultServerDispatcher) messagePump() {
 				// Current request for client timed out. Removing request and triggering cancel callback
 				q, _ := d.queueMap.Get(clientID)
 				bundle, _ := q.Peek().(RequestBundle)
+				d.metrics.IncCounter(metrics.RequestTimeoutsTotal, actionLabels(metrics.RoleServer, bundle.Call.Action))
+				d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleServer, bundle.Call.Action, "failed"))
+				d.latency.stop(clientID + "/" + bundle.Call.UniqueId)
 				d.CompleteRequest(clientID, bundle.Call.UniqueId)
-				log.Infof("request %v for %v timed out", bundle.Call.UniqueId, clientID)
-				if d.onRequestCancel != nil {
-					d.onRequestCancel(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
-						ocpp.NewError(GenericError, "Request timed out", bundle.Call.UniqueId))
+				withFields(d.getLogger(), clientID, bundle.Call.UniqueId, bundle.Call.Action).Infof("request %v for %v timed out", bundle.Call.UniqueId, clientID)
+				d.requestCanceled(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
+					ocpp.NewError(GenericError, "Request timed out", bundle.Call.UniqueId))
+			}
+		case canceled := <-d.canceledC:
+			// Context of a request is done
+			if _, ok = d.queueMap.Get(canceled.clientID); !ok {
+				continue
+			}
+			if d.pendingRequestState.HasPendingRequest(canceled.clientID) {
+				// Cancel timeout of the pending request, if the request is the one being canceled
+				if _, isPending := d.pendingRequestState.GetClientState(canceled.clientID).GetPendingRequest(canceled.requestID); isPending {
+					clientCtx = clientContextMap[canceled.clientID]
+					if clientCtx.isActive() {
+						clientCtx.cancel()
+						clientContextMap[canceled.clientID] = clientTimeoutContext{}
+					}
 				}
 			}
+			d.cancelRequest(canceled.clientID, canceled.requestID, canceled.err)
+			continue
+		case clientID = <-d.replacedC:
+			// Connection of a client was replaced, the pending request won't be answered anymore
+			clientCtx = clientContextMap[clientID]
+			if clientCtx.isActive() {
+				clientCtx.cancel()
+				clientContextMap[clientID] = clientTimeoutContext{}
+			}
+			if d.pendingRequestState.HasPendingRequest(clientID) {
+				q, _ := d.queueMap.Get(clientID)
+				bundle, _ := q.Peek().(RequestBundle)
+				d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleServer, bundle.Call.Action, "replaced"))
+				d.latency.stop(clientID + "/" + bundle.Call.UniqueId)
+				d.CompleteRequest(clientID, bundle.Call.UniqueId)
+				withFields(d.getLogger(), clientID, bundle.Call.UniqueId, bundle.Call.Action).Infof("request %v for %v canceled, connection was replaced", bundle.Call.UniqueId, clientID)
+				d.requestCanceled(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
+					ocpp.NewError(GenericError, "Connection replaced", bundle.Call.UniqueId))
+			}
+			continue
 		case clientID = <-d.readyForDispatch:
 			// Cancel previous timeout (if any)
 			clientCtx, ok = clientContextMap[clientID]
@@ -553,7 +1174,7 @@ func (d *DefaultServerDispatcher) messagePump() {
 				// Ready to transmit
 				rdy = true
 			}
-			log.Debugf("%v ready to transmit again", clientID)
+			withFields(d.getLogger(), clientID, "", "").Debugf("%v ready to transmit again", clientID)
 		}
 
 		// Only dispatch request if able to send and request queue isn't empty
@@ -574,23 +1195,33 @@ func (d *DefaultServerDispatcher) dispatchNextRequest(clientID string) (clientCt
 	// Get first element in queue
 	q, ok := d.queueMap.Get(clientID)
 	if !ok {
-		log.Errorf("failed to dispatch next request for %s, no request queue available", clientID)
+		withFields(d.getLogger(), clientID, "", "").Errorf("failed to dispatch next request for %s, no request queue available", clientID)
 		return
 	}
 	el := q.Peek()
 	bundle, _ := el.(RequestBundle)
+	for bundle.Context != nil && bundle.Context.Err() != nil {
+		// Context is done, but the request couldn't be removed from the queue before (see removableQueue)
+		q.Pop()
+		bundle.complete()
+		d.addQueued(-1)
+		d.requestContextDone(clientID, bundle.Call.UniqueId, bundle, bundle.Context.Err())
+		if q.IsEmpty() {
+			return
+		}
+		bundle, _ = q.Peek().(RequestBundle)
+	}
 	jsonMessage := bundle.Data
 	callID := bundle.Call.GetUniqueId()
 	d.pendingRequestState.AddPendingRequest(clientID, callID, bundle.Call.Payload)
 	err := d.network.Write(clientID, jsonMessage)
 	if err != nil {
-		log.Errorf("error while sending message: %v", err)
+		withFields(d.getLogger(), clientID, callID, bundle.Call.Action).Errorf("error while sending message: %v", err)
 		// TODO: handle retransmission instead of removing pending request
 		d.CompleteRequest(clientID, callID)
-		if d.onRequestCancel != nil {
-			d.onRequestCancel(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
-				ocpp.NewError(InternalError, err.Error(), bundle.Call.UniqueId))
-		}
+		d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleServer, bundle.Call.Action, "failed"))
+		d.requestCanceled(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
+			ocpp.NewError(InternalError, err.Error(), bundle.Call.UniqueId))
 		return
 	}
 	// Create and return context (only if timeout is set)
@@ -598,14 +1229,17 @@ func (d *DefaultServerDispatcher) dispatchNextRequest(clientID string) (clientCt
 		ctx, cancel := context.WithTimeout(context.TODO(), d.timeout)
 		clientCtx = clientTimeoutContext{ctx: ctx, cancel: cancel}
 	}
-	log.Infof("dispatched request %s for %s", callID, clientID)
-	log.Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
+	d.latency.start(clientID + "/" + callID)
+	d.metrics.IncCounter(metrics.RequestsSentTotal, actionLabels(metrics.RoleServer, bundle.Call.Action))
+	bundle.traceEvent(EventSent)
+	withFields(d.getLogger(), clientID, callID, bundle.Call.Action).Infof("dispatched request %s for %s", callID, clientID)
+	withFields(d.getLogger(), clientID, callID, bundle.Call.Action).Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
 	return
 }
 
 func (d *DefaultServerDispatcher) waitForTimeout(clientID string, clientCtx clientTimeoutContext) {
 	defer clientCtx.cancel()
-	log.Debugf("started timeout timer for %s", clientID)
+	withFields(d.getLogger(), clientID, "", "").Debugf("started timeout timer for %s", clientID)
 	select {
 	case <-clientCtx.ctx.Done():
 		err := clientCtx.ctx.Err()
@@ -617,33 +1251,74 @@ func (d *DefaultServerDispatcher) waitForTimeout(clientID string, clientCtx clie
 				d.timerC <- clientID
 			}
 		} else {
-			log.Debugf("timeout canceled for %s", clientID)
+			withFields(d.getLogger(), clientID, "", "").Debugf("timeout canceled for %s", clientID)
 		}
 	case <-d.stoppedC:
 		// Server was stopped, every pending timeout gets canceled
 	}
 }
 
+// cancelRequest removes a request from a client's queue, after its context was done.
+// A request that was already sent is completed as if it timed out.
+func (d *DefaultServerDispatcher) cancelRequest(clientID string, requestID string, err error) {
+	q, ok := d.queueMap.Get(clientID)
+	if !ok {
+		return
+	}
+	var bundle RequestBundle
+	if _, isPending := d.pendingRequestState.GetClientState(clientID).GetPendingRequest(requestID); isPending {
+		bundle, _ = q.Peek().(RequestBundle)
+		d.latency.stop(clientID + "/" + requestID)
+		d.CompleteRequest(clientID, requestID)
+	} else {
+		queue, ok := q.(removableQueue)
+		if !ok {
+			// Request is canceled once it reaches the front of the queue
+			return
+		}
+		el := queue.Remove(matchRequest(requestID))
+		if el == nil {
+			// Request was already completed
+			return
+		}
+		d.addQueued(-1)
+		bundle, _ = el.(RequestBundle)
+	}
+	d.requestContextDone(clientID, requestID, bundle, err)
+}
+
+// requestContextDone notifies about a request, which was removed from a client's queue because its context is done.
+func (d *DefaultServerDispatcher) requestContextDone(clientID string, requestID string, bundle RequestBundle, err error) {
+	withFields(d.getLogger(), clientID, requestID, bundle.Call.Action).Infof("request %v for %v canceled: %v", requestID, clientID, err)
+	d.metrics.IncCounter(metrics.RequestsCanceledTotal, canceledLabels(metrics.RoleServer, bundle.Call.Action, "context"))
+	d.requestCanceled(clientID, requestID, bundle.Call.Payload, contextCanceledError(requestID, err))
+}
+
 func (d *DefaultServerDispatcher) CompleteRequest(clientID string, requestID string) {
 	q, ok := d.queueMap.Get(clientID)
 	if !ok {
-		log.Errorf("attempting to complete request for client %v, but no matching queue found", clientID)
+		withFields(d.getLogger(), clientID, requestID, "").Errorf("attempting to complete request for client %v, but no matching queue found", clientID)
 		return
 	}
 	el := q.Peek()
 	if el == nil {
-		log.Errorf("attempting to pop front of queue, but queue is empty")
+		withFields(d.getLogger(), clientID, requestID, "").Errorf("attempting to pop front of queue, but queue is empty")
 		return
 	}
 	bundle, _ := el.(RequestBundle)
 	callID := bundle.Call.GetUniqueId()
 	if callID != requestID {
-		log.Errorf("internal state mismatch: processing response for %v but expected response for %v", requestID, callID)
+		withFields(d.getLogger(), clientID, requestID, "").Errorf("internal state mismatch: processing response for %v but expected response for %v", requestID, callID)
 		return
 	}
 	q.Pop()
+	bundle.complete()
 	d.pendingRequestState.DeletePendingRequest(clientID, requestID)
-	log.Debugf("completed request %s for %s", callID, clientID)
+	d.addQueued(-1)
+	if elapsed, ok := d.latency.stop(clientID + "/" + requestID); ok {
+		d.metrics.ObserveHistogram(metrics.RequestDurationSeconds, elapsed.Seconds(), actionLabels(metrics.RoleServer, bundle.Call.Action))
+	}
+	withFields(d.getLogger(), clientID, callID, bundle.Call.Action).Debugf("completed request %s for %s", callID, clientID)
 	// Signal that next message in queue may be sent
 	d.readyForDispatch <- clientID
 }
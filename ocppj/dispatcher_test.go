@@ -1,7 +1,9 @@
 package ocppj_test
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/lorenzodonini/ocpp-go/metrics"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/lorenzodonini/ocpp-go/ocppj"
 )
@@ -82,6 +85,46 @@ func (s *ServerDispatcherTestSuite) TestServerSendRequest() {
 	time.Sleep(1300 * time.Millisecond)
 }
 
+func (s *ServerDispatcherTestSuite) TestServerDispatcherMetrics() {
+	t := s.T()
+	// Setup
+	clientID := "client1"
+	sent := make(chan bool, 1)
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		sent <- true
+	}).Return(nil)
+	registry := metrics.NewRegistry()
+	s.dispatcher.(*ocppj.DefaultServerDispatcher).SetMetrics(registry)
+	s.dispatcher.Start()
+	require.True(t, s.dispatcher.IsRunning())
+	s.dispatcher.CreateClient(clientID)
+	// Send two requests, the second one stays queued
+	var requestIDs []string
+	for i := 0; i < 2; i++ {
+		call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+		require.NoError(t, err)
+		data, err := call.MarshalJSON()
+		require.NoError(t, err)
+		err = s.dispatcher.SendRequest(clientID, ocppj.RequestBundle{Call: call, Data: data})
+		require.NoError(t, err)
+		requestIDs = append(requestIDs, call.UniqueId)
+	}
+	<-sent
+	s.dispatcher.CompleteRequest(clientID, requestIDs[0])
+	<-sent
+	var b strings.Builder
+	require.NoError(t, registry.Write(&b))
+	output := b.String()
+	assert.Contains(t, output, `ocpp_requests_sent_total{action="Mock",role="server"} 2`)
+	assert.Contains(t, output, `ocpp_request_duration_seconds_count{action="Mock",role="server"} 1`)
+	assert.Contains(t, output, `ocpp_request_queue_depth{role="server"} 1`)
+	// Deleting the client clears its queue
+	s.dispatcher.DeleteClient(clientID)
+	b.Reset()
+	require.NoError(t, registry.Write(&b))
+	assert.Contains(t, b.String(), `ocpp_request_queue_depth{role="server"} 0`)
+}
+
 func (s *ServerDispatcherTestSuite) TestServerRequestCanceled() {
 	t := s.T()
 	// Setup
@@ -136,6 +179,52 @@ func (s *ServerDispatcherTestSuite) TestServerRequestCanceled() {
 	assert.True(t, q.IsEmpty())
 }
 
+func (s *ServerDispatcherTestSuite) TestServerRequestContextCanceled() {
+	t := s.T()
+	// Setup
+	clientID := "client1"
+	writeC := make(chan bool, 1)
+	canceled := make(chan bool, 1)
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- true
+	}).Return(nil)
+	// Create mock request with a context, which expires before the dispatcher timeout
+	req := newMockRequest("somevalue")
+	call, err := s.endpoint.CreateCall(req)
+	require.NoError(t, err)
+	requestID := call.UniqueId
+	data, err := call.MarshalJSON()
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	bundle := ocppj.RequestBundle{Call: call, Data: data, Context: ctx}
+	s.dispatcher.SetTimeout(10 * time.Second)
+	s.dispatcher.SetOnRequestCanceled(func(cID string, rID string, request ocpp.Request, err *ocpp.Error) {
+		assert.Equal(t, clientID, cID)
+		assert.Equal(t, requestID, rID)
+		assert.Equal(t, req, request)
+		assert.Equal(t, ocppj.GenericError, err.Code)
+		assert.Equal(t, "Request canceled: context deadline exceeded", err.Description)
+		canceled <- true
+	})
+	s.dispatcher.Start()
+	require.True(t, s.dispatcher.IsRunning())
+	// Simulate client connection
+	s.dispatcher.CreateClient(clientID)
+	err = s.dispatcher.SendRequest(clientID, bundle)
+	require.NoError(t, err)
+	// Check status after sending request
+	<-writeC
+	assert.True(t, s.state.HasPendingRequest(clientID))
+	// Wait for context to expire
+	_, ok := <-canceled
+	require.True(t, ok)
+	assert.False(t, s.state.HasPendingRequest(clientID))
+	q, ok := s.queueMap.Get(clientID)
+	require.True(t, ok)
+	assert.True(t, q.IsEmpty())
+}
+
 func (s *ServerDispatcherTestSuite) TestCreateClient() {
 	t := s.T()
 	// Setup
@@ -285,6 +374,55 @@ func (c *ClientDispatcherTestSuite) TestClientSendRequest() {
 
 }
 
+func (c *ClientDispatcherTestSuite) TestClientSendRequestStoppedDispatcher() {
+	t := c.T()
+	c.dispatcher.Start()
+	c.dispatcher.Stop()
+	req := newMockRequest("somevalue")
+	call, err := c.endpoint.CreateCall(req)
+	require.NoError(t, err)
+	data, err := call.MarshalJSON()
+	require.NoError(t, err)
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	assert.EqualError(t, err, "cannot SendRequest, dispatcher was stopped")
+	c.websocketClient.AssertNotCalled(t, "Write", mock.Anything)
+}
+
+func (c *ClientDispatcherTestSuite) TestClientSendRequestBeforeStart() {
+	t := c.T()
+	sent := make(chan bool, 1)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		sent <- true
+	}).Return(nil)
+	req := newMockRequest("somevalue")
+	call, err := c.endpoint.CreateCall(req)
+	require.NoError(t, err)
+	data, err := call.MarshalJSON()
+	require.NoError(t, err)
+	// Request is queued, but not sent
+	done := make(chan error, 1)
+	go func() {
+		done <- c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	}()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("SendRequest blocked on a dispatcher which wasn't started")
+	}
+	assert.Equal(t, 1, c.queue.Size())
+	c.websocketClient.AssertNotCalled(t, "Write", mock.Anything)
+	// Request is sent after starting
+	c.dispatcher.Start()
+	defer c.dispatcher.Stop()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("queued request wasn't sent after starting the dispatcher")
+	}
+	assert.True(t, c.state.HasPendingRequest())
+}
+
 func (c *ClientDispatcherTestSuite) TestClientRequestCanceled() {
 	t := c.T()
 	// Setup
@@ -457,3 +595,331 @@ func (c *ClientDispatcherTestSuite) TestClientSendPausedDispatcher() {
 	assert.Equal(t, requestNumber, c.queue.Size())
 	assert.False(t, c.state.HasPendingRequest())
 }
+
+func (c *ClientDispatcherTestSuite) TestClientRequestContextCanceled() {
+	t := c.T()
+	// Setup
+	writeC := make(chan bool, 1)
+	canceled := make(chan string, 1)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- true
+	}).Return(nil)
+	c.dispatcher.SetTimeout(10 * time.Second)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		assert.Equal(t, ocppj.GenericError, err.Code)
+		assert.Equal(t, "Request canceled: context canceled", err.Description)
+		canceled <- rID
+	})
+	c.dispatcher.Start()
+	require.True(t, c.dispatcher.IsRunning())
+	// Send two requests, each with a dedicated context
+	requestIDs := []string{}
+	cancelFuncs := []context.CancelFunc{}
+	for i := 0; i < 2; i++ {
+		req := newMockRequest("somevalue")
+		call, err := c.endpoint.CreateCall(req)
+		require.NoError(t, err)
+		data, err := call.MarshalJSON()
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		bundle := ocppj.RequestBundle{Call: call, Data: data, Context: ctx}
+		err = c.dispatcher.SendRequest(bundle)
+		require.NoError(t, err)
+		requestIDs = append(requestIDs, call.UniqueId)
+		cancelFuncs = append(cancelFuncs, cancel)
+	}
+	// First request is pending, second request is queued
+	<-writeC
+	assert.True(t, c.state.HasPendingRequest())
+	assert.Equal(t, 2, c.queue.Size())
+	// Cancel queued request, which is removed without being sent
+	cancelFuncs[1]()
+	assert.Equal(t, requestIDs[1], <-canceled)
+	assert.Equal(t, 1, c.queue.Size())
+	assert.True(t, c.state.HasPendingRequest())
+	// Cancel pending request
+	cancelFuncs[0]()
+	assert.Equal(t, requestIDs[0], <-canceled)
+	assert.False(t, c.state.HasPendingRequest())
+	assert.True(t, c.queue.IsEmpty())
+	// No further write occurred
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, writeC, 0)
+}
+
+// A request queue, which doesn't support removing elements at arbitrary positions.
+type basicRequestQueue struct {
+	ocppj.RequestQueue
+}
+
+func (c *ClientDispatcherTestSuite) TestClientRequestContextCanceledBasicQueue() {
+	t := c.T()
+	// Setup
+	writeC := make(chan bool, 2)
+	canceled := make(chan string, 1)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- true
+	}).Return(nil)
+	c.dispatcher = ocppj.NewDefaultClientDispatcher(basicRequestQueue{c.queue})
+	c.dispatcher.SetPendingRequestState(c.state)
+	c.dispatcher.SetNetworkClient(&c.websocketClient)
+	c.dispatcher.SetTimeout(10 * time.Second)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		canceled <- rID
+	})
+	c.dispatcher.Start()
+	defer c.dispatcher.Stop()
+	// Send two requests, each with a dedicated context
+	requestIDs := []string{}
+	cancelFuncs := []context.CancelFunc{}
+	for i := 0; i < 2; i++ {
+		call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+		require.NoError(t, err)
+		data, err := call.MarshalJSON()
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data, Context: ctx})
+		require.NoError(t, err)
+		requestIDs = append(requestIDs, call.UniqueId)
+		cancelFuncs = append(cancelFuncs, cancel)
+	}
+	<-writeC
+	// Queued request can't be removed right away
+	cancelFuncs[1]()
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, canceled, 0)
+	assert.Equal(t, 2, c.queue.Size())
+	// Once the first request is completed, the canceled request is dropped instead of being sent
+	c.dispatcher.CompleteRequest(requestIDs[0])
+	assert.Equal(t, requestIDs[1], <-canceled)
+	assert.True(t, c.queue.IsEmpty())
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, writeC, 0)
+}
+
+func (c *ClientDispatcherTestSuite) TestClientRetryPolicyWriteError() {
+	t := c.T()
+	// Setup
+	writeC := make(chan time.Time, 3)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- time.Now()
+	}).Return(fmt.Errorf("mockError")).Twice()
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- time.Now()
+	}).Return(nil).Once()
+	c.dispatcher.SetTimeout(10 * time.Second)
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetRetryPolicy(ocppj.NewRetryPolicy(3, 100*time.Millisecond), MockFeatureName)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		require.Fail(t, "unexpected OnRequestCanceled")
+	})
+	c.dispatcher.Start()
+	require.True(t, c.dispatcher.IsRunning())
+	// Send mocked request
+	req := newMockRequest("somevalue")
+	call, err := c.endpoint.CreateCall(req)
+	require.NoError(t, err)
+	data, err := call.MarshalJSON()
+	require.NoError(t, err)
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	require.NoError(t, err)
+	// Request is retransmitted with linear backoff
+	first := <-writeC
+	second := <-writeC
+	third := <-writeC
+	assert.GreaterOrEqual(t, second.Sub(first), 100*time.Millisecond)
+	assert.GreaterOrEqual(t, third.Sub(second), 200*time.Millisecond)
+	// Third attempt succeeded
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, c.state.HasPendingRequest())
+	assert.Equal(t, 1, c.queue.Size())
+	c.dispatcher.CompleteRequest(call.UniqueId)
+	assert.True(t, c.queue.IsEmpty())
+}
+
+func (c *ClientDispatcherTestSuite) TestClientRetryPolicyExhausted() {
+	t := c.T()
+	// Setup
+	writeC := make(chan bool, 3)
+	canceled := make(chan bool, 1)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- true
+	}).Return(nil)
+	c.dispatcher.SetTimeout(200 * time.Millisecond)
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetRetryPolicy(ocppj.NewRetryPolicy(2, 100*time.Millisecond), MockFeatureName)
+	req := newMockRequest("somevalue")
+	call, err := c.endpoint.CreateCall(req)
+	require.NoError(t, err)
+	data, err := call.MarshalJSON()
+	require.NoError(t, err)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		assert.Equal(t, call.UniqueId, rID)
+		assert.Equal(t, req, request)
+		assert.Equal(t, ocppj.GenericError, err.Code)
+		assert.Equal(t, "Request timed out", err.Description)
+		canceled <- true
+	})
+	c.dispatcher.Start()
+	require.True(t, c.dispatcher.IsRunning())
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	require.NoError(t, err)
+	// First attempt times out, request is not pending while waiting for retransmission
+	<-writeC
+	time.Sleep(250 * time.Millisecond)
+	assert.False(t, c.state.HasPendingRequest())
+	assert.Equal(t, 1, c.queue.Size())
+	// Second attempt times out as well, request is canceled
+	<-writeC
+	_, ok := <-canceled
+	require.True(t, ok)
+	assert.False(t, c.state.HasPendingRequest())
+	assert.True(t, c.queue.IsEmpty())
+	assert.Len(t, writeC, 0)
+}
+
+func (c *ClientDispatcherTestSuite) TestClientOfflinePolicy() {
+	t := c.T()
+	// Setup
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		require.Fail(t, "write should never be called")
+	}).Return(nil)
+	policy := ocppj.NewOfflinePolicy(ocppj.OfflineDrop)
+	policy.Coalesce(MockFeatureName, func(request ocpp.Request) string {
+		return request.(*MockRequest).MockValue
+	})
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetOfflinePolicy(policy)
+	canceled := make(chan string, 1)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		assert.Equal(t, ocppj.GenericError, err.Code)
+		canceled <- rID
+	})
+	c.dispatcher.Start()
+	require.True(t, c.dispatcher.IsRunning())
+	c.dispatcher.Pause()
+	send := func(value string) string {
+		call, err := c.endpoint.CreateCall(newMockRequest(value))
+		require.NoError(t, err)
+		data, err := call.MarshalJSON()
+		require.NoError(t, err)
+		err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+		require.NoError(t, err)
+		return call.UniqueId
+	}
+	// Request at the front of the queue is replaced as well, since it wasn't sent yet
+	first := send("first")
+	send("first")
+	assert.Equal(t, first, <-canceled)
+	assert.Equal(t, 1, c.queue.Size())
+	// Queued requests with the same key are replaced
+	a1 := send("a")
+	send("b")
+	send("a")
+	assert.Equal(t, a1, <-canceled)
+	assert.Equal(t, 3, c.queue.Size())
+	// Requests without a rule are dropped, according to the default action
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetOfflinePolicy(ocppj.NewOfflinePolicy(ocppj.OfflineDrop))
+	call, err := c.endpoint.CreateCall(newMockRequest("b"))
+	require.NoError(t, err)
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: []byte{}})
+	require.Error(t, err)
+	assert.Equal(t, 3, c.queue.Size())
+	// Without a policy, all requests are queued
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetOfflinePolicy(nil)
+	send("b")
+	assert.Equal(t, 4, c.queue.Size())
+}
+
+func (c *ClientDispatcherTestSuite) TestClientOfflinePolicyQueuedBeforePause() {
+	t := c.T()
+	// Setup
+	writeC := make(chan bool, 1)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- true
+	}).Return(nil)
+	policy := ocppj.NewOfflinePolicy(ocppj.OfflineDrop)
+	policy.Coalesce(MockFeatureName, func(request ocpp.Request) string {
+		return request.(*MockRequest).MockValue
+	})
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetOfflinePolicy(policy)
+	canceled := make(chan string, 3)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		assert.Equal(t, ocppj.GenericError, err.Code)
+		canceled <- rID
+	})
+	c.dispatcher.Start()
+	require.True(t, c.dispatcher.IsRunning())
+	send := func(value string) string {
+		call, err := c.endpoint.CreateCall(newMockRequest(value))
+		require.NoError(t, err)
+		data, err := call.MarshalJSON()
+		require.NoError(t, err)
+		err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+		require.NoError(t, err)
+		return call.UniqueId
+	}
+	// Requests are queued while online, behind a pending request
+	head := send("a")
+	<-writeC
+	a1 := send("a")
+	b := send("b")
+	a2 := send("a")
+	assert.Equal(t, 4, c.queue.Size())
+	// Queued requests are reclassified when pausing, but the pending request is kept
+	c.dispatcher.Pause()
+	assert.Equal(t, a1, <-canceled)
+	assert.Equal(t, 3, c.queue.Size())
+	// Once the pending request completed, the request at the front of the queue wasn't sent yet
+	c.dispatcher.CompleteRequest(head)
+	assert.Equal(t, 2, c.queue.Size())
+	// Queued requests are reclassified again when resuming, including the front of the queue
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetOfflinePolicy(ocppj.NewOfflinePolicy(ocppj.OfflineDrop))
+	c.dispatcher.Resume()
+	assert.ElementsMatch(t, []string{b, a2}, []string{<-canceled, <-canceled})
+	assert.True(t, c.queue.IsEmpty())
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, writeC, 0)
+}
+
+func (c *ClientDispatcherTestSuite) TestClientDispatcherMetrics() {
+	t := c.T()
+	// Setup
+	writeC := make(chan bool, 1)
+	canceled := make(chan bool, 1)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		writeC <- true
+	}).Return(nil)
+	registry := metrics.NewRegistry()
+	c.dispatcher.(*ocppj.DefaultClientDispatcher).SetMetrics(registry)
+	c.dispatcher.SetTimeout(500 * time.Millisecond)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		canceled <- true
+	})
+	c.dispatcher.Start()
+	require.True(t, c.dispatcher.IsRunning())
+	send := func() string {
+		call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+		require.NoError(t, err)
+		data, err := call.MarshalJSON()
+		require.NoError(t, err)
+		err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+		require.NoError(t, err)
+		return call.UniqueId
+	}
+	// First request receives a response
+	requestID := send()
+	<-writeC
+	c.dispatcher.CompleteRequest(requestID)
+	// Second request times out
+	send()
+	<-writeC
+	<-canceled
+	var b strings.Builder
+	require.NoError(t, registry.Write(&b))
+	output := b.String()
+	assert.Contains(t, output, `ocpp_requests_sent_total{action="Mock",role="client"} 2`)
+	assert.Contains(t, output, `ocpp_request_duration_seconds_count{action="Mock",role="client"} 1`)
+	assert.Contains(t, output, `ocpp_request_timeouts_total{action="Mock",role="client"} 1`)
+	assert.Contains(t, output, `ocpp_requests_canceled_total{action="Mock",reason="failed",role="client"} 1`)
+	assert.Contains(t, output, `ocpp_request_queue_depth{role="client"} 0`)
+}
@@ -0,0 +1,120 @@
+//go:build go1.18
+// +build go1.18
+
+package ocppj_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// Frames used as seed corpus by all fuzz targets. Message ID "1234" refers to a pending request.
+var fuzzSeeds = []string{
+	`[2,"1234","Mock",{"mockValue":"somevalue"}]`,
+	`[2,"1234","Mock",{}]`,
+	`[2,"1234","Mock",null]`,
+	`[2,"1234","Mock",{"mockValue":1234}]`,
+	`[2,"1234","Unknown",{}]`,
+	`[2,"1234","Mock"]`,
+	`[2,"",null,{}]`,
+	`[3,"1234",{"mockValue":"somevalue"}]`,
+	`[3,"1234",{"mockValue":""}]`,
+	`[3,"1234",[]]`,
+	`[3,"5678",{}]`,
+	`[4,"1234","GenericError","description",{"details":1}]`,
+	`[4,"1234","NotAnErrorCode",null]`,
+	`[4,"1234",5]`,
+	`[5,"1234",{}]`,
+	`[2.5,"1234","Mock",{}]`,
+	`[-1e300,"1234"]`,
+	`["2","1234","Mock",{}]`,
+	`[]`,
+	`{}`,
+	`null`,
+}
+
+func FuzzParseMessage(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		endpoint := ocppj.Endpoint{}
+		endpoint.AddProfile(ocpp.NewProfile("mock", &MockFeature{}))
+		state := ocppj.NewClientState()
+		state.AddPendingRequest("1234", newMockRequest("somevalue"))
+		parsedJson, err := ocppj.ParseRawJsonMessage(data)
+		if err != nil {
+			return
+		}
+		message, err := endpoint.ParseMessage(parsedJson, state)
+		if err != nil {
+			// Parsing errors must always be OCPP errors, so they can be sent back to the other endpoint
+			_, ok := err.(*ocpp.Error)
+			require.True(t, ok, "unexpected error type %T", err)
+			return
+		}
+		if message == nil {
+			// Response to a request that was never sent
+			return
+		}
+		assert.NotEmpty(t, message.GetUniqueId())
+		switch message.GetMessageTypeId() {
+		case ocppj.CALL:
+			require.IsType(t, &ocppj.Call{}, message)
+			assert.NotNil(t, message.(*ocppj.Call).Payload)
+		case ocppj.CALL_RESULT:
+			require.IsType(t, &ocppj.CallResult{}, message)
+			assert.NotNil(t, message.(*ocppj.CallResult).Payload)
+		case ocppj.CALL_ERROR:
+			require.IsType(t, &ocppj.CallError{}, message)
+		default:
+			t.Fatalf("unexpected message type %v", message.GetMessageTypeId())
+		}
+	})
+}
+
+func FuzzServerMessageHandler(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		mockServer := &MockWebsocketServer{}
+		mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+		mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+		mockServer.On("Stop").Return(nil)
+		server := ocppj.NewServer(mockServer, nil, nil, ocpp.NewProfile("mock", &MockFeature{}))
+		// No handlers are set on purpose, as they are optional
+		server.Start(8887, "/{ws}")
+		defer server.Stop()
+		mockChargePoint := NewMockWebSocket("1234")
+		server.RequestState.AddPendingRequest(mockChargePoint.ID(), "1234", newMockRequest("somevalue"))
+		// Must never panic
+		_ = mockServer.MessageHandler(mockChargePoint, data)
+	})
+}
+
+func FuzzClientMessageHandler(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		mockClient := &MockWebsocketClient{}
+		mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+		mockClient.On("Write", mock.Anything).Return(nil)
+		mockClient.On("Stop").Return(nil)
+		mockClient.On("IsConnected").Return(false)
+		client := ocppj.NewClient("mock_id", mockClient, nil, nil, ocpp.NewProfile("mock", &MockFeature{}))
+		// No handlers are set on purpose, as they are optional
+		require.NoError(t, client.Start("someUrl"))
+		defer client.Stop()
+		client.RequestState.AddPendingRequest("1234", newMockRequest("somevalue"))
+		// Must never panic
+		_ = mockClient.MessageHandler(data)
+	})
+}
@@ -0,0 +1,78 @@
+package ocppj
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/go-playground/validator.v9"
+
+	"github.com/lorenzodonini/ocpp-go/metrics"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// Labels attached to the metrics reported by clients and servers respectively
+var (
+	clientLabels = metrics.Labels{metrics.LabelRole: metrics.RoleClient}
+	serverLabels = metrics.Labels{metrics.LabelRole: metrics.RoleServer}
+)
+
+// metricsSetter is implemented by all components, which report metrics.
+// It allows Client and Server endpoints to forward their Metrics to the dispatcher and networking layer,
+// without requiring the respective interfaces to support metrics.
+type metricsSetter interface {
+	SetMetrics(m metrics.Metrics)
+}
+
+func actionLabels(role string, action string) metrics.Labels {
+	return metrics.Labels{metrics.LabelRole: role, metrics.LabelAction: action}
+}
+
+func canceledLabels(role string, action string, reason string) metrics.Labels {
+	return metrics.Labels{metrics.LabelRole: role, metrics.LabelAction: action, metrics.LabelReason: reason}
+}
+
+// Returns the labels of a failed validation, or false if the error wasn't caused by a failed validation.
+// Outgoing messages fail with validator.ValidationErrors, incoming messages with a *validationError.
+func validationLabels(role string, direction string, err error) (metrics.Labels, bool) {
+	var code ocpp.ErrorCode
+	switch e := err.(type) {
+	case validator.ValidationErrors:
+		code = errorFromValidation(e, "", "").Code
+	case *validationError:
+		code = e.err.Code
+	default:
+		return nil, false
+	}
+	return metrics.Labels{metrics.LabelRole: role, metrics.LabelDirection: direction, metrics.LabelCode: string(code)}, true
+}
+
+// requestLatency keeps track of the dispatch time of sent requests, for measuring the time until a response is received.
+// Access is thread-safe.
+type requestLatency struct {
+	sentAt map[string]time.Time
+	mutex  sync.Mutex
+}
+
+func newRequestLatency() *requestLatency {
+	return &requestLatency{sentAt: map[string]time.Time{}}
+}
+
+// Records the dispatch time of the request with the given key.
+func (l *requestLatency) start(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sentAt[key] = time.Now()
+}
+
+// Returns the time elapsed since the request with the given key was dispatched, and stops tracking the request.
+// If the request is not being tracked, false is returned.
+func (l *requestLatency) stop(key string) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sentAt, ok := l.sentAt[key]
+	if !ok {
+		return 0, false
+	}
+	delete(l.sentAt, key)
+	return time.Since(sentAt), true
+}
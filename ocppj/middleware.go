@@ -0,0 +1,116 @@
+package ocppj
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// ErrShortCircuited is returned when sending a request, which was short-circuited by a middleware.
+// The request was neither queued nor sent, hence no response will ever be received for it.
+var ErrShortCircuited = errors.New("request short-circuited by middleware")
+
+// MessageDirection indicates whether a message was received from or is about to be sent to the other endpoint.
+type MessageDirection int
+
+const (
+	Inbound MessageDirection = iota
+	Outbound
+)
+
+func (d MessageDirection) String() string {
+	if d == Inbound {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+// Envelope wraps a message passing through a middleware chain.
+type Envelope struct {
+	// Whether the message was received or is about to be sent.
+	Direction MessageDirection
+	// The ID of the client the message is exchanged with. On a client endpoint, this is the client's own ID.
+	ClientID string
+	// The parsed message: either a *Call, *CallResult or *CallError.
+	// A middleware may modify the message, or replace it with a message of the same type.
+	Message Message
+}
+
+// MessageHandlerFunc processes a message passing through a middleware chain.
+type MessageHandlerFunc func(envelope *Envelope) *ocpp.Error
+
+// Middleware intercepts inbound and outbound messages on an endpoint.
+// A middleware receives the next handler in the chain and returns a new handler, which may:
+//
+// - modify the message and pass it on, by invoking next
+//
+// - reject the message, by returning an error without invoking next
+//
+// - short-circuit the message, by returning nil without invoking next
+//
+// A rejected inbound Call is answered with a CallError containing the returned error,
+// while a rejected inbound CallResult or CallError is delivered to the error handler instead.
+// A rejected outbound message isn't sent, and the error is returned to the caller.
+//
+// A short-circuited message is silently dropped. An inbound response still completes the pending request,
+// and the request canceled handler is invoked instead of the response handler.
+// For inbound calls, the middleware is in charge of sending a response.
+// A short-circuited outbound call isn't queued, and ErrShortCircuited is returned to the caller.
+//
+// Outbound messages are sent after the entire chain returned,
+// while inbound messages are handled within the innermost handler.
+//
+//	endpoint.AddMiddleware(func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+//		return func(envelope *ocppj.Envelope) *ocpp.Error {
+//			log.Printf("%v %v message %v", envelope.Direction, envelope.ClientID, envelope.Message.GetUniqueId())
+//			return next(envelope)
+//		}
+//	})
+type Middleware func(next MessageHandlerFunc) MessageHandlerFunc
+
+// AddMiddleware appends the given middlewares to the chain of the endpoint.
+// Middlewares are invoked in the order they were added, i.e. the first middleware sees a message first.
+//
+// This function must be called before starting the endpoint.
+func (endpoint *Endpoint) AddMiddleware(middlewares ...Middleware) {
+	endpoint.middlewares = append(endpoint.middlewares, middlewares...)
+}
+
+// Passes a message through the middleware chain, invoking the handler at the end of the chain.
+// Returns true, if the message reached the handler.
+func (endpoint *Endpoint) intercept(envelope *Envelope, handler MessageHandlerFunc) (bool, *ocpp.Error) {
+	handled := false
+	next := func(envelope *Envelope) *ocpp.Error {
+		handled = true
+		return handler(envelope)
+	}
+	for i := len(endpoint.middlewares) - 1; i >= 0; i-- {
+		next = endpoint.middlewares[i](next)
+	}
+	err := next(envelope)
+	if err != nil && err.MessageId == "" && envelope.Message != nil {
+		err.MessageId = envelope.Message.GetUniqueId()
+	}
+	return handled, err
+}
+
+// Passes an outbound message through the middleware chain.
+// Returns the message to be sent, or nil if the message was short-circuited.
+func (endpoint *Endpoint) interceptOutbound(clientID string, message Message) (Message, error) {
+	envelope := &Envelope{Direction: Outbound, ClientID: clientID, Message: message}
+	passed, err := endpoint.intercept(envelope, func(envelope *Envelope) *ocpp.Error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !passed {
+		endpoint.logWith(clientID, message.GetUniqueId(), "").Debugf("outbound message [%s] short-circuited by middleware", message.GetUniqueId())
+		return nil, nil
+	}
+	if envelope.Message == nil || envelope.Message.GetMessageTypeId() != message.GetMessageTypeId() {
+		return nil, fmt.Errorf("middleware replaced message [%s] with a message of a different type", message.GetUniqueId())
+	}
+	return envelope.Message, nil
+}
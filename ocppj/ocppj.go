@@ -35,6 +35,8 @@ func init() {
 // Sets a custom Logger implementation, allowing the ocpp-j package to log events.
 // By default, a VoidLogger is used, so no logs will be sent to any output.
 //
+// The logger is used by all endpoints, which don't have a logger of their own (see Endpoint.SetLogger).
+//
 // The function panics, if a nil logger is passed.
 func SetLogger(logger logging.Logger) {
 	if logger == nil {
@@ -45,10 +47,20 @@ func SetLogger(logger logging.Logger) {
 
 // Allows an instance of ocppj to configure if the message is Marshaled by escaping special caracters like "<", ">", "&" etc
 // For more info https://pkg.go.dev/encoding/json#HTMLEscape
+//
+// The setting applies to all endpoints, which don't override it (see Endpoint.SetHTMLEscape).
 func SetHTMLEscape(flag bool) {
 	EscapeHTML = flag
 }
 
+// Returns the HTML escape setting of an endpoint or message, falling back to the package-level setting if none was set.
+func isHTMLEscapeEnabled(flag *bool) bool {
+	if flag != nil {
+		return *flag
+	}
+	return EscapeHTML
+}
+
 // Allows to enable/disable automatic validation for OCPP messages
 // (this includes the field constraints defined for every request/response).
 // The feature may be useful when working with OCPP implementations that don't fully comply to the specs.
@@ -57,6 +69,8 @@ func SetHTMLEscape(flag bool) {
 //
 // ⚠️ Use at your own risk! When disabled, outgoing and incoming OCPP messages will not be validated anymore,
 // potentially leading to errors.
+//
+// The setting applies to all endpoints, which don't override it (see Endpoint.SetMessageValidation).
 func SetMessageValidation(enabled bool) {
 	validationEnabled = enabled
 }
@@ -89,6 +103,8 @@ var messageIdGenerator = func() string {
 // Settings this overrides the default behavior, which is:
 //
 //	fmt.Sprintf("%v", rand.Uint32())
+//
+// The generator is used by all endpoints, which don't have a generator of their own (see Endpoint.SetMessageIdGenerator).
 func SetMessageIdGenerator(generator func() string) {
 	if generator != nil {
 		messageIdGenerator = generator
@@ -104,6 +120,7 @@ type Call struct {
 	UniqueId      string       `json:"uniqueId" validate:"required,max=36"`
 	Action        string       `json:"action" validate:"required,max=36"`
 	Payload       ocpp.Request `json:"payload" validate:"required"`
+	escapeHTML    *bool
 }
 
 func (call *Call) GetMessageTypeId() MessageType {
@@ -115,12 +132,16 @@ func (call *Call) GetUniqueId() string {
 }
 
 func (call *Call) MarshalJSON() ([]byte, error) {
+	return call.marshal(isHTMLEscapeEnabled(call.escapeHTML))
+}
+
+func (call *Call) marshal(escapeHTML bool) ([]byte, error) {
 	fields := make([]interface{}, 4)
 	fields[0] = int(call.MessageTypeId)
 	fields[1] = call.UniqueId
 	fields[2] = call.Action
 	fields[3] = call.Payload
-	return jsonMarshal(fields)
+	return jsonMarshal(fields, escapeHTML)
 }
 
 // -------------------- Call Result --------------------
@@ -131,6 +152,7 @@ type CallResult struct {
 	MessageTypeId MessageType   `json:"messageTypeId" validate:"required,eq=3"`
 	UniqueId      string        `json:"uniqueId" validate:"required,max=36"`
 	Payload       ocpp.Response `json:"payload" validate:"required"`
+	escapeHTML    *bool
 }
 
 func (callResult *CallResult) GetMessageTypeId() MessageType {
@@ -142,11 +164,15 @@ func (callResult *CallResult) GetUniqueId() string {
 }
 
 func (callResult *CallResult) MarshalJSON() ([]byte, error) {
+	return callResult.marshal(isHTMLEscapeEnabled(callResult.escapeHTML))
+}
+
+func (callResult *CallResult) marshal(escapeHTML bool) ([]byte, error) {
 	fields := make([]interface{}, 3)
 	fields[0] = int(callResult.MessageTypeId)
 	fields[1] = callResult.UniqueId
 	fields[2] = callResult.Payload
-	return jsonMarshal(fields)
+	return jsonMarshal(fields, escapeHTML)
 }
 
 // -------------------- Call Error --------------------
@@ -159,6 +185,7 @@ type CallError struct {
 	ErrorCode        ocpp.ErrorCode `json:"errorCode" validate:"errorCode"`
 	ErrorDescription string         `json:"errorDescription" validate:"omitempty"`
 	ErrorDetails     interface{}    `json:"errorDetails" validate:"omitempty"`
+	escapeHTML       *bool
 }
 
 func (callError *CallError) GetMessageTypeId() MessageType {
@@ -170,6 +197,10 @@ func (callError *CallError) GetUniqueId() string {
 }
 
 func (callError *CallError) MarshalJSON() ([]byte, error) {
+	return callError.marshal(isHTMLEscapeEnabled(callError.escapeHTML))
+}
+
+func (callError *CallError) marshal(escapeHTML bool) ([]byte, error) {
 	fields := make([]interface{}, 5)
 	fields[0] = int(callError.MessageTypeId)
 	fields[1] = callError.UniqueId
@@ -180,7 +211,7 @@ func (callError *CallError) MarshalJSON() ([]byte, error) {
 	} else {
 		fields[4] = callError.ErrorDetails
 	}
-	return ocppMessageToJson(fields)
+	return ocppMessageToJson(fields, escapeHTML)
 }
 
 const (
@@ -202,14 +233,14 @@ type dialector interface {
 	Dialect() ocpp.Dialect
 }
 
+// FormatErrorType returns the error code for syntactically incorrect payloads, which differs between OCPP versions.
+// Endpoints without a dialect fall back to the OCPP 1.6 error code, since malformed input must never crash an endpoint.
 func FormatErrorType(d dialector) ocpp.ErrorCode {
 	switch d.Dialect() {
-	case ocpp.V16:
-		return FormatViolationV16
 	case ocpp.V2:
 		return FormatViolationV2
 	default:
-		panic(fmt.Sprintf("invalid dialect: %v", d))
+		return FormatViolationV16
 	}
 }
 
@@ -242,8 +273,8 @@ func ParseJsonMessage(dataJson string) ([]interface{}, error) {
 	return ParseRawJsonMessage(rawJson)
 }
 
-func ocppMessageToJson(message interface{}) ([]byte, error) {
-	jsonData, err := jsonMarshal(message)
+func ocppMessageToJson(message interface{}, escapeHTML bool) ([]byte, error) {
+	jsonData, err := jsonMarshal(message, escapeHTML)
 	if err != nil {
 		return nil, err
 	}
@@ -306,10 +337,10 @@ func errorFromValidation(validationErrors validator.ValidationErrors, messageId
 }
 
 // Marshals data by manipulating EscapeHTML property of encoder
-func jsonMarshal(t interface{}) ([]byte, error) {
+func jsonMarshal(t interface{}, escapeHTML bool) ([]byte, error) {
 	buffer := &bytes.Buffer{}
 	encoder := json.NewEncoder(buffer)
-	encoder.SetEscapeHTML(EscapeHTML)
+	encoder.SetEscapeHTML(escapeHTML)
 	err := encoder.Encode(t)
 	return bytes.TrimRight(buffer.Bytes(), "\n"), err
 }
@@ -318,9 +349,18 @@ func jsonMarshal(t interface{}) ([]byte, error) {
 
 // An OCPP-J endpoint is one of the two entities taking part in the communication.
 // The endpoint keeps state for supported OCPP profiles and current pending requests.
+//
+// Logging, validation, HTML escaping and message ID generation may be configured for each endpoint individually.
+// Settings that weren't configured on an endpoint fall back to the respective package-level setting,
+// so multiple independently configured endpoints may coexist within the same process.
 type Endpoint struct {
-	dialect  ocpp.Dialect
-	Profiles []*ocpp.Profile
+	dialect            ocpp.Dialect
+	Profiles           []*ocpp.Profile
+	middlewares        []Middleware
+	logger             logging.Logger
+	validationEnabled  *bool
+	escapeHTML         *bool
+	messageIdGenerator func() string
 }
 
 // Sets endpoint dialect.
@@ -328,6 +368,113 @@ func (endpoint *Endpoint) SetDialect(d ocpp.Dialect) {
 	endpoint.dialect = d
 }
 
+// Sets a custom Logger implementation for this endpoint only.
+// Passing nil restores the package-level logger (see SetLogger).
+func (endpoint *Endpoint) SetLogger(logger logging.Logger) {
+	endpoint.logger = logger
+}
+
+// Allows to enable/disable automatic validation of outgoing OCPP messages for this endpoint only.
+// If never invoked, the package-level setting applies (see SetMessageValidation).
+func (endpoint *Endpoint) SetMessageValidation(enabled bool) {
+	endpoint.validationEnabled = &enabled
+}
+
+// Configures whether special HTML characters are escaped, when marshaling messages sent by this endpoint.
+// If never invoked, the package-level setting applies (see SetHTMLEscape).
+func (endpoint *Endpoint) SetHTMLEscape(flag bool) {
+	endpoint.escapeHTML = &flag
+}
+
+// Sets a lambda function for generating unique IDs for new messages created by this endpoint.
+// Passing nil restores the package-level generator (see SetMessageIdGenerator).
+func (endpoint *Endpoint) SetMessageIdGenerator(generator func() string) {
+	endpoint.messageIdGenerator = generator
+}
+
+// loggerSetter is implemented by all components, which support a logger of their own.
+// It allows Client and Server endpoints to forward their logger to the dispatcher and networking layer.
+type loggerSetter interface {
+	SetLogger(logger logging.Logger)
+}
+
+func (endpoint *Endpoint) getLogger() logging.Logger {
+	if endpoint.logger != nil {
+		return endpoint.logger
+	}
+	return log
+}
+
+// Returns a logger, which attaches the endpoint dialect, as well as the given client ID, message ID and action
+// to every log entry. Empty values are omitted.
+func (endpoint *Endpoint) logWith(clientID string, messageID string, action string) logging.Logger {
+	logger := endpoint.getLogger()
+	if _, ok := logger.(*logging.VoidLogger); ok {
+		return logger
+	}
+	fields := logFields(clientID, messageID, action)
+	if endpoint.dialect != 0 {
+		fields[logging.FieldDialect] = endpoint.dialect.String()
+	}
+	return logging.WithFields(logger, fields)
+}
+
+// Returns a logger, which attaches the given client ID, message ID and action to every log entry.
+// Empty values are omitted.
+func withFields(logger logging.Logger, clientID string, messageID string, action string) logging.Logger {
+	if _, ok := logger.(*logging.VoidLogger); ok {
+		return logger
+	}
+	return logging.WithFields(logger, logFields(clientID, messageID, action))
+}
+
+func logFields(clientID string, messageID string, action string) logging.Fields {
+	fields := logging.Fields{}
+	if clientID != "" {
+		fields[logging.FieldClientID] = clientID
+	}
+	if messageID != "" {
+		fields[logging.FieldMessageID] = messageID
+	}
+	if action != "" {
+		fields[logging.FieldAction] = action
+	}
+	return fields
+}
+
+func (endpoint *Endpoint) isValidationEnabled() bool {
+	if endpoint.validationEnabled != nil {
+		return *endpoint.validationEnabled
+	}
+	return validationEnabled
+}
+
+func (endpoint *Endpoint) isHTMLEscapeEnabled() bool {
+	return isHTMLEscapeEnabled(endpoint.escapeHTML)
+}
+
+func (endpoint *Endpoint) newMessageId() string {
+	if endpoint.messageIdGenerator != nil {
+		return endpoint.messageIdGenerator()
+	}
+	return messageIdGenerator()
+}
+
+// Marshals a message, according to the HTML escape settings of the endpoint.
+func (endpoint *Endpoint) marshalMessage(message Message) ([]byte, error) {
+	escapeHTML := endpoint.isHTMLEscapeEnabled()
+	switch m := message.(type) {
+	case *Call:
+		return m.marshal(escapeHTML)
+	case *CallResult:
+		return m.marshal(escapeHTML)
+	case *CallError:
+		return m.marshal(escapeHTML)
+	default:
+		return message.MarshalJSON()
+	}
+}
+
 // Gets endpoint dialect.
 func (endpoint *Endpoint) Dialect() ocpp.Dialect {
 	return endpoint.dialect
@@ -394,10 +541,34 @@ func parseRawJsonConfirmation(raw interface{}, confirmationType reflect.Type) (o
 	return result, nil
 }
 
+// validationError is returned by parseMessage for messages that are well-formed, but fail validation.
+type validationError struct {
+	err *ocpp.Error
+}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+// Returns the OCPP error wrapped by a *validationError, or err itself otherwise.
+func unwrapValidationError(err error) error {
+	if validationErr, ok := err.(*validationError); ok {
+		return validationErr.err
+	}
+	return err
+}
+
 // Parses an OCPP-J message. The function expects an array of elements, as contained in the JSON message.
 //
 // Pending requests are automatically cleared, in case the received message is a CallResponse or CallError.
 func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState ClientState) (Message, error) {
+	message, err := endpoint.parseMessage(arr, pendingRequestState)
+	return message, unwrapValidationError(err)
+}
+
+// Parses an OCPP-J message like ParseMessage, but returns validation failures as a *validationError,
+// so they may be told apart from malformed messages.
+func (endpoint *Endpoint) parseMessage(arr []interface{}, pendingRequestState ClientState) (Message, error) {
 	// Checking message fields
 	if len(arr) < 3 {
 		return nil, ocpp.NewError(FormatErrorType(endpoint), "Invalid message. Expected array length >= 3", "")
@@ -440,13 +611,13 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 		}
 		err = Validate.Struct(call)
 		if err != nil {
-			return nil, errorFromValidation(err.(validator.ValidationErrors), uniqueId, action)
+			return nil, &validationError{errorFromValidation(err.(validator.ValidationErrors), uniqueId, action)}
 		}
 		return &call, nil
 	} else if typeId == CALL_RESULT {
 		request, ok := pendingRequestState.GetPendingRequest(uniqueId)
 		if !ok {
-			log.Infof("No previous request %v sent. Discarding response message", uniqueId)
+			endpoint.logWith("", uniqueId, "").Infof("No previous request %v sent. Discarding response message", uniqueId)
 			return nil, nil
 		}
 		profile, _ := endpoint.GetProfileForFeature(request.GetFeatureName())
@@ -461,13 +632,13 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 		}
 		err = Validate.Struct(callResult)
 		if err != nil {
-			return nil, errorFromValidation(err.(validator.ValidationErrors), uniqueId, request.GetFeatureName())
+			return nil, &validationError{errorFromValidation(err.(validator.ValidationErrors), uniqueId, request.GetFeatureName())}
 		}
 		return &callResult, nil
 	} else if typeId == CALL_ERROR {
 		_, ok := pendingRequestState.GetPendingRequest(uniqueId)
 		if !ok {
-			log.Infof("No previous request %v sent. Discarding error message", uniqueId)
+			endpoint.logWith("", uniqueId, "").Infof("No previous request %v sent. Discarding error message", uniqueId)
 			return nil, nil
 		}
 		if len(arr) < 4 {
@@ -495,7 +666,7 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 		}
 		err := Validate.Struct(callError)
 		if err != nil {
-			return nil, errorFromValidation(err.(validator.ValidationErrors), uniqueId, "")
+			return nil, &validationError{errorFromValidation(err.(validator.ValidationErrors), uniqueId, "")}
 		}
 		return &callError, nil
 	} else {
@@ -507,6 +678,9 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 // Returns an error in case the request's feature is not supported on this endpoint.
 //
 // The created call is not automatically scheduled for transmission and is not added to the list of pending requests.
+//
+// The message is validated and marshaled according to the settings of this endpoint,
+// even when invoking its MarshalJSON method directly (see SetMessageValidation and SetHTMLEscape).
 func (endpoint *Endpoint) CreateCall(request ocpp.Request) (*Call, error) {
 	action := request.GetFeatureName()
 	profile, _ := endpoint.GetProfileForFeature(action)
@@ -514,14 +688,15 @@ func (endpoint *Endpoint) CreateCall(request ocpp.Request) (*Call, error) {
 		return nil, fmt.Errorf("Couldn't create Call for unsupported action %v", action)
 	}
 	// TODO: handle collisions?
-	uniqueId := messageIdGenerator()
+	uniqueId := endpoint.newMessageId()
 	call := Call{
 		MessageTypeId: CALL,
 		UniqueId:      uniqueId,
 		Action:        action,
 		Payload:       request,
+		escapeHTML:    endpoint.escapeHTML,
 	}
-	if validationEnabled {
+	if endpoint.isValidationEnabled() {
 		err := Validate.Struct(call)
 		if err != nil {
 			return nil, err
@@ -533,6 +708,9 @@ func (endpoint *Endpoint) CreateCall(request ocpp.Request) (*Call, error) {
 // Creates a CallResult message, given an OCPP response and the message's unique ID.
 //
 // Returns an error in case the response's feature is not supported on this endpoint.
+//
+// The message is validated and marshaled according to the settings of this endpoint,
+// even when invoking its MarshalJSON method directly (see SetMessageValidation and SetHTMLEscape).
 func (endpoint *Endpoint) CreateCallResult(confirmation ocpp.Response, uniqueId string) (*CallResult, error) {
 	action := confirmation.GetFeatureName()
 	profile, _ := endpoint.GetProfileForFeature(action)
@@ -543,8 +721,9 @@ func (endpoint *Endpoint) CreateCallResult(confirmation ocpp.Response, uniqueId
 		MessageTypeId: CALL_RESULT,
 		UniqueId:      uniqueId,
 		Payload:       confirmation,
+		escapeHTML:    endpoint.escapeHTML,
 	}
-	if validationEnabled {
+	if endpoint.isValidationEnabled() {
 		err := Validate.Struct(callResult)
 		if err != nil {
 			return nil, err
@@ -554,6 +733,9 @@ func (endpoint *Endpoint) CreateCallResult(confirmation ocpp.Response, uniqueId
 }
 
 // Creates a CallError message, given the message's unique ID and the error.
+//
+// The message is validated and marshaled according to the settings of this endpoint,
+// even when invoking its MarshalJSON method directly (see SetMessageValidation and SetHTMLEscape).
 func (endpoint *Endpoint) CreateCallError(uniqueId string, code ocpp.ErrorCode, description string, details interface{}) (*CallError, error) {
 	callError := CallError{
 		MessageTypeId:    CALL_ERROR,
@@ -561,8 +743,9 @@ func (endpoint *Endpoint) CreateCallError(uniqueId string, code ocpp.ErrorCode,
 		ErrorCode:        code,
 		ErrorDescription: description,
 		ErrorDetails:     details,
+		escapeHTML:       endpoint.escapeHTML,
 	}
-	if validationEnabled {
+	if endpoint.isValidationEnabled() {
 		err := Validate.Struct(callError)
 		if err != nil {
 			return nil, err
@@ -1,12 +1,16 @@
 package ocppj_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	ut "github.com/go-playground/universal-translator"
 
@@ -174,6 +178,56 @@ func (websocketClient *MockWebsocketClient) IsConnected() bool {
 	return args.Bool(0)
 }
 
+// ---------------------- MOCK TRACER ----------------------
+
+type MockSpan struct {
+	Name       string
+	Attributes map[string]string
+	Events     []string
+	Err        *ocpp.Error
+	Ended      bool
+	mutex      sync.Mutex
+}
+
+func (s *MockSpan) SetAttribute(key string, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Attributes[key] = value
+}
+
+func (s *MockSpan) AddEvent(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Events = append(s.Events, name)
+}
+
+func (s *MockSpan) End(err *ocpp.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Err = err
+	s.Ended = true
+}
+
+func (s *MockSpan) GetEvents() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.Events...)
+}
+
+type MockTracer struct {
+	SpanC chan *MockSpan
+}
+
+func NewMockTracer() *MockTracer {
+	return &MockTracer{SpanC: make(chan *MockSpan, 10)}
+}
+
+func (t *MockTracer) StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, ocppj.Span) {
+	span := &MockSpan{Name: name, Attributes: attributes}
+	t.SpanC <- span
+	return ctx, span
+}
+
 // ---------------------- MOCK FEATURE ----------------------
 const (
 	MockFeatureName = "Mock"
@@ -852,6 +906,192 @@ func (suite *OcppJTestSuite) TestLogger() {
 	})
 }
 
+func (suite *OcppJTestSuite) TestEndpointLogger() {
+	t := suite.T()
+	logger := testLogger{c: make(chan string, 1)}
+	suite.chargePoint.SetLogger(&logger)
+	arr, err := ocppj.ParseRawJsonMessage([]byte("[3,\"1234\",{}]"))
+	require.NoError(t, err)
+	// Other endpoints keep using the package-level logger
+	_, _ = suite.centralSystem.ParseMessage(arr, suite.centralSystem.RequestState.GetClientState("someClient"))
+	assert.Len(t, logger.c, 0)
+	_, _ = suite.chargePoint.ParseMessage(arr, suite.chargePoint.RequestState)
+	assert.Equal(t, "infof", <-logger.c)
+	// Restore package-level logger
+	suite.chargePoint.SetLogger(nil)
+	_, _ = suite.chargePoint.ParseMessage(arr, suite.chargePoint.RequestState)
+	assert.Len(t, logger.c, 0)
+}
+
+type structuredLogEntry struct {
+	message string
+	fields  logging.Fields
+}
+
+// structuredTestLogger records all log entries along with their fields.
+type structuredTestLogger struct {
+	fields  logging.Fields
+	entries *[]structuredLogEntry
+	mutex   *sync.Mutex
+}
+
+func newStructuredTestLogger() *structuredTestLogger {
+	return &structuredTestLogger{fields: logging.Fields{}, entries: &[]structuredLogEntry{}, mutex: &sync.Mutex{}}
+}
+
+func (l *structuredTestLogger) WithFields(fields logging.Fields) logging.StructuredLogger {
+	merged := logging.Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &structuredTestLogger{fields: merged, entries: l.entries, mutex: l.mutex}
+}
+
+func (l *structuredTestLogger) record(message string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	*l.entries = append(*l.entries, structuredLogEntry{message: message, fields: l.fields})
+}
+
+// Returns the fields of the first entry starting with the given prefix.
+func (l *structuredTestLogger) find(prefix string) (logging.Fields, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, entry := range *l.entries {
+		if strings.HasPrefix(entry.message, prefix) {
+			return entry.fields, true
+		}
+	}
+	return nil, false
+}
+
+func (l *structuredTestLogger) Debug(args ...interface{}) { l.record(fmt.Sprint(args...)) }
+func (l *structuredTestLogger) Debugf(format string, args ...interface{}) {
+	l.record(fmt.Sprintf(format, args...))
+}
+func (l *structuredTestLogger) Info(args ...interface{}) { l.record(fmt.Sprint(args...)) }
+func (l *structuredTestLogger) Infof(format string, args ...interface{}) {
+	l.record(fmt.Sprintf(format, args...))
+}
+func (l *structuredTestLogger) Error(args ...interface{}) { l.record(fmt.Sprint(args...)) }
+func (l *structuredTestLogger) Errorf(format string, args ...interface{}) {
+	l.record(fmt.Sprintf(format, args...))
+}
+
+func (suite *OcppJTestSuite) TestStructuredLogger() {
+	t := suite.T()
+	logger := newStructuredTestLogger()
+	suite.chargePoint.SetLogger(logger)
+	suite.chargePoint.SetRequestHandler(func(request ocpp.Request, requestId string, action string) {})
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	err := suite.chargePoint.Start("someUrl")
+	require.NoError(t, err)
+	// Incoming call
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[2,"1234","%v",{"mockValue":"someValue"}]`, MockFeatureName)))
+	require.NoError(t, err)
+	fields, ok := logger.find("handling incoming CALL")
+	require.True(t, ok)
+	assert.Equal(t, logging.Fields{
+		logging.FieldClientID:  "mock_id",
+		logging.FieldMessageID: "1234",
+		logging.FieldAction:    MockFeatureName,
+		logging.FieldDialect:   ocpp.V16.String(),
+	}, fields)
+	// Outgoing call, logged by the dispatcher
+	err = suite.chargePoint.SendRequest(newMockRequest("someValue"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		fields, ok = logger.find("dispatched request")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "mock_id", fields[logging.FieldClientID])
+	assert.Equal(t, MockFeatureName, fields[logging.FieldAction])
+	assert.NotEmpty(t, fields[logging.FieldMessageID])
+}
+
+func (suite *OcppJTestSuite) TestEndpointMessageValidation() {
+	t := suite.T()
+	suite.chargePoint.SetMessageValidation(false)
+	invalidRequest := newMockRequest("aVeryLongInvalidValue")
+	call, err := suite.chargePoint.CreateCall(invalidRequest)
+	require.NoError(t, err)
+	assert.NotNil(t, call)
+	// Other endpoints keep validating messages
+	call, err = suite.centralSystem.CreateCall(invalidRequest)
+	require.Error(t, err)
+	assert.Nil(t, call)
+	// Endpoint setting takes precedence over the package-level setting
+	ocppj.SetMessageValidation(false)
+	defer ocppj.SetMessageValidation(true)
+	suite.chargePoint.SetMessageValidation(true)
+	_, err = suite.chargePoint.CreateCall(invalidRequest)
+	require.Error(t, err)
+}
+
+func (suite *OcppJTestSuite) TestEndpointMessageIdGenerator() {
+	t := suite.T()
+	suite.chargePoint.SetMessageIdGenerator(func() string {
+		return "customId"
+	})
+	call, err := suite.chargePoint.CreateCall(newMockRequest("someValue"))
+	require.NoError(t, err)
+	assert.Equal(t, "customId", call.UniqueId)
+	call, err = suite.centralSystem.CreateCall(newMockRequest("someValue"))
+	require.NoError(t, err)
+	assert.NotEqual(t, "customId", call.UniqueId)
+	// Restore package-level generator
+	suite.chargePoint.SetMessageIdGenerator(nil)
+	call, err = suite.chargePoint.CreateCall(newMockRequest("someValue"))
+	require.NoError(t, err)
+	assert.NotEqual(t, "customId", call.UniqueId)
+}
+
+func (suite *OcppJTestSuite) TestEndpointHTMLEscape() {
+	t := suite.T()
+	mockChargePointId := "1234"
+	suite.chargePoint.SetHTMLEscape(false)
+	clientWriteC := make(chan string, 1)
+	serverWriteC := make(chan string, 1)
+	suite.mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		clientWriteC <- string(args.Get(0).([]byte))
+	}).Return(nil)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Run(func(args mock.Arguments) {
+		serverWriteC <- string(args.Get(1).([]byte))
+	}).Return(nil)
+	err := suite.chargePoint.SendResponse("5678", newMockConfirmation("<a&b>"))
+	require.NoError(t, err)
+	assert.Contains(t, <-clientWriteC, `"mockValue":"<a&b>"`)
+	// Other endpoints keep escaping HTML characters
+	err = suite.centralSystem.SendResponse(mockChargePointId, "5678", newMockConfirmation("<a&b>"))
+	require.NoError(t, err)
+	assert.Contains(t, <-serverWriteC, `"mockValue":"\u003ca\u0026b\u003e"`)
+	// Messages created by an endpoint follow its setting, when marshaled directly
+	call, err := suite.chargePoint.CreateCall(newMockRequest("<a&b>"))
+	require.NoError(t, err)
+	data, err := call.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"mockValue":"<a&b>"`)
+	callResult, err := suite.chargePoint.CreateCallResult(newMockConfirmation("<a&b>"), "5678")
+	require.NoError(t, err)
+	data, err = callResult.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"mockValue":"<a&b>"`)
+	callError, err := suite.chargePoint.CreateCallError("5678", ocppj.GenericError, "<a&b>", nil)
+	require.NoError(t, err)
+	data, err = callError.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"<a&b>"`)
+	call, err = suite.centralSystem.CreateCall(newMockRequest("<a&b>"))
+	require.NoError(t, err)
+	data, err = call.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"mockValue":"\u003ca\u0026b\u003e"`)
+}
+
 type MockValidationError struct {
 	tag       string
 	namespace string
@@ -875,6 +1115,7 @@ func (m MockValidationError) Error() string                     { return fmt.Spr
 
 func TestMockOcppJ(t *testing.T) {
 	suite.Run(t, new(ClientQueueTestSuite))
+	suite.Run(t, new(FileRequestQueueTestSuite))
 	suite.Run(t, new(ServerQueueMapTestSuite))
 	suite.Run(t, new(ClientStateTestSuite))
 	suite.Run(t, new(ServerStateTestSuite))
@@ -0,0 +1,114 @@
+package ocppj
+
+import (
+	"sync"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// OfflineAction defines how a request is handled, if it is sent while the client is offline.
+type OfflineAction int
+
+const (
+	// OfflineKeep queues the request, same as when the client is online.
+	OfflineKeep OfflineAction = iota
+	// OfflineDrop rejects the request right away.
+	OfflineDrop
+	// OfflineCoalesce queues the request, replacing a previously queued request with the same coalescing key.
+	// The replaced request is canceled.
+	OfflineCoalesce
+)
+
+func (a OfflineAction) String() string {
+	switch a {
+	case OfflineKeep:
+		return "keep"
+	case OfflineDrop:
+		return "drop"
+	case OfflineCoalesce:
+		return "coalesce"
+	default:
+		return "unknown"
+	}
+}
+
+// OfflinePolicy classifies outgoing requests, which are sent while a client is offline,
+// so that the backlog sent after reconnecting stays compact.
+//
+// Requests are classified by feature name. Features without an explicit rule are handled via the default action.
+// The policy is thread-safe.
+//
+//	policy := ocppj.NewOfflinePolicy(ocppj.OfflineKeep)
+//	policy.Drop(core.HeartbeatFeatureName)
+//	policy.Coalesce(core.StatusNotificationFeatureName, func(request ocpp.Request) string {
+//		return fmt.Sprintf("%v", request.(*core.StatusNotificationRequest).ConnectorId)
+//	})
+type OfflinePolicy struct {
+	defaultAction OfflineAction
+	actions       map[string]OfflineAction
+	keys          map[string]func(request ocpp.Request) string
+	mutex         sync.RWMutex
+}
+
+// NewOfflinePolicy creates a new OfflinePolicy, applying the given action to requests without a specific rule.
+// OfflineCoalesce is not a valid default action, and is treated as OfflineKeep.
+func NewOfflinePolicy(defaultAction OfflineAction) *OfflinePolicy {
+	if defaultAction == OfflineCoalesce {
+		defaultAction = OfflineKeep
+	}
+	return &OfflinePolicy{
+		defaultAction: defaultAction,
+		actions:       map[string]OfflineAction{},
+		keys:          map[string]func(request ocpp.Request) string{},
+	}
+}
+
+// Keep marks requests for the given features to be queued while offline.
+func (p *OfflinePolicy) Keep(featureNames ...string) *OfflinePolicy {
+	return p.set(OfflineKeep, nil, featureNames...)
+}
+
+// Drop marks requests for the given features to be rejected while offline.
+func (p *OfflinePolicy) Drop(featureNames ...string) *OfflinePolicy {
+	return p.set(OfflineDrop, nil, featureNames...)
+}
+
+// Coalesce marks requests for the given feature to replace queued requests of the same feature,
+// for which the key function returns the same key.
+// To coalesce all requests of a feature, regardless of their content, a nil key function may be passed.
+func (p *OfflinePolicy) Coalesce(featureName string, key func(request ocpp.Request) string) *OfflinePolicy {
+	if key == nil {
+		key = func(request ocpp.Request) string { return "" }
+	}
+	return p.set(OfflineCoalesce, key, featureName)
+}
+
+func (p *OfflinePolicy) set(action OfflineAction, key func(request ocpp.Request) string, featureNames ...string) *OfflinePolicy {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, featureName := range featureNames {
+		p.actions[featureName] = action
+		if key != nil {
+			p.keys[featureName] = key
+		} else {
+			delete(p.keys, featureName)
+		}
+	}
+	return p
+}
+
+// Classify returns the action to be applied to a request sent while offline.
+// For OfflineCoalesce, the coalescing key of the request is returned as well.
+func (p *OfflinePolicy) Classify(request ocpp.Request) (OfflineAction, string) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	featureName := request.GetFeatureName()
+	action, ok := p.actions[featureName]
+	if !ok {
+		return p.defaultAction, ""
+	}
+	if action == OfflineCoalesce {
+		return action, featureName + "/" + p.keys[featureName](request)
+	}
+	return action, ""
+}
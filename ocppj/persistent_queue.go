@@ -0,0 +1,346 @@
+package ocppj
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PersistentRequestQueue is a RequestQueue, which stores its elements in a durable storage,
+// so that queued requests survive a restart of the process.
+//
+// Since requests are persisted in their serialized form, they need to be decoded again after a restart.
+// The ocppj client takes care of this automatically, by invoking Restore when it is started.
+//
+// A default dispatcher will not clear a PersistentRequestQueue when it is stopped.
+type PersistentRequestQueue interface {
+	RequestQueue
+	// Restore loads the requests found in the persistent storage into the queue.
+	// Each stored request that isn't already contained in the queue is decoded via the passed decode function,
+	// while elements pushed since the queue was created are kept as they are.
+	// Requests that cannot be decoded anymore are dropped.
+	//
+	// Returns all requests contained in the queue after the operation, in FIFO order.
+	Restore(decode func(data []byte) (*Call, error)) ([]RequestBundle, error)
+}
+
+// requestRestorer is implemented by client dispatchers, which are able to restore persisted requests.
+// The ocppj client invokes it when started.
+type requestRestorer interface {
+	restoreRequests(decode func(data []byte) (*Call, error)) ([]RequestBundle, error)
+}
+
+const (
+	fileQueueName             = "requests.log"
+	fileQueueCompactThreshold = 100
+)
+
+type fileQueueOp string
+
+const (
+	fileQueuePush   fileQueueOp = "push"
+	fileQueueRemove fileQueueOp = "remove"
+)
+
+// fileQueueRecord is a single line of the append-only log backing a FileRequestQueue.
+type fileQueueRecord struct {
+	Op   fileQueueOp     `json:"op"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// FileRequestQueue is a PersistentRequestQueue, backed by an append-only log file inside a directory.
+// The queue is thread-safe.
+//
+// Every push and removal is appended to the log and synced to disk before returning,
+// so that at most the operation currently being written may be lost in case of a crash.
+// The log is compacted automatically, once it contains mostly removed requests.
+//
+// Only RequestBundle elements may be pushed into the queue.
+type FileRequestQueue struct {
+	elements []interface{}
+	records  []fileQueueRecord // requests currently persisted on disk, in FIFO order
+	written  int               // number of records in the log file, including removals
+	capacity int
+	path     string
+	file     *os.File
+	mutex    sync.RWMutex
+}
+
+// NewFileRequestQueue creates a new FileRequestQueue, persisting requests in the given directory.
+// If the directory doesn't exist, it is created.
+//
+// If the directory already contains a queue, the persisted requests are loaded, but need to be decoded
+// by calling Restore, before they are available in the queue.
+//
+// Passing capacity = 0 will create a queue without a maximum capacity.
+// The capacity cannot change after creation.
+func NewFileRequestQueue(dir string, capacity int) (*FileRequestQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("couldn't create request queue directory: %w", err)
+	}
+	q := &FileRequestQueue{
+		elements: make([]interface{}, 0, capacity),
+		capacity: capacity,
+		path:     filepath.Join(dir, fileQueueName),
+	}
+	records, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	q.records = records
+	// Rewrite log from scratch, getting rid of removed and corrupted records
+	if err = q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load replays the log file, returning the requests that were never removed.
+func (q *FileRequestQueue) load() ([]fileQueueRecord, error) {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't open request queue: %w", err)
+	}
+	defer f.Close()
+	var records []fileQueueRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record fileQueueRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Most likely a partial write, caused by a crash
+			log.Errorf("discarding corrupted request queue record: %v", err)
+			continue
+		}
+		switch record.Op {
+		case fileQueuePush:
+			records = append(records, record)
+		case fileQueueRemove:
+			records = removeRecord(records, record.ID)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read request queue: %w", err)
+	}
+	return records, nil
+}
+
+func removeRecord(records []fileQueueRecord, id string) []fileQueueRecord {
+	for i, r := range records {
+		if r.ID == id {
+			return append(records[:i:i], records[i+1:]...)
+		}
+	}
+	return records
+}
+
+// compact atomically replaces the log file with a new one, containing only the currently persisted requests.
+func (q *FileRequestQueue) compact() error {
+	tmpPath := q.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't compact request queue: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, record := range q.records {
+		if err = writeRecord(w, record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err == nil {
+		err = os.Rename(tmpPath, q.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("couldn't compact request queue: %w", err)
+	}
+	if q.file != nil {
+		q.file.Close()
+	}
+	q.file, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't open request queue: %w", err)
+	}
+	q.written = len(q.records)
+	return nil
+}
+
+func writeRecord(w interface{ Write(p []byte) (int, error) }, record fileQueueRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// append writes a record to the log file and syncs it to disk.
+func (q *FileRequestQueue) append(record fileQueueRecord) error {
+	if q.file == nil {
+		return fmt.Errorf("request queue is closed")
+	}
+	if err := writeRecord(q.file, record); err != nil {
+		return err
+	}
+	q.written++
+	return q.file.Sync()
+}
+
+// remove deletes a persisted request, compacting the log if needed.
+func (q *FileRequestQueue) remove(id string) {
+	q.records = removeRecord(q.records, id)
+	if err := q.append(fileQueueRecord{Op: fileQueueRemove, ID: id}); err != nil {
+		log.Errorf("couldn't remove request %v from persistent queue: %v", id, err)
+		return
+	}
+	if q.written > fileQueueCompactThreshold && q.written > 2*len(q.records) {
+		if err := q.compact(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+func (q *FileRequestQueue) Init() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.elements = make([]interface{}, 0, q.capacity)
+	q.records = nil
+	if err := q.compact(); err != nil {
+		log.Error(err)
+	}
+}
+
+func (q *FileRequestQueue) Push(element interface{}) error {
+	bundle, ok := element.(RequestBundle)
+	if !ok {
+		return fmt.Errorf("invalid element type %T, only RequestBundle may be pushed into a persistent queue", element)
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.elements) >= q.capacity && q.capacity > 0 {
+		return fmt.Errorf("request queue is full, cannot push new element")
+	}
+	record := fileQueueRecord{Op: fileQueuePush, ID: bundle.Call.UniqueId, Data: bundle.Data}
+	if err := q.append(record); err != nil {
+		return fmt.Errorf("couldn't persist request %v: %w", bundle.Call.UniqueId, err)
+	}
+	q.records = append(q.records, record)
+	q.elements = append(q.elements, element)
+	return nil
+}
+
+func (q *FileRequestQueue) Peek() interface{} {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if len(q.elements) == 0 {
+		return nil
+	}
+	return q.elements[0]
+}
+
+func (q *FileRequestQueue) Pop() interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.elements) == 0 {
+		return nil
+	}
+	result := q.elements[0]
+	q.elements = q.elements[1:]
+	q.remove(result.(RequestBundle).Call.UniqueId)
+	return result
+}
+
+func (q *FileRequestQueue) Remove(match func(element interface{}) bool) interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, el := range q.elements {
+		if match(el) {
+			q.elements = append(q.elements[:i:i], q.elements[i+1:]...)
+			q.remove(el.(RequestBundle).Call.UniqueId)
+			return el
+		}
+	}
+	return nil
+}
+
+func (q *FileRequestQueue) Size() int {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.elements)
+}
+
+func (q *FileRequestQueue) IsFull() bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.elements) >= q.capacity && q.capacity > 0
+}
+
+func (q *FileRequestQueue) IsEmpty() bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.elements) == 0
+}
+
+func (q *FileRequestQueue) Restore(decode func(data []byte) (*Call, error)) ([]RequestBundle, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.file == nil {
+		return nil, fmt.Errorf("request queue is closed")
+	}
+	// Elements pushed after the queue was created are still alive, and must not be replaced
+	live := make(map[string]RequestBundle, len(q.elements))
+	for _, el := range q.elements {
+		bundle := el.(RequestBundle)
+		live[bundle.Call.UniqueId] = bundle
+	}
+	restored := make([]RequestBundle, 0, len(q.records))
+	var dropped []string
+	for _, record := range q.records {
+		if bundle, ok := live[record.ID]; ok {
+			restored = append(restored, bundle)
+			continue
+		}
+		call, err := decode(record.Data)
+		if err != nil {
+			log.Errorf("dropping persisted request %v: %v", record.ID, err)
+			dropped = append(dropped, record.ID)
+			continue
+		}
+		restored = append(restored, RequestBundle{Call: call, Data: record.Data})
+	}
+	for _, id := range dropped {
+		q.remove(id)
+	}
+	q.elements = make([]interface{}, 0, len(restored))
+	for _, bundle := range restored {
+		q.elements = append(q.elements, bundle)
+	}
+	log.Debugf("restored %v requests from persistent queue", len(restored))
+	return restored, nil
+}
+
+// Close closes the underlying log file. The queue cannot be used anymore afterwards.
+// Persisted requests are not affected, and may be loaded by creating a new queue on the same directory.
+func (q *FileRequestQueue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
@@ -0,0 +1,246 @@
+package ocppj_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+type FileRequestQueueTestSuite struct {
+	suite.Suite
+	dir      string
+	endpoint ocppj.Client
+	queue    *ocppj.FileRequestQueue
+}
+
+func (suite *FileRequestQueueTestSuite) SetupTest() {
+	var err error
+	suite.dir = suite.T().TempDir()
+	suite.endpoint = ocppj.Client{Id: "client1"}
+	suite.endpoint.AddProfile(ocpp.NewProfile("mock", &MockFeature{}))
+	suite.queue, err = ocppj.NewFileRequestQueue(suite.dir, queueCapacity)
+	require.NoError(suite.T(), err)
+}
+
+func (suite *FileRequestQueueTestSuite) TearDownTest() {
+	_ = suite.queue.Close()
+}
+
+func (suite *FileRequestQueueTestSuite) newBundle(value string) ocppj.RequestBundle {
+	call, err := suite.endpoint.CreateCall(newMockRequest(value))
+	require.NoError(suite.T(), err)
+	data, err := call.MarshalJSON()
+	require.NoError(suite.T(), err)
+	return ocppj.RequestBundle{Call: call, Data: data}
+}
+
+func (suite *FileRequestQueueTestSuite) decode(data []byte) (*ocppj.Call, error) {
+	parsedJson, err := ocppj.ParseRawJsonMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	message, err := suite.endpoint.ParseMessage(parsedJson, nil)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ocppj.Call), nil
+}
+
+// Closes the current queue and opens a new one on the same directory, simulating a restart.
+func (suite *FileRequestQueueTestSuite) reopen() []ocppj.RequestBundle {
+	t := suite.T()
+	require.NoError(t, suite.queue.Close())
+	var err error
+	suite.queue, err = ocppj.NewFileRequestQueue(suite.dir, queueCapacity)
+	require.NoError(t, err)
+	restored, err := suite.queue.Restore(suite.decode)
+	require.NoError(t, err)
+	return restored
+}
+
+func (suite *FileRequestQueueTestSuite) TestPushAndRestore() {
+	t := suite.T()
+	bundles := []ocppj.RequestBundle{suite.newBundle("value0"), suite.newBundle("value1"), suite.newBundle("value2")}
+	for _, b := range bundles {
+		require.NoError(t, suite.queue.Push(b))
+	}
+	assert.Equal(t, 3, suite.queue.Size())
+	restored := suite.reopen()
+	require.Len(t, restored, 3)
+	assert.Equal(t, 3, suite.queue.Size())
+	for i, b := range bundles {
+		el, ok := suite.queue.Pop().(ocppj.RequestBundle)
+		require.True(t, ok)
+		assert.Equal(t, b.Call.UniqueId, el.Call.UniqueId)
+		assert.Equal(t, b.Call.UniqueId, restored[i].Call.UniqueId)
+		assert.Equal(t, b.Call.Payload, el.Call.Payload)
+		assert.Equal(t, b.Data, el.Data)
+	}
+	assert.True(t, suite.queue.IsEmpty())
+}
+
+func (suite *FileRequestQueueTestSuite) TestPopAndRemoveArePersisted() {
+	t := suite.T()
+	bundles := []ocppj.RequestBundle{suite.newBundle("value0"), suite.newBundle("value1"), suite.newBundle("value2")}
+	for _, b := range bundles {
+		require.NoError(t, suite.queue.Push(b))
+	}
+	el := suite.queue.Pop()
+	assert.Equal(t, bundles[0].Call.UniqueId, el.(ocppj.RequestBundle).Call.UniqueId)
+	el = suite.queue.Remove(func(element interface{}) bool {
+		return element.(ocppj.RequestBundle).Call.UniqueId == bundles[2].Call.UniqueId
+	})
+	require.NotNil(t, el)
+	restored := suite.reopen()
+	require.Len(t, restored, 1)
+	assert.Equal(t, bundles[1].Call.UniqueId, restored[0].Call.UniqueId)
+	assert.Equal(t, 1, suite.queue.Size())
+}
+
+func (suite *FileRequestQueueTestSuite) TestQueueFull() {
+	t := suite.T()
+	for i := 0; i < queueCapacity; i++ {
+		require.NoError(t, suite.queue.Push(suite.newBundle("value")))
+	}
+	assert.True(t, suite.queue.IsFull())
+	err := suite.queue.Push(suite.newBundle("value"))
+	require.Error(t, err)
+	// Restored requests count towards the capacity as well
+	suite.reopen()
+	assert.True(t, suite.queue.IsFull())
+}
+
+func (suite *FileRequestQueueTestSuite) TestRestoreKeepsLiveElements() {
+	t := suite.T()
+	persisted := suite.newBundle("value0")
+	require.NoError(t, suite.queue.Push(persisted))
+	require.NoError(t, suite.queue.Close())
+	var err error
+	suite.queue, err = ocppj.NewFileRequestQueue(suite.dir, queueCapacity)
+	require.NoError(t, err)
+	// Push a new request before restoring the persisted ones
+	live := suite.newBundle("value1")
+	require.NoError(t, suite.queue.Push(live))
+	restored, err := suite.queue.Restore(suite.decode)
+	require.NoError(t, err)
+	require.Len(t, restored, 2)
+	assert.Equal(t, persisted.Call.UniqueId, restored[0].Call.UniqueId)
+	// The live element is kept as it is, rather than being decoded again
+	assert.Same(t, live.Call, restored[1].Call)
+	assert.Equal(t, 2, suite.queue.Size())
+	el, ok := suite.queue.Pop().(ocppj.RequestBundle)
+	require.True(t, ok)
+	assert.Equal(t, persisted.Call.UniqueId, el.Call.UniqueId)
+	el, ok = suite.queue.Pop().(ocppj.RequestBundle)
+	require.True(t, ok)
+	assert.Same(t, live.Call, el.Call)
+}
+
+func (suite *FileRequestQueueTestSuite) TestPushInvalidElement() {
+	t := suite.T()
+	err := suite.queue.Push(newMockRequest("value"))
+	require.Error(t, err)
+	assert.True(t, suite.queue.IsEmpty())
+}
+
+func (suite *FileRequestQueueTestSuite) TestCorruptedRecord() {
+	t := suite.T()
+	b := suite.newBundle("value0")
+	require.NoError(t, suite.queue.Push(b))
+	require.NoError(t, suite.queue.Close())
+	// Simulate partial write after a crash
+	f, err := os.OpenFile(filepath.Join(suite.dir, "requests.log"), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"push","id":"123","da`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	restored := suite.reopen()
+	require.Len(t, restored, 1)
+	assert.Equal(t, b.Call.UniqueId, restored[0].Call.UniqueId)
+}
+
+func (suite *FileRequestQueueTestSuite) TestCompaction() {
+	t := suite.T()
+	for i := 0; i < 500; i++ {
+		require.NoError(t, suite.queue.Push(suite.newBundle("value")))
+		require.NotNil(t, suite.queue.Pop())
+	}
+	b := suite.newBundle("last")
+	require.NoError(t, suite.queue.Push(b))
+	info, err := os.Stat(filepath.Join(suite.dir, "requests.log"))
+	require.NoError(t, err)
+	// Only the few most recent records are left in the log
+	assert.Less(t, info.Size(), int64(100*len(b.Data)))
+	restored := suite.reopen()
+	require.Len(t, restored, 1)
+	assert.Equal(t, b.Call.UniqueId, restored[0].Call.UniqueId)
+}
+
+func (suite *FileRequestQueueTestSuite) TestClientRestoresRequests() {
+	t := suite.T()
+	// Persist request, then restart
+	b := suite.newBundle("value0")
+	require.NoError(t, suite.queue.Push(b))
+	require.NoError(t, suite.queue.Close())
+	var err error
+	suite.queue, err = ocppj.NewFileRequestQueue(suite.dir, queueCapacity)
+	require.NoError(t, err)
+	// Start client on top of the persisted queue
+	writeC := make(chan []byte, 1)
+	mockClient := MockWebsocketClient{}
+	mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("Write", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- args.Get(0).([]byte)
+	})
+	dispatcher := ocppj.NewDefaultClientDispatcher(suite.queue)
+	client := ocppj.NewClient("client1", &mockClient, dispatcher, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	var restoredIDs []string
+	client.SetOnRequestRestored(func(requestId string, request ocpp.Request) {
+		assert.Equal(t, b.Call.Payload, request)
+		restoredIDs = append(restoredIDs, requestId)
+	})
+	err = client.Start("someUrl")
+	require.NoError(t, err)
+	defer dispatcher.Stop()
+	assert.Equal(t, []string{b.Call.UniqueId}, restoredIDs)
+	// Restored request is sent right away
+	assert.Equal(t, b.Data, <-writeC)
+	assert.True(t, client.RequestState.HasPendingRequest())
+}
+
+func (suite *FileRequestQueueTestSuite) TestClientRestoresRequestsOnce() {
+	t := suite.T()
+	// Persist request, then restart
+	b := suite.newBundle("value0")
+	require.NoError(t, suite.queue.Push(b))
+	require.NoError(t, suite.queue.Close())
+	var err error
+	suite.queue, err = ocppj.NewFileRequestQueue(suite.dir, queueCapacity)
+	require.NoError(t, err)
+	// First connection attempt fails
+	mockClient := MockWebsocketClient{}
+	mockClient.On("Start", mock.AnythingOfType("string")).Return(errors.New("connection refused")).Once()
+	mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("Write", mock.Anything).Return(nil)
+	dispatcher := ocppj.NewDefaultClientDispatcher(suite.queue)
+	client := ocppj.NewClient("client1", &mockClient, dispatcher, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	var restoredIDs []string
+	client.SetOnRequestRestored(func(requestId string, request ocpp.Request) {
+		restoredIDs = append(restoredIDs, requestId)
+	})
+	err = client.Start("someUrl")
+	require.Error(t, err)
+	err = client.Start("someUrl")
+	require.NoError(t, err)
+	defer dispatcher.Stop()
+	// Restored request is only reported once
+	assert.Equal(t, []string{b.Call.UniqueId}, restoredIDs)
+}
@@ -1,15 +1,36 @@
 package ocppj
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
 
 // RequestBundle is a convenience struct for passing a call object struct and the
 // raw byte data into the queue containing outgoing requests.
+//
+// An optional Context may be bound to the request. If the context is done before a response is received,
+// the dispatcher cancels the request. A nil context is never done.
 type RequestBundle struct {
-	Call *Call
-	Data []byte
+	Call    *Call
+	Data    []byte
+	Context context.Context
+	done    chan struct{} // closed by the dispatcher once the request leaves the queue
+	span    Span          // set by the endpoint, if the request is traced
+}
+
+// complete notifies a potential context watcher that the request was removed from the queue.
+func (b RequestBundle) complete() {
+	if b.done != nil {
+		close(b.done)
+	}
+}
+
+// traceEvent records an event on the span of the request, if the request is traced.
+func (b RequestBundle) traceEvent(name string) {
+	if b.span != nil {
+		b.span.AddEvent(name)
+	}
 }
 
 // RequestQueue can be arbitrarily implemented, as long as it conforms to the Queue interface.
@@ -34,6 +55,16 @@ type RequestQueue interface {
 	IsEmpty() bool
 }
 
+// removableQueue is optionally implemented by a RequestQueue, which supports removing elements at any position.
+// Remove deletes the first element, for which the match function returns true, from the queue.
+// It returns the removed element, or nil if no element matched.
+//
+// Dispatchers rely on it for removing queued requests, whose context is done, and for coalescing requests while offline.
+// With other queues, such requests are only canceled once they reach the front of the queue, and no requests are coalesced.
+type removableQueue interface {
+	Remove(match func(element interface{}) bool) interface{}
+}
+
 // FIFOClientQueue is a default queue implementation. The queue is thread-safe.
 type FIFOClientQueue struct {
 	elements []interface{}
@@ -77,6 +108,18 @@ func (q *FIFOClientQueue) Pop() interface{} {
 	return result
 }
 
+func (q *FIFOClientQueue) Remove(match func(element interface{}) bool) interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, el := range q.elements {
+		if match(el) {
+			q.elements = append(q.elements[:i:i], q.elements[i+1:]...)
+			return el
+		}
+	}
+	return nil
+}
+
 func (q *FIFOClientQueue) Size() int {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
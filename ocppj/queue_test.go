@@ -1,6 +1,8 @@
 package ocppj_test
 
 import (
+	"fmt"
+
 	"github.com/lorenzodonini/ocpp-go/ocppj"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -95,6 +97,28 @@ func (suite *ClientQueueTestSuite) TestPopElement() {
 	assert.False(t, suite.queue.IsFull())
 }
 
+func (suite *ClientQueueTestSuite) TestRemoveElement() {
+	t := suite.T()
+	for i := 0; i < 3; i++ {
+		req := newMockRequest(fmt.Sprintf("value%v", i))
+		err := suite.queue.Push(req)
+		require.Nil(t, err)
+	}
+	match := func(value string) func(element interface{}) bool {
+		return func(element interface{}) bool {
+			return element.(*MockRequest).MockValue == value
+		}
+	}
+	queue := suite.queue.(*ocppj.FIFOClientQueue)
+	el := queue.Remove(match("value1"))
+	require.NotNil(t, el)
+	assert.Equal(t, "value1", el.(*MockRequest).MockValue)
+	assert.Equal(t, 2, suite.queue.Size())
+	assert.Nil(t, queue.Remove(match("value1")))
+	assert.Equal(t, "value0", suite.queue.Pop().(*MockRequest).MockValue)
+	assert.Equal(t, "value2", suite.queue.Pop().(*MockRequest).MockValue)
+}
+
 func (suite *ClientQueueTestSuite) TestQueueNoCapacity() {
 	t := suite.T()
 	suite.queue = ocppj.NewFIFOClientQueue(0)
@@ -0,0 +1,227 @@
+package ocppj
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/metrics"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+// Frame is a raw OCPP-J message, exactly as it was sent or received by an endpoint.
+type Frame struct {
+	// The time at which the frame was sent or received.
+	Timestamp time.Time `json:"timestamp"`
+	// Whether the frame was received or sent by the recording endpoint.
+	Direction MessageDirection `json:"direction"`
+	// The ID of the client the frame was exchanged with. On a client endpoint, this is the client's own ID.
+	ClientID string `json:"clientId"`
+	// The OCPP version spoken by the recording endpoint, e.g. "ocpp1.6".
+	Dialect string `json:"dialect"`
+	// The role of the recording endpoint, either "server" or "client".
+	Role string `json:"role"`
+	// The raw message. This is a string instead of a JSON object, as received frames may be malformed.
+	Data string `json:"data"`
+}
+
+// sentByClient returns true, if the frame was originally sent by the client endpoint.
+func (f Frame) sentByClient() bool {
+	if f.Role == metrics.RoleServer {
+		return f.Direction == Inbound
+	}
+	return f.Direction == Outbound
+}
+
+func (d MessageDirection) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *MessageDirection) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "inbound":
+		*d = Inbound
+	case "outbound":
+		*d = Outbound
+	default:
+		return fmt.Errorf("invalid message direction %q", string(text))
+	}
+	return nil
+}
+
+// Recorder receives every raw frame sent or received by an endpoint, e.g. to write a transcript of the traffic.
+// Recordings may be replayed via a Replayer.
+//
+// Frames are recorded by different goroutines, hence the implementation must be thread-safe.
+// Recording happens synchronously, so a recorder should not block for long.
+type Recorder interface {
+	Record(frame Frame) error
+}
+
+// JSONLRecorder is a Recorder, which writes every frame as a single line of JSON to a writer.
+// The recorder is thread-safe.
+type JSONLRecorder struct {
+	writer io.Writer
+	closer io.Closer
+	mutex  sync.Mutex
+}
+
+// NewJSONLRecorder creates a recorder, which writes frames to the given writer.
+func NewJSONLRecorder(w io.Writer) *JSONLRecorder {
+	return &JSONLRecorder{writer: w}
+}
+
+// CreateJSONLRecorder creates a recorder, which appends frames to the file at the given path.
+// The file is created if it doesn't exist. Close must be invoked once the recording is done.
+func CreateJSONLRecorder(path string) (*JSONLRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open recording: %w", err)
+	}
+	return &JSONLRecorder{writer: f, closer: f}, nil
+}
+
+func (r *JSONLRecorder) Record(frame Frame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, err = r.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the underlying file, if the recorder was created via CreateJSONLRecorder.
+func (r *JSONLRecorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// ReadFrames parses all frames from a recording in JSONL format. Empty lines are ignored.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+			var frame Frame
+			if jsonErr := json.Unmarshal(trimmed, &frame); jsonErr != nil {
+				return nil, fmt.Errorf("invalid frame on line %d: %w", line, jsonErr)
+			}
+			frames = append(frames, frame)
+		}
+		if err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// LoadFrames parses all frames from a recording file in JSONL format.
+func LoadFrames(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open recording: %w", err)
+	}
+	defer f.Close()
+	return ReadFrames(f)
+}
+
+// recordingServer decorates the websocket server passed to a dispatcher, recording all outgoing requests.
+type recordingServer struct {
+	ws.WsServer
+	record func(clientID string, data []byte)
+}
+
+func (s *recordingServer) Write(webSocketId string, data []byte) error {
+	s.record(webSocketId, data)
+	return s.WsServer.Write(webSocketId, data)
+}
+
+// recordingClient decorates the websocket client passed to a dispatcher, recording all outgoing requests.
+type recordingClient struct {
+	ws.WsClient
+	record func(data []byte)
+}
+
+func (c *recordingClient) Write(data []byte) error {
+	c.record(data)
+	return c.WsClient.Write(data)
+}
+
+// SetRecorder sets a recorder, which receives every raw frame sent to or received from clients.
+// Outgoing frames are recorded right before being passed to the websocket server.
+// Passing nil disables recording.
+//
+// This function must be called before starting the server.
+func (s *Server) SetRecorder(recorder Recorder) {
+	s.recorder = recorder
+	if recorder == nil {
+		s.dispatcher.SetNetworkServer(s.server)
+		return
+	}
+	s.dispatcher.SetNetworkServer(&recordingServer{WsServer: s.server, record: func(clientID string, data []byte) {
+		s.record(Outbound, clientID, data)
+	}})
+}
+
+func (s *Server) record(direction MessageDirection, clientID string, data []byte) {
+	if s.recorder == nil {
+		return
+	}
+	err := s.recorder.Record(Frame{
+		Timestamp: time.Now(),
+		Direction: direction,
+		ClientID:  clientID,
+		Dialect:   s.Dialect().String(),
+		Role:      metrics.RoleServer,
+		Data:      string(data),
+	})
+	if err != nil {
+		s.logWith(clientID, "", "").Errorf("couldn't record frame: %v", err)
+	}
+}
+
+// SetRecorder sets a recorder, which receives every raw frame sent to or received from the server.
+// Outgoing frames are recorded right before being passed to the websocket client.
+// Passing nil disables recording.
+//
+// This function must be called before starting the client.
+func (c *Client) SetRecorder(recorder Recorder) {
+	c.recorder = recorder
+	if recorder == nil {
+		c.dispatcher.SetNetworkClient(c.client)
+		return
+	}
+	c.dispatcher.SetNetworkClient(&recordingClient{WsClient: c.client, record: func(data []byte) {
+		c.record(Outbound, data)
+	}})
+}
+
+func (c *Client) record(direction MessageDirection, data []byte) {
+	if c.recorder == nil {
+		return
+	}
+	err := c.recorder.Record(Frame{
+		Timestamp: time.Now(),
+		Direction: direction,
+		ClientID:  c.Id,
+		Dialect:   c.Dialect().String(),
+		Role:      metrics.RoleClient,
+		Data:      string(data),
+	})
+	if err != nil {
+		c.logWith(c.Id, "", "").Errorf("couldn't record frame: %v", err)
+	}
+}
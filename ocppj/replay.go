@@ -0,0 +1,329 @@
+package ocppj
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/metrics"
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+// Default time a Replayer waits for the endpoint under test, e.g. for a client to connect or for a request to be answered.
+const defaultReplayTimeout = 10 * time.Second
+
+// Replayer reproduces a recorded conversation against a live endpoint, e.g. to turn the transcript
+// of a misbehaving charger into a regression test. Recordings are created via a Recorder.
+//
+// The replayer impersonates one side of the recording, and sends all frames originally sent by that side,
+// in the recorded order. The endpoint under test plays the other side:
+//
+// - NewClientReplayer impersonates the recorded clients, driving a server endpoint (e.g. a CentralSystem or CSMS)
+//
+// - NewServerReplayer impersonates the recorded server, driving client endpoints (e.g. a ChargePoint)
+//
+// Since the endpoint under test generates its own message IDs, a recorded CallResult or CallError is sent
+// in response to the oldest unanswered request received from the endpoint under test, replacing the recorded message ID.
+// If no such request is received within the timeout, the frame is sent unmodified.
+//
+// By default, frames are sent as fast as possible. Use SetOriginalTiming to reproduce the recorded delays.
+type Replayer struct {
+	frames         []Frame
+	role           string
+	serverURL      string
+	newClient      func(clientID string) ws.WsClient
+	server         ws.WsServer
+	originalTiming bool
+	timeout        time.Duration
+	dialects       map[string]string
+	sessions       map[string]*replaySession
+	transcript     []Frame
+	pending        requestSet
+	mutex          sync.Mutex
+}
+
+// replaySession holds the state of a single client connection during a replay.
+type replaySession struct {
+	clientID    string
+	client      ws.WsClient
+	connectedC  chan struct{}
+	connectOnce sync.Once
+	callC       chan string // IDs of requests received from the endpoint under test
+}
+
+func newReplaySession(clientID string) *replaySession {
+	return &replaySession{clientID: clientID, connectedC: make(chan struct{}), callC: make(chan string, 100)}
+}
+
+func (s *replaySession) setConnected() {
+	s.connectOnce.Do(func() {
+		close(s.connectedC)
+	})
+}
+
+// NewClientReplayer creates a replayer, which impersonates the recorded clients and sends their frames to a server endpoint.
+//
+// For every recorded client ID, a websocket client is created via newClient, and connected to serverURL + "/" + clientID.
+// The recorded dialect is requested as sub-protocol. All clients are stopped once the replay is over.
+func NewClientReplayer(frames []Frame, serverURL string, newClient func(clientID string) ws.WsClient) *Replayer {
+	return &Replayer{
+		frames:    frames,
+		role:      metrics.RoleClient,
+		serverURL: strings.TrimSuffix(serverURL, "/"),
+		newClient: newClient,
+		timeout:   defaultReplayTimeout,
+		dialects:  frameDialects(frames),
+		sessions:  map[string]*replaySession{},
+	}
+}
+
+// NewServerReplayer creates a replayer, which impersonates the recorded server and sends its frames to client endpoints.
+//
+// The handlers of the websocket server are replaced immediately, while starting the server is up to the caller.
+// Before sending the first frame to a recorded client ID, the replayer waits for that client to connect.
+func NewServerReplayer(frames []Frame, server ws.WsServer) *Replayer {
+	r := &Replayer{
+		frames:   frames,
+		role:     metrics.RoleServer,
+		server:   server,
+		timeout:  defaultReplayTimeout,
+		dialects: frameDialects(frames),
+		sessions: map[string]*replaySession{},
+	}
+	server.SetNewClientHandler(func(ws ws.Channel) {
+		r.getSession(ws.ID()).setConnected()
+	})
+	server.SetMessageHandler(func(ws ws.Channel, data []byte) error {
+		r.received(ws.ID(), data)
+		return nil
+	})
+	return r
+}
+
+// SetOriginalTiming configures whether frames are sent with the delays found in the recording.
+// If disabled (default), frames are sent as fast as possible.
+func (r *Replayer) SetOriginalTiming(enabled bool) {
+	r.originalTiming = enabled
+}
+
+// SetTimeout sets how long the replayer waits for the endpoint under test,
+// e.g. for a client to connect or for a request to be answered. The default is 10 seconds.
+func (r *Replayer) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// Replay sends the recorded frames to the endpoint under test, and waits until all requests sent by the replayer were answered.
+//
+// Returns the transcript of the replay, containing all frames sent and received by the replayer, in the same format as a recording.
+// An error is returned if a frame couldn't be sent, the context is done or requests weren't answered in time.
+// The transcript is returned in any case.
+func (r *Replayer) Replay(ctx context.Context) ([]Frame, error) {
+	defer r.stopClients()
+	if len(r.frames) == 0 {
+		return nil, nil
+	}
+	start := time.Now()
+	first := r.frames[0].Timestamp
+	for _, frame := range r.frames {
+		if frame.sentByClient() != (r.role == metrics.RoleClient) {
+			// Frame is sent by the endpoint under test
+			continue
+		}
+		if r.originalTiming {
+			if err := sleepContext(ctx, time.Until(start.Add(frame.Timestamp.Sub(first)))); err != nil {
+				return r.getTranscript(), err
+			}
+		}
+		session, err := r.connect(ctx, frame)
+		if err != nil {
+			return r.getTranscript(), err
+		}
+		if err = r.send(ctx, session, frame); err != nil {
+			return r.getTranscript(), err
+		}
+	}
+	// Wait for responses to all requests sent by the replayer
+	waitCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if err := r.pending.wait(waitCtx); err != nil {
+		return r.getTranscript(), fmt.Errorf("requests weren't answered: %w", err)
+	}
+	return r.getTranscript(), nil
+}
+
+func (r *Replayer) getSession(clientID string) *replaySession {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	session, ok := r.sessions[clientID]
+	if !ok {
+		session = newReplaySession(clientID)
+		r.sessions[clientID] = session
+	}
+	return session
+}
+
+// Returns the session for the client of a frame, once the client is connected.
+func (r *Replayer) connect(ctx context.Context, frame Frame) (*replaySession, error) {
+	session := r.getSession(frame.ClientID)
+	if r.role == metrics.RoleServer {
+		// Wait for the client under test to connect
+		select {
+		case <-session.connectedC:
+			return session, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.timeout):
+			return nil, fmt.Errorf("client %v didn't connect", frame.ClientID)
+		}
+	}
+	if session.client != nil {
+		return session, nil
+	}
+	client := r.newClient(frame.ClientID)
+	if frame.Dialect != "" && frame.Dialect != ocpp.Dialect(0).String() {
+		client.SetRequestedSubProtocol(frame.Dialect)
+	}
+	client.SetMessageHandler(func(data []byte) error {
+		r.received(frame.ClientID, data)
+		return nil
+	})
+	if err := client.Start(r.serverURL + "/" + frame.ClientID); err != nil {
+		return nil, fmt.Errorf("couldn't connect client %v: %w", frame.ClientID, err)
+	}
+	session.client = client
+	session.setConnected()
+	return session, nil
+}
+
+func (r *Replayer) send(ctx context.Context, session *replaySession, frame Frame) error {
+	data := []byte(frame.Data)
+	messageType, messageID, ok := parseFrameHeader(data)
+	if ok && (messageType == CALL_RESULT || messageType == CALL_ERROR) {
+		// Answer the request received from the endpoint under test
+		select {
+		case requestID := <-session.callC:
+			data = replaceMessageID(data, requestID)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.timeout):
+		}
+	} else if ok && messageType == CALL {
+		r.pending.add(requestKey{clientID: session.clientID, requestID: messageID})
+	}
+	r.addToTranscript(Outbound, frame.ClientID, frame.Dialect, data)
+	var err error
+	if session.client != nil {
+		err = session.client.Write(data)
+	} else {
+		err = r.server.Write(session.clientID, data)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't send frame to %v: %w", session.clientID, err)
+	}
+	return nil
+}
+
+// Handles a frame received from the endpoint under test.
+func (r *Replayer) received(clientID string, data []byte) {
+	r.addToTranscript(Inbound, clientID, r.dialects[clientID], data)
+	messageType, messageID, ok := parseFrameHeader(data)
+	if !ok {
+		return
+	}
+	switch messageType {
+	case CALL:
+		select {
+		case r.getSession(clientID).callC <- messageID:
+		default:
+		}
+	case CALL_RESULT, CALL_ERROR:
+		r.pending.remove(requestKey{clientID: clientID, requestID: messageID})
+	}
+}
+
+func (r *Replayer) addToTranscript(direction MessageDirection, clientID string, dialect string, data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.transcript = append(r.transcript, Frame{
+		Timestamp: time.Now(),
+		Direction: direction,
+		ClientID:  clientID,
+		Dialect:   dialect,
+		Role:      r.role,
+		Data:      string(data),
+	})
+}
+
+func (r *Replayer) getTranscript() []Frame {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	transcript := make([]Frame, len(r.transcript))
+	copy(transcript, r.transcript)
+	return transcript
+}
+
+func (r *Replayer) stopClients() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, session := range r.sessions {
+		if session.client != nil {
+			session.client.Stop()
+		}
+	}
+}
+
+// Returns the recorded dialect of each client.
+func frameDialects(frames []Frame) map[string]string {
+	dialects := map[string]string{}
+	for _, frame := range frames {
+		dialects[frame.ClientID] = frame.Dialect
+	}
+	return dialects
+}
+
+// Returns the message type and the message ID of a raw frame, if the frame is well-formed.
+func parseFrameHeader(data []byte) (MessageType, string, bool) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) < 2 {
+		return 0, "", false
+	}
+	var messageType MessageType
+	var messageID string
+	if json.Unmarshal(fields[0], &messageType) != nil || json.Unmarshal(fields[1], &messageID) != nil {
+		return 0, "", false
+	}
+	return messageType, messageID, true
+}
+
+// Replaces the message ID of a raw frame. The remaining fields are preserved, except for insignificant whitespace.
+func replaceMessageID(data []byte, messageID string) []byte {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) < 2 {
+		return data
+	}
+	fields[1], _ = json.Marshal(messageID)
+	replaced, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return replaced
+}
+
+// Sleeps for the given duration, or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
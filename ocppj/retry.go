@@ -0,0 +1,54 @@
+package ocppj
+
+import (
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// RetryPolicy defines how a client dispatcher retransmits a request, after the request failed.
+// A request fails if it couldn't be written to the network, if no response was received within the timeout,
+// or if it was answered with a CALLERROR.
+//
+// The policy mirrors the TransactionMessageAttempts and TransactionMessageRetryInterval configuration keys
+// defined by OCPP 1.6: after each failed attempt, the dispatcher waits for RetryInterval multiplied by the number
+// of failed attempts so far, before retransmitting the request.
+//
+// While a request is waiting to be retransmitted, it stays at the front of the queue and no other request is sent.
+// Once all attempts have failed, the request is canceled as usual.
+type RetryPolicy struct {
+	// Maximum number of transmissions for a request, including the first one.
+	// A value <= 1 disables retransmission.
+	MaxAttempts int
+	// Base interval to wait before retransmitting a request.
+	RetryInterval time.Duration
+	// Upper bound for the interval between two attempts. If zero, the interval isn't capped.
+	MaxRetryInterval time.Duration
+}
+
+// NewRetryPolicy creates a RetryPolicy with the given maximum number of attempts and base retry interval.
+func NewRetryPolicy(maxAttempts int, retryInterval time.Duration) RetryPolicy {
+	return RetryPolicy{MaxAttempts: maxAttempts, RetryInterval: retryInterval}
+}
+
+// callErrorRetrier is implemented by client dispatchers, which may retransmit a request answered with a CALLERROR.
+type callErrorRetrier interface {
+	// Returns true, if the pending request with the given ID will be retransmitted, instead of being completed.
+	retryOnError(requestID string, err *ocpp.Error) bool
+}
+
+// A CALLERROR received for the pending request, which is passed to the messagePump.
+type failedRequest struct {
+	requestID string
+	err       *ocpp.Error
+	retryC    chan bool
+}
+
+// Returns the interval to wait before the next attempt, after the given number of failed attempts.
+func (p RetryPolicy) backoff(failedAttempts int) time.Duration {
+	interval := p.RetryInterval * time.Duration(failedAttempts)
+	if p.MaxRetryInterval > 0 && interval > p.MaxRetryInterval {
+		interval = p.MaxRetryInterval
+	}
+	return interval
+}
@@ -1,10 +1,16 @@
 package ocppj
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
 
 	"gopkg.in/go-playground/validator.v9"
 
+	"github.com/lorenzodonini/ocpp-go/logging"
+	"github.com/lorenzodonini/ocpp-go/metrics"
 	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/lorenzodonini/ocpp-go/ws"
 )
@@ -20,11 +26,24 @@ type Server struct {
 	requestHandler            RequestHandler
 	responseHandler           ResponseHandler
 	errorHandler              ErrorHandler
+	canceledRequestHandler    CanceledRequestHandler
 	invalidMessageHook        InvalidMessageHook
 	dispatcher                ServerDispatcher
+	metrics                   metrics.Metrics
+	tracer                    Tracer
+	recorder                  Recorder
+	spans                     spanMap
+	inbound                   requestSet
+	channels                  channelMap
+	shuttingDown              int32
 	RequestState              ServerState
 }
 
+// listenerServer is implemented by websocket servers, which may serve on a caller-provided listener (see ws.Server).
+type listenerServer interface {
+	Serve(listener net.Listener)
+}
+
 type ClientHandler func(client ws.Channel)
 type RequestHandler func(client ws.Channel, request ocpp.Request, requestId string, action string)
 type ResponseHandler func(client ws.Channel, response ocpp.Response, requestId string)
@@ -59,11 +78,17 @@ func NewServer(wsServer ws.WsServer, dispatcher ServerDispatcher, stateHandler S
 	dispatcher.SetPendingRequestState(stateHandler)
 
 	// Create server and add profiles
-	s := Server{Endpoint: Endpoint{}, server: wsServer, RequestState: stateHandler, dispatcher: dispatcher}
+	s := &Server{Endpoint: Endpoint{}, server: wsServer, RequestState: stateHandler, dispatcher: dispatcher, metrics: &metrics.VoidMetrics{}, tracer: &VoidTracer{}}
 	for _, profile := range profiles {
 		s.AddProfile(profile)
 	}
-	return &s
+	// Spans of canceled requests need to be ended, even if no handler is registered
+	if observer, ok := dispatcher.(serverCancelObserver); ok {
+		observer.setCancelObserver(func(clientID string, requestID string, err *ocpp.Error) {
+			s.spans.end(spanKey{clientID: clientID, requestID: requestID}, err)
+		})
+	}
+	return s
 }
 
 // Registers a handler for incoming requests.
@@ -100,8 +125,29 @@ func (s *Server) SetInvalidMessageHook(hook InvalidMessageHook) {
 }
 
 // Registers a handler for canceled request messages.
+//
+// The spans of canceled requests are ended before invoking the handler.
+// Dispatchers other than DefaultServerDispatcher only end the spans once a handler is registered.
 func (s *Server) SetCanceledRequestHandler(handler CanceledRequestHandler) {
-	s.dispatcher.SetOnRequestCanceled(handler)
+	s.canceledRequestHandler = handler
+	if _, ok := s.dispatcher.(serverCancelObserver); ok {
+		s.dispatcher.SetOnRequestCanceled(handler)
+		return
+	}
+	s.dispatcher.SetOnRequestCanceled(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		s.spans.end(spanKey{clientID: clientID, requestID: requestID}, err)
+		if handler != nil {
+			handler(clientID, requestID, request, err)
+		}
+	})
+}
+
+// Sets the Tracer, which opens a span for every outgoing request.
+// By default, a VoidTracer is used.
+//
+// This function must be called before starting the server.
+func (s *Server) SetTracer(tracer Tracer) {
+	s.tracer = tracer
 }
 
 // Registers a handler for incoming client connections.
@@ -119,6 +165,43 @@ func (s *Server) SetDisconnectedClientHandler(handler ClientHandler) {
 	s.disconnectedClientHandler = handler
 }
 
+// Sets the Metrics implementation, which the endpoint reports validation failures to.
+// The metrics are forwarded to the dispatcher and to the websocket server as well,
+// if they report metrics (e.g. DefaultServerDispatcher and ws.Server do).
+//
+// This function must be called before starting the server.
+func (s *Server) SetMetrics(m metrics.Metrics) {
+	s.metrics = m
+	if setter, ok := s.dispatcher.(metricsSetter); ok {
+		setter.SetMetrics(m)
+	}
+	if setter, ok := s.server.(metricsSetter); ok {
+		setter.SetMetrics(m)
+	}
+}
+
+// Reports a failed validation of a message, if the error was caused by one.
+func (s *Server) countValidationFailure(direction string, err error) {
+	if labels, ok := validationLabels(metrics.RoleServer, direction, err); ok {
+		s.metrics.IncCounter(metrics.ValidationFailuresTotal, labels)
+	}
+}
+
+// Sets a custom Logger implementation for this server only.
+// The logger is forwarded to the dispatcher and to the websocket server, if these support it.
+// Passing nil restores the package-level loggers.
+//
+// This function must be called before starting the server.
+func (s *Server) SetLogger(logger logging.Logger) {
+	s.Endpoint.SetLogger(logger)
+	if setter, ok := s.dispatcher.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+	if setter, ok := s.server.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
 // Starts the underlying Websocket server on a specified listenPort and listenPath.
 //
 // The function runs indefinitely, until the server is stopped.
@@ -126,15 +209,57 @@ func (s *Server) SetDisconnectedClientHandler(handler ClientHandler) {
 //
 // An error may be returned, if the websocket server couldn't be started.
 func (s *Server) Start(listenPort int, listenPath string) {
+	s.prepare()
+	// Serve & run
+	s.server.Start(listenPort, listenPath)
+	// TODO: return error?
+}
+
+// Starts the server on a caller-provided listener, e.g. a unix socket or a socket passed by the service manager.
+// The underlying websocket server must support this (see ws.Server.Serve).
+//
+// The function runs indefinitely, until the server is stopped.
+// Invoke this function in a separate goroutine, to perform other operations on the main thread.
+func (s *Server) Serve(listener net.Listener) {
+	ls, ok := s.server.(listenerServer)
+	if !ok {
+		s.logWith("", "", "").Errorf("websocket server doesn't support serving on a listener")
+		return
+	}
+	s.prepare()
+	ls.Serve(listener)
+}
+
+// Handler starts the server without listening for incoming connections, and returns the
+// websocket upgrade handler instead. This allows to mount the server on an existing router, e.g.:
+//
+//	router.Handle("/ocpp/{id}", server.Handler())
+//
+// The final element of the URL path is used as client ID.
+// To stop the server, call the Stop function.
+//
+// If the underlying websocket server cannot be used as HTTP handler (see ws.Server.ServeHTTP), nil is returned.
+func (s *Server) Handler() http.Handler {
+	handler, ok := s.server.(http.Handler)
+	if !ok {
+		return nil
+	}
+	s.prepare()
+	return handler
+}
+
+// Registers the internal handlers on the websocket server and starts the dispatcher.
+func (s *Server) prepare() {
 	// Set internal message handler
 	s.server.SetCheckClientHandler(s.checkClientHandler)
 	s.server.SetNewClientHandler(s.onClientConnected)
 	s.server.SetDisconnectedClientHandler(s.onClientDisconnected)
 	s.server.SetMessageHandler(s.ocppMessageHandler)
+	if graceful, ok := s.server.(gracefulServer); ok {
+		graceful.SetDrainHandler(s.drain)
+	}
+	atomic.StoreInt32(&s.shuttingDown, 0)
 	s.dispatcher.Start()
-	// Serve & run
-	s.server.Start(listenPort, listenPath)
-	// TODO: return error?
 }
 
 // Stops the server.
@@ -142,6 +267,50 @@ func (s *Server) Start(listenPort int, listenPath string) {
 func (s *Server) Stop() {
 	s.dispatcher.Stop()
 	s.server.Stop()
+	s.spans.endAll(ocpp.NewError(GenericError, "server stopped", ""))
+}
+
+// Shutdown gracefully stops the server, in order to hand over clients to another server instance:
+//
+// - new client connections are refused
+//
+// - new outgoing requests are refused, while queued and pending requests are completed
+//
+// - incoming requests, which are being handled, are completed and their responses are sent,
+// while new incoming requests are rejected with an InternalError
+//
+// - connections are closed with a CloseGoingAway code, so clients may reconnect
+//
+// If the passed context is done before all requests were completed, the remaining connections
+// are forcefully closed and the context error is returned.
+//
+// If the underlying websocket server doesn't support a graceful shutdown,
+// the server only waits for requests to complete before being stopped.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logWith("", "", "").Info("shutting down server")
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	var err error
+	if graceful, ok := s.server.(gracefulServer); ok {
+		err = graceful.Shutdown(ctx)
+		s.dispatcher.Stop()
+	} else {
+		err = s.drain(ctx)
+		s.dispatcher.Stop()
+		s.server.Stop()
+	}
+	s.spans.endAll(ocpp.NewError(GenericError, "server stopped", ""))
+	return err
+}
+
+// Waits until responses to all incoming requests were sent, and all outgoing requests were completed.
+func (s *Server) drain(ctx context.Context) error {
+	if err := s.inbound.wait(ctx); err != nil {
+		return err
+	}
+	if d, ok := s.dispatcher.(drainer); ok {
+		return d.Drain(ctx)
+	}
+	return nil
 }
 
 // Sends an OCPP Request to a client, identified by the clientID parameter.
@@ -156,24 +325,49 @@ func (s *Server) Stop() {
 //
 // - the output queue is full
 func (s *Server) SendRequest(clientID string, request ocpp.Request) error {
+	_, err := s.SendRequestCtx(context.Background(), clientID, request)
+	return err
+}
+
+// Sends an OCPP Request to a client, same as SendRequest.
+// The passed context is attached to the request: once the context is done,
+// the request is removed from the queue or, if it was already sent, treated as timed out.
+// In both cases, the request canceled handler is invoked.
+//
+// Returns the unique ID of the enqueued request, which is passed to the response, error and request canceled handlers.
+func (s *Server) SendRequestCtx(ctx context.Context, clientID string, request ocpp.Request) (string, error) {
 	if !s.dispatcher.IsRunning() {
-		return fmt.Errorf("ocppj server is not started, couldn't send request")
+		return "", fmt.Errorf("ocppj server is not started, couldn't send request")
+	}
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		return "", fmt.Errorf("ocppj server is shutting down, couldn't send request")
 	}
 	call, err := s.CreateCall(request)
 	if err != nil {
-		return err
+		s.countValidationFailure(metrics.DirectionOutbound, err)
+		return "", err
 	}
-	jsonMessage, err := call.MarshalJSON()
+	message, err := s.interceptOutbound(clientID, call)
 	if err != nil {
-		return err
+		return "", err
+	} else if message == nil {
+		return "", ErrShortCircuited
+	}
+	call = message.(*Call)
+	jsonMessage, err := s.marshalMessage(call)
+	if err != nil {
+		return "", err
 	}
+	ctx, span := startCallSpan(s.tracer, ctx, clientID, call)
+	s.spans.add(spanKey{clientID: clientID, requestID: call.UniqueId}, span)
 	// Will not send right away. Queuing message and let it be processed by dedicated requestPump routine
-	if err = s.dispatcher.SendRequest(clientID, RequestBundle{call, jsonMessage}); err != nil {
-		log.Errorf("error dispatching request [%s, %s] to %s: %v", call.UniqueId, call.Action, clientID, err)
-		return err
+	if err = s.dispatcher.SendRequest(clientID, RequestBundle{Call: call, Data: jsonMessage, Context: ctx, span: span}); err != nil {
+		s.logWith(clientID, call.UniqueId, call.Action).Errorf("error dispatching request [%s, %s] to %s: %v", call.UniqueId, call.Action, clientID, err)
+		s.spans.end(spanKey{clientID: clientID, requestID: call.UniqueId}, ocpp.NewError(GenericError, err.Error(), call.UniqueId))
+		return "", err
 	}
-	log.Debugf("enqueued CALL [%s, %s] for %s", call.UniqueId, call.Action, clientID)
-	return nil
+	s.logWith(clientID, call.UniqueId, call.Action).Debugf("enqueued CALL [%s, %s] for %s", call.UniqueId, call.Action, clientID)
+	return call.UniqueId, nil
 }
 
 // Sends an OCPP Response to a client, identified by the clientID parameter.
@@ -187,20 +381,29 @@ func (s *Server) SendRequest(clientID string, request ocpp.Request) error {
 //
 // - a network error occurred
 func (s *Server) SendResponse(clientID string, requestId string, response ocpp.Response) error {
+	// The request is considered handled, even if no response could be sent
+	defer s.inbound.remove(requestKey{clientID: clientID, requestID: requestId})
 	callResult, err := s.CreateCallResult(response, requestId)
 	if err != nil {
+		s.countValidationFailure(metrics.DirectionOutbound, err)
+		return err
+	}
+	message, err := s.interceptOutbound(clientID, callResult)
+	if err != nil || message == nil {
 		return err
 	}
-	jsonMessage, err := callResult.MarshalJSON()
+	callResult = message.(*CallResult)
+	jsonMessage, err := s.marshalMessage(callResult)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	s.record(Outbound, clientID, jsonMessage)
 	if err = s.server.Write(clientID, jsonMessage); err != nil {
-		log.Errorf("error sending response [%s] to %s: %v", callResult.GetUniqueId(), clientID, err)
+		s.logWith(clientID, requestId, response.GetFeatureName()).Errorf("error sending response [%s] to %s: %v", callResult.GetUniqueId(), clientID, err)
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
-	log.Debugf("sent CALL RESULT [%s] for %s", callResult.GetUniqueId(), clientID)
-	log.Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
+	s.logWith(clientID, requestId, response.GetFeatureName()).Debugf("sent CALL RESULT [%s] for %s", callResult.GetUniqueId(), clientID)
+	s.logWith(clientID, requestId, response.GetFeatureName()).Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
 	return nil
 }
 
@@ -213,35 +416,50 @@ func (s *Server) SendResponse(clientID string, requestId string, response ocpp.R
 //
 // - a network error occurred
 func (s *Server) SendError(clientID string, requestId string, errorCode ocpp.ErrorCode, description string, details interface{}) error {
+	// The request is considered handled, even if no error could be sent
+	defer s.inbound.remove(requestKey{clientID: clientID, requestID: requestId})
 	callError, err := s.CreateCallError(requestId, errorCode, description, details)
 	if err != nil {
 		return err
 	}
-	jsonMessage, err := callError.MarshalJSON()
+	message, err := s.interceptOutbound(clientID, callError)
+	if err != nil || message == nil {
+		return err
+	}
+	callError = message.(*CallError)
+	jsonMessage, err := s.marshalMessage(callError)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	s.record(Outbound, clientID, jsonMessage)
 	if err = s.server.Write(clientID, jsonMessage); err != nil {
-		log.Errorf("error sending response error [%s] to %s: %v", callError.UniqueId, clientID, err)
+		s.logWith(clientID, requestId, "").Errorf("error sending response error [%s] to %s: %v", callError.UniqueId, clientID, err)
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
-	log.Debugf("sent CALL ERROR [%s] for %s", callError.UniqueId, clientID)
-	log.Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
+	s.logWith(clientID, requestId, "").Debugf("sent CALL ERROR [%s] for %s", callError.UniqueId, clientID)
+	s.logWith(clientID, requestId, "").Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
 	return nil
 }
 
 func (s *Server) ocppMessageHandler(wsChannel ws.Channel, data []byte) error {
+	s.record(Inbound, wsChannel.ID(), data)
 	parsedJson, err := ParseRawJsonMessage(data)
 	if err != nil {
-		log.Error(err)
+		s.logWith(wsChannel.ID(), "", "").Error(err)
 		return err
 	}
-	log.Debugf("received JSON message from %s: %s", wsChannel.ID(), string(data))
+	s.logWith(wsChannel.ID(), "", "").Debugf("received JSON message from %s: %s", wsChannel.ID(), string(data))
 	// Get pending requests for client
 	pending := s.RequestState.GetClientState(wsChannel.ID())
-	message, err := s.ParseMessage(parsedJson, pending)
+	message, err := s.parseMessage(parsedJson, pending)
 	if err != nil {
-		ocppErr := err.(*ocpp.Error)
+		s.countValidationFailure(metrics.DirectionInbound, err)
+		err = unwrapValidationError(err)
+		ocppErr, ok := err.(*ocpp.Error)
+		if !ok {
+			// Parsing errors are expected to be OCPP errors, but a malformed message must never crash the endpoint
+			ocppErr = ocpp.NewError(GenericError, err.Error(), "")
+		}
 		messageID := ocppErr.MessageId
 		// Support ad-hoc callback for invalid message handling
 		if s.invalidMessageHook != nil {
@@ -260,36 +478,95 @@ func (s *Server) ocppMessageHandler(wsChannel ws.Channel, data []byte) error {
 				return err2
 			}
 		}
-		log.Error(err)
+		s.logWith(wsChannel.ID(), ocppErr.MessageId, "").Error(err)
 		return err
 	}
 	if message != nil {
-		switch message.GetMessageTypeId() {
-		case CALL:
-			call := message.(*Call)
-			log.Debugf("handling incoming CALL [%s, %s] from %s", call.UniqueId, call.Action, wsChannel.ID())
-			if s.requestHandler != nil {
-				s.requestHandler(wsChannel, call.Payload, call.UniqueId, call.Action)
-			}
-		case CALL_RESULT:
-			callResult := message.(*CallResult)
-			log.Debugf("handling incoming CALL RESULT [%s] from %s", callResult.UniqueId, wsChannel.ID())
-			s.dispatcher.CompleteRequest(wsChannel.ID(), callResult.GetUniqueId())
-			if s.responseHandler != nil {
-				s.responseHandler(wsChannel, callResult.Payload, callResult.UniqueId)
-			}
-		case CALL_ERROR:
-			callError := message.(*CallError)
-			log.Debugf("handling incoming CALL RESULT [%s] from %s", callError.UniqueId, wsChannel.ID())
-			s.dispatcher.CompleteRequest(wsChannel.ID(), callError.GetUniqueId())
-			if s.errorHandler != nil {
-				s.errorHandler(wsChannel, ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId), callError.ErrorDetails)
+		handled, ocppErr := s.intercept(&Envelope{Direction: Inbound, ClientID: wsChannel.ID(), Message: message}, func(envelope *Envelope) *ocpp.Error {
+			return s.handleMessage(wsChannel, envelope)
+		})
+		if !handled {
+			return s.handleInterceptedMessage(wsChannel, message, ocppErr)
+		}
+		if ocppErr != nil {
+			return ocppErr
+		}
+	}
+	return nil
+}
+
+// Handles an inbound message, after it passed the middleware chain.
+func (s *Server) handleMessage(wsChannel ws.Channel, envelope *Envelope) *ocpp.Error {
+	switch envelope.Message.GetMessageTypeId() {
+	case CALL:
+		call := envelope.Message.(*Call)
+		s.logWith(wsChannel.ID(), call.UniqueId, call.Action).Debugf("handling incoming CALL [%s, %s] from %s", call.UniqueId, call.Action, wsChannel.ID())
+		if atomic.LoadInt32(&s.shuttingDown) == 1 {
+			// New requests wouldn't be answered before the connection is closed
+			s.logWith(wsChannel.ID(), call.UniqueId, call.Action).Infof("rejecting incoming CALL [%s, %s] from %s, server is shutting down", call.UniqueId, call.Action, wsChannel.ID())
+			if err := s.SendError(wsChannel.ID(), call.UniqueId, InternalError, "server is shutting down", nil); err != nil {
+				s.logWith(wsChannel.ID(), call.UniqueId, call.Action).Error(err)
 			}
+			return nil
+		}
+		if s.requestHandler != nil {
+			// The request is in-flight until a response is sent
+			s.inbound.add(requestKey{clientID: wsChannel.ID(), requestID: call.UniqueId})
+			s.requestHandler(wsChannel, call.Payload, call.UniqueId, call.Action)
+		}
+	case CALL_RESULT:
+		callResult := envelope.Message.(*CallResult)
+		s.logWith(wsChannel.ID(), callResult.UniqueId, callResult.Payload.GetFeatureName()).Debugf("handling incoming CALL RESULT [%s] from %s", callResult.UniqueId, wsChannel.ID())
+		s.dispatcher.CompleteRequest(wsChannel.ID(), callResult.GetUniqueId())
+		s.spans.end(spanKey{clientID: wsChannel.ID(), requestID: callResult.UniqueId}, nil)
+		if s.responseHandler != nil {
+			s.responseHandler(wsChannel, callResult.Payload, callResult.UniqueId)
+		}
+	case CALL_ERROR:
+		callError := envelope.Message.(*CallError)
+		s.logWith(wsChannel.ID(), callError.UniqueId, "").Debugf("handling incoming CALL ERROR [%s] from %s", callError.UniqueId, wsChannel.ID())
+		s.dispatcher.CompleteRequest(wsChannel.ID(), callError.GetUniqueId())
+		ocppErr := ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId)
+		s.spans.end(spanKey{clientID: wsChannel.ID(), requestID: callError.UniqueId}, ocppErr)
+		if s.errorHandler != nil {
+			s.errorHandler(wsChannel, ocppErr, callError.ErrorDetails)
 		}
 	}
 	return nil
 }
 
+// Handles an inbound message, which was rejected or short-circuited by a middleware.
+func (s *Server) handleInterceptedMessage(wsChannel ws.Channel, message Message, err *ocpp.Error) error {
+	requestID := message.GetUniqueId()
+	if message.GetMessageTypeId() == CALL {
+		if err == nil {
+			s.logWith(wsChannel.ID(), requestID, "").Debugf("incoming CALL [%s] from %s short-circuited by middleware", requestID, wsChannel.ID())
+			return nil
+		}
+		s.logWith(wsChannel.ID(), requestID, "").Infof("incoming CALL [%s] from %s rejected by middleware: %v", requestID, wsChannel.ID(), err)
+		return s.SendError(wsChannel.ID(), requestID, err.Code, err.Description, nil)
+	}
+	// The pending request is completed in any case, so the next request may be sent
+	request, _ := s.RequestState.GetClientState(wsChannel.ID()).GetPendingRequest(requestID)
+	s.dispatcher.CompleteRequest(wsChannel.ID(), requestID)
+	if err == nil {
+		s.logWith(wsChannel.ID(), requestID, "").Debugf("incoming response [%s] from %s short-circuited by middleware", requestID, wsChannel.ID())
+		// No response will be delivered, hence the request is treated as canceled
+		cancelErr := ocpp.NewError(GenericError, "response short-circuited by middleware", requestID)
+		s.spans.end(spanKey{clientID: wsChannel.ID(), requestID: requestID}, cancelErr)
+		if s.canceledRequestHandler != nil && request != nil {
+			s.canceledRequestHandler(wsChannel.ID(), requestID, request, cancelErr)
+		}
+		return nil
+	}
+	s.spans.end(spanKey{clientID: wsChannel.ID(), requestID: requestID}, err)
+	s.logWith(wsChannel.ID(), requestID, "").Infof("incoming response [%s] from %s rejected by middleware: %v", requestID, wsChannel.ID(), err)
+	if s.errorHandler != nil {
+		s.errorHandler(wsChannel, err, nil)
+	}
+	return nil
+}
+
 // HandleFailedResponseError allows to handle failures while sending responses (either CALL_RESULT or CALL_ERROR).
 // It internally analyzes and creates an ocpp.Error based on the given error.
 // It will the attempt to send it to the client.
@@ -298,7 +575,7 @@ func (s *Server) ocppMessageHandler(wsChannel ws.Channel, data []byte) error {
 // The method will, however, only attempt to send a default error once.
 // If this operation fails, the other endpoint may still starve.
 func (s *Server) HandleFailedResponseError(clientID string, requestID string, err error, featureName string) {
-	log.Debugf("handling error for failed response [%s]", requestID)
+	s.logWith(clientID, requestID, featureName).Debugf("handling error for failed response [%s]", requestID)
 	var responseErr *ocpp.Error
 	// There's several possible errors: invalid profile, invalid payload or send error
 	switch err.(type) {
@@ -320,6 +597,12 @@ func (s *Server) HandleFailedResponseError(clientID string, requestID string, er
 func (s *Server) onClientConnected(ws ws.Channel) {
 	// Create state for connected client
 	s.dispatcher.CreateClient(ws.ID())
+	if replaced := s.channels.add(ws); replaced {
+		// No disconnection was reported for the replaced connection, hence requests in flight need to be canceled here
+		if observer, ok := s.dispatcher.(replacementObserver); ok {
+			observer.clientReplaced(ws.ID())
+		}
+	}
 	// Invoke callback
 	if s.newClientHandler != nil {
 		s.newClientHandler(ws)
@@ -330,6 +613,9 @@ func (s *Server) onClientDisconnected(ws ws.Channel) {
 	// Clear state for disconnected client
 	s.dispatcher.DeleteClient(ws.ID())
 	s.RequestState.ClearClientPendingRequest(ws.ID())
+	s.spans.endClient(ws.ID(), ocpp.NewError(GenericError, "client disconnected", ""))
+	s.inbound.removeClient(ws.ID())
+	s.channels.remove(ws)
 	// Invoke callback
 	if s.disconnectedClientHandler != nil {
 		s.disconnectedClientHandler(ws)
@@ -0,0 +1,87 @@
+package ocppj
+
+import (
+	"context"
+	"sync"
+)
+
+// gracefulServer is implemented by websocket servers, which support a graceful shutdown (see ws.Server).
+type gracefulServer interface {
+	SetDrainHandler(handler func(ctx context.Context) error)
+	Shutdown(ctx context.Context) error
+}
+
+// drainer is implemented by dispatchers, which can wait for all queued and pending requests to be completed.
+type drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// requestKey identifies a request exchanged with a specific client.
+type requestKey struct {
+	clientID  string
+	requestID string
+}
+
+// requestSet keeps track of incoming requests, until a response was sent.
+// Access is thread-safe.
+type requestSet struct {
+	requests map[requestKey]struct{}
+	emptyC   chan struct{} // closed once the set is empty, created by wait
+	mutex    sync.Mutex
+}
+
+func (s *requestSet) add(key requestKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.requests == nil {
+		s.requests = map[requestKey]struct{}{}
+	}
+	s.requests[key] = struct{}{}
+}
+
+func (s *requestSet) remove(key requestKey) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.requests, key)
+	s.notifyEmpty()
+}
+
+// Removes all requests of the given client.
+func (s *requestSet) removeClient(clientID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.requests {
+		if key.clientID == clientID {
+			delete(s.requests, key)
+		}
+	}
+	s.notifyEmpty()
+}
+
+// Wakes up all waiters, if the set is empty. Must be invoked while holding the mutex.
+func (s *requestSet) notifyEmpty() {
+	if len(s.requests) == 0 && s.emptyC != nil {
+		close(s.emptyC)
+		s.emptyC = nil
+	}
+}
+
+// wait blocks until the set is empty. If the passed context is done before, the context error is returned.
+func (s *requestSet) wait(ctx context.Context) error {
+	s.mutex.Lock()
+	if len(s.requests) == 0 {
+		s.mutex.Unlock()
+		return nil
+	}
+	if s.emptyC == nil {
+		s.emptyC = make(chan struct{})
+	}
+	emptyC := s.emptyC
+	s.mutex.Unlock()
+	select {
+	case <-emptyC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package ocppj
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// Attribute keys set on the spans opened by an endpoint.
+const (
+	AttributeAction    = "ocpp.action"
+	AttributeUniqueID  = "ocpp.unique_id"
+	AttributeClientID  = "ocpp.client_id"
+	AttributeErrorCode = "ocpp.error_code"
+)
+
+// Events recorded on the span of a request, while it is processed by the dispatcher.
+const (
+	EventQueued = "queued"
+	EventSent   = "sent"
+	EventRetry  = "retry"
+)
+
+// Tracer is the adapter interface that needs to be implemented, if outgoing requests should be traced.
+//
+// This allows to hook up your tracing system of choice (e.g. OpenTelemetry).
+// An endpoint opens a span for every outgoing Call, and ends it once a CallResult or CallError was received,
+// or when the request was canceled (e.g. after a timeout).
+//
+// The context passed to the tracer is the one bound to the request (see SendRequestCtx),
+// so a span may be linked to a parent span carried by the context.
+type Tracer interface {
+	// StartSpan opens a new span with the given name and attributes.
+	// The returned context is bound to the request instead of the original one,
+	// hence it must not drop the deadline or cancellation signal of the original context.
+	StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, Span)
+}
+
+// Span represents the lifetime of a single outgoing request.
+// The methods are invoked by different goroutines (e.g. the dispatcher and the message handler),
+// hence the implementation must be thread-safe.
+type Span interface {
+	// SetAttribute adds an attribute to the span.
+	SetAttribute(key string, value string)
+	// AddEvent records an event, which occurred while the request was being processed.
+	AddEvent(name string)
+	// End closes the span. If the request failed, the respective error is passed, otherwise err is nil.
+	End(err *ocpp.Error)
+}
+
+// VoidTracer is an empty implementation of the Tracer interface, which doesn't actually trace any requests.
+// It is used by default, if no tracer was set.
+type VoidTracer struct{}
+
+func (t *VoidTracer) StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, Span) {
+	return ctx, voidSpan{}
+}
+
+type voidSpan struct{}
+
+func (s voidSpan) SetAttribute(key string, value string) {}
+func (s voidSpan) AddEvent(name string)                  {}
+func (s voidSpan) End(err *ocpp.Error)                   {}
+
+// Opens the span for an outgoing call.
+func startCallSpan(tracer Tracer, ctx context.Context, clientID string, call *Call) (context.Context, Span) {
+	return tracer.StartSpan(ctx, call.Action, map[string]string{
+		AttributeAction:   call.Action,
+		AttributeUniqueID: call.UniqueId,
+		AttributeClientID: clientID,
+	})
+}
+
+// clientCancelObserver is implemented by client dispatchers, which notify an observer of canceled requests,
+// in addition to the handler set via SetOnRequestCanceled (see DefaultClientDispatcher).
+// It allows a Client to end the spans of canceled requests, without replacing the dispatcher's handler.
+type clientCancelObserver interface {
+	setCancelObserver(observer func(requestID string, err *ocpp.Error))
+}
+
+// serverCancelObserver is the counterpart of clientCancelObserver for server dispatchers (see DefaultServerDispatcher).
+type serverCancelObserver interface {
+	setCancelObserver(observer func(clientID string, requestID string, err *ocpp.Error))
+}
+
+// spanKey identifies a span tracked by an endpoint. On a client endpoint, the client ID is always empty.
+type spanKey struct {
+	clientID  string
+	requestID string
+}
+
+// spanMap keeps track of the spans of outgoing requests, until a response is received.
+// Access is thread-safe.
+type spanMap struct {
+	spans map[spanKey]Span
+	mutex sync.Mutex
+}
+
+func (m *spanMap) add(key spanKey, span Span) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.spans == nil {
+		m.spans = map[spanKey]Span{}
+	}
+	m.spans[key] = span
+}
+
+// Ends and removes the span with the given key, if it exists.
+func (m *spanMap) end(key spanKey, err *ocpp.Error) {
+	m.mutex.Lock()
+	span, ok := m.spans[key]
+	delete(m.spans, key)
+	m.mutex.Unlock()
+	if ok {
+		endSpan(span, err)
+	}
+}
+
+// Ends and removes all spans.
+func (m *spanMap) endAll(err *ocpp.Error) {
+	m.endMatching(func(key spanKey) bool { return true }, err)
+}
+
+// Ends and removes all spans of the given client.
+func (m *spanMap) endClient(clientID string, err *ocpp.Error) {
+	m.endMatching(func(key spanKey) bool { return key.clientID == clientID }, err)
+}
+
+func (m *spanMap) endMatching(match func(key spanKey) bool, err *ocpp.Error) {
+	var ended []Span
+	m.mutex.Lock()
+	for key, span := range m.spans {
+		if match(key) {
+			ended = append(ended, span)
+			delete(m.spans, key)
+		}
+	}
+	m.mutex.Unlock()
+	for _, span := range ended {
+		endSpan(span, err)
+	}
+}
+
+func endSpan(span Span, err *ocpp.Error) {
+	if err != nil {
+		span.SetAttribute(AttributeErrorCode, string(err.Code))
+	}
+	span.End(err)
+}
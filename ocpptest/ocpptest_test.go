@@ -0,0 +1,282 @@
+package ocpptest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	types16 "github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	ocpp2 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/authorization"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/provisioning"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/remotecontrol"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/transactions"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/lorenzodonini/ocpp-go/ocpptest"
+)
+
+const (
+	validIdTag   = "validTag"
+	invalidIdTag = "invalidTag"
+)
+
+// ---------------------- OCPP 1.6 ----------------------
+
+type centralSystemHandler struct {
+	core.CentralSystemHandler
+	registrationStatus core.RegistrationStatus
+}
+
+func (h *centralSystemHandler) idTagInfo(idTag string) *types16.IdTagInfo {
+	if idTag == validIdTag {
+		return types16.NewIdTagInfo(types16.AuthorizationStatusAccepted)
+	}
+	return types16.NewIdTagInfo(types16.AuthorizationStatusInvalid)
+}
+
+func (h *centralSystemHandler) OnAuthorize(chargePointId string, request *core.AuthorizeRequest) (*core.AuthorizeConfirmation, error) {
+	return core.NewAuthorizationConfirmation(h.idTagInfo(request.IdTag)), nil
+}
+
+func (h *centralSystemHandler) OnBootNotification(chargePointId string, request *core.BootNotificationRequest) (*core.BootNotificationConfirmation, error) {
+	return core.NewBootNotificationConfirmation(types16.NewDateTime(time.Now()), 60, h.registrationStatus), nil
+}
+
+func (h *centralSystemHandler) OnHeartbeat(chargePointId string, request *core.HeartbeatRequest) (*core.HeartbeatConfirmation, error) {
+	return core.NewHeartbeatConfirmation(types16.NewDateTime(time.Now())), nil
+}
+
+func (h *centralSystemHandler) OnStatusNotification(chargePointId string, request *core.StatusNotificationRequest) (*core.StatusNotificationConfirmation, error) {
+	return core.NewStatusNotificationConfirmation(), nil
+}
+
+func (h *centralSystemHandler) OnStartTransaction(chargePointId string, request *core.StartTransactionRequest) (*core.StartTransactionConfirmation, error) {
+	return core.NewStartTransactionConfirmation(h.idTagInfo(request.IdTag), 42), nil
+}
+
+func (h *centralSystemHandler) OnStopTransaction(chargePointId string, request *core.StopTransactionRequest) (*core.StopTransactionConfirmation, error) {
+	if request.TransactionId != 42 {
+		return nil, ocpp.NewError(ocppj.PropertyConstraintViolation, "unknown transaction", "")
+	}
+	return core.NewStopTransactionConfirmation(), nil
+}
+
+func newCentralSystemRunner(registrationStatus core.RegistrationStatus) *ocpptest.Runner {
+	return ocpptest.NewCentralSystemRunner(func(centralSystem ocpp16.CentralSystem) {
+		centralSystem.SetCoreHandler(&centralSystemHandler{registrationStatus: registrationStatus})
+	})
+}
+
+type chargePointHandler struct {
+	core.ChargePointHandler
+	chargePoint ocpp16.ChargePoint
+}
+
+func (h *chargePointHandler) OnChangeAvailability(request *core.ChangeAvailabilityRequest) (*core.ChangeAvailabilityConfirmation, error) {
+	return core.NewChangeAvailabilityConfirmation(core.AvailabilityStatusAccepted), nil
+}
+
+func (h *chargePointHandler) OnReset(request *core.ResetRequest) (*core.ResetConfirmation, error) {
+	return core.NewResetConfirmation(core.ResetStatusAccepted), nil
+}
+
+func (h *chargePointHandler) OnRemoteStartTransaction(request *core.RemoteStartTransactionRequest) (*core.RemoteStartTransactionConfirmation, error) {
+	go func() {
+		_, _ = h.chargePoint.StatusNotification(*request.ConnectorId, core.NoError, core.ChargePointStatusPreparing)
+		_, _ = h.chargePoint.StartTransaction(*request.ConnectorId, request.IdTag, 0, types16.NewDateTime(time.Now()))
+	}()
+	return core.NewRemoteStartTransactionConfirmation(types16.RemoteStartStopStatusAccepted), nil
+}
+
+func newChargePointRunner() *ocpptest.Runner {
+	return ocpptest.NewChargePointRunner(func(chargePoint ocpp16.ChargePoint) {
+		chargePoint.SetCoreHandler(&chargePointHandler{chargePoint: chargePoint})
+	})
+}
+
+func TestCentralSystemScenarios(t *testing.T) {
+	newCentralSystemRunner(core.RegistrationStatusAccepted).RunTests(t, ocpptest.CentralSystemScenarios(validIdTag, invalidIdTag))
+}
+
+func TestChargePointScenarios(t *testing.T) {
+	newChargePointRunner().RunTests(t, ocpptest.ChargePointScenarios(validIdTag))
+}
+
+// ---------------------- OCPP 2.0.1 ----------------------
+
+type csmsHandler struct{}
+
+func (h *csmsHandler) idTokenInfo(idToken *types.IdToken) *types.IdTokenInfo {
+	if idToken.IdToken == validIdTag {
+		return types.NewIdTokenInfo(types.AuthorizationStatusAccepted)
+	}
+	return types.NewIdTokenInfo(types.AuthorizationStatusUnknown)
+}
+
+func (h *csmsHandler) OnBootNotification(chargingStationID string, request *provisioning.BootNotificationRequest) (*provisioning.BootNotificationResponse, error) {
+	return provisioning.NewBootNotificationResponse(types.NewDateTime(time.Now()), 60, provisioning.RegistrationStatusAccepted), nil
+}
+
+func (h *csmsHandler) OnNotifyReport(chargingStationID string, request *provisioning.NotifyReportRequest) (*provisioning.NotifyReportResponse, error) {
+	return provisioning.NewNotifyReportResponse(), nil
+}
+
+func (h *csmsHandler) OnHeartbeat(chargingStationID string, request *availability.HeartbeatRequest) (*availability.HeartbeatResponse, error) {
+	return availability.NewHeartbeatResponse(*types.NewDateTime(time.Now())), nil
+}
+
+func (h *csmsHandler) OnStatusNotification(chargingStationID string, request *availability.StatusNotificationRequest) (*availability.StatusNotificationResponse, error) {
+	return availability.NewStatusNotificationResponse(), nil
+}
+
+func (h *csmsHandler) OnAuthorize(chargingStationID string, request *authorization.AuthorizeRequest) (*authorization.AuthorizeResponse, error) {
+	return authorization.NewAuthorizationResponse(*h.idTokenInfo(&request.IdToken)), nil
+}
+
+func (h *csmsHandler) OnTransactionEvent(chargingStationID string, request *transactions.TransactionEventRequest) (*transactions.TransactionEventResponse, error) {
+	response := transactions.NewTransactionEventResponse()
+	if request.IDToken != nil {
+		response.IDTokenInfo = h.idTokenInfo(request.IDToken)
+	}
+	return response, nil
+}
+
+type provisioningHandler struct {
+	provisioning.ChargingStationHandler
+}
+
+func (h *provisioningHandler) OnReset(request *provisioning.ResetRequest) (*provisioning.ResetResponse, error) {
+	return provisioning.NewResetResponse(provisioning.ResetStatusAccepted), nil
+}
+
+type availabilityHandler struct{}
+
+func (h *availabilityHandler) OnChangeAvailability(request *availability.ChangeAvailabilityRequest) (*availability.ChangeAvailabilityResponse, error) {
+	return availability.NewChangeAvailabilityResponse(availability.ChangeAvailabilityStatusScheduled), nil
+}
+
+type remoteControlHandler struct {
+	remotecontrol.ChargingStationHandler
+	chargingStation ocpp2.ChargingStation
+}
+
+func (h *remoteControlHandler) OnRequestStartTransaction(request *remotecontrol.RequestStartTransactionRequest) (*remotecontrol.RequestStartTransactionResponse, error) {
+	go func() {
+		_, _ = h.chargingStation.TransactionEvent(transactions.TransactionEventStarted, types.NewDateTime(time.Now()), transactions.TriggerReasonRemoteStart, 0,
+			transactions.Transaction{TransactionID: "tx1", RemoteStartID: &request.RemoteStartID}, func(event *transactions.TransactionEventRequest) {
+				event.IDToken = &request.IDToken
+			})
+	}()
+	return remotecontrol.NewRequestStartTransactionResponse(remotecontrol.RequestStartStopStatusAccepted), nil
+}
+
+func TestCSMSScenarios(t *testing.T) {
+	runner := ocpptest.NewCSMSRunner(func(csms ocpp2.CSMS) {
+		handler := &csmsHandler{}
+		csms.SetProvisioningHandler(handler)
+		csms.SetAvailabilityHandler(handler)
+		csms.SetAuthorizationHandler(handler)
+		csms.SetTransactionsHandler(handler)
+	})
+	runner.RunTests(t, ocpptest.CSMSScenarios(validIdTag, invalidIdTag))
+}
+
+func TestChargingStationScenarios(t *testing.T) {
+	runner := ocpptest.NewChargingStationRunner(func(chargingStation ocpp2.ChargingStation) {
+		chargingStation.SetProvisioningHandler(&provisioningHandler{})
+		chargingStation.SetAvailabilityHandler(&availabilityHandler{})
+		chargingStation.SetRemoteControlHandler(&remoteControlHandler{chargingStation: chargingStation})
+	})
+	runner.RunTests(t, ocpptest.ChargingStationScenarios(validIdTag))
+}
+
+// ---------------------- Runner ----------------------
+
+func TestRunnerFieldMismatch(t *testing.T) {
+	runner := newCentralSystemRunner(core.RegistrationStatusPending)
+	err := runner.Run(context.Background(), ocpptest.CentralSystemScenarios(validIdTag, invalidIdTag)[0])
+	assert.EqualError(t, err, "step 1 (send BootNotification): field status: expected Accepted, got Pending")
+}
+
+func TestRunnerVariables(t *testing.T) {
+	runner := newCentralSystemRunner(core.RegistrationStatusAccepted)
+	scenario := ocpptest.Scenario{
+		Name: "StopUnknownTransaction",
+		Steps: []ocpptest.Step{
+			ocpptest.Send{
+				Request: core.NewStartTransactionRequest(1, validIdTag, 0, types16.NewDateTime(time.Now())),
+				Fields:  ocpptest.Fields{"idTagInfo.status": "Accepted", "idTagInfo.parentIdTag": nil, "transactionId": 42},
+				Save:    map[string]string{"transactionId": "tx"},
+			},
+			ocpptest.Send{
+				RequestFunc: func(vars ocpptest.Variables) ocpp.Request {
+					assert.Equal(t, "42", vars.String("tx"))
+					return core.NewStopTransactionRequest(0, types16.NewDateTime(time.Now()), vars.Int("tx")+1)
+				},
+				ErrorCode: ocppj.PropertyConstraintViolation,
+			},
+			// No handler is set for the firmware profile
+			ocpptest.Send{
+				Request:   firmware.NewDiagnosticsStatusNotificationRequest(firmware.DiagnosticsStatusIdle),
+				ErrorCode: ocppj.NotSupported,
+			},
+		},
+	}
+	require.NoError(t, runner.Run(context.Background(), scenario))
+	// Unexpected error
+	scenario.Steps[1] = ocpptest.Send{Request: core.NewStopTransactionRequest(0, types16.NewDateTime(time.Now()), 1)}
+	err := runner.Run(context.Background(), scenario)
+	assert.EqualError(t, err, "step 2 (send StopTransaction): received error PropertyConstraintViolation: unknown transaction")
+	// Expected error, but got response
+	scenario.Steps[1] = ocpptest.Send{Request: core.NewHeartbeatRequest(), ErrorCode: ocppj.NotSupported}
+	err = runner.Run(context.Background(), scenario)
+	assert.EqualError(t, err, "step 2 (send Heartbeat): expected error NotSupported, got Heartbeat response")
+}
+
+func TestRunnerOrdering(t *testing.T) {
+	runner := newChargePointRunner()
+	remoteStart := ocpptest.ChargePointScenarios(validIdTag)[2]
+	scenario := ocpptest.Scenario{
+		Name: "UnexpectedOrder",
+		Steps: []ocpptest.Step{
+			remoteStart.Steps[0],
+			ocpptest.Expect{Action: core.StartTransactionFeatureName, Response: core.NewStatusNotificationConfirmation()},
+		},
+	}
+	err := runner.Run(context.Background(), scenario)
+	assert.EqualError(t, err, "step 2 (expect StartTransaction): expected StartTransaction request, got StatusNotification")
+	// Scripted error responses
+	scenario.Steps = []ocpptest.Step{
+		remoteStart.Steps[0],
+		ocpptest.Expect{Action: core.StatusNotificationFeatureName, ErrorCode: ocppj.InternalError},
+		ocpptest.Expect{Action: core.StartTransactionFeatureName, ErrorCode: ocppj.InternalError},
+	}
+	require.NoError(t, runner.Run(context.Background(), scenario))
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	runner := newCentralSystemRunner(core.RegistrationStatusAccepted)
+	runner.SetTimeout(50 * time.Millisecond)
+	scenario := ocpptest.Scenario{
+		Name: "NoRequest",
+		Steps: []ocpptest.Step{
+			ocpptest.Expect{Action: core.RemoteStartTransactionFeatureName, Optional: true},
+			ocpptest.Expect{Action: core.RemoteStartTransactionFeatureName, Timeout: 100 * time.Millisecond},
+		},
+	}
+	err := runner.Run(context.Background(), scenario)
+	assert.EqualError(t, err, "step 2 (expect RemoteStartTransaction): timed out after 100ms waiting for RemoteStartTransaction request")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = runner.Run(ctx, scenario)
+	assert.ErrorIs(t, err, context.Canceled)
+}
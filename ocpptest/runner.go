@@ -0,0 +1,262 @@
+package ocpptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+const (
+	// The client ID used by the runner, both for impersonated clients and for clients under test.
+	ClientID = "ocpptest"
+	// Default time a step waits for the endpoint under test.
+	defaultTimeout = 5 * time.Second
+	// Port and path passed to the in-memory websocket server. No socket is opened.
+	listenPort = 8887
+	listenPath = "/{ws}"
+	serverURL  = "ws://localhost:8887"
+)
+
+var errNoCall = errors.New("no request received")
+
+// Runner executes scenarios against an endpoint under test. Every scenario is executed against a fresh instance of the endpoint,
+// connected to the runner via the in-memory websocket transport.
+//
+// Runners are created via NewCentralSystemRunner, NewChargePointRunner, NewCSMSRunner or NewChargingStationRunner.
+type Runner struct {
+	// Starts the endpoint under test, connects it to the session and returns a function for stopping it.
+	start   func(s *session) (func(), error)
+	timeout time.Duration
+}
+
+// SetTimeout sets how long each step waits for the endpoint under test, unless overridden by the step itself.
+// The default is 5 seconds.
+func (r *Runner) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// Run executes a scenario. Steps are executed in order, and the first failed step aborts the scenario.
+//
+// The returned error describes the failed step.
+func (r *Runner) Run(ctx context.Context, scenario Scenario) error {
+	s := newSession(r.timeout)
+	stop, err := r.start(s)
+	if err != nil {
+		return fmt.Errorf("couldn't start endpoint under test: %w", err)
+	}
+	defer stop()
+	for i, step := range scenario.Steps {
+		if err = step.run(ctx, s); err != nil {
+			return fmt.Errorf("step %d (%v): %w", i+1, step.Description(), err)
+		}
+	}
+	return nil
+}
+
+// RunTests executes every scenario as a subtest of t, named after the scenario.
+func (r *Runner) RunTests(t *testing.T, scenarios []Scenario) {
+	for _, scenario := range scenarios {
+		scenario := scenario
+		t.Run(scenario.Name, func(t *testing.T) {
+			if err := r.Run(context.Background(), scenario); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// peer abstracts the endpoint played by the runner, which is either an ocppj client or an ocppj server.
+type peer interface {
+	sendRequest(request ocpp.Request) error
+	sendResponse(requestID string, response ocpp.Response) error
+	sendError(requestID string, errorCode ocpp.ErrorCode, description string) error
+}
+
+type clientPeer struct {
+	endpoint *ocppj.Client
+}
+
+func (p *clientPeer) sendRequest(request ocpp.Request) error {
+	return p.endpoint.SendRequest(request)
+}
+
+func (p *clientPeer) sendResponse(requestID string, response ocpp.Response) error {
+	return p.endpoint.SendResponse(requestID, response)
+}
+
+func (p *clientPeer) sendError(requestID string, errorCode ocpp.ErrorCode, description string) error {
+	return p.endpoint.SendError(requestID, errorCode, description, nil)
+}
+
+type serverPeer struct {
+	endpoint *ocppj.Server
+}
+
+func (p *serverPeer) sendRequest(request ocpp.Request) error {
+	return p.endpoint.SendRequest(ClientID, request)
+}
+
+func (p *serverPeer) sendResponse(requestID string, response ocpp.Response) error {
+	return p.endpoint.SendResponse(ClientID, requestID, response)
+}
+
+func (p *serverPeer) sendError(requestID string, errorCode ocpp.ErrorCode, description string) error {
+	return p.endpoint.SendError(ClientID, requestID, errorCode, description, nil)
+}
+
+// incomingCall is a request received from the endpoint under test.
+type incomingCall struct {
+	requestID string
+	action    string
+	request   ocpp.Request
+}
+
+// result is the outcome of a request sent to the endpoint under test.
+type result struct {
+	response ocpp.Response
+	err      *ocpp.Error
+}
+
+// session holds the state of a single scenario run.
+type session struct {
+	peer     peer
+	timeout  time.Duration
+	vars     Variables
+	callC    chan incomingCall
+	resultC  chan result
+	nextCall *incomingCall // Received, but not yet consumed by an Expect step
+}
+
+func newSession(timeout time.Duration) *session {
+	return &session{
+		timeout: timeout,
+		vars:    Variables{},
+		callC:   make(chan incomingCall, 100),
+		resultC: make(chan result, 10),
+	}
+}
+
+func (s *session) stepTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return s.timeout
+}
+
+func (s *session) onRequest(request ocpp.Request, requestID string, action string) {
+	s.callC <- incomingCall{requestID: requestID, action: action, request: request}
+}
+
+func (s *session) onResponse(response ocpp.Response) {
+	s.resultC <- result{response: response}
+}
+
+func (s *session) onError(err *ocpp.Error) {
+	s.resultC <- result{err: err}
+}
+
+// Returns the next request received from the endpoint under test, without consuming it.
+// If no request is received within the timeout, errNoCall is returned.
+func (s *session) peekCall(ctx context.Context, timeout time.Duration) (*incomingCall, error) {
+	if s.nextCall != nil {
+		return s.nextCall, nil
+	}
+	select {
+	case call := <-s.callC:
+		s.nextCall = &call
+		return s.nextCall, nil
+	case <-time.After(timeout):
+		return nil, errNoCall
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Creates a runner, which impersonates a client and connects to a server endpoint under test.
+//
+// startServer is invoked for every scenario, and must start the endpoint under test on the given in-memory server.
+// It returns a function for stopping the endpoint.
+func newServerRunner(subProtocol string, dialect ocpp.Dialect, profiles []*ocpp.Profile, startServer func(server *ws.MemoryServer) func()) *Runner {
+	return &Runner{
+		timeout: defaultTimeout,
+		start: func(s *session) (func(), error) {
+			server := ws.NewMemoryServer()
+			stopServer := startServer(server)
+			client := ws.NewMemoryClient(server)
+			client.SetRequestedSubProtocol(subProtocol)
+			endpoint := ocppj.NewClient(ClientID, client, nil, nil, profiles...)
+			endpoint.SetDialect(dialect)
+			endpoint.SetRequestHandler(s.onRequest)
+			endpoint.SetResponseHandler(func(response ocpp.Response, requestId string) {
+				s.onResponse(response)
+			})
+			endpoint.SetErrorHandler(func(err *ocpp.Error, details interface{}) {
+				s.onError(err)
+			})
+			s.peer = &clientPeer{endpoint: endpoint}
+			if err := endpoint.Start(serverURL); err != nil {
+				stopServer()
+				return nil, err
+			}
+			return func() {
+				endpoint.Stop()
+				stopServer()
+			}, nil
+		},
+	}
+}
+
+// Creates a runner, which impersonates a server, to which a client endpoint under test connects.
+//
+// startClient is invoked for every scenario, and must connect the endpoint under test to the given in-memory server.
+// It returns a function for stopping the endpoint.
+func newClientRunner(subProtocol string, dialect ocpp.Dialect, profiles []*ocpp.Profile, startClient func(server *ws.MemoryServer) (func(), error)) *Runner {
+	r := &Runner{timeout: defaultTimeout}
+	r.start = func(s *session) (func(), error) {
+		server := ws.NewMemoryServer()
+		server.AddSupportedSubprotocol(subProtocol)
+		endpoint := ocppj.NewServer(server, nil, nil, profiles...)
+		endpoint.SetDialect(dialect)
+		connectedC := make(chan struct{}, 1)
+		endpoint.SetNewClientHandler(func(client ws.Channel) {
+			select {
+			case connectedC <- struct{}{}:
+			default:
+			}
+		})
+		endpoint.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+			s.onRequest(request, requestId, action)
+		})
+		endpoint.SetResponseHandler(func(client ws.Channel, response ocpp.Response, requestId string) {
+			s.onResponse(response)
+		})
+		endpoint.SetErrorHandler(func(client ws.Channel, err *ocpp.Error, details interface{}) {
+			s.onError(err)
+		})
+		s.peer = &serverPeer{endpoint: endpoint}
+		go endpoint.Start(listenPort, listenPath)
+		stopClient, err := startClient(server)
+		if err != nil {
+			endpoint.Stop()
+			return nil, err
+		}
+		stop := func() {
+			stopClient()
+			endpoint.Stop()
+		}
+		select {
+		case <-connectedC:
+		case <-time.After(r.timeout):
+			stop()
+			return nil, fmt.Errorf("client didn't connect")
+		}
+		return stop, nil
+	}
+	return r
+}
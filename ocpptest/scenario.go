@@ -0,0 +1,313 @@
+// Package ocpptest runs declarative conformance scenarios against OCPP endpoints, over the in-process stack.
+//
+// A scenario is an ordered list of steps. The runner plays the counterpart of the endpoint under test:
+// it either sends requests and verifies the responses (Send), or waits for requests sent by the endpoint under test
+// and answers them with a scripted response (Expect).
+//
+// Runners are available for both sides of OCPP 1.6 (NewCentralSystemRunner, NewChargePointRunner)
+// and OCPP 2.0.1 (NewCSMSRunner, NewChargingStationRunner). A starter set of scenarios, modelled on the use cases of the specification,
+// is provided for each of them (e.g. CentralSystemScenarios).
+//
+// No sockets are involved, so scenarios may be run as regular unit tests:
+//
+//	runner := ocpptest.NewCentralSystemRunner(func(centralSystem ocpp16.CentralSystem) {
+//		centralSystem.SetCoreHandler(&MyCoreHandler{})
+//	})
+//	runner.RunTests(t, ocpptest.CentralSystemScenarios("validTag", "invalidTag"))
+package ocpptest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// Scenario is a named, ordered list of steps, which are executed against a fresh instance of the endpoint under test.
+type Scenario struct {
+	Name        string
+	Description string
+	Steps       []Step
+}
+
+// Step is a single interaction with the endpoint under test. Available steps are Send and Expect.
+type Step interface {
+	// Description returns a short, human-readable description of the step, used in error messages.
+	Description() string
+	run(ctx context.Context, s *session) error
+}
+
+// Fields contains the expected values of message fields, indexed by their path.
+//
+// A path is made of the JSON field names, separated by dots. Array elements are addressed by their index,
+// e.g. "idTagInfo.status" or "meterValue.0.timestamp".
+// Expected values are compared to the JSON encoding of the message, hence both typed values (e.g. core.RegistrationStatusAccepted)
+// and their raw JSON counterpart (e.g. "Accepted") may be used. A nil value expects the field to be absent.
+type Fields map[string]interface{}
+
+// Variables holds values saved by previous steps of a running scenario, indexed by variable name.
+//
+// Values are stored in their JSON representation, i.e. numbers are stored as float64.
+type Variables map[string]interface{}
+
+// String returns the value of a variable as string, or an empty string if the variable doesn't exist.
+func (v Variables) String(name string) string {
+	value, ok := v[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Int returns the value of a numeric variable as int, or 0 if the variable doesn't exist or isn't a number.
+func (v Variables) Int(name string) int {
+	switch value := v[name].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	case string:
+		i, _ := strconv.Atoi(value)
+		return i
+	default:
+		return 0
+	}
+}
+
+// Send sends a request to the endpoint under test and waits for the response.
+type Send struct {
+	// The request to send.
+	Request ocpp.Request
+	// Builds the request to send, e.g. using variables saved by previous steps. Takes precedence over Request.
+	RequestFunc func(vars Variables) ocpp.Request
+	// The expected fields of the response.
+	Fields Fields
+	// Optional custom assertion on the response.
+	Check func(response ocpp.Response, vars Variables) error
+	// If set, the endpoint under test is expected to reply with a CallError with this error code, instead of a response.
+	ErrorCode ocpp.ErrorCode
+	// Response fields to save as variables for later steps, indexed by field path.
+	Save map[string]string
+	// How long to wait for the response. If zero, the timeout of the runner is used.
+	Timeout time.Duration
+}
+
+func (step Send) Description() string {
+	if step.Request != nil && step.RequestFunc == nil {
+		return fmt.Sprintf("send %v", step.Request.GetFeatureName())
+	}
+	return "send request"
+}
+
+func (step Send) run(ctx context.Context, s *session) error {
+	request := step.Request
+	if step.RequestFunc != nil {
+		request = step.RequestFunc(s.vars)
+	}
+	if request == nil {
+		return fmt.Errorf("no request to send")
+	}
+	if err := s.peer.sendRequest(request); err != nil {
+		return fmt.Errorf("couldn't send %v request: %w", request.GetFeatureName(), err)
+	}
+	timeout := s.stepTimeout(step.Timeout)
+	var res result
+	select {
+	case res = <-s.resultC:
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %v waiting for %v response", timeout, request.GetFeatureName())
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if res.err != nil {
+		if step.ErrorCode == "" {
+			return fmt.Errorf("received error %v: %v", res.err.Code, res.err.Description)
+		} else if res.err.Code != step.ErrorCode {
+			return fmt.Errorf("expected error %v, got %v: %v", step.ErrorCode, res.err.Code, res.err.Description)
+		}
+		return nil
+	}
+	if step.ErrorCode != "" {
+		return fmt.Errorf("expected error %v, got %v response", step.ErrorCode, res.response.GetFeatureName())
+	}
+	return s.verify(res.response, step.Fields, step.Save, func() error {
+		if step.Check == nil {
+			return nil
+		}
+		return step.Check(res.response, s.vars)
+	})
+}
+
+// Expect waits for a request sent by the endpoint under test, verifies it and replies with a scripted response.
+//
+// Requests must be received in the order of the Expect steps. A request for a different action fails the scenario,
+// unless the step is optional: optional steps are skipped, if the next received request doesn't match,
+// or if no request is received within the timeout.
+// Requests received after the last step are ignored.
+type Expect struct {
+	// The expected action, e.g. "StartTransaction".
+	Action string
+	// The expected fields of the request.
+	Fields Fields
+	// Optional custom assertion on the request.
+	Check func(request ocpp.Request, vars Variables) error
+	// Request fields to save as variables for later steps, indexed by field path.
+	Save map[string]string
+	// The response to reply with.
+	Response ocpp.Response
+	// Builds the response to reply with, e.g. using variables saved by previous steps. Takes precedence over Response.
+	ResponseFunc func(request ocpp.Request, vars Variables) ocpp.Response
+	// If set, the request is answered with a CallError with this error code, instead of a response.
+	ErrorCode ocpp.ErrorCode
+	// Whether the step may be skipped.
+	Optional bool
+	// How long to wait for the request. If zero, the timeout of the runner is used.
+	Timeout time.Duration
+}
+
+func (step Expect) Description() string {
+	if step.Optional {
+		return fmt.Sprintf("expect optional %v", step.Action)
+	}
+	return fmt.Sprintf("expect %v", step.Action)
+}
+
+func (step Expect) run(ctx context.Context, s *session) error {
+	timeout := s.stepTimeout(step.Timeout)
+	call, err := s.peekCall(ctx, timeout)
+	if err == errNoCall {
+		if step.Optional {
+			return nil
+		}
+		return fmt.Errorf("timed out after %v waiting for %v request", timeout, step.Action)
+	} else if err != nil {
+		return err
+	}
+	if call.action != step.Action {
+		if step.Optional {
+			return nil
+		}
+		return fmt.Errorf("expected %v request, got %v", step.Action, call.action)
+	}
+	// Request is consumed by this step
+	s.nextCall = nil
+	err = s.verify(call.request, step.Fields, step.Save, func() error {
+		if step.Check == nil {
+			return nil
+		}
+		return step.Check(call.request, s.vars)
+	})
+	if err != nil {
+		return err
+	}
+	if step.ErrorCode != "" {
+		return s.peer.sendError(call.requestID, step.ErrorCode, "scripted error")
+	}
+	response := step.Response
+	if step.ResponseFunc != nil {
+		response = step.ResponseFunc(call.request, s.vars)
+	}
+	if response == nil {
+		return fmt.Errorf("no response configured for %v request", step.Action)
+	}
+	if err = s.peer.sendResponse(call.requestID, response); err != nil {
+		return fmt.Errorf("couldn't send %v response: %w", step.Action, err)
+	}
+	return nil
+}
+
+// Verifies the fields of a received message, runs the custom assertion and saves the requested variables.
+func (s *session) verify(message interface{}, fields Fields, save map[string]string, check func() error) error {
+	document, err := toJSONValue(message)
+	if err != nil {
+		return err
+	}
+	if err = matchFields(document, fields); err != nil {
+		return err
+	}
+	if err = check(); err != nil {
+		return err
+	}
+	for path, name := range save {
+		value, ok := lookupField(document, path)
+		if !ok {
+			return fmt.Errorf("couldn't save field %v: field is missing", path)
+		}
+		s.vars[name] = value
+	}
+	return nil
+}
+
+// Checks the expected fields against a message in its generic JSON representation. Fields are checked in alphabetical order.
+func matchFields(document interface{}, fields Fields) error {
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		actual, found := lookupField(document, path)
+		if fields[path] == nil {
+			if found && actual != nil {
+				return fmt.Errorf("field %v: expected no value, got %v", path, actual)
+			}
+			continue
+		}
+		expected, err := toJSONValue(fields[path])
+		if err != nil {
+			return fmt.Errorf("field %v: %w", path, err)
+		}
+		if !found {
+			return fmt.Errorf("field %v: expected %v, but field is missing", path, expected)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			return fmt.Errorf("field %v: expected %v, got %v", path, expected, actual)
+		}
+	}
+	return nil
+}
+
+// Returns the value at the given path of a generic JSON document.
+func lookupField(document interface{}, path string) (interface{}, bool) {
+	value := document
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Converts a value to its generic JSON representation, so it can be compared with decoded messages.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err = json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,207 @@
+package ocpptest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp16 "github.com/lorenzodonini/ocpp-go/ocpp1.6"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/certificates"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/core"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/extendedtriggermessage"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/logging"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/reservation"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/securefirmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/security"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/smartcharging"
+	"github.com/lorenzodonini/ocpp-go/ocpp1.6/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+var profiles16 = []*ocpp.Profile{
+	core.Profile,
+	localauth.Profile,
+	firmware.Profile,
+	reservation.Profile,
+	remotetrigger.Profile,
+	smartcharging.Profile,
+	logging.Profile,
+	security.Profile,
+	extendedtriggermessage.Profile,
+	certificates.Profile,
+	securefirmware.Profile,
+}
+
+// NewCentralSystemRunner creates a runner for OCPP 1.6 central systems. The runner impersonates a charge point with ID ClientID.
+//
+// For every scenario, a new central system is created and passed to setup, which is expected to set the handlers under test.
+// The central system is started by the runner.
+func NewCentralSystemRunner(setup func(centralSystem ocpp16.CentralSystem)) *Runner {
+	return newServerRunner(types.V16Subprotocol, ocpp.V16, profiles16, func(server *ws.MemoryServer) func() {
+		centralSystem := ocpp16.NewCentralSystem(nil, server)
+		setup(centralSystem)
+		go centralSystem.Start(listenPort, listenPath)
+		return centralSystem.Stop
+	})
+}
+
+// NewChargePointRunner creates a runner for OCPP 1.6 charge points. The runner impersonates a central system.
+//
+// For every scenario, a new charge point with ID ClientID is created and passed to setup, which is expected to set the handlers under test.
+// The charge point is started by the runner.
+func NewChargePointRunner(setup func(chargePoint ocpp16.ChargePoint)) *Runner {
+	return newClientRunner(types.V16Subprotocol, ocpp.V16, profiles16, func(server *ws.MemoryServer) (func(), error) {
+		chargePoint := ocpp16.NewChargePoint(ClientID, nil, ws.NewMemoryClient(server))
+		setup(chargePoint)
+		if err := chargePoint.Start(serverURL); err != nil {
+			return nil, err
+		}
+		return chargePoint.Stop, nil
+	})
+}
+
+// Steps of a charge point booting with a single connector.
+func bootSteps16() []Step {
+	return []Step{
+		Send{
+			Request: core.NewBootNotificationRequest("ocpptest", "ocpp-go"),
+			Fields:  Fields{"status": core.RegistrationStatusAccepted},
+		},
+		Send{Request: core.NewStatusNotificationRequest(0, core.NoError, core.ChargePointStatusAvailable)},
+		Send{Request: core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusAvailable)},
+	}
+}
+
+// CentralSystemScenarios returns the starter set of scenarios for OCPP 1.6 central systems.
+//
+// The central system is expected to accept the charge point, to accept validIdTag and to reject invalidIdTag.
+func CentralSystemScenarios(validIdTag string, invalidIdTag string) []Scenario {
+	return []Scenario{
+		{
+			Name:        "ColdBoot",
+			Description: "The charge point boots and reports the status of its connectors.",
+			Steps:       bootSteps16(),
+		},
+		{
+			Name:        "Heartbeat",
+			Description: "The charge point sends a heartbeat after booting.",
+			Steps: append(bootSteps16(),
+				Send{Request: core.NewHeartbeatRequest()},
+			),
+		},
+		{
+			Name:        "RegularChargingSession",
+			Description: "An EV driver authorizes, charges and stops the transaction locally.",
+			Steps: append(bootSteps16(),
+				Send{Request: core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusPreparing)},
+				Send{
+					Request: core.NewAuthorizationRequest(validIdTag),
+					Fields:  Fields{"idTagInfo.status": types.AuthorizationStatusAccepted},
+				},
+				Send{
+					RequestFunc: func(vars Variables) ocpp.Request {
+						return core.NewStartTransactionRequest(1, validIdTag, 0, types.NewDateTime(time.Now()))
+					},
+					Fields: Fields{"idTagInfo.status": types.AuthorizationStatusAccepted},
+					Save:   map[string]string{"transactionId": "transactionId"},
+				},
+				Send{Request: core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusCharging)},
+				Send{
+					RequestFunc: func(vars Variables) ocpp.Request {
+						request := core.NewStopTransactionRequest(1000, types.NewDateTime(time.Now()), vars.Int("transactionId"))
+						request.IdTag = validIdTag
+						request.Reason = core.ReasonLocal
+						return request
+					},
+				},
+				Send{Request: core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusFinishing)},
+				Send{Request: core.NewStatusNotificationRequest(1, core.NoError, core.ChargePointStatusAvailable)},
+			),
+		},
+		{
+			Name:        "AuthorizeInvalidIdTag",
+			Description: "An EV driver presents an unknown idTag, which is not accepted.",
+			Steps: append(bootSteps16(),
+				Send{
+					Request: core.NewAuthorizationRequest(invalidIdTag),
+					Check: func(response ocpp.Response, vars Variables) error {
+						if status := response.(*core.AuthorizeConfirmation).IdTagInfo.Status; status == types.AuthorizationStatusAccepted {
+							return fmt.Errorf("idTag %v was accepted", invalidIdTag)
+						}
+						return nil
+					},
+				},
+			),
+		},
+	}
+}
+
+// Accepts the status of a ChangeAvailability response, if the change was either applied or scheduled.
+func checkAvailabilityChanged16(response ocpp.Response, vars Variables) error {
+	switch status := response.(*core.ChangeAvailabilityConfirmation).Status; status {
+	case core.AvailabilityStatusAccepted, core.AvailabilityStatusScheduled:
+		return nil
+	default:
+		return fmt.Errorf("availability change was %v", status)
+	}
+}
+
+// ChargePointScenarios returns the starter set of scenarios for OCPP 1.6 charge points.
+//
+// The charge point is expected to accept resets, availability changes and remote start requests for idTag.
+// After a remote start, the charge point must start a transaction on connector 1. Authorize and StatusNotification requests sent in the meantime are accepted.
+func ChargePointScenarios(idTag string) []Scenario {
+	return []Scenario{
+		{
+			Name:        "SoftReset",
+			Description: "The central system requests a soft reset.",
+			Steps: []Step{
+				Send{
+					Request: core.NewResetRequest(core.ResetTypeSoft),
+					Fields:  Fields{"status": core.ResetStatusAccepted},
+				},
+			},
+		},
+		{
+			Name:        "ChangeAvailability",
+			Description: "The central system sets the charge point to inoperative, and back to operative.",
+			Steps: []Step{
+				Send{Request: core.NewChangeAvailabilityRequest(0, core.AvailabilityTypeInoperative), Check: checkAvailabilityChanged16},
+				Send{Request: core.NewChangeAvailabilityRequest(0, core.AvailabilityTypeOperative), Check: checkAvailabilityChanged16},
+			},
+		},
+		{
+			Name:        "RemoteStartTransaction",
+			Description: "The central system remotely starts a transaction on connector 1.",
+			Steps: []Step{
+				Send{
+					RequestFunc: func(vars Variables) ocpp.Request {
+						request := core.NewRemoteStartTransactionRequest(idTag)
+						connectorID := 1
+						request.ConnectorId = &connectorID
+						return request
+					},
+					Fields: Fields{"status": types.RemoteStartStopStatusAccepted},
+				},
+				Expect{
+					Action:   core.AuthorizeFeatureName,
+					Optional: true,
+					Response: core.NewAuthorizationConfirmation(types.NewIdTagInfo(types.AuthorizationStatusAccepted)),
+				},
+				Expect{
+					Action:   core.StatusNotificationFeatureName,
+					Optional: true,
+					Response: core.NewStatusNotificationConfirmation(),
+				},
+				Expect{
+					Action:   core.StartTransactionFeatureName,
+					Fields:   Fields{"connectorId": 1, "idTag": idTag},
+					Response: core.NewStartTransactionConfirmation(types.NewIdTagInfo(types.AuthorizationStatusAccepted), 1),
+				},
+			},
+		},
+	}
+}
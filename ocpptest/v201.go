@@ -0,0 +1,231 @@
+package ocpptest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+	ocpp2 "github.com/lorenzodonini/ocpp-go/ocpp2.0.1"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/authorization"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/availability"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/data"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/diagnostics"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/display"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/firmware"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/iso15118"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/localauth"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/meter"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/provisioning"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/remotecontrol"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/reservation"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/security"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/smartcharging"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/tariffcost"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/transactions"
+	"github.com/lorenzodonini/ocpp-go/ocpp2.0.1/types"
+	"github.com/lorenzodonini/ocpp-go/ws"
+)
+
+var profiles201 = []*ocpp.Profile{
+	authorization.Profile,
+	availability.Profile,
+	data.Profile,
+	diagnostics.Profile,
+	display.Profile,
+	firmware.Profile,
+	iso15118.Profile,
+	localauth.Profile,
+	meter.Profile,
+	provisioning.Profile,
+	remotecontrol.Profile,
+	reservation.Profile,
+	security.Profile,
+	smartcharging.Profile,
+	tariffcost.Profile,
+	transactions.Profile,
+}
+
+// NewCSMSRunner creates a runner for OCPP 2.0.1 charging station management systems. The runner impersonates a charging station with ID ClientID.
+//
+// For every scenario, a new CSMS is created and passed to setup, which is expected to set the handlers under test.
+// The CSMS is started by the runner.
+func NewCSMSRunner(setup func(csms ocpp2.CSMS)) *Runner {
+	return newServerRunner(types.V201Subprotocol, ocpp.V2, profiles201, func(server *ws.MemoryServer) func() {
+		csms := ocpp2.NewCSMS(nil, server)
+		setup(csms)
+		go csms.Start(listenPort, listenPath)
+		return csms.Stop
+	})
+}
+
+// NewChargingStationRunner creates a runner for OCPP 2.0.1 charging stations. The runner impersonates a CSMS.
+//
+// For every scenario, a new charging station with ID ClientID is created and passed to setup, which is expected to set the handlers under test.
+// The charging station is started by the runner.
+func NewChargingStationRunner(setup func(chargingStation ocpp2.ChargingStation)) *Runner {
+	return newClientRunner(types.V201Subprotocol, ocpp.V2, profiles201, func(server *ws.MemoryServer) (func(), error) {
+		chargingStation := ocpp2.NewChargingStation(ClientID, nil, ws.NewMemoryClient(server))
+		setup(chargingStation)
+		if err := chargingStation.Start(serverURL); err != nil {
+			return nil, err
+		}
+		return chargingStation.Stop, nil
+	})
+}
+
+// Steps of a charging station booting with a single EVSE and connector.
+func bootSteps201() []Step {
+	return []Step{
+		Send{
+			Request: provisioning.NewBootNotificationRequest(provisioning.BootReasonPowerUp, "ocpptest", "ocpp-go"),
+			Fields:  Fields{"status": provisioning.RegistrationStatusAccepted},
+		},
+		Send{
+			RequestFunc: func(vars Variables) ocpp.Request {
+				return availability.NewStatusNotificationRequest(types.NewDateTime(time.Now()), availability.ConnectorStatusAvailable, 1, 1)
+			},
+		},
+	}
+}
+
+// Builds a TransactionEvent request for the transaction started by the scenario, on EVSE 1.
+func transactionEvent201(eventType transactions.TransactionEvent, reason transactions.TriggerReason, seqNo int, idToken string) *transactions.TransactionEventRequest {
+	info := transactions.Transaction{TransactionID: "ocpptest-1"}
+	if eventType == transactions.TransactionEventEnded {
+		info.StoppedReason = transactions.ReasonLocal
+	}
+	request := transactions.NewTransactionEventRequest(eventType, types.NewDateTime(time.Now()), reason, seqNo, info)
+	connectorID := 1
+	request.Evse = &types.EVSE{ID: 1, ConnectorID: &connectorID}
+	request.IDToken = &types.IdToken{IdToken: idToken, Type: types.IdTokenTypeISO14443}
+	return request
+}
+
+// CSMSScenarios returns the starter set of scenarios for OCPP 2.0.1 charging station management systems.
+// Scenario names are prefixed with the ID of the use case they are modelled on.
+//
+// The CSMS is expected to accept the charging station, to accept validIdToken and to reject invalidIdToken (both of type ISO14443).
+func CSMSScenarios(validIdToken string, invalidIdToken string) []Scenario {
+	return []Scenario{
+		{
+			Name:        "B01_ColdBoot",
+			Description: "The charging station boots and reports the status of its connector.",
+			Steps:       bootSteps201(),
+		},
+		{
+			Name:        "G02_Heartbeat",
+			Description: "The charging station sends a heartbeat after booting.",
+			Steps: append(bootSteps201(),
+				Send{Request: availability.NewHeartbeatRequest()},
+			),
+		},
+		{
+			Name:        "E03_StartTransactionIdTokenFirst",
+			Description: "An EV driver authorizes before the transaction is started, and stops the transaction locally.",
+			Steps: append(bootSteps201(),
+				Send{
+					Request: authorization.NewAuthorizationRequest(validIdToken, types.IdTokenTypeISO14443),
+					Fields:  Fields{"idTokenInfo.status": types.AuthorizationStatusAccepted},
+				},
+				Send{
+					RequestFunc: func(vars Variables) ocpp.Request {
+						return transactionEvent201(transactions.TransactionEventStarted, transactions.TriggerReasonAuthorized, 0, validIdToken)
+					},
+					Fields: Fields{"idTokenInfo.status": types.AuthorizationStatusAccepted},
+				},
+				Send{
+					RequestFunc: func(vars Variables) ocpp.Request {
+						return transactionEvent201(transactions.TransactionEventEnded, transactions.TriggerReasonStopAuthorized, 1, validIdToken)
+					},
+				},
+			),
+		},
+		{
+			Name:        "C01_AuthorizeInvalidIdToken",
+			Description: "An EV driver presents an unknown idToken, which is not accepted.",
+			Steps: append(bootSteps201(),
+				Send{
+					Request: authorization.NewAuthorizationRequest(invalidIdToken, types.IdTokenTypeISO14443),
+					Check: func(response ocpp.Response, vars Variables) error {
+						if status := response.(*authorization.AuthorizeResponse).IdTokenInfo.Status; status == types.AuthorizationStatusAccepted {
+							return fmt.Errorf("idToken %v was accepted", invalidIdToken)
+						}
+						return nil
+					},
+				},
+			),
+		},
+	}
+}
+
+// Accepts the status of a ChangeAvailability response, if the change was either applied or scheduled.
+func checkAvailabilityChanged201(response ocpp.Response, vars Variables) error {
+	switch status := response.(*availability.ChangeAvailabilityResponse).Status; status {
+	case availability.ChangeAvailabilityStatusAccepted, availability.ChangeAvailabilityStatusScheduled:
+		return nil
+	default:
+		return fmt.Errorf("availability change was %v", status)
+	}
+}
+
+// ChargingStationScenarios returns the starter set of scenarios for OCPP 2.0.1 charging stations.
+// Scenario names are prefixed with the ID of the use case they are modelled on.
+//
+// The charging station is expected to accept resets, availability changes and remote start requests for idToken (of type Central).
+// After a remote start, the charging station must start a transaction. Authorize and StatusNotification requests sent in the meantime are accepted.
+func ChargingStationScenarios(idToken string) []Scenario {
+	return []Scenario{
+		{
+			Name:        "B11_ResetWithoutOngoingTransaction",
+			Description: "The CSMS requests a reset, while no transaction is ongoing.",
+			Steps: []Step{
+				Send{
+					Request: provisioning.NewResetRequest(provisioning.ResetTypeOnIdle),
+					Fields:  Fields{"status": provisioning.ResetStatusAccepted},
+				},
+			},
+		},
+		{
+			Name:        "G04_ChangeAvailabilityChargingStation",
+			Description: "The CSMS sets the charging station to inoperative, and back to operative.",
+			Steps: []Step{
+				Send{Request: availability.NewChangeAvailabilityRequest(availability.OperationalStatusInoperative), Check: checkAvailabilityChanged201},
+				Send{Request: availability.NewChangeAvailabilityRequest(availability.OperationalStatusOperative), Check: checkAvailabilityChanged201},
+			},
+		},
+		{
+			Name:        "F01_RemoteStartTransaction",
+			Description: "The CSMS remotely starts a transaction on EVSE 1.",
+			Steps: []Step{
+				Send{
+					RequestFunc: func(vars Variables) ocpp.Request {
+						request := remotecontrol.NewRequestStartTransactionRequest(1, types.IdToken{IdToken: idToken, Type: types.IdTokenTypeCentral})
+						evseID := 1
+						request.EvseID = &evseID
+						return request
+					},
+					Fields: Fields{"status": remotecontrol.RequestStartStopStatusAccepted},
+				},
+				Expect{
+					Action:   authorization.AuthorizeFeatureName,
+					Optional: true,
+					Response: authorization.NewAuthorizationResponse(*types.NewIdTokenInfo(types.AuthorizationStatusAccepted)),
+				},
+				Expect{
+					Action:   availability.StatusNotificationFeatureName,
+					Optional: true,
+					Response: availability.NewStatusNotificationResponse(),
+				},
+				Expect{
+					Action: transactions.TransactionEventFeatureName,
+					Fields: Fields{"eventType": transactions.TransactionEventStarted},
+					ResponseFunc: func(request ocpp.Request, vars Variables) ocpp.Response {
+						response := transactions.NewTransactionEventResponse()
+						response.IDTokenInfo = types.NewIdTokenInfo(types.AuthorizationStatusAccepted)
+						return response
+					},
+				},
+			},
+		},
+	}
+}
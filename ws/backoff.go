@@ -0,0 +1,102 @@
+package ws
+
+import (
+	"math/rand"
+	"time"
+)
+
+// BackoffStrategy determines how long a client waits before each automatic reconnection attempt,
+// and when to give up reconnecting.
+//
+// The strategy is consulted before every attempt. Attempts are numbered starting from 1,
+// and are reset once the client reconnected successfully.
+// The passed error is the reason for the previous failure: either the error that caused the
+// disconnection (before the first attempt), or the error returned by the previous attempt.
+type BackoffStrategy interface {
+	// NextDelay returns the time to wait before the given reconnection attempt.
+	// If false is returned, the client gives up reconnecting.
+	NextDelay(attempt int, lastErr error) (time.Duration, bool)
+}
+
+// BackoffFunc is an adapter, allowing to use an ordinary function as BackoffStrategy.
+type BackoffFunc func(attempt int, lastErr error) (time.Duration, bool)
+
+func (f BackoffFunc) NextDelay(attempt int, lastErr error) (time.Duration, bool) {
+	return f(attempt, lastErr)
+}
+
+// NewDefaultBackoff returns the backoff strategy used by clients by default, based on the RetryBackOff
+// parameters of a ClientTimeoutConfig:
+//
+// The first delay is RetryBackOffWaitMinimum plus a random amount of up to RetryBackOffRandomRange seconds.
+// After every failed attempt, the delay is doubled and a new random amount is added,
+// until RetryBackOffRepeatTimes is reached. From then on, the delay remains the same.
+// The client never gives up reconnecting.
+func NewDefaultBackoff(config ClientTimeoutConfig) BackoffStrategy {
+	jitter := func() time.Duration {
+		return time.Duration(rand.Intn(config.RetryBackOffRandomRange+1)) * time.Second
+	}
+	return BackoffFunc(func(attempt int, lastErr error) (time.Duration, bool) {
+		delay := config.RetryBackOffWaitMinimum + jitter()
+		for i := 1; i < attempt && i < config.RetryBackOffRepeatTimes; i++ {
+			delay = 2*delay + jitter()
+		}
+		return delay, true
+	})
+}
+
+// NewFixedBackoff returns a backoff strategy, which always waits for the same delay.
+// The client never gives up reconnecting.
+func NewFixedBackoff(delay time.Duration) BackoffStrategy {
+	return BackoffFunc(func(attempt int, lastErr error) (time.Duration, bool) {
+		return delay, true
+	})
+}
+
+// NewExponentialBackoff returns an exponential backoff strategy with full jitter.
+//
+// The delay before each attempt is picked randomly between zero and base * 2^(attempt-1), capped at maxDelay.
+// Randomizing the entire delay spreads out reconnection attempts of many clients,
+// which lost their connection at the same time (e.g. after a server outage).
+// The client never gives up reconnecting.
+func NewExponentialBackoff(base time.Duration, maxDelay time.Duration) BackoffStrategy {
+	return BackoffFunc(func(attempt int, lastErr error) (time.Duration, bool) {
+		ceiling := base
+		for i := 1; i < attempt && ceiling < maxDelay; i++ {
+			ceiling *= 2
+		}
+		if ceiling > maxDelay {
+			ceiling = maxDelay
+		}
+		if ceiling <= 0 {
+			return 0, true
+		}
+		return time.Duration(rand.Int63n(int64(ceiling) + 1)), true
+	})
+}
+
+// WithMaxDelay caps the delays returned by a backoff strategy at maxDelay.
+func WithMaxDelay(strategy BackoffStrategy, maxDelay time.Duration) BackoffStrategy {
+	return BackoffFunc(func(attempt int, lastErr error) (time.Duration, bool) {
+		delay, ok := strategy.NextDelay(attempt, lastErr)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		return delay, ok
+	})
+}
+
+// WithMaxAttempts limits a backoff strategy to the given amount of reconnection attempts.
+// Once all attempts failed, the client gives up reconnecting and the onGiveUp callback is invoked
+// with the error returned by the last attempt. The callback may be nil.
+func WithMaxAttempts(strategy BackoffStrategy, maxAttempts int, onGiveUp func(lastErr error)) BackoffStrategy {
+	return BackoffFunc(func(attempt int, lastErr error) (time.Duration, bool) {
+		if attempt > maxAttempts {
+			if onGiveUp != nil {
+				onGiveUp(lastErr)
+			}
+			return 0, false
+		}
+		return strategy.NextDelay(attempt, lastErr)
+	})
+}
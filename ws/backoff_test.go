@@ -0,0 +1,118 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultBackoff(t *testing.T) {
+	config := NewClientTimeoutConfig()
+	config.RetryBackOffWaitMinimum = time.Second
+	config.RetryBackOffRandomRange = 0
+	config.RetryBackOffRepeatTimes = 3
+	backoff := NewDefaultBackoff(config)
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, e := range expected {
+		delay, ok := backoff.NextDelay(i+1, nil)
+		assert.True(t, ok)
+		assert.Equal(t, e, delay)
+	}
+	// Random range is added to every delay
+	config.RetryBackOffRandomRange = 2
+	backoff = NewDefaultBackoff(config)
+	delay, _ := backoff.NextDelay(1, nil)
+	assert.GreaterOrEqual(t, delay, time.Second)
+	assert.LessOrEqual(t, delay, 3*time.Second)
+}
+
+func TestFixedBackoff(t *testing.T) {
+	backoff := NewFixedBackoff(3 * time.Second)
+	for attempt := 1; attempt < 10; attempt++ {
+		delay, ok := backoff.NextDelay(attempt, nil)
+		assert.True(t, ok)
+		assert.Equal(t, 3*time.Second, delay)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := NewExponentialBackoff(time.Second, 30*time.Second)
+	ceilings := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, ceiling := range ceilings {
+		for j := 0; j < 20; j++ {
+			delay, ok := backoff.NextDelay(i+1, nil)
+			assert.True(t, ok)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, ceiling)
+		}
+	}
+	// Large attempt numbers don't overflow
+	delay, ok := backoff.NextDelay(1000, nil)
+	assert.True(t, ok)
+	assert.LessOrEqual(t, delay, 30*time.Second)
+}
+
+func TestBackoffWrappers(t *testing.T) {
+	capped := WithMaxDelay(NewFixedBackoff(time.Minute), 5*time.Second)
+	delay, ok := capped.NextDelay(1, nil)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+	var givenUp error
+	limited := WithMaxAttempts(NewFixedBackoff(time.Second), 2, func(lastErr error) {
+		givenUp = lastErr
+	})
+	for attempt := 1; attempt <= 2; attempt++ {
+		delay, ok = limited.NextDelay(attempt, nil)
+		assert.True(t, ok)
+		assert.Equal(t, time.Second, delay)
+	}
+	assert.Nil(t, givenUp)
+	lastErr := errors.New("connection refused")
+	_, ok = limited.NextDelay(3, lastErr)
+	assert.False(t, ok)
+	assert.Equal(t, lastErr, givenUp)
+}
+
+func TestClientReconnectBackoff(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	wsClient := newWebsocketClient(t, nil)
+	type reconnectAttempt struct {
+		attempt int
+		err     error
+	}
+	attemptC := make(chan reconnectAttempt, 5)
+	wsClient.SetReconnectAttemptHandler(func(attempt int, lastErr error) {
+		attemptC <- reconnectAttempt{attempt: attempt, err: lastErr}
+	})
+	giveUpC := make(chan error, 1)
+	wsClient.SetBackoffStrategy(WithMaxAttempts(NewFixedBackoff(50*time.Millisecond), 2, func(lastErr error) {
+		giveUpC <- lastErr
+	}))
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := wsClient.Start(u.String())
+	require.NoError(t, err)
+	// Server goes away, client attempts to reconnect twice and then gives up
+	wsServer.Stop()
+	first := <-attemptC
+	assert.Equal(t, 1, first.attempt)
+	assert.Error(t, first.err)
+	second := <-attemptC
+	assert.Equal(t, 2, second.attempt)
+	assert.Error(t, second.err)
+	lastErr := <-giveUpC
+	assert.Error(t, lastErr)
+	assert.NotEqual(t, first.err, second.err)
+	assert.False(t, wsClient.IsConnected())
+	select {
+	case a := <-attemptC:
+		t.Fatalf("unexpected reconnection attempt %v", a.attempt)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateStore holds the certificate currently served by a TLS server.
+// Access is thread-safe, so the certificate may be replaced while handshakes are in progress.
+type certificateStore struct {
+	certificate   *tls.Certificate
+	watchInterval time.Duration
+	watchStopC    chan struct{}
+	mutex         sync.RWMutex
+}
+
+func (s *certificateStore) set(certificate *tls.Certificate) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.certificate = certificate
+}
+
+func (s *certificateStore) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.certificate == nil {
+		return nil, fmt.Errorf("no server certificate loaded")
+	}
+	return s.certificate, nil
+}
+
+// Returns a copy of the passed TLS config, which retrieves the server certificate from the store on every handshake.
+func (s *certificateStore) tlsConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.Certificates = nil
+	config.GetCertificate = s.getCertificate
+	return config
+}
+
+// ReloadCertificates reads the TLS certificate and key from the paths passed to NewTLSServer,
+// and serves the new certificate on all following TLS handshakes.
+// Connections which are already established are not affected.
+//
+// If the certificate cannot be loaded, an error is returned and the previous certificate is kept.
+//
+// The certificates are loaded automatically when starting the server.
+// To reload them whenever the files change, see SetCertificateWatchInterval.
+func (server *Server) ReloadCertificates() error {
+	if server.tlsCertificatePath == "" || server.tlsCertificateKey == "" {
+		return fmt.Errorf("couldn't reload certificates: server was not created with a TLS certificate and key")
+	}
+	certificate, err := tls.LoadX509KeyPair(server.tlsCertificatePath, server.tlsCertificateKey)
+	if err != nil {
+		return fmt.Errorf("couldn't reload certificates: %w", err)
+	}
+	server.certificates.set(&certificate)
+	server.getLogger().Infof("loaded server certificate %v", server.tlsCertificatePath)
+	return nil
+}
+
+// SetCertificateWatchInterval enables watching the TLS certificate and key files of the server.
+// The files are checked for modifications at the given interval, and are reloaded whenever they changed.
+// Reload errors are reported on the Errors channel, while the previous certificate remains in use.
+//
+// By default, or if a non-positive interval is passed, files are not watched.
+// Certificates may still be reloaded explicitly via ReloadCertificates.
+//
+// This function must be called before starting the server.
+func (server *Server) SetCertificateWatchInterval(interval time.Duration) {
+	server.certificates.watchInterval = interval
+}
+
+func (server *Server) startCertificateWatcher() {
+	if server.certificates.watchInterval <= 0 {
+		return
+	}
+	stopC := make(chan struct{})
+	server.certificates.mutex.Lock()
+	server.certificates.watchStopC = stopC
+	server.certificates.mutex.Unlock()
+	go server.watchCertificates(server.certificates.watchInterval, stopC)
+}
+
+func (server *Server) stopCertificateWatcher() {
+	server.certificates.mutex.Lock()
+	defer server.certificates.mutex.Unlock()
+	if server.certificates.watchStopC != nil {
+		close(server.certificates.watchStopC)
+		server.certificates.watchStopC = nil
+	}
+}
+
+func (server *Server) watchCertificates(interval time.Duration, stopC chan struct{}) {
+	lastModified := certificateModTime(server.tlsCertificatePath, server.tlsCertificateKey)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+			modified := certificateModTime(server.tlsCertificatePath, server.tlsCertificateKey)
+			if modified.Equal(lastModified) {
+				continue
+			}
+			// Files are only marked as loaded after a successful reload,
+			// so a partially written certificate/key pair is retried on the next tick
+			if err := server.ReloadCertificates(); err != nil {
+				server.error(err)
+				continue
+			}
+			lastModified = modified
+		}
+	}
+}
+
+// Returns the most recent modification time among the passed files. Files which cannot be accessed are ignored.
+func certificateModTime(paths ...string) time.Time {
+	var latest time.Time
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,106 @@
+package ws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadCertPool(t *testing.T, certificateFilename string) *x509.CertPool {
+	certPool := x509.NewCertPool()
+	data, err := os.ReadFile(certificateFilename)
+	require.NoError(t, err)
+	require.True(t, certPool.AppendCertsFromPEM(data))
+	return certPool
+}
+
+// Returns the certificate currently served by the server, skipping verification.
+func servedCertificate(t *testing.T) *x509.Certificate {
+	conn, err := tls.Dial("tcp", fmt.Sprintf("localhost:%v", serverPort), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestReloadCertificates(t *testing.T) {
+	certFilename := "/tmp/cert.pem"
+	keyFilename := "/tmp/key.pem"
+	require.NoError(t, createTLSCertificate(certFilename, keyFilename, "localhost", nil, nil))
+	defer os.Remove(certFilename)
+	defer os.Remove(keyFilename)
+	oldCertPool := loadCertPool(t, certFilename)
+	wsServer := NewTLSServer(certFilename, keyFilename, nil)
+	wsServer.SetMessageHandler(func(ws Channel, data []byte) error {
+		return nil
+	})
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	u := url.URL{Scheme: "wss", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	// Connect with the original certificate
+	wsClient := NewTLSClient(&tls.Config{RootCAs: oldCertPool})
+	wsClient.SetRequestedSubProtocol(defaultSubProtocol)
+	require.NoError(t, wsClient.Start(u.String()))
+	oldSerial := servedCertificate(t).SerialNumber
+	// Rotate the certificate
+	require.NoError(t, createTLSCertificate(certFilename, keyFilename, "localhost", nil, nil))
+	newCertPool := loadCertPool(t, certFilename)
+	require.NoError(t, wsServer.ReloadCertificates())
+	// Existing connection isn't affected
+	assert.True(t, wsClient.IsConnected())
+	wsClient.Stop()
+	// Client still trusting the old certificate cannot connect anymore
+	err := wsClient.Start(u.String())
+	require.Error(t, err)
+	// Swap trust store and connect again
+	wsClient.SetTLSConfig(&tls.Config{RootCAs: newCertPool})
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	assert.NotEqual(t, 0, servedCertificate(t).SerialNumber.Cmp(oldSerial))
+}
+
+func TestReloadCertificatesInvalid(t *testing.T) {
+	certFilename := "/tmp/cert.pem"
+	keyFilename := "/tmp/key.pem"
+	require.NoError(t, createTLSCertificate(certFilename, keyFilename, "localhost", nil, nil))
+	defer os.Remove(certFilename)
+	defer os.Remove(keyFilename)
+	wsServer := NewTLSServer(certFilename, keyFilename, nil)
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	serial := servedCertificate(t).SerialNumber
+	// Corrupt key, the previous certificate is kept
+	require.NoError(t, os.WriteFile(keyFilename, []byte("invalid"), 0600))
+	err := wsServer.ReloadCertificates()
+	require.Error(t, err)
+	assert.Equal(t, serial, servedCertificate(t).SerialNumber)
+	// Plain server has no certificates to reload
+	assert.Error(t, NewServer().ReloadCertificates())
+}
+
+func TestCertificateWatcher(t *testing.T) {
+	certFilename := "/tmp/cert.pem"
+	keyFilename := "/tmp/key.pem"
+	require.NoError(t, createTLSCertificate(certFilename, keyFilename, "localhost", nil, nil))
+	defer os.Remove(certFilename)
+	defer os.Remove(keyFilename)
+	wsServer := NewTLSServer(certFilename, keyFilename, nil)
+	wsServer.SetCertificateWatchInterval(50 * time.Millisecond)
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	oldSerial := servedCertificate(t).SerialNumber
+	// Rotate the certificate on disk, the server picks it up automatically
+	require.NoError(t, createTLSCertificate(certFilename, keyFilename, "localhost", nil, nil))
+	assert.Eventually(t, func() bool {
+		return servedCertificate(t).SerialNumber.Cmp(oldSerial) != 0
+	}, 2*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,102 @@
+package ws
+
+import (
+	"compress/flate"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// CompressionConfig contains the parameters for per-message compression (RFC 7692, permessage-deflate).
+type CompressionConfig struct {
+	// Level is the flate compression level used for outgoing messages,
+	// between flate.HuffmanOnly (-2) and flate.BestCompression (9).
+	Level int
+	// Threshold is the minimum size in bytes of an outgoing message to be compressed.
+	// Smaller messages are sent uncompressed, as compressing them typically isn't worth the overhead.
+	Threshold int
+}
+
+// NewCompressionConfig creates a default configuration for per-message compression.
+//
+// Messages of at least 1KB are compressed, favoring speed over compression ratio.
+func NewCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Level:     flate.BestSpeed,
+		Threshold: 1024,
+	}
+}
+
+func (c CompressionConfig) validate() error {
+	if c.Level < flate.HuffmanOnly || c.Level > flate.BestCompression {
+		return fmt.Errorf("invalid compression level %d", c.Level)
+	}
+	return nil
+}
+
+// EnableCompression enables the negotiation of per-message compression (permessage-deflate) with clients.
+//
+// Compression is only used for connections to clients that offer it during the websocket handshake.
+// Whether it was negotiated can be checked via the CompressionNegotiated method of the respective Channel.
+//
+// This function must be called before starting the server.
+func (server *Server) EnableCompression(config CompressionConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	server.compression = &config
+	server.upgrader.EnableCompression = true
+	return nil
+}
+
+// EnableCompression enables per-message compression (permessage-deflate), which is offered to the server
+// during the websocket handshake. Compression is only used if the server supports it.
+// Whether it was negotiated can be checked via the CompressionNegotiated method of the respective Channel.
+//
+// This function must be called before starting the client.
+func (client *Client) EnableCompression(config CompressionConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	client.compression = &config
+	return nil
+}
+
+// Returns true if permessage-deflate is contained in the Sec-WebSocket-Extensions header.
+func offersCompression(header http.Header) bool {
+	for _, value := range header.Values("Sec-Websocket-Extensions") {
+		for _, extension := range strings.Split(value, ",") {
+			name := strings.Split(extension, ";")[0]
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Applies the compression parameters to a websocket, if compression was negotiated.
+func (ws *WebSocket) setCompression(config *CompressionConfig, negotiated bool) {
+	if config == nil || !negotiated {
+		return
+	}
+	ws.compressionNegotiated = true
+	ws.compressionThreshold = config.Threshold
+	// The level was validated beforehand
+	_ = ws.connection.SetCompressionLevel(config.Level)
+}
+
+// Writes a text message, compressing it if compression was negotiated and the message exceeds the threshold.
+// Must only be invoked by the write routine of the websocket.
+func (ws *WebSocket) writeText(data []byte) error {
+	if ws.compressionNegotiated {
+		ws.connection.EnableWriteCompression(len(data) >= ws.compressionThreshold)
+	}
+	if err := ws.connection.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	ws.stats.sent(len(data))
+	return nil
+}
@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingConn counts the bytes read from the underlying connection.
+type countingConn struct {
+	net.Conn
+	read *int64
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(c.read, int64(n))
+	return n, err
+}
+
+func startCompressionTest(t *testing.T, serverCompression bool, clientCompression bool) (*Server, *Client, Channel, chan []byte, *int64) {
+	wsServer := newWebsocketServer(t, nil)
+	if serverCompression {
+		require.NoError(t, wsServer.EnableCompression(NewCompressionConfig()))
+	}
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(200 * time.Millisecond)
+	receivedC := make(chan []byte, 1)
+	wsClient := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	if clientCompression {
+		require.NoError(t, wsClient.EnableCompression(NewCompressionConfig()))
+	}
+	var read int64
+	wsClient.AddOption(func(dialer *websocket.Dialer) {
+		dialer.NetDial = func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, read: &read}, nil
+		}
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	channel := <-connectedC
+	return wsServer, wsClient, channel, receivedC, &read
+}
+
+func TestCompressionNegotiated(t *testing.T) {
+	wsServer, wsClient, channel, receivedC, read := startCompressionTest(t, true, true)
+	defer wsServer.Stop()
+	defer wsClient.Stop()
+	assert.True(t, channel.(CompressionChannel).CompressionNegotiated())
+	assert.True(t, wsClient.webSocket.CompressionNegotiated())
+	before := atomic.LoadInt64(read)
+	message := bytes.Repeat([]byte("compressible "), 1000)
+	require.NoError(t, wsServer.Write(channel.ID(), message))
+	assert.Equal(t, message, <-receivedC)
+	// Message was compressed on the wire
+	assert.Less(t, atomic.LoadInt64(read)-before, int64(len(message)/2))
+}
+
+func TestCompressionBelowThreshold(t *testing.T) {
+	wsServer, wsClient, channel, receivedC, read := startCompressionTest(t, true, true)
+	defer wsServer.Stop()
+	defer wsClient.Stop()
+	before := atomic.LoadInt64(read)
+	message := bytes.Repeat([]byte("a"), 512)
+	require.NoError(t, wsServer.Write(channel.ID(), message))
+	assert.Equal(t, message, <-receivedC)
+	// Message was sent uncompressed
+	assert.GreaterOrEqual(t, atomic.LoadInt64(read)-before, int64(len(message)))
+}
+
+func TestCompressionNotOffered(t *testing.T) {
+	wsServer, wsClient, channel, receivedC, _ := startCompressionTest(t, true, false)
+	defer wsServer.Stop()
+	defer wsClient.Stop()
+	assert.False(t, channel.(CompressionChannel).CompressionNegotiated())
+	assert.False(t, wsClient.webSocket.CompressionNegotiated())
+	message := bytes.Repeat([]byte("compressible "), 1000)
+	require.NoError(t, wsServer.Write(channel.ID(), message))
+	assert.Equal(t, message, <-receivedC)
+}
+
+func TestCompressionNotSupportedByServer(t *testing.T) {
+	wsServer, wsClient, channel, _, _ := startCompressionTest(t, false, true)
+	defer wsServer.Stop()
+	defer wsClient.Stop()
+	assert.False(t, channel.(CompressionChannel).CompressionNegotiated())
+	assert.False(t, wsClient.webSocket.CompressionNegotiated())
+}
+
+func TestCompressionInvalidLevel(t *testing.T) {
+	config := NewCompressionConfig()
+	config.Level = 10
+	assert.EqualError(t, NewServer().EnableCompression(config), "invalid compression level 10")
+	assert.EqualError(t, NewClient().EnableCompression(config), "invalid compression level 10")
+}
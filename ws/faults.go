@@ -0,0 +1,654 @@
+package ws
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Fault is a network failure, which can be injected into a websocket connection by a FaultInjector.
+type Fault int
+
+const (
+	// The message is delivered normally.
+	FaultNone Fault = iota
+	// The message is silently discarded.
+	FaultDrop
+	// The message is delivered twice.
+	FaultDuplicate
+	// Only the first half of the message is delivered, which typically results in invalid JSON.
+	FaultTruncate
+	// The connection is closed abruptly, without a closing handshake. The message is lost.
+	FaultDisconnect
+)
+
+func (f Fault) String() string {
+	switch f {
+	case FaultNone:
+		return "none"
+	case FaultDrop:
+		return "drop"
+	case FaultDuplicate:
+		return "duplicate"
+	case FaultTruncate:
+		return "truncate"
+	case FaultDisconnect:
+		return "disconnect"
+	}
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+// FaultDirection is the direction of a message, as seen by the decorated client or server.
+type FaultDirection string
+
+const (
+	// Messages received from the remote endpoint.
+	FaultInbound FaultDirection = "inbound"
+	// Messages written to the remote endpoint.
+	FaultOutbound FaultDirection = "outbound"
+)
+
+// FaultProfile describes which faults are injected into a connection, and how often.
+//
+// Every message is delayed by Latency, plus a random value in the range [-Jitter, +Jitter].
+// Messages are never reordered: a message is delivered no earlier than the previous message
+// of the same connection and direction.
+//
+// The rates are probabilities between 0 and 1, and are evaluated independently for every message.
+// Their sum must not exceed 1.
+type FaultProfile struct {
+	// Seed of the random source. The same seed yields the same sequence of faults.
+	Seed           int64
+	Latency        time.Duration
+	Jitter         time.Duration
+	DropRate       float64
+	DuplicateRate  float64
+	TruncateRate   float64
+	DisconnectRate float64
+}
+
+// Validate checks whether the profile contains valid values.
+func (p FaultProfile) Validate() error {
+	if p.Latency < 0 || p.Jitter < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	sum := 0.0
+	for _, rate := range []float64{p.DropRate, p.DuplicateRate, p.TruncateRate, p.DisconnectRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid fault rate %v, must be between 0 and 1", rate)
+		}
+		sum += rate
+	}
+	if sum > 1 {
+		return fmt.Errorf("sum of all fault rates must not exceed 1, got %v", sum)
+	}
+	return nil
+}
+
+// ParseFaultProfile parses a fault profile from a comma-separated list of key=value pairs, e.g.:
+//
+//	seed=42,latency=200ms,jitter=50ms,drop=0.05,duplicate=0.01,truncate=0.01,disconnect=0.001
+//
+// Durations use the format accepted by time.ParseDuration. Omitted values default to zero.
+// This is useful for configuring fault injection via environment variables or command line flags.
+func ParseFaultProfile(s string) (FaultProfile, error) {
+	var profile FaultProfile
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return profile, fmt.Errorf("invalid fault profile entry %q, expected key=value", pair)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "seed":
+			profile.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "latency":
+			profile.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			profile.Jitter, err = time.ParseDuration(value)
+		case "drop":
+			profile.DropRate, err = strconv.ParseFloat(value, 64)
+		case "duplicate":
+			profile.DuplicateRate, err = strconv.ParseFloat(value, 64)
+		case "truncate":
+			profile.TruncateRate, err = strconv.ParseFloat(value, 64)
+		case "disconnect":
+			profile.DisconnectRate, err = strconv.ParseFloat(value, 64)
+		default:
+			return profile, fmt.Errorf("unknown fault profile key %q", key)
+		}
+		if err != nil {
+			return profile, fmt.Errorf("invalid value for %v: %w", key, err)
+		}
+	}
+	return profile, profile.Validate()
+}
+
+// FaultScript decides which fault to inject for a specific message.
+// If ok is false, the fault is picked randomly according to the rates of the FaultProfile instead.
+//
+// Scripts are invoked sequentially and may hence safely keep state, e.g. to fail only the n-th message.
+// A script must not invoke any methods of the FaultInjector it is set on.
+type FaultScript func(direction FaultDirection, clientID string, data []byte) (fault Fault, ok bool)
+
+// FaultInjector decides the faults and delays to apply to websocket messages,
+// based on a seeded FaultProfile and an optional FaultScript.
+//
+// An injector is attached to a websocket client or server via NewFaultyClient or NewFaultyServer.
+// It may be shared between multiple decorators. The produced sequence of faults is reproducible
+// for a given seed, as long as messages are processed in the same order.
+//
+// Profile and script may be changed at any time, also while connections are open.
+type FaultInjector struct {
+	profile FaultProfile
+	script  FaultScript
+	random  *rand.Rand
+	mutex   sync.Mutex
+}
+
+// NewFaultInjector creates a new fault injector using the given profile.
+func NewFaultInjector(profile FaultProfile) *FaultInjector {
+	return &FaultInjector{
+		profile: profile,
+		random:  rand.New(rand.NewSource(profile.Seed)),
+	}
+}
+
+// SetProfile replaces the profile of the injector.
+// The random source is reset using the seed of the new profile.
+func (f *FaultInjector) SetProfile(profile FaultProfile) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.profile = profile
+	f.random = rand.New(rand.NewSource(profile.Seed))
+}
+
+// Profile returns the current profile of the injector.
+func (f *FaultInjector) Profile() FaultProfile {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.profile
+}
+
+// SetScript sets a script, which decides the fault for each message before the random rates are applied.
+// Pass nil to remove the script.
+func (f *FaultInjector) SetScript(script FaultScript) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.script = script
+}
+
+// Next returns the fault and the delay for the next message.
+func (f *FaultInjector) Next(direction FaultDirection, clientID string, data []byte) (Fault, time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// Random values are always drawn, so that scripted faults don't alter the random sequence
+	fault := f.randomFault()
+	delay := f.randomDelay()
+	if f.script != nil {
+		if scripted, ok := f.script(direction, clientID, data); ok {
+			fault = scripted
+		}
+	}
+	return fault, delay
+}
+
+// Must be invoked while holding the lock.
+func (f *FaultInjector) randomFault() Fault {
+	r := f.random.Float64()
+	for _, candidate := range []struct {
+		fault Fault
+		rate  float64
+	}{
+		{FaultDrop, f.profile.DropRate},
+		{FaultDuplicate, f.profile.DuplicateRate},
+		{FaultTruncate, f.profile.TruncateRate},
+		{FaultDisconnect, f.profile.DisconnectRate},
+	} {
+		if r < candidate.rate {
+			return candidate.fault
+		}
+		r -= candidate.rate
+	}
+	return FaultNone
+}
+
+// Must be invoked while holding the lock.
+func (f *FaultInjector) randomDelay() time.Duration {
+	delay := f.profile.Latency
+	if f.profile.Jitter > 0 {
+		delay += time.Duration(f.random.Int63n(int64(2*f.profile.Jitter)+1)) - f.profile.Jitter
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// faultQueue executes delayed actions for one direction of a connection.
+//
+// Actions are executed in order by a dedicated goroutine. An action is never executed before the previous one,
+// even if its delay is shorter.
+type faultQueue struct {
+	queue  []faultAction
+	last   time.Time
+	closed bool
+	closeC chan struct{}
+	mutex  sync.Mutex
+	cond   *sync.Cond
+}
+
+type faultAction struct {
+	due time.Time
+	run func()
+}
+
+func newFaultQueue() *faultQueue {
+	q := &faultQueue{closeC: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mutex)
+	go q.run()
+	return q
+}
+
+// Schedules the actions for execution after the given delay.
+func (q *faultQueue) push(delay time.Duration, actions ...func()) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	due := time.Now().Add(delay)
+	if due.Before(q.last) {
+		due = q.last
+	}
+	q.last = due
+	for _, action := range actions {
+		q.queue = append(q.queue, faultAction{due: due, run: action})
+	}
+	q.cond.Signal()
+}
+
+// Closes the queue. Actions that weren't executed yet are discarded.
+func (q *faultQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.queue = nil
+	close(q.closeC)
+	q.cond.Signal()
+}
+
+func (q *faultQueue) run() {
+	for {
+		q.mutex.Lock()
+		for len(q.queue) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mutex.Unlock()
+			return
+		}
+		action := q.queue[0]
+		q.queue = q.queue[1:]
+		q.mutex.Unlock()
+		if wait := time.Until(action.due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-q.closeC:
+				timer.Stop()
+				return
+			}
+		}
+		action.run()
+	}
+}
+
+// faultQueues holds the queues of both directions of a connection.
+type faultQueues struct {
+	channel  Channel
+	inbound  *faultQueue
+	outbound *faultQueue
+}
+
+func newFaultQueues(channel Channel) *faultQueues {
+	return &faultQueues{channel: channel, inbound: newFaultQueue(), outbound: newFaultQueue()}
+}
+
+func (q *faultQueues) close() {
+	q.inbound.close()
+	q.outbound.close()
+}
+
+// Schedules the delivery of a message on the queue, applying the given fault.
+func injectFault(q *faultQueue, fault Fault, delay time.Duration, data []byte, deliver func(data []byte), disconnect func()) {
+	switch fault {
+	case FaultDrop:
+		// Message is lost
+	case FaultDuplicate:
+		q.push(delay, func() { deliver(data) }, func() { deliver(data) })
+	case FaultTruncate:
+		truncated := data[:len(data)/2]
+		q.push(delay, func() { deliver(truncated) })
+	case FaultDisconnect:
+		q.push(delay, disconnect)
+	default:
+		q.push(delay, func() { deliver(data) })
+	}
+}
+
+// DropConnection abruptly closes the network connection of a specific client, without a closing handshake.
+// This simulates a network failure: the disconnected client handler is invoked, and the client will typically reconnect.
+func (server *Server) DropConnection(id string) error {
+	server.connMutex.RLock()
+	ws, ok := server.connections[id]
+	server.connMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("couldn't drop websocket connection. No connection with id %s is open", id)
+	}
+	withClientID(server.getLogger(), id).Debugf("dropping connection to %s", id)
+	return ws.connection.Close()
+}
+
+// DropConnection abruptly closes the network connection to the server, without a closing handshake.
+// This simulates a network failure: the disconnected handler is invoked, and the client attempts to reconnect automatically.
+func (client *Client) DropConnection() error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if !client.connected {
+		return fmt.Errorf("client is currently not connected, cannot drop connection")
+	}
+	client.getLogger().Debugf("dropping connection to server")
+	return client.webSocket.connection.Close()
+}
+
+// serverConnectionDropper is implemented by servers, which can simulate network failures on their connections.
+type serverConnectionDropper interface {
+	DropConnection(id string) error
+}
+
+// clientConnectionDropper is implemented by clients, which can simulate network failures on their connection.
+type clientConnectionDropper interface {
+	DropConnection() error
+}
+
+// FaultyServer decorates a WsServer, injecting network faults into all its connections, both for
+// inbound and outbound messages. Faults are decided by a FaultInjector.
+//
+// It is meant for testing how an application copes with unreliable networks, without requiring external tools:
+//
+//	injector := ws.NewFaultInjector(ws.FaultProfile{Seed: 42, Latency: 200 * time.Millisecond, DropRate: 0.05})
+//	server := ws.NewFaultyServer(ws.NewServer(), injector)
+//	centralSystem := ocpp16.NewCentralSystem(nil, server)
+//
+// Handlers must be set on the decorator, not on the decorated server.
+//
+// Messages are delivered asynchronously, hence errors returned by the message handler and
+// errors occurring while writing a delayed message can't be reported.
+// Writing to a client, which isn't connected, returns an error immediately.
+type FaultyServer struct {
+	WsServer
+	injector            *FaultInjector
+	messageHandler      func(ws Channel, data []byte) error
+	newClientHandler    func(ws Channel)
+	disconnectedHandler func(ws Channel)
+	queues              map[string]*faultQueues
+	mutex               sync.Mutex
+}
+
+// NewFaultyServer creates a decorator for the given server, which injects faults using the given injector.
+func NewFaultyServer(server WsServer, injector *FaultInjector) *FaultyServer {
+	f := &FaultyServer{
+		WsServer: server,
+		injector: injector,
+		queues:   map[string]*faultQueues{},
+	}
+	server.SetMessageHandler(f.onMessage)
+	server.SetNewClientHandler(f.onNewClient)
+	server.SetDisconnectedClientHandler(f.onDisconnected)
+	return f
+}
+
+// Injector returns the fault injector used by the server.
+func (f *FaultyServer) Injector() *FaultInjector {
+	return f.injector
+}
+
+func (f *FaultyServer) SetMessageHandler(handler func(ws Channel, data []byte) error) {
+	f.messageHandler = handler
+}
+
+func (f *FaultyServer) SetNewClientHandler(handler func(ws Channel)) {
+	f.newClientHandler = handler
+}
+
+func (f *FaultyServer) SetDisconnectedClientHandler(handler func(ws Channel)) {
+	f.disconnectedHandler = handler
+}
+
+func (f *FaultyServer) Write(webSocketId string, data []byte) error {
+	q, ok := f.getQueues(webSocketId)
+	if !ok {
+		return f.WsServer.Write(webSocketId, data)
+	}
+	fault, delay := f.injector.Next(FaultOutbound, webSocketId, data)
+	injectFault(q.outbound, fault, delay, data, func(data []byte) {
+		_ = f.WsServer.Write(webSocketId, data)
+	}, func() {
+		_ = f.DropConnection(webSocketId)
+	})
+	return nil
+}
+
+// DropConnection abruptly closes the connection of a specific client.
+//
+// If the decorated server doesn't support dropping connections, the connection is closed with a CloseGoingAway code instead.
+func (f *FaultyServer) DropConnection(id string) error {
+	if dropper, ok := f.WsServer.(serverConnectionDropper); ok {
+		return dropper.DropConnection(id)
+	}
+	return f.WsServer.StopConnection(id, websocket.CloseError{Code: websocket.CloseGoingAway, Text: "connection dropped"})
+}
+
+func (f *FaultyServer) getQueues(id string) (*faultQueues, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	q, ok := f.queues[id]
+	return q, ok
+}
+
+func (f *FaultyServer) onNewClient(ws Channel) {
+	f.mutex.Lock()
+	if previous, ok := f.queues[ws.ID()]; ok {
+		previous.close()
+	}
+	f.queues[ws.ID()] = newFaultQueues(ws)
+	f.mutex.Unlock()
+	if f.newClientHandler != nil {
+		f.newClientHandler(ws)
+	}
+}
+
+func (f *FaultyServer) onDisconnected(ws Channel) {
+	f.mutex.Lock()
+	// A replaced connection must not remove the queues of the new connection with the same ID
+	if q, ok := f.queues[ws.ID()]; ok && q.channel == ws {
+		q.close()
+		delete(f.queues, ws.ID())
+	}
+	f.mutex.Unlock()
+	if f.disconnectedHandler != nil {
+		f.disconnectedHandler(ws)
+	}
+}
+
+func (f *FaultyServer) onMessage(ws Channel, data []byte) error {
+	q, ok := f.getQueues(ws.ID())
+	if !ok {
+		if f.messageHandler != nil {
+			return f.messageHandler(ws, data)
+		}
+		return nil
+	}
+	fault, delay := f.injector.Next(FaultInbound, ws.ID(), data)
+	injectFault(q.inbound, fault, delay, data, func(data []byte) {
+		if f.messageHandler != nil {
+			_ = f.messageHandler(ws, data)
+		}
+	}, func() {
+		_ = f.DropConnection(ws.ID())
+	})
+	return nil
+}
+
+// FaultyClient decorates a WsClient, injecting network faults into its connection, both for
+// inbound and outbound messages. Faults are decided by a FaultInjector.
+//
+// It is meant for simulating unreliable chargers, e.g. connected via cellular networks:
+//
+//	injector := ws.NewFaultInjector(ws.FaultProfile{Seed: 42, Latency: 500 * time.Millisecond, Jitter: 200 * time.Millisecond})
+//	client := ws.NewFaultyClient(ws.NewClient(), injector)
+//	chargePoint := ocpp16.NewChargePoint("CP-1", nil, client)
+//
+// Handlers must be set on the decorator, not on the decorated client.
+//
+// Messages are delivered asynchronously, hence errors returned by the message handler and
+// errors occurring while writing a delayed message can't be reported.
+// Writing while the client isn't connected returns an error immediately.
+type FaultyClient struct {
+	WsClient
+	injector            *FaultInjector
+	messageHandler      func(data []byte) error
+	disconnectedHandler func(err error)
+	id                  string
+	queues              *faultQueues
+	mutex               sync.Mutex
+}
+
+// NewFaultyClient creates a decorator for the given client, which injects faults using the given injector.
+func NewFaultyClient(client WsClient, injector *FaultInjector) *FaultyClient {
+	f := &FaultyClient{
+		WsClient: client,
+		injector: injector,
+	}
+	client.SetMessageHandler(f.onMessage)
+	client.SetDisconnectedHandler(f.onDisconnected)
+	return f
+}
+
+// Injector returns the fault injector used by the client.
+func (f *FaultyClient) Injector() *FaultInjector {
+	return f.injector
+}
+
+func (f *FaultyClient) Start(urlStr string) error {
+	f.setID(urlStr)
+	return f.WsClient.Start(urlStr)
+}
+
+func (f *FaultyClient) StartWithRetries(urlStr string) {
+	f.setID(urlStr)
+	f.WsClient.StartWithRetries(urlStr)
+}
+
+func (f *FaultyClient) Stop() {
+	f.WsClient.Stop()
+	f.closeQueues()
+}
+
+func (f *FaultyClient) SetMessageHandler(handler func(data []byte) error) {
+	f.messageHandler = handler
+}
+
+func (f *FaultyClient) SetDisconnectedHandler(handler func(err error)) {
+	f.disconnectedHandler = handler
+}
+
+func (f *FaultyClient) Write(data []byte) error {
+	if !f.IsConnected() {
+		return f.WsClient.Write(data)
+	}
+	fault, delay := f.injector.Next(FaultOutbound, f.getID(), data)
+	injectFault(f.getQueues().outbound, fault, delay, data, func(data []byte) {
+		_ = f.WsClient.Write(data)
+	}, func() {
+		_ = f.DropConnection()
+	})
+	return nil
+}
+
+// DropConnection abruptly closes the connection to the server.
+// The decorated client must support dropping connections, otherwise an error is returned.
+func (f *FaultyClient) DropConnection() error {
+	if dropper, ok := f.WsClient.(clientConnectionDropper); ok {
+		return dropper.DropConnection()
+	}
+	return fmt.Errorf("client doesn't support dropping connections")
+}
+
+func (f *FaultyClient) setID(urlStr string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if u, err := url.Parse(urlStr); err == nil {
+		f.id = path.Base(u.Path)
+	}
+}
+
+func (f *FaultyClient) getID() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.id
+}
+
+// Returns the queues of the current connection, creating them if necessary.
+func (f *FaultyClient) getQueues() *faultQueues {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.queues == nil {
+		f.queues = newFaultQueues(nil)
+	}
+	return f.queues
+}
+
+func (f *FaultyClient) closeQueues() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.queues != nil {
+		f.queues.close()
+		f.queues = nil
+	}
+}
+
+func (f *FaultyClient) onDisconnected(err error) {
+	f.closeQueues()
+	if f.disconnectedHandler != nil {
+		f.disconnectedHandler(err)
+	}
+}
+
+func (f *FaultyClient) onMessage(data []byte) error {
+	fault, delay := f.injector.Next(FaultInbound, f.getID(), data)
+	injectFault(f.getQueues().inbound, fault, delay, data, func(data []byte) {
+		if f.messageHandler != nil {
+			_ = f.messageHandler(data)
+		}
+	}, func() {
+		_ = f.DropConnection()
+	})
+	return nil
+}
@@ -0,0 +1,259 @@
+package ws
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFaultProfile(t *testing.T) {
+	profile, err := ParseFaultProfile("seed=42, latency=200ms,jitter=50ms,drop=0.05,duplicate=0.01,truncate=0.02,disconnect=0.001")
+	require.NoError(t, err)
+	assert.Equal(t, FaultProfile{
+		Seed:           42,
+		Latency:        200 * time.Millisecond,
+		Jitter:         50 * time.Millisecond,
+		DropRate:       0.05,
+		DuplicateRate:  0.01,
+		TruncateRate:   0.02,
+		DisconnectRate: 0.001,
+	}, profile)
+	profile, err = ParseFaultProfile("")
+	require.NoError(t, err)
+	assert.Equal(t, FaultProfile{}, profile)
+	_, err = ParseFaultProfile("latency")
+	assert.EqualError(t, err, "invalid fault profile entry \"latency\", expected key=value")
+	_, err = ParseFaultProfile("loss=0.1")
+	assert.EqualError(t, err, "unknown fault profile key \"loss\"")
+	_, err = ParseFaultProfile("latency=fast")
+	assert.Error(t, err)
+	_, err = ParseFaultProfile("drop=1.5")
+	assert.EqualError(t, err, "invalid fault rate 1.5, must be between 0 and 1")
+	_, err = ParseFaultProfile("drop=0.6,truncate=0.6")
+	assert.EqualError(t, err, "sum of all fault rates must not exceed 1, got 1.2")
+}
+
+func TestFaultInjectorDeterministic(t *testing.T) {
+	profile := FaultProfile{
+		Seed:           7,
+		Latency:        100 * time.Millisecond,
+		Jitter:         50 * time.Millisecond,
+		DropRate:       0.2,
+		DuplicateRate:  0.2,
+		TruncateRate:   0.2,
+		DisconnectRate: 0.2,
+	}
+	first := NewFaultInjector(profile)
+	second := NewFaultInjector(profile)
+	counts := map[Fault]int{}
+	for i := 0; i < 500; i++ {
+		fault1, delay1 := first.Next(FaultOutbound, "id", nil)
+		fault2, delay2 := second.Next(FaultOutbound, "id", nil)
+		require.Equal(t, fault1, fault2)
+		require.Equal(t, delay1, delay2)
+		assert.GreaterOrEqual(t, delay1, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay1, 150*time.Millisecond)
+		counts[fault1]++
+	}
+	// All faults occur with the configured rates
+	for _, fault := range []Fault{FaultNone, FaultDrop, FaultDuplicate, FaultTruncate, FaultDisconnect} {
+		assert.InDelta(t, 100, counts[fault], 40, fault.String())
+	}
+	// Resetting the profile restarts the sequence
+	first.SetProfile(profile)
+	third := NewFaultInjector(profile)
+	for i := 0; i < 10; i++ {
+		fault1, delay1 := first.Next(FaultInbound, "id", nil)
+		fault2, delay2 := third.Next(FaultInbound, "id", nil)
+		assert.Equal(t, fault1, fault2)
+		assert.Equal(t, delay1, delay2)
+	}
+}
+
+func TestFaultInjectorScript(t *testing.T) {
+	injector := NewFaultInjector(FaultProfile{DropRate: 1})
+	injector.SetScript(func(direction FaultDirection, clientID string, data []byte) (Fault, bool) {
+		if direction == FaultInbound {
+			return FaultTruncate, true
+		}
+		return FaultNone, false
+	})
+	fault, _ := injector.Next(FaultInbound, "id", nil)
+	assert.Equal(t, FaultTruncate, fault)
+	// Falls back to profile
+	fault, _ = injector.Next(FaultOutbound, "id", nil)
+	assert.Equal(t, FaultDrop, fault)
+	injector.SetScript(nil)
+	fault, _ = injector.Next(FaultInbound, "id", nil)
+	assert.Equal(t, FaultDrop, fault)
+}
+
+func TestFaultyClient(t *testing.T) {
+	receivedC := make(chan string, 10)
+	server, client := newMemoryPair(func(ws Channel, data []byte) {
+		receivedC <- string(data)
+	}, nil)
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	injector := NewFaultInjector(FaultProfile{})
+	faults := map[string]Fault{
+		"message 1": FaultDrop,
+		"message 2": FaultDuplicate,
+		"message 3": FaultTruncate,
+	}
+	injector.SetScript(func(direction FaultDirection, clientID string, data []byte) (Fault, bool) {
+		assert.Equal(t, FaultOutbound, direction)
+		assert.Equal(t, "testws", clientID)
+		fault, ok := faults[string(data)]
+		return fault, ok
+	})
+	faultyClient := NewFaultyClient(client, injector)
+	require.NoError(t, faultyClient.Start(memoryURL))
+	defer faultyClient.Stop()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, faultyClient.Write([]byte(fmt.Sprintf("message %d", i))))
+	}
+	for _, expected := range []string{"message 0", "message 2", "message 2", "mess", "message 4"} {
+		select {
+		case received := <-receivedC:
+			assert.Equal(t, expected, received)
+		case <-time.After(time.Second):
+			t.Fatalf("didn't receive %v", expected)
+		}
+	}
+	assert.Len(t, receivedC, 0)
+}
+
+func TestFaultyServerLatency(t *testing.T) {
+	receivedC := make(chan string, 50)
+	server, client := newMemoryPair(nil, func(data []byte) {
+		receivedC <- string(data)
+	})
+	latency := 50 * time.Millisecond
+	faultyServer := NewFaultyServer(server, NewFaultInjector(FaultProfile{Seed: 1, Latency: latency, Jitter: 40 * time.Millisecond}))
+	connectedC := make(chan Channel, 1)
+	faultyServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go faultyServer.Start(8887, "/ws/{id}")
+	defer faultyServer.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	<-connectedC
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, faultyServer.Write("testws", []byte(fmt.Sprintf("message %d", i))))
+	}
+	// Messages are delayed, but never reordered
+	for i := 0; i < 20; i++ {
+		select {
+		case received := <-receivedC:
+			assert.Equal(t, fmt.Sprintf("message %d", i), received)
+		case <-time.After(time.Second):
+			t.Fatalf("didn't receive message %d", i)
+		}
+	}
+	assert.GreaterOrEqual(t, time.Since(start), latency)
+	// Writing to unknown clients fails immediately
+	assert.Error(t, faultyServer.Write("unknown", []byte("data")))
+}
+
+func TestFaultyServerDisconnect(t *testing.T) {
+	receivedC := make(chan string, 10)
+	server, client := newMemoryPair(nil, nil)
+	injector := NewFaultInjector(FaultProfile{})
+	injector.SetScript(func(direction FaultDirection, clientID string, data []byte) (Fault, bool) {
+		if direction == FaultInbound && string(data) == "disconnect" {
+			return FaultDisconnect, true
+		}
+		return FaultNone, false
+	})
+	faultyServer := NewFaultyServer(server, injector)
+	faultyServer.SetMessageHandler(func(ws Channel, data []byte) error {
+		receivedC <- string(data)
+		return nil
+	})
+	connectedC := make(chan Channel, 2)
+	faultyServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	disconnectedC := make(chan Channel, 1)
+	faultyServer.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	clientDisconnectedC := make(chan error, 1)
+	client.SetDisconnectedHandler(func(err error) {
+		clientDisconnectedC <- err
+	})
+	go faultyServer.Start(8887, "/ws/{id}")
+	defer faultyServer.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	<-connectedC
+	require.NoError(t, client.Write([]byte("disconnect")))
+	err := <-clientDisconnectedC
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok)
+	assert.Equal(t, websocket.CloseAbnormalClosure, closeErr.Code)
+	assert.Equal(t, "testws", (<-disconnectedC).ID())
+	// Client reconnects automatically, and messages are delivered once again
+	select {
+	case <-connectedC:
+	case <-time.After(time.Second):
+		t.Fatal("client didn't reconnect")
+	}
+	require.NoError(t, client.Write([]byte("hello")))
+	assert.Equal(t, "hello", <-receivedC)
+	assert.Len(t, receivedC, 0)
+}
+
+func TestDropConnection(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	connectedC := make(chan Channel, 2)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	disconnectedC := make(chan Channel, 2)
+	wsServer.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	wsClient := newWebsocketClient(t, nil)
+	wsClient.SetBackoffStrategy(NewFixedBackoff(10 * time.Millisecond))
+	clientDisconnectedC := make(chan error, 2)
+	wsClient.SetDisconnectedHandler(func(err error) {
+		clientDisconnectedC <- err
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	<-connectedC
+	// Drop from the server side
+	require.NoError(t, wsServer.DropConnection("testws"))
+	assert.Equal(t, "testws", (<-disconnectedC).ID())
+	assert.Error(t, <-clientDisconnectedC)
+	select {
+	case <-connectedC:
+	case <-time.After(time.Second):
+		t.Fatal("client didn't reconnect")
+	}
+	// Drop from the client side
+	assert.Eventually(t, wsClient.IsConnected, time.Second, 10*time.Millisecond)
+	require.NoError(t, wsClient.DropConnection())
+	assert.Error(t, <-clientDisconnectedC)
+	assert.Equal(t, "testws", (<-disconnectedC).ID())
+	select {
+	case <-connectedC:
+	case <-time.After(time.Second):
+		t.Fatal("client didn't reconnect")
+	}
+	assert.Eventually(t, wsClient.IsConnected, time.Second, 10*time.Millisecond)
+	assert.Error(t, wsServer.DropConnection("unknown"))
+}
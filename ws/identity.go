@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// IdentityField identifies a field of a TLS client certificate, which may be matched against the client ID.
+type IdentityField string
+
+const (
+	// The common name of the certificate subject.
+	IdentityCommonName IdentityField = "CN"
+	// Any DNS name, email address or URI contained in the subject alternative names of the certificate.
+	// DNS names are matched case-insensitively.
+	IdentitySubjectAltName IdentityField = "SAN"
+	// The serial number of the certificate, in decimal notation.
+	IdentitySerialNumber IdentityField = "serialNumber"
+	// The serial number of the certificate, in hexadecimal notation (case-insensitive, colons and leading zeros are ignored).
+	IdentitySerialNumberHex IdentityField = "serialNumberHex"
+)
+
+// ClientIdentity is the identity of a client, which was verified by matching
+// its TLS client certificate against the client ID taken from the URL path.
+type ClientIdentity struct {
+	// The client ID, which was verified.
+	ID string
+	// The certificate field, which matched the client ID.
+	Field IdentityField
+	// The verified client certificate.
+	Certificate *x509.Certificate
+}
+
+// ClientIdentityError is reported on the server Errors channel,
+// whenever a client is rejected because its TLS client certificate doesn't match the client ID.
+type ClientIdentityError struct {
+	ClientID string
+	Reason   string
+}
+
+func (e ClientIdentityError) Error() string {
+	return fmt.Sprintf("client identity verification failed for %v: %v", e.ClientID, e.Reason)
+}
+
+// Verifies, that the leaf client certificate of a connection matches the client ID on at least one of the given fields.
+// Fields are checked in order, the first match is returned.
+func verifyClientIdentity(clientID string, state *tls.ConnectionState, fields []IdentityField) (*ClientIdentity, error) {
+	if state == nil {
+		return nil, ClientIdentityError{ClientID: clientID, Reason: "connection is not secured via TLS"}
+	}
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil, ClientIdentityError{ClientID: clientID, Reason: "no verified client certificate"}
+	}
+	certificate := state.PeerCertificates[0]
+	for _, field := range fields {
+		if matchIdentityField(clientID, certificate, field) {
+			return &ClientIdentity{ID: clientID, Field: field, Certificate: certificate}, nil
+		}
+	}
+	return nil, ClientIdentityError{
+		ClientID: clientID,
+		Reason:   fmt.Sprintf("certificate (CN=%v, serial=%v) doesn't match on any of %v", certificate.Subject.CommonName, certificate.SerialNumber, fields),
+	}
+}
+
+func matchIdentityField(clientID string, certificate *x509.Certificate, field IdentityField) bool {
+	switch field {
+	case IdentityCommonName:
+		return certificate.Subject.CommonName == clientID
+	case IdentitySubjectAltName:
+		for _, name := range certificate.DNSNames {
+			// DNS names are case-insensitive
+			if strings.EqualFold(name, clientID) {
+				return true
+			}
+		}
+		for _, address := range certificate.EmailAddresses {
+			if address == clientID {
+				return true
+			}
+		}
+		for _, uri := range certificate.URIs {
+			if uri.String() == clientID {
+				return true
+			}
+		}
+	case IdentitySerialNumber:
+		return certificate.SerialNumber != nil && certificate.SerialNumber.String() == clientID
+	case IdentitySerialNumberHex:
+		if certificate.SerialNumber == nil {
+			return false
+		}
+		serial := strings.ReplaceAll(clientID, ":", "")
+		if serial == "" {
+			return false
+		}
+		// Leading zeros are not part of the serial, but a serial of all zeros is 0
+		trimmed := strings.TrimLeft(serial, "0")
+		if trimmed == "" {
+			trimmed = "0"
+		}
+		return strings.EqualFold(certificate.SerialNumber.Text(16), trimmed)
+	}
+	return false
+}
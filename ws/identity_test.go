@@ -0,0 +1,160 @@
+package ws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newVerifiedConnectionState(certificate *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{certificate},
+		VerifiedChains:   [][]*x509.Certificate{{certificate}},
+	}
+}
+
+func TestVerifyClientIdentity(t *testing.T) {
+	uri, _ := url.Parse("urn:cp:CP-URI")
+	certificate := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "CP-1"},
+		SerialNumber:   big.NewInt(0xABCDEF),
+		DNSNames:       []string{"cp-2.example.com"},
+		EmailAddresses: []string{"cp-3@example.com"},
+		URIs:           []*url.URL{uri},
+	}
+	state := newVerifiedConnectionState(certificate)
+	allFields := []IdentityField{IdentityCommonName, IdentitySubjectAltName, IdentitySerialNumber, IdentitySerialNumberHex}
+	testTable := []struct {
+		clientID      string
+		fields        []IdentityField
+		expectedField IdentityField
+		expectedValid bool
+	}{
+		{"CP-1", allFields, IdentityCommonName, true},
+		{"cp-2.example.com", allFields, IdentitySubjectAltName, true},
+		{"CP-2.Example.com", allFields, IdentitySubjectAltName, true},
+		{"cp-3@example.com", allFields, IdentitySubjectAltName, true},
+		{"urn:cp:CP-URI", allFields, IdentitySubjectAltName, true},
+		{"11259375", allFields, IdentitySerialNumber, true},
+		{"abcdef", allFields, IdentitySerialNumberHex, true},
+		{"00:AB:CD:EF", allFields, IdentitySerialNumberHex, true},
+		{"CP-1", []IdentityField{IdentitySerialNumber, IdentitySerialNumberHex}, "", false},
+		{"abcdef", []IdentityField{IdentitySerialNumber}, "", false},
+		{"11259375", []IdentityField{IdentitySerialNumberHex}, "", false},
+		{"cp-1", allFields, "", false},
+		{"CP-3@example.com", allFields, "", false},
+		{"CP-4", allFields, "", false},
+	}
+	for _, tc := range testTable {
+		identity, err := verifyClientIdentity(tc.clientID, state, tc.fields)
+		if tc.expectedValid {
+			require.NoError(t, err, tc.clientID)
+			require.NotNil(t, identity)
+			assert.Equal(t, tc.clientID, identity.ID)
+			assert.Equal(t, tc.expectedField, identity.Field)
+			assert.Equal(t, certificate, identity.Certificate)
+		} else {
+			require.Error(t, err, tc.clientID)
+			assert.IsType(t, ClientIdentityError{}, err)
+			assert.Nil(t, identity)
+		}
+	}
+	// A serial of 0 matches any number of zeros, but not an empty ID
+	zeroCertificate := &x509.Certificate{SerialNumber: big.NewInt(0)}
+	zeroState := newVerifiedConnectionState(zeroCertificate)
+	for _, clientID := range []string{"0", "00", "00:00"} {
+		identity, err := verifyClientIdentity(clientID, zeroState, []IdentityField{IdentitySerialNumberHex})
+		require.NoError(t, err, clientID)
+		assert.Equal(t, IdentitySerialNumberHex, identity.Field)
+	}
+	_, err := verifyClientIdentity(":", zeroState, []IdentityField{IdentitySerialNumberHex})
+	assert.Error(t, err)
+	// No TLS connection
+	_, err = verifyClientIdentity("CP-1", nil, allFields)
+	assert.EqualError(t, err, "client identity verification failed for CP-1: connection is not secured via TLS")
+	// Unverified certificate
+	_, err = verifyClientIdentity("CP-1", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}, allFields)
+	assert.EqualError(t, err, "client identity verification failed for CP-1: no verified client certificate")
+}
+
+func TestClientIdentityTLS(t *testing.T) {
+	// Create CA and client certificates, the client ID is the final element of testPath
+	caCertFilename := "/tmp/ca.pem"
+	caKeyFilename := "/tmp/ca_key.pem"
+	ca, caKey, err := createCACertificate(caCertFilename, caKeyFilename)
+	require.NoError(t, err)
+	defer os.Remove(caCertFilename)
+	defer os.Remove(caKeyFilename)
+	validCertFilename := "/tmp/client_valid.pem"
+	validKeyFilename := "/tmp/client_valid_key.pem"
+	require.NoError(t, createTLSCertificate(validCertFilename, validKeyFilename, "testws", ca, caKey))
+	defer os.Remove(validCertFilename)
+	defer os.Remove(validKeyFilename)
+	invalidCertFilename := "/tmp/client_invalid.pem"
+	invalidKeyFilename := "/tmp/client_invalid_key.pem"
+	require.NoError(t, createTLSCertificate(invalidCertFilename, invalidKeyFilename, "otherws", ca, caKey))
+	defer os.Remove(invalidCertFilename)
+	defer os.Remove(invalidKeyFilename)
+	serverCertFilename := "/tmp/cert.pem"
+	serverKeyFilename := "/tmp/key.pem"
+	require.NoError(t, createTLSCertificate(serverCertFilename, serverKeyFilename, "localhost", ca, caKey))
+	defer os.Remove(serverCertFilename)
+	defer os.Remove(serverKeyFilename)
+	certPool := x509.NewCertPool()
+	data, err := os.ReadFile(caCertFilename)
+	require.NoError(t, err)
+	require.True(t, certPool.AppendCertsFromPEM(data))
+	// Create TLS server with identity verification
+	wsServer := NewTLSServer(serverCertFilename, serverKeyFilename, &tls.Config{
+		ClientCAs:  certPool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	})
+	wsServer.SetClientIdentityFields(IdentityCommonName)
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	errC := wsServer.Errors()
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	u := url.URL{Scheme: "wss", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	newClient := func(certFilename string, keyFilename string) *Client {
+		cert, err := tls.LoadX509KeyPair(certFilename, keyFilename)
+		require.NoError(t, err)
+		wsClient := NewTLSClient(&tls.Config{RootCAs: certPool, Certificates: []tls.Certificate{cert}})
+		wsClient.SetRequestedSubProtocol(defaultSubProtocol)
+		return wsClient
+	}
+	// Certificate doesn't match the client ID
+	wsClient := newClient(invalidCertFilename, invalidKeyFilename)
+	err = wsClient.Start(u.String())
+	require.Error(t, err)
+	httpErr, ok := err.(HttpConnectionError)
+	require.True(t, ok)
+	assert.Equal(t, 401, httpErr.HttpCode)
+	serverErr := <-errC
+	identityErr, ok := serverErr.(ClientIdentityError)
+	require.True(t, ok)
+	assert.Equal(t, "testws", identityErr.ClientID)
+	// Certificate matches the client ID
+	wsClient = newClient(validCertFilename, validKeyFilename)
+	err = wsClient.Start(u.String())
+	require.NoError(t, err)
+	defer wsClient.Stop()
+	channel := <-connectedC
+	identity := channel.(IdentityChannel).ClientIdentity()
+	require.NotNil(t, identity)
+	assert.Equal(t, "testws", identity.ID)
+	assert.Equal(t, IdentityCommonName, identity.Field)
+	assert.Equal(t, "testws", identity.Certificate.Subject.CommonName)
+}
@@ -0,0 +1,83 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MessageTooBigError is reported on the Errors channel of an endpoint,
+// whenever the remote peer sent a message exceeding the configured maximum message size.
+// The connection is closed with a CloseMessageTooBig code.
+type MessageTooBigError struct {
+	ID    string
+	Limit int64
+}
+
+func (e *MessageTooBigError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("message exceeds the maximum size of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("message from %s exceeds the maximum size of %d bytes", e.ID, e.Limit)
+}
+
+// SetReadLimitHandler sets a callback, which determines the maximum message size for an incoming connection,
+// overriding the MaxMessageSize of the ServerTimeoutConfig. A returned value of 0 disables the limit.
+//
+// The callback is invoked once for every connection, before upgrading it to a websocket connection.
+//
+// This function must be called before starting the server.
+func (server *Server) SetReadLimitHandler(handler func(id string, r *http.Request) int64) {
+	server.readLimitHandler = handler
+}
+
+func (server *Server) getReadLimit(id string, r *http.Request) int64 {
+	if server.readLimitHandler != nil {
+		return server.readLimitHandler(id, r)
+	}
+	return server.timeoutConfig.MaxMessageSize
+}
+
+// Applies the read limit to the underlying connection. A limit <= 0 disables the limit.
+func (ws *WebSocket) setReadLimit(limit int64) {
+	if limit <= 0 {
+		return
+	}
+	ws.readLimit = limit
+	ws.connection.SetReadLimit(limit)
+}
+
+// Reads the next data message from the connection, enforcing the read limit.
+//
+// The limit applies to the size of frames on the wire, as well as to the size of decompressed messages.
+// In both cases the connection is closed with a CloseMessageTooBig code and websocket.ErrReadLimit is returned.
+func (ws *WebSocket) readMessage(writeWait time.Duration) ([]byte, error) {
+	_, r, err := ws.connection.NextReader()
+	if err != nil {
+		return nil, err
+	}
+	if ws.readLimit > 0 {
+		r = io.LimitReader(r, ws.readLimit+1)
+	}
+	message, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if ws.readLimit > 0 && int64(len(message)) > ws.readLimit {
+		// Decompressed message is too big. Frames exceeding the limit are already handled by the connection itself.
+		_ = ws.connection.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""),
+			time.Now().Add(writeWait))
+		return nil, websocket.ErrReadLimit
+	}
+	ws.stats.received(len(message))
+	return message, nil
+}
+
+func isReadLimitError(err error) bool {
+	return errors.Is(err, websocket.ErrReadLimit)
+}
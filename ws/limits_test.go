@@ -0,0 +1,153 @@
+package ws
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/metrics"
+)
+
+func TestServerMaxMessageSize(t *testing.T) {
+	wsServer := newWebsocketServer(t, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+	config := NewServerTimeoutConfig()
+	config.MaxMessageSize = 1024
+	wsServer.SetTimeoutConfig(config)
+	registry := metrics.NewRegistry()
+	wsServer.SetMetrics(registry)
+	errC := wsServer.Errors()
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	receivedC := make(chan []byte, 1)
+	wsClient := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	disconnectedC := make(chan error, 1)
+	wsClient.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	// Message within the limit is accepted
+	message := bytes.Repeat([]byte("a"), 1024)
+	require.NoError(t, wsClient.Write(message))
+	assert.Equal(t, message, <-receivedC)
+	// Message exceeding the limit closes the connection
+	require.NoError(t, wsClient.Write(bytes.Repeat([]byte("a"), 1025)))
+	select {
+	case err := <-errC:
+		tooBigErr, ok := err.(*MessageTooBigError)
+		require.True(t, ok)
+		assert.Equal(t, "testws", tooBigErr.ID)
+		assert.Equal(t, int64(1024), tooBigErr.Limit)
+	case <-time.After(time.Second):
+		t.Fatal("expected message too big error")
+	}
+	select {
+	case err := <-disconnectedC:
+		closeErr, ok := err.(*websocket.CloseError)
+		require.True(t, ok)
+		assert.Equal(t, websocket.CloseMessageTooBig, closeErr.Code)
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed")
+	}
+	var b bytes.Buffer
+	require.NoError(t, registry.Write(&b))
+	assert.Contains(t, b.String(), `ocpp_ws_messages_too_big_total{role="server"} 1`)
+}
+
+func TestServerReadLimitHandler(t *testing.T) {
+	wsServer := newWebsocketServer(t, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+	config := NewServerTimeoutConfig()
+	config.MaxMessageSize = 16
+	wsServer.SetTimeoutConfig(config)
+	wsServer.SetReadLimitHandler(func(id string, r *http.Request) int64 {
+		if id == "testws" {
+			return 0
+		}
+		return config.MaxMessageSize
+	})
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	receivedC := make(chan []byte, 1)
+	wsClient := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	// Limit is disabled for this client
+	message := bytes.Repeat([]byte("a"), 1024)
+	require.NoError(t, wsClient.Write(message))
+	assert.Equal(t, message, <-receivedC)
+}
+
+func TestServerMaxMessageSizeCompressed(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	require.NoError(t, wsServer.EnableCompression(NewCompressionConfig()))
+	config := NewServerTimeoutConfig()
+	config.MaxMessageSize = 1024
+	wsServer.SetTimeoutConfig(config)
+	errC := wsServer.Errors()
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	wsClient := newWebsocketClient(t, nil)
+	require.NoError(t, wsClient.EnableCompression(NewCompressionConfig()))
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	// Compressed frame is within the limit, the decompressed message isn't
+	require.NoError(t, wsClient.Write(bytes.Repeat([]byte("a"), 10000)))
+	select {
+	case err := <-errC:
+		assert.IsType(t, &MessageTooBigError{}, err)
+	case <-time.After(time.Second):
+		t.Fatal("expected message too big error")
+	}
+}
+
+func TestClientMaxMessageSize(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	wsClient := newWebsocketClient(t, nil)
+	config := NewClientTimeoutConfig()
+	config.MaxMessageSize = 1024
+	wsClient.SetTimeoutConfig(config)
+	errC := wsClient.Errors()
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	channel := <-connectedC
+	require.NoError(t, wsServer.Write(channel.ID(), bytes.Repeat([]byte("a"), 1025)))
+	select {
+	case err := <-errC:
+		tooBigErr, ok := err.(*MessageTooBigError)
+		require.True(t, ok)
+		assert.Equal(t, "message exceeds the maximum size of 1024 bytes", tooBigErr.Error())
+	case <-time.After(time.Second):
+		t.Fatal("expected message too big error")
+	}
+}
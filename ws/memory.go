@@ -0,0 +1,753 @@
+package ws
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Delay between reconnection attempts of a MemoryClient, unless a different backoff strategy is set.
+const defaultMemoryReconnectDelay = 10 * time.Millisecond
+
+// memoryAddr is the address of an in-memory connection.
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
+
+// memoryPipe delivers messages in one direction of an in-memory connection.
+//
+// Writes never block. Messages are delivered in order by a dedicated goroutine,
+// just like a websocket connection is read by a single routine.
+type memoryPipe struct {
+	queue      [][]byte
+	closed     bool
+	delivering bool
+	deliver    func(data []byte)
+	mutex      sync.Mutex
+	cond       *sync.Cond
+}
+
+func newMemoryPipe(deliver func(data []byte)) *memoryPipe {
+	p := &memoryPipe{deliver: deliver}
+	p.cond = sync.NewCond(&p.mutex)
+	go p.run()
+	return p
+}
+
+func (p *memoryPipe) write(data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return fmt.Errorf("connection is closed")
+	}
+	p.queue = append(p.queue, data)
+	p.cond.Broadcast()
+	return nil
+}
+
+// Waits until all queued messages were delivered, the pipe is closed or the timeout expires.
+func (p *memoryPipe) flush(timeout time.Duration) {
+	flushedC := make(chan struct{})
+	go func() {
+		p.mutex.Lock()
+		for (len(p.queue) > 0 || p.delivering) && !p.closed {
+			p.cond.Wait()
+		}
+		p.mutex.Unlock()
+		close(flushedC)
+	}()
+	select {
+	case <-flushedC:
+	case <-time.After(timeout):
+	}
+}
+
+// Closes the pipe. Messages that weren't delivered yet are discarded.
+func (p *memoryPipe) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	p.queue = nil
+	p.cond.Broadcast()
+}
+
+func (p *memoryPipe) run() {
+	for {
+		p.mutex.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mutex.Unlock()
+			return
+		}
+		data := p.queue[0]
+		p.queue = p.queue[1:]
+		p.delivering = true
+		p.mutex.Unlock()
+		p.deliver(data)
+		p.mutex.Lock()
+		p.delivering = false
+		p.cond.Broadcast()
+		p.mutex.Unlock()
+	}
+}
+
+// memoryConnection is an in-memory connection between a MemoryClient and a MemoryServer.
+// It is the Channel passed to the handlers of the server.
+type memoryConnection struct {
+	id          string
+	subProtocol string
+	server      *MemoryServer
+	client      *MemoryClient
+	toServer    *memoryPipe
+	toClient    *memoryPipe
+	serverStats *connectionStats
+	clientStats *connectionStats
+	closeOnce   sync.Once
+}
+
+func (c *memoryConnection) ID() string {
+	return c.id
+}
+
+func (c *memoryConnection) RemoteAddr() net.Addr {
+	return memoryAddr(c.id)
+}
+
+func (c *memoryConnection) TLSConnectionState() *tls.ConnectionState {
+	return nil
+}
+
+func (c *memoryConnection) SubProtocol() string {
+	return c.subProtocol
+}
+
+func (c *memoryConnection) ClientIdentity() *ClientIdentity {
+	return nil
+}
+
+func (c *memoryConnection) Tenant() string {
+	return ""
+}
+
+func (c *memoryConnection) CompressionNegotiated() bool {
+	return false
+}
+
+func (c *memoryConnection) Stats() ConnectionStats {
+	return c.serverStats.snapshot()
+}
+
+// Closes both directions of the connection and notifies both endpoints.
+// If the connection was closed by the client itself, the client doesn't attempt to reconnect.
+func (c *memoryConnection) close(closeErr error, byClient bool) {
+	c.closeOnce.Do(func() {
+		c.toServer.close()
+		c.toClient.close()
+		c.server.connectionClosed(c)
+		c.client.connectionClosed(c, closeErr, byClient)
+	})
+}
+
+// MemoryServer is an in-process implementation of the WsServer interface, which doesn't use any sockets.
+//
+// Clients connect to the server via a MemoryClient. Messages are delivered asynchronously,
+// but strictly in the order they were written, separately for each connection and direction.
+// Network failures may be simulated via DropConnection.
+//
+// The in-memory transport is meant for tests, allowing to wire a charge point and a central system
+// together without binding any ports:
+//
+//	server := ws.NewMemoryServer()
+//	centralSystem := ocpp16.NewCentralSystem(nil, server)
+//	go centralSystem.Start(8887, "/{ws}")
+//	chargePoint := ocpp16.NewChargePoint("cp1", nil, ws.NewMemoryClient(server))
+//	err := chargePoint.Start("ws://localhost:8887")
+//
+// The port and path passed to Start are ignored.
+type MemoryServer struct {
+	connections         map[string]*memoryConnection
+	messageHandler      func(ws Channel, data []byte) error
+	newClientHandler    func(ws Channel)
+	disconnectedHandler func(ws Channel)
+	checkClientHandler  func(id string, r *http.Request) bool
+	checkOriginHandler  func(r *http.Request) bool
+	basicAuthHandler    func(username string, password string) bool
+	timeoutConfig       ServerTimeoutConfig
+	subProtocols        []string
+	running             bool
+	startedC            chan struct{}
+	stoppedC            chan struct{}
+	errC                chan error
+	mutex               sync.RWMutex
+}
+
+// NewMemoryServer creates a new in-memory websocket server.
+func NewMemoryServer() *MemoryServer {
+	return &MemoryServer{
+		connections:   map[string]*memoryConnection{},
+		timeoutConfig: NewServerTimeoutConfig(),
+		startedC:      make(chan struct{}),
+	}
+}
+
+// Start marks the server as running, allowing clients to connect. The port and path are ignored.
+//
+// Like for a regular server, the function blocks until the server is stopped.
+func (server *MemoryServer) Start(port int, listenPath string) {
+	server.mutex.Lock()
+	if server.running {
+		server.mutex.Unlock()
+		return
+	}
+	server.running = true
+	stoppedC := make(chan struct{})
+	server.stoppedC = stoppedC
+	close(server.startedC)
+	server.mutex.Unlock()
+	<-stoppedC
+}
+
+// Stop stops the server. All open connections are closed with a CloseNormalClosure code,
+// and the previously called Start function returns.
+func (server *MemoryServer) Stop() {
+	server.mutex.Lock()
+	if !server.running {
+		server.mutex.Unlock()
+		return
+	}
+	server.running = false
+	server.startedC = make(chan struct{})
+	close(server.stoppedC)
+	connections := server.connectionList()
+	server.mutex.Unlock()
+	for _, c := range connections {
+		c.close(&websocket.CloseError{Code: websocket.CloseNormalClosure}, false)
+	}
+	server.mutex.Lock()
+	if server.errC != nil {
+		close(server.errC)
+		server.errC = nil
+	}
+	server.mutex.Unlock()
+}
+
+// StopConnection closes a specific connection with the given close error.
+// The client receives the close error, just like with a regular websocket connection.
+func (server *MemoryServer) StopConnection(id string, closeError websocket.CloseError) error {
+	c, ok := server.getConnection(id)
+	if !ok {
+		return fmt.Errorf("couldn't stop websocket connection. No connection with id %s is open", id)
+	}
+	c.close(&closeError, false)
+	return nil
+}
+
+// DropConnection simulates a network failure on a specific connection.
+//
+// Messages that weren't delivered yet are lost. Both endpoints are notified of the abnormal closure,
+// and the client attempts to reconnect automatically.
+func (server *MemoryServer) DropConnection(id string) error {
+	c, ok := server.getConnection(id)
+	if !ok {
+		return fmt.Errorf("couldn't drop websocket connection. No connection with id %s is open", id)
+	}
+	c.close(&websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}, false)
+	return nil
+}
+
+func (server *MemoryServer) Errors() <-chan error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.errC == nil {
+		server.errC = make(chan error, 1)
+	}
+	return server.errC
+}
+
+func (server *MemoryServer) error(err error) {
+	log.Error(err)
+	server.mutex.RLock()
+	errC := server.errC
+	server.mutex.RUnlock()
+	if errC != nil {
+		errC <- err
+	}
+}
+
+func (server *MemoryServer) SetMessageHandler(handler func(ws Channel, data []byte) error) {
+	server.messageHandler = handler
+}
+
+func (server *MemoryServer) SetNewClientHandler(handler func(ws Channel)) {
+	server.newClientHandler = handler
+}
+
+func (server *MemoryServer) SetDisconnectedClientHandler(handler func(ws Channel)) {
+	server.disconnectedHandler = handler
+}
+
+func (server *MemoryServer) SetTimeoutConfig(config ServerTimeoutConfig) {
+	server.timeoutConfig = config
+}
+
+func (server *MemoryServer) Write(webSocketId string, data []byte) error {
+	c, ok := server.getConnection(webSocketId)
+	if !ok {
+		return fmt.Errorf("couldn't write to websocket. No socket with id %v is open", webSocketId)
+	}
+	if err := c.toClient.write(data); err != nil {
+		return fmt.Errorf("couldn't write to websocket %v: %w", webSocketId, err)
+	}
+	c.serverStats.sent(len(data))
+	return nil
+}
+
+func (server *MemoryServer) AddSupportedSubprotocol(subProto string) {
+	for _, sub := range server.subProtocols {
+		if sub == subProto {
+			// Don't add duplicates
+			return
+		}
+	}
+	server.subProtocols = append(server.subProtocols, subProto)
+}
+
+func (server *MemoryServer) SetBasicAuthHandler(handler func(username string, password string) bool) {
+	server.basicAuthHandler = handler
+}
+
+func (server *MemoryServer) SetCheckOriginHandler(handler func(r *http.Request) bool) {
+	server.checkOriginHandler = handler
+}
+
+func (server *MemoryServer) SetCheckClientHandler(handler func(id string, r *http.Request) bool) {
+	server.checkClientHandler = handler
+}
+
+// Addr always returns nil, as the server doesn't listen on any network address.
+func (server *MemoryServer) Addr() *net.TCPAddr {
+	return nil
+}
+
+func (server *MemoryServer) getConnection(id string) (*memoryConnection, bool) {
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	c, ok := server.connections[id]
+	return c, ok
+}
+
+// Must be invoked while holding the lock.
+func (server *MemoryServer) connectionList() []*memoryConnection {
+	connections := make([]*memoryConnection, 0, len(server.connections))
+	for _, c := range server.connections {
+		connections = append(connections, c)
+	}
+	return connections
+}
+
+// Waits until the server is running, or the timeout expires.
+func (server *MemoryServer) waitStarted(timeout time.Duration, cancelC <-chan struct{}) error {
+	server.mutex.RLock()
+	startedC := server.startedC
+	server.mutex.RUnlock()
+	select {
+	case <-startedC:
+		return nil
+	case <-cancelC:
+		return fmt.Errorf("connection attempt canceled")
+	case <-time.After(timeout):
+		return fmt.Errorf("server not running")
+	}
+}
+
+// Performs the equivalent of a websocket handshake for a connecting client.
+// The new client handler is invoked before returning, so the client is known to the server once connected.
+func (server *MemoryServer) accept(client *MemoryClient, r *http.Request, subProtocols []string) (*memoryConnection, error) {
+	id := path.Base(r.URL.Path)
+	if server.checkOriginHandler != nil && !server.checkOriginHandler(r) {
+		return nil, HttpConnectionError{Message: "websocket: bad handshake", HttpStatus: "403 Forbidden", HttpCode: http.StatusForbidden}
+	}
+	if server.basicAuthHandler != nil {
+		username, password, ok := r.BasicAuth()
+		if ok {
+			ok = server.basicAuthHandler(username, password)
+		}
+		if !ok {
+			return nil, HttpConnectionError{Message: "websocket: bad handshake", HttpStatus: "401 Unauthorized", HttpCode: http.StatusUnauthorized}
+		}
+	}
+	if server.checkClientHandler != nil && !server.checkClientHandler(id, r) {
+		return nil, HttpConnectionError{Message: "websocket: bad handshake", HttpStatus: "401 Unauthorized", HttpCode: http.StatusUnauthorized}
+	}
+	subProtocol := server.negotiateSubProtocol(subProtocols)
+	if subProtocol == "" {
+		return nil, fmt.Errorf("unsupported subprotocols %v for new client %v", subProtocols, id)
+	}
+	c := &memoryConnection{
+		id:          id,
+		subProtocol: subProtocol,
+		server:      server,
+		client:      client,
+		serverStats: newConnectionStats(),
+		clientStats: newConnectionStats(),
+	}
+	c.toServer = newMemoryPipe(func(data []byte) {
+		c.serverStats.received(len(data))
+		if server.messageHandler != nil {
+			if err := server.messageHandler(c, data); err != nil {
+				server.error(fmt.Errorf("handling failed for %s: %w", id, err))
+			}
+		}
+	})
+	c.toClient = newMemoryPipe(func(data []byte) {
+		c.clientStats.received(len(data))
+		client.handleMessage(data)
+	})
+	server.mutex.Lock()
+	if !server.running {
+		server.mutex.Unlock()
+		return nil, fmt.Errorf("server not running")
+	}
+	if _, exists := server.connections[id]; exists {
+		server.mutex.Unlock()
+		return nil, &websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: "a connection with this ID already exists"}
+	}
+	server.connections[id] = c
+	server.mutex.Unlock()
+	if server.newClientHandler != nil {
+		server.newClientHandler(c)
+	}
+	return c, nil
+}
+
+func (server *MemoryServer) negotiateSubProtocol(requested []string) string {
+	for _, requestedProto := range requested {
+		if len(server.subProtocols) == 0 {
+			// All subProtocols are accepted, pick first
+			return requestedProto
+		}
+		for _, supportedProto := range server.subProtocols {
+			if requestedProto == supportedProto {
+				return requestedProto
+			}
+		}
+	}
+	return ""
+}
+
+func (server *MemoryServer) connectionClosed(c *memoryConnection) {
+	server.mutex.Lock()
+	if server.connections[c.id] != c {
+		server.mutex.Unlock()
+		return
+	}
+	delete(server.connections, c.id)
+	server.mutex.Unlock()
+	if server.disconnectedHandler != nil {
+		server.disconnectedHandler(c)
+	}
+}
+
+// MemoryClient is an in-process implementation of the WsClient interface, connecting to a MemoryServer.
+//
+// The URL passed to Start is only used for determining the client ID, which is the final element of the path.
+// If the server isn't running yet, connecting waits up to the HandshakeTimeout of the ClientTimeoutConfig.
+//
+// After an unexpected disconnection, the client reconnects automatically.
+// By default, reconnection attempts are performed every 10ms; a different strategy may be set via SetBackoffStrategy.
+type MemoryClient struct {
+	server         *MemoryServer
+	connection     *memoryConnection
+	url            string
+	messageHandler func(data []byte) error
+	onDisconnected func(err error)
+	onReconnected  func()
+	timeoutConfig  ClientTimeoutConfig
+	backoff        BackoffStrategy
+	dialOptions    []func(*websocket.Dialer)
+	header         http.Header
+	reconnectC     chan struct{}
+	errC           chan error
+	mutex          sync.Mutex
+}
+
+// NewMemoryClient creates a new in-memory websocket client, which connects to the given server.
+func NewMemoryClient(server *MemoryServer) *MemoryClient {
+	return &MemoryClient{
+		server:        server,
+		timeoutConfig: NewClientTimeoutConfig(),
+		backoff:       NewFixedBackoff(defaultMemoryReconnectDelay),
+		header:        http.Header{},
+	}
+}
+
+func (client *MemoryClient) Start(url string) error {
+	client.mutex.Lock()
+	client.url = url
+	client.reconnectC = make(chan struct{})
+	client.mutex.Unlock()
+	return client.connect()
+}
+
+func (client *MemoryClient) StartWithRetries(url string) {
+	err := client.Start(url)
+	if err != nil {
+		client.reconnect(err)
+	}
+}
+
+// Stop closes the connection to the server.
+// Like for a regular client, the disconnected handler is invoked with a nil error.
+//
+// Messages written before stopping are delivered to the server first, unless this takes longer than the configured WriteWait.
+func (client *MemoryClient) Stop() {
+	client.mutex.Lock()
+	c := client.connection
+	if client.reconnectC != nil {
+		close(client.reconnectC)
+		client.reconnectC = nil
+	}
+	client.mutex.Unlock()
+	if c != nil {
+		// A regular client sends its close frame after all pending messages
+		c.toServer.flush(client.timeoutConfig.WriteWait)
+		c.close(&websocket.CloseError{Code: websocket.CloseNormalClosure}, true)
+	}
+	client.mutex.Lock()
+	if client.errC != nil {
+		close(client.errC)
+		client.errC = nil
+	}
+	client.mutex.Unlock()
+}
+
+func (client *MemoryClient) Errors() <-chan error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.errC == nil {
+		client.errC = make(chan error, 1)
+	}
+	return client.errC
+}
+
+func (client *MemoryClient) error(err error) {
+	log.Error(err)
+	client.mutex.Lock()
+	errC := client.errC
+	client.mutex.Unlock()
+	if errC != nil {
+		errC <- err
+	}
+}
+
+func (client *MemoryClient) SetMessageHandler(handler func(data []byte) error) {
+	client.messageHandler = handler
+}
+
+func (client *MemoryClient) SetTimeoutConfig(config ClientTimeoutConfig) {
+	client.timeoutConfig = config
+}
+
+func (client *MemoryClient) SetDisconnectedHandler(handler func(err error)) {
+	client.onDisconnected = handler
+}
+
+func (client *MemoryClient) SetReconnectedHandler(handler func()) {
+	client.onReconnected = handler
+}
+
+// SetBackoffStrategy sets the strategy for reconnecting after an unexpected disconnection.
+func (client *MemoryClient) SetBackoffStrategy(strategy BackoffStrategy) {
+	client.backoff = strategy
+}
+
+func (client *MemoryClient) IsConnected() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.connection != nil
+}
+
+func (client *MemoryClient) Write(data []byte) error {
+	client.mutex.Lock()
+	c := client.connection
+	client.mutex.Unlock()
+	if c == nil {
+		return fmt.Errorf("client is currently not connected, cannot send data")
+	}
+	if err := c.toServer.write(data); err != nil {
+		return fmt.Errorf("couldn't write to websocket: %w", err)
+	}
+	c.clientStats.sent(len(data))
+	return nil
+}
+
+// AddOption adds a dialer option to the client. Only the requested sub-protocols are taken into account.
+func (client *MemoryClient) AddOption(option interface{}) {
+	dialOption, ok := option.(func(*websocket.Dialer))
+	if ok {
+		client.dialOptions = append(client.dialOptions, dialOption)
+	}
+}
+
+func (client *MemoryClient) SetRequestedSubProtocol(subProto string) {
+	client.AddOption(func(dialer *websocket.Dialer) {
+		for _, proto := range dialer.Subprotocols {
+			if proto == subProto {
+				return
+			}
+		}
+		dialer.Subprotocols = append(dialer.Subprotocols, subProto)
+	})
+}
+
+func (client *MemoryClient) SetBasicAuth(username string, password string) {
+	client.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+func (client *MemoryClient) SetHeaderValue(key string, value string) {
+	client.header.Set(key, value)
+}
+
+// DropConnection simulates a network failure on the connection to the server.
+//
+// Messages that weren't delivered yet are lost. Both endpoints are notified of the abnormal closure,
+// and the client attempts to reconnect automatically.
+func (client *MemoryClient) DropConnection() error {
+	client.mutex.Lock()
+	c := client.connection
+	client.mutex.Unlock()
+	if c == nil {
+		return fmt.Errorf("client is currently not connected, cannot drop connection")
+	}
+	c.close(&websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}, false)
+	return nil
+}
+
+// Stats returns the statistics of the current connection. If the client isn't connected, empty statistics are returned.
+func (client *MemoryClient) Stats() ConnectionStats {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.connection == nil {
+		return ConnectionStats{}
+	}
+	return client.connection.clientStats.snapshot()
+}
+
+func (client *MemoryClient) connect() error {
+	client.mutex.Lock()
+	url := client.url
+	cancelC := client.reconnectC
+	client.mutex.Unlock()
+	if cancelC == nil {
+		return fmt.Errorf("client stopped")
+	}
+	r, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	r.Header = client.header.Clone()
+	r.RemoteAddr = memoryAddr(path.Base(r.URL.Path)).String()
+	dialer := websocket.Dialer{}
+	for _, option := range client.dialOptions {
+		option(&dialer)
+	}
+	if len(dialer.Subprotocols) > 0 {
+		r.Header.Set("Sec-Websocket-Protocol", strings.Join(dialer.Subprotocols, ", "))
+	}
+	if err = client.server.waitStarted(client.timeoutConfig.HandshakeTimeout, cancelC); err != nil {
+		return err
+	}
+	c, err := client.server.accept(client, r, dialer.Subprotocols)
+	if err != nil {
+		return err
+	}
+	client.mutex.Lock()
+	if client.reconnectC != cancelC {
+		// Client was stopped in the meantime
+		client.mutex.Unlock()
+		c.close(&websocket.CloseError{Code: websocket.CloseNormalClosure}, true)
+		return fmt.Errorf("client stopped")
+	}
+	client.connection = c
+	client.mutex.Unlock()
+	return nil
+}
+
+func (client *MemoryClient) handleMessage(data []byte) {
+	if client.messageHandler == nil {
+		return
+	}
+	if err := client.messageHandler(data); err != nil {
+		client.error(fmt.Errorf("handle failed: %w", err))
+	}
+}
+
+func (client *MemoryClient) connectionClosed(c *memoryConnection, closeErr error, byClient bool) {
+	client.mutex.Lock()
+	if client.connection == c {
+		client.connection = nil
+	}
+	client.mutex.Unlock()
+	if byClient {
+		// Like for a regular client, the handler is notified with a nil error after stopping
+		if client.onDisconnected != nil {
+			client.onDisconnected(nil)
+		}
+		return
+	}
+	if client.onDisconnected != nil {
+		client.onDisconnected(closeErr)
+	}
+	go client.reconnect(closeErr)
+}
+
+func (client *MemoryClient) reconnect(lastErr error) {
+	client.mutex.Lock()
+	cancelC := client.reconnectC
+	client.mutex.Unlock()
+	if cancelC == nil {
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		delay, ok := client.backoff.NextDelay(attempt, lastErr)
+		if !ok {
+			client.error(fmt.Errorf("giving up reconnection after %d attempts: %w", attempt-1, lastErr))
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-cancelC:
+			return
+		}
+		err := client.connect()
+		if err == nil {
+			if client.onReconnected != nil {
+				client.onReconnected()
+			}
+			return
+		}
+		select {
+		case <-cancelC:
+			return
+		default:
+		}
+		lastErr = err
+	}
+}
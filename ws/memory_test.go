@@ -0,0 +1,214 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const memoryURL = "ws://localhost:8887/ws/testws"
+
+func newMemoryPair(onServerMessage func(ws Channel, data []byte), onClientMessage func(data []byte)) (*MemoryServer, *MemoryClient) {
+	server := NewMemoryServer()
+	server.AddSupportedSubprotocol(defaultSubProtocol)
+	server.SetMessageHandler(func(ws Channel, data []byte) error {
+		if onServerMessage != nil {
+			onServerMessage(ws, data)
+		}
+		return nil
+	})
+	client := NewMemoryClient(server)
+	client.SetRequestedSubProtocol(defaultSubProtocol)
+	client.SetMessageHandler(func(data []byte) error {
+		if onClientMessage != nil {
+			onClientMessage(data)
+		}
+		return nil
+	})
+	return server, client
+}
+
+func TestMemoryTransport(t *testing.T) {
+	var server *MemoryServer
+	server, client := newMemoryPair(func(ws Channel, data []byte) {
+		// Echo
+		assert.NoError(t, server.Write(ws.ID(), data))
+	}, nil)
+	receivedC := make(chan []byte, 100)
+	client.SetMessageHandler(func(data []byte) error {
+		receivedC <- data
+		return nil
+	})
+	connectedC := make(chan Channel, 1)
+	server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	assert.True(t, client.IsConnected())
+	// New client handler was invoked before Start returned
+	var channel Channel
+	select {
+	case channel = <-connectedC:
+	default:
+		t.Fatal("new client handler wasn't invoked")
+	}
+	assert.Equal(t, "testws", channel.ID())
+	assert.Equal(t, defaultSubProtocol, channel.(SubProtocolChannel).SubProtocol())
+	// Messages are delivered in order
+	for i := 0; i < 100; i++ {
+		require.NoError(t, client.Write([]byte(fmt.Sprintf("message %d", i))))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, fmt.Sprintf("message %d", i), string(<-receivedC))
+	}
+	assert.Equal(t, channel.(StatsChannel).Stats().BytesReceived, client.Stats().BytesSent)
+}
+
+func TestMemoryTransportWaitsForServer(t *testing.T) {
+	server, client := newMemoryPair(nil, nil)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.Start(8887, "/ws/{id}")
+	}()
+	defer server.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	assert.True(t, client.IsConnected())
+}
+
+func TestMemoryTransportRejected(t *testing.T) {
+	server, client := newMemoryPair(nil, nil)
+	server.SetCheckClientHandler(func(id string, r *http.Request) bool {
+		return false
+	})
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	err := client.Start(memoryURL)
+	require.Error(t, err)
+	httpErr, ok := err.(HttpConnectionError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, httpErr.HttpCode)
+	assert.False(t, client.IsConnected())
+	// Unsupported sub-protocol
+	server.SetCheckClientHandler(nil)
+	client = NewMemoryClient(server)
+	client.SetRequestedSubProtocol("ocpp0.1")
+	err = client.Start(memoryURL)
+	assert.EqualError(t, err, "unsupported subprotocols [ocpp0.1] for new client testws")
+}
+
+func TestMemoryTransportStopConnection(t *testing.T) {
+	server, client := newMemoryPair(nil, nil)
+	disconnectedC := make(chan error, 1)
+	client.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	serverDisconnectedC := make(chan Channel, 1)
+	server.SetDisconnectedClientHandler(func(ws Channel) {
+		serverDisconnectedC <- ws
+	})
+	// Client shouldn't reconnect for this test
+	client.SetBackoffStrategy(WithMaxAttempts(NewFixedBackoff(0), 0, nil))
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	err := server.StopConnection("testws", websocket.CloseError{Code: websocket.CloseTryAgainLater, Text: "later"})
+	require.NoError(t, err)
+	err = <-disconnectedC
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok)
+	assert.Equal(t, websocket.CloseTryAgainLater, closeErr.Code)
+	assert.Equal(t, "testws", (<-serverDisconnectedC).ID())
+	assert.False(t, client.IsConnected())
+	assert.Error(t, client.Write([]byte("data")))
+	assert.Error(t, server.Write("testws", []byte("data")))
+}
+
+func TestMemoryTransportClientStopDeliversPending(t *testing.T) {
+	receivedC := make(chan string, 10)
+	server, client := newMemoryPair(func(ws Channel, data []byte) {
+		time.Sleep(10 * time.Millisecond)
+		receivedC <- string(data)
+	}, nil)
+	serverDisconnectedC := make(chan Channel, 1)
+	server.SetDisconnectedClientHandler(func(ws Channel) {
+		serverDisconnectedC <- ws
+	})
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, client.Write([]byte(fmt.Sprintf("message %d", i))))
+	}
+	client.Stop()
+	// All messages were delivered before the server was notified of the disconnection
+	assert.Len(t, receivedC, 5)
+	assert.Equal(t, "testws", (<-serverDisconnectedC).ID())
+}
+
+func TestMemoryTransportDropConnection(t *testing.T) {
+	server, client := newMemoryPair(nil, nil)
+	disconnectedC := make(chan error, 1)
+	client.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	reconnectedC := make(chan struct{}, 1)
+	client.SetReconnectedHandler(func() {
+		reconnectedC <- struct{}{}
+	})
+	connectedC := make(chan Channel, 2)
+	server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	first := <-connectedC
+	require.NoError(t, server.DropConnection("testws"))
+	err := <-disconnectedC
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok)
+	assert.Equal(t, websocket.CloseAbnormalClosure, closeErr.Code)
+	// Client reconnects automatically
+	select {
+	case <-reconnectedC:
+	case <-time.After(time.Second):
+		t.Fatal("client didn't reconnect")
+	}
+	second := <-connectedC
+	assert.NotSame(t, first, second)
+	assert.True(t, client.IsConnected())
+}
+
+func TestMemoryTransportServerStop(t *testing.T) {
+	server, client := newMemoryPair(nil, nil)
+	serverDisconnectedC := make(chan Channel, 1)
+	server.SetDisconnectedClientHandler(func(ws Channel) {
+		serverDisconnectedC <- ws
+	})
+	stoppedC := make(chan struct{})
+	go func() {
+		server.Start(8887, "/ws/{id}")
+		close(stoppedC)
+	}()
+	require.NoError(t, client.Start(memoryURL))
+	defer client.Stop()
+	server.Stop()
+	<-stoppedC
+	<-serverDisconnectedC
+	assert.False(t, client.IsConnected())
+	// Client reconnects once the server is started again
+	go server.Start(8887, "/ws/{id}")
+	defer server.Stop()
+	assert.Eventually(t, client.IsConnected, time.Second, 10*time.Millisecond)
+}
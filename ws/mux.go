@@ -0,0 +1,405 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ServerMux allows multiple independent endpoints to share a single websocket server.
+//
+// Every endpoint is bound to a specific sub-protocol and receives a dedicated WsServer view,
+// which only sees the channels that negotiated that sub-protocol.
+// This allows, for example, to serve OCPP 1.6 and OCPP 2.0.1 clients on the same listener:
+//
+//	mux := ws.NewServerMux(ws.NewServer())
+//	v16Server := mux.Route("ocpp1.6")
+//	v201Server := mux.Route("ocpp2.0.1")
+//	// Pass the routes to the respective ocppj servers...
+//	go mux.Start(8887, "/{ws}")
+//
+// Only the mux owns the listener: the underlying server is started, stopped and shut down via the mux directly.
+// Calling Start on a route has no effect, while Stop only closes the connections of that route.
+//
+// Every route only operates on its own channels. Settings affecting the whole server,
+// such as the timeout config or the origin check, must be set on the underlying server instead.
+type ServerMux struct {
+	server              WsServer
+	routes              map[string]*serverRoute
+	clients             map[string]muxClient
+	newClientHandler    func(ws Channel)
+	disconnectedHandler func(ws Channel)
+	mutex               sync.RWMutex
+}
+
+// NewServerMux creates a new multiplexer on top of the passed websocket server.
+//
+// The mux overwrites the message and connection handlers of the server, so they should not be set directly
+// after creating the mux. Use the handlers on the single routes, or the shared handlers on the mux instead.
+func NewServerMux(server WsServer) *ServerMux {
+	if server == nil {
+		server = NewServer()
+	}
+	mux := &ServerMux{server: server, routes: map[string]*serverRoute{}, clients: map[string]muxClient{}}
+	server.SetCheckClientHandler(mux.checkClient)
+	server.SetNewClientHandler(mux.onClientConnected)
+	server.SetDisconnectedClientHandler(mux.onClientDisconnected)
+	server.SetMessageHandler(mux.onMessage)
+	if graceful, ok := server.(gracefulServer); ok {
+		graceful.SetDrainHandler(mux.drain)
+	}
+	return mux
+}
+
+// muxClient is a channel connected on a route.
+type muxClient struct {
+	channel Channel
+	route   *serverRoute
+}
+
+// gracefulServer is implemented by websocket servers, which support a graceful shutdown (see Server.Shutdown).
+type gracefulServer interface {
+	SetDrainHandler(handler func(ctx context.Context) error)
+	Shutdown(ctx context.Context) error
+}
+
+// Route returns a WsServer view for the specified sub-protocol.
+// The sub-protocol is automatically added to the supported sub-protocols of the underlying server.
+//
+// Invoking Route multiple times with the same sub-protocol returns the same view.
+func (mux *ServerMux) Route(subProto string) WsServer {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	route, ok := mux.routes[subProto]
+	if !ok {
+		route = &serverRoute{mux: mux, subProtocol: subProto}
+		mux.routes[subProto] = route
+		mux.server.AddSupportedSubprotocol(subProto)
+	}
+	return route
+}
+
+// SetNewClientHandler sets a callback, invoked for every new client connection, regardless of the route.
+// The callback is invoked after the route-specific callback.
+//
+// The negotiated sub-protocol may be retrieved via the Channel's SubProtocol method.
+func (mux *ServerMux) SetNewClientHandler(handler func(ws Channel)) {
+	mux.newClientHandler = handler
+}
+
+// SetDisconnectedClientHandler sets a callback, invoked for every client disconnection, regardless of the route.
+// The callback is invoked after the route-specific callback.
+func (mux *ServerMux) SetDisconnectedClientHandler(handler func(ws Channel)) {
+	mux.disconnectedHandler = handler
+}
+
+// Server returns the underlying websocket server.
+func (mux *ServerMux) Server() WsServer {
+	return mux.server
+}
+
+// Start runs the underlying websocket server. The function blocks until the server is stopped.
+func (mux *ServerMux) Start(port int, listenPath string) {
+	mux.server.Start(port, listenPath)
+}
+
+// Stop shuts down the underlying websocket server, closing all channels on every route.
+func (mux *ServerMux) Stop() {
+	mux.server.Stop()
+}
+
+// Shutdown gracefully shuts down the underlying websocket server (see Server.Shutdown).
+// While draining, the drain handlers of all routes are invoked concurrently.
+//
+// If the underlying server doesn't support a graceful shutdown, the drain handlers are invoked
+// before stopping the server.
+func (mux *ServerMux) Shutdown(ctx context.Context) error {
+	if graceful, ok := mux.server.(gracefulServer); ok {
+		return graceful.Shutdown(ctx)
+	}
+	err := mux.drain(ctx)
+	mux.server.Stop()
+	return err
+}
+
+// Invokes the drain handlers of all routes concurrently, returning the first error.
+func (mux *ServerMux) drain(ctx context.Context) error {
+	mux.mutex.RLock()
+	var handlers []func(ctx context.Context) error
+	for _, route := range mux.routes {
+		if route.drainHandler != nil {
+			handlers = append(handlers, route.drainHandler)
+		}
+	}
+	mux.mutex.RUnlock()
+	errC := make(chan error, len(handlers))
+	for _, handler := range handlers {
+		go func(handler func(ctx context.Context) error) {
+			errC <- handler(ctx)
+		}(handler)
+	}
+	var err error
+	for range handlers {
+		if handlerErr := <-errC; handlerErr != nil && err == nil {
+			err = handlerErr
+		}
+	}
+	return err
+}
+
+// Returns the sub-protocol negotiated by a client, or an empty string if the channel doesn't expose it.
+func subProtocol(ws Channel) string {
+	if channel, ok := ws.(SubProtocolChannel); ok {
+		return channel.SubProtocol()
+	}
+	return ""
+}
+
+func (mux *ServerMux) getRoute(subProto string) (*serverRoute, bool) {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	route, ok := mux.routes[subProto]
+	return route, ok
+}
+
+// negotiate mimics the sub-protocol negotiation performed by the server,
+// so that the route can be determined before the connection is upgraded.
+func (mux *ServerMux) negotiate(r *http.Request) (*serverRoute, bool) {
+	for _, requestedProto := range websocket.Subprotocols(r) {
+		if route, ok := mux.getRoute(requestedProto); ok {
+			return route, true
+		}
+	}
+	return nil, false
+}
+
+// Returns whether the client with the given ID is connected on the route.
+func (mux *ServerMux) isConnected(id string, route *serverRoute) bool {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	return mux.clients[id].route == route
+}
+
+// Returns the IDs of all clients connected on the route.
+func (mux *ServerMux) connectedClients(route *serverRoute) []string {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	var ids []string
+	for id, client := range mux.clients {
+		if client.route == route {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (mux *ServerMux) checkClient(id string, r *http.Request) bool {
+	route, ok := mux.negotiate(r)
+	if !ok {
+		// Unsupported sub-protocols are rejected by the server after the upgrade
+		return true
+	}
+	mux.mutex.RLock()
+	basicAuthHandler := route.basicAuthHandler
+	checkClientHandler := route.checkClientHandler
+	mux.mutex.RUnlock()
+	if basicAuthHandler != nil {
+		username, password, ok := r.BasicAuth()
+		if !ok || !basicAuthHandler(username, password) {
+			route.error(fmt.Errorf("basic auth failed for %v: credentials invalid", id))
+			return false
+		}
+	}
+	if checkClientHandler != nil && !checkClientHandler(id, r) {
+		route.error(fmt.Errorf("client validation failed for %v: invalid client", id))
+		return false
+	}
+	return true
+}
+
+func (mux *ServerMux) onClientConnected(ws Channel) {
+	if route, ok := mux.getRoute(subProtocol(ws)); ok {
+		mux.mutex.Lock()
+		mux.clients[ws.ID()] = muxClient{channel: ws, route: route}
+		mux.mutex.Unlock()
+		if route.newClientHandler != nil {
+			route.newClientHandler(ws)
+		}
+	}
+	if mux.newClientHandler != nil {
+		mux.newClientHandler(ws)
+	}
+}
+
+func (mux *ServerMux) onClientDisconnected(ws Channel) {
+	if route, ok := mux.getRoute(subProtocol(ws)); ok {
+		mux.mutex.Lock()
+		// A replaced connection must not remove the client, which replaced it
+		if mux.clients[ws.ID()].channel == ws {
+			delete(mux.clients, ws.ID())
+		}
+		mux.mutex.Unlock()
+		if route.disconnectedHandler != nil {
+			route.disconnectedHandler(ws)
+		}
+	}
+	if mux.disconnectedHandler != nil {
+		mux.disconnectedHandler(ws)
+	}
+}
+
+func (mux *ServerMux) onMessage(ws Channel, data []byte) error {
+	route, ok := mux.getRoute(subProtocol(ws))
+	if !ok {
+		return fmt.Errorf("no route for sub-protocol %v of client %v", subProtocol(ws), ws.ID())
+	}
+	if route.messageHandler == nil {
+		return nil
+	}
+	err := route.messageHandler(ws, data)
+	if err != nil {
+		route.error(fmt.Errorf("handling failed for %s: %w", ws.ID(), err))
+	}
+	return err
+}
+
+// serverRoute is a WsServer view on a ServerMux, bound to a single sub-protocol.
+type serverRoute struct {
+	mux                 *ServerMux
+	subProtocol         string
+	messageHandler      func(ws Channel, data []byte) error
+	checkClientHandler  func(id string, r *http.Request) bool
+	newClientHandler    func(ws Channel)
+	disconnectedHandler func(ws Channel)
+	drainHandler        func(ctx context.Context) error
+	basicAuthHandler    func(username string, password string) bool
+	errC                chan error
+}
+
+// Start has no effect on a route and returns immediately, since the listener is owned by the ServerMux.
+// The mux must be started separately, after all routes were set up.
+func (route *serverRoute) Start(port int, listenPath string) {
+	log.Debugf("route %v doesn't own a listener, ignoring start", route.subProtocol)
+}
+
+// Stop closes all connections of the route. The listener is owned by the ServerMux and keeps running,
+// so clients may still connect to the route until the mux itself is stopped.
+func (route *serverRoute) Stop() {
+	for _, id := range route.mux.connectedClients(route) {
+		err := route.mux.server.StopConnection(id, websocket.CloseError{Code: websocket.CloseNormalClosure})
+		if err != nil {
+			log.Debugf("route %v couldn't stop connection %v: %v", route.subProtocol, id, err)
+		}
+	}
+}
+
+// SetDrainHandler sets a callback, which is invoked while the route is shut down,
+// as well as during a graceful shutdown of the ServerMux.
+func (route *serverRoute) SetDrainHandler(handler func(ctx context.Context) error) {
+	route.mux.mutex.Lock()
+	defer route.mux.mutex.Unlock()
+	route.drainHandler = handler
+}
+
+// Shutdown only invokes the drain handler of the route, since the listener and the connections are owned by the ServerMux.
+// Connections are closed once the ServerMux itself is stopped or shut down.
+func (route *serverRoute) Shutdown(ctx context.Context) error {
+	route.mux.mutex.RLock()
+	handler := route.drainHandler
+	route.mux.mutex.RUnlock()
+	if handler == nil {
+		return nil
+	}
+	return handler(ctx)
+}
+
+// StopConnection closes the connection with the given ID, if the client is connected on this route.
+func (route *serverRoute) StopConnection(id string, closeError websocket.CloseError) error {
+	if !route.mux.isConnected(id, route) {
+		return fmt.Errorf("couldn't stop websocket connection. No connection with id %s is open on route %v", id, route.subProtocol)
+	}
+	return route.mux.server.StopConnection(id, closeError)
+}
+
+// Errors returns a channel, which receives the errors attributable to this route,
+// i.e. rejected clients and failures of the message handler.
+// Errors of the underlying server are reported on the channel returned by ServerMux.Server().Errors().
+func (route *serverRoute) Errors() <-chan error {
+	route.mux.mutex.Lock()
+	defer route.mux.mutex.Unlock()
+	if route.errC == nil {
+		route.errC = make(chan error, 1)
+	}
+	return route.errC
+}
+
+func (route *serverRoute) error(err error) {
+	log.Error(err)
+	route.mux.mutex.RLock()
+	errC := route.errC
+	route.mux.mutex.RUnlock()
+	if errC != nil {
+		errC <- err
+	}
+}
+
+func (route *serverRoute) SetMessageHandler(handler func(ws Channel, data []byte) error) {
+	route.messageHandler = handler
+}
+
+func (route *serverRoute) SetNewClientHandler(handler func(ws Channel)) {
+	route.newClientHandler = handler
+}
+
+func (route *serverRoute) SetDisconnectedClientHandler(handler func(ws Channel)) {
+	route.disconnectedHandler = handler
+}
+
+// SetTimeoutConfig has no effect on a route, since the timeouts apply to all connections of the underlying server.
+// Set the config on the server passed to the ServerMux instead.
+func (route *serverRoute) SetTimeoutConfig(config ServerTimeoutConfig) {
+	log.Errorf("route %v cannot set the timeout config of the shared server, ignoring", route.subProtocol)
+}
+
+// Write sends data to the client with the given ID, if the client is connected on this route.
+func (route *serverRoute) Write(webSocketId string, data []byte) error {
+	if !route.mux.isConnected(webSocketId, route) {
+		return fmt.Errorf("couldn't write to websocket. No socket with id %v is open on route %v", webSocketId, route.subProtocol)
+	}
+	return route.mux.server.Write(webSocketId, data)
+}
+
+// AddSupportedSubprotocol has no effect on a route, since every route is bound to exactly one sub-protocol.
+func (route *serverRoute) AddSupportedSubprotocol(subProto string) {
+	if subProto != route.subProtocol {
+		log.Errorf("route %v cannot support additional sub-protocol %v", route.subProtocol, subProto)
+	}
+}
+
+// SetBasicAuthHandler sets a handler, which authenticates the clients negotiating the sub-protocol of this route.
+// Clients failing authentication are rejected with a 401 status code.
+func (route *serverRoute) SetBasicAuthHandler(handler func(username string, password string) bool) {
+	route.mux.mutex.Lock()
+	defer route.mux.mutex.Unlock()
+	route.basicAuthHandler = handler
+}
+
+// SetCheckOriginHandler has no effect on a route, since the origin check is shared by all routes.
+// Set the handler on the server passed to the ServerMux instead.
+func (route *serverRoute) SetCheckOriginHandler(handler func(r *http.Request) bool) {
+	log.Errorf("route %v cannot set the origin check of the shared server, ignoring", route.subProtocol)
+}
+
+func (route *serverRoute) SetCheckClientHandler(handler func(id string, r *http.Request) bool) {
+	route.mux.mutex.Lock()
+	defer route.mux.mutex.Unlock()
+	route.checkClientHandler = handler
+}
+
+func (route *serverRoute) Addr() *net.TCPAddr {
+	return route.mux.server.Addr()
+}
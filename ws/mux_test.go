@@ -0,0 +1,175 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMuxRouting(t *testing.T) {
+	mux := NewServerMux(NewServer())
+	v16Route := mux.Route("ocpp1.6")
+	v201Route := mux.Route("ocpp2.0.1")
+	assert.Equal(t, v16Route, mux.Route("ocpp1.6"))
+	v16C := make(chan string, 1)
+	v201C := make(chan string, 1)
+	v16Route.SetMessageHandler(func(ws Channel, data []byte) error {
+		assert.Equal(t, "ocpp1.6", ws.(SubProtocolChannel).SubProtocol())
+		v16C <- string(data)
+		return nil
+	})
+	v201Route.SetMessageHandler(func(ws Channel, data []byte) error {
+		assert.Equal(t, "ocpp2.0.1", ws.(SubProtocolChannel).SubProtocol())
+		v201C <- string(data)
+		return nil
+	})
+	v201Route.SetCheckClientHandler(func(id string, r *http.Request) bool {
+		return id != "blocked"
+	})
+	connectedC := make(chan string, 2)
+	mux.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws.(SubProtocolChannel).SubProtocol()
+	})
+	go mux.Start(serverPort, serverPath)
+	defer mux.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	connect := func(id string, subProto string) (*Client, error) {
+		client := NewClient()
+		client.SetRequestedSubProtocol(subProto)
+		u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: fmt.Sprintf("/ws/%v", id)}
+		return client, client.Start(u.String())
+	}
+	// Messages are routed depending on the negotiated sub-protocol
+	v16Client, err := connect("cp1", "ocpp1.6")
+	require.NoError(t, err)
+	defer v16Client.Stop()
+	assert.Equal(t, "ocpp1.6", <-connectedC)
+	v201Client, err := connect("cs1", "ocpp2.0.1")
+	require.NoError(t, err)
+	defer v201Client.Stop()
+	assert.Equal(t, "ocpp2.0.1", <-connectedC)
+	require.NoError(t, v16Client.Write([]byte("v16")))
+	require.NoError(t, v201Client.Write([]byte("v201")))
+	assert.Equal(t, "v16", <-v16C)
+	assert.Equal(t, "v201", <-v201C)
+	// Client validation is performed by the route
+	blockedClient, err := connect("blocked", "ocpp1.6")
+	require.NoError(t, err)
+	blockedClient.Stop()
+	_, err = connect("blocked", "ocpp2.0.1")
+	require.Error(t, err)
+	httpErr, ok := err.(HttpConnectionError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, httpErr.HttpCode)
+}
+
+func TestServerMuxShutdown(t *testing.T) {
+	mux := NewServerMux(NewServer())
+	v16Route := mux.Route("ocpp1.6")
+	v201Route := mux.Route("ocpp2.0.1")
+	drainedC := make(chan string, 3)
+	v16Route.(*serverRoute).SetDrainHandler(func(ctx context.Context) error {
+		drainedC <- "ocpp1.6"
+		return nil
+	})
+	v201Route.(*serverRoute).SetDrainHandler(func(ctx context.Context) error {
+		drainedC <- "ocpp2.0.1"
+		return nil
+	})
+	go mux.Start(serverPort, serverPath)
+	time.Sleep(200 * time.Millisecond)
+	client := NewClient()
+	client.SetRequestedSubProtocol("ocpp1.6")
+	disconnectedC := make(chan error, 1)
+	client.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: "/ws/cp1"}
+	require.NoError(t, client.Start(u.String()))
+	defer client.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	// Shutting down a route only drains the route, while connections stay open
+	err := v16Route.(*serverRoute).Shutdown(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ocpp1.6", <-drainedC)
+	assert.True(t, client.IsConnected())
+	// Shutting down the mux drains all routes, then closes the connections
+	err = mux.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ocpp1.6", "ocpp2.0.1"}, []string{<-drainedC, <-drainedC})
+	err = <-disconnectedC
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+}
+
+func TestServerMuxRouteScope(t *testing.T) {
+	server := NewServer()
+	mux := NewServerMux(server)
+	v16Route := mux.Route("ocpp1.6")
+	v201Route := mux.Route("ocpp2.0.1")
+	v16Errors := v16Route.Errors()
+	v16Route.SetBasicAuthHandler(func(username string, password string) bool {
+		return username == "user" && password == "secret"
+	})
+	// Settings of the shared server cannot be changed via a route
+	v16Route.SetTimeoutConfig(ServerTimeoutConfig{PingWait: time.Hour})
+	assert.Equal(t, NewServerTimeoutConfig(), server.timeoutConfig)
+	connectedC := make(chan string, 3)
+	mux.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws.ID()
+	})
+	go mux.Start(serverPort, serverPath)
+	defer mux.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	connect := func(id string, subProto string, password string) (*Client, error) {
+		client := NewClient()
+		client.SetRequestedSubProtocol(subProto)
+		if password != "" {
+			client.SetBasicAuth("user", password)
+		}
+		u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: fmt.Sprintf("/ws/%v", id)}
+		return client, client.Start(u.String())
+	}
+	// Basic auth only applies to the route it was set on
+	_, err := connect("cp1", "ocpp1.6", "wrong")
+	require.Error(t, err)
+	httpErr, ok := err.(HttpConnectionError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, httpErr.HttpCode)
+	assert.Error(t, <-v16Errors)
+	v16Client, err := connect("cp1", "ocpp1.6", "secret")
+	require.NoError(t, err)
+	defer v16Client.Stop()
+	assert.Equal(t, "cp1", <-connectedC)
+	disconnectedC := make(chan error, 1)
+	v16Client.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	v201Client, err := connect("cs1", "ocpp2.0.1", "")
+	require.NoError(t, err)
+	defer v201Client.Stop()
+	assert.Equal(t, "cs1", <-connectedC)
+	// Routes only operate on their own connections
+	assert.Error(t, v16Route.Write("cs1", []byte("v16")))
+	assert.Error(t, v16Route.StopConnection("cs1", websocket.CloseError{Code: websocket.CloseNormalClosure}))
+	assert.NoError(t, v201Route.Write("cs1", []byte("v201")))
+	// Stopping a route only closes the connections of that route
+	v16Route.Stop()
+	err = <-disconnectedC
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok)
+	assert.Equal(t, websocket.CloseNormalClosure, closeErr.Code)
+	assert.True(t, v201Client.IsConnected())
+	assert.NoError(t, v201Route.Write("cs1", []byte("v201")))
+}
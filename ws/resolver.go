@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/gorilla/mux"
+)
+
+// ClientIDResolver extracts the ID of a connecting client from its HTTP upgrade request.
+// If an error is returned, the connection is rejected with a 400 Bad Request.
+//
+// By default, the final element of the URL path is used (see DefaultClientIDResolver).
+type ClientIDResolver func(r *http.Request) (string, error)
+
+// TenantResolver extracts the tenant of a connecting client from its HTTP upgrade request.
+// If an error is returned, the connection is rejected with a 400 Bad Request.
+//
+// The resolved tenant is available via the Tenant method of the respective Channel.
+type TenantResolver func(r *http.Request) (string, error)
+
+// DefaultClientIDResolver returns the final element of the URL path as client ID.
+func DefaultClientIDResolver(r *http.Request) (string, error) {
+	return path.Base(r.URL.Path), nil
+}
+
+// FromPathVariable returns a resolver, which extracts the value of a named path variable
+// (e.g. "id" for a path template "/ocpp/{tenant}/{id}").
+//
+// Path variables are only available when the server is started with a matching path template (see Start),
+// or when mounting the server into a mux.Router (see ServeHTTP).
+// The resolver may be used both as ClientIDResolver and as TenantResolver.
+func FromPathVariable(name string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		value := mux.Vars(r)[name]
+		if value == "" {
+			return "", fmt.Errorf("path variable %v not found in %v", name, r.URL.Path)
+		}
+		return value, nil
+	}
+}
+
+// FromHeader returns a resolver, which extracts the value of an HTTP header (e.g. set by a reverse proxy).
+// The resolver may be used both as ClientIDResolver and as TenantResolver.
+func FromHeader(name string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		value := r.Header.Get(name)
+		if value == "" {
+			return "", fmt.Errorf("header %v not found", name)
+		}
+		return value, nil
+	}
+}
+
+// FromQueryParameter returns a resolver, which extracts the value of a URL query parameter.
+// The resolver may be used both as ClientIDResolver and as TenantResolver.
+func FromQueryParameter(name string) func(r *http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			return "", fmt.Errorf("query parameter %v not found", name)
+		}
+		return value, nil
+	}
+}
+
+// SetClientIDResolver sets a custom function for extracting the client ID from incoming connections.
+// Passing nil restores the default behavior (see DefaultClientIDResolver).
+//
+// The resolved ID identifies the connection on the server, and must hence be unique across all tenants.
+// The ID is passed to the check client handler and used for client identity verification.
+//
+// This function must be called before starting the server.
+func (server *Server) SetClientIDResolver(resolver ClientIDResolver) {
+	server.clientIDResolver = resolver
+}
+
+// SetTenantResolver sets a function for extracting the tenant from incoming connections.
+// If no resolver is set, the tenant of all connections is empty.
+//
+// This function must be called before starting the server.
+func (server *Server) SetTenantResolver(resolver TenantResolver) {
+	server.tenantResolver = resolver
+}
+
+// Resolves the client ID and tenant of an incoming connection.
+func (server *Server) resolveClient(r *http.Request) (id string, tenant string, err error) {
+	resolveID := server.clientIDResolver
+	if resolveID == nil {
+		resolveID = DefaultClientIDResolver
+	}
+	id, err = resolveID(r)
+	if err == nil && id == "" {
+		err = fmt.Errorf("empty client ID")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't resolve client ID: %w", err)
+	}
+	if server.tenantResolver != nil {
+		tenant, err = server.tenantResolver(r)
+		if err != nil {
+			return "", "", fmt.Errorf("couldn't resolve tenant for client %v: %w", id, err)
+		}
+	}
+	return id, tenant, nil
+}
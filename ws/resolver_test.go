@@ -0,0 +1,82 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultClientIDResolver(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ocpp/tenant1/cp1?foo=bar", nil)
+	id, err := DefaultClientIDResolver(r)
+	require.NoError(t, err)
+	assert.Equal(t, "cp1", id)
+}
+
+func TestQueryParameterResolver(t *testing.T) {
+	resolver := FromQueryParameter("id")
+	r := httptest.NewRequest(http.MethodGet, "/ocpp?id=cp1", nil)
+	id, err := resolver(r)
+	require.NoError(t, err)
+	assert.Equal(t, "cp1", id)
+	r = httptest.NewRequest(http.MethodGet, "/ocpp", nil)
+	_, err = resolver(r)
+	assert.EqualError(t, err, "query parameter id not found")
+}
+
+func TestServerClientIDResolver(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	wsServer.SetClientIDResolver(FromHeader("X-Charge-Point-Id"))
+	wsServer.SetTenantResolver(FromPathVariable("tenant"))
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	checkedC := make(chan string, 1)
+	wsServer.SetCheckClientHandler(func(id string, r *http.Request) bool {
+		checkedC <- id
+		return true
+	})
+	go wsServer.Start(serverPort, "/ocpp/{tenant}")
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	wsClient := newWebsocketClient(t, nil)
+	wsClient.SetHeaderValue("X-Charge-Point-Id", "cp1")
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: "/ocpp/tenant1"}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	assert.Equal(t, "cp1", <-checkedC)
+	channel := <-connectedC
+	assert.Equal(t, "cp1", channel.ID())
+	assert.Equal(t, "tenant1", channel.(TenantChannel).Tenant())
+	// Messages are routed via the resolved ID
+	assert.NoError(t, wsServer.Write("cp1", []byte("hello")))
+}
+
+func TestServerClientIDResolverError(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	wsServer.SetClientIDResolver(FromHeader("X-Charge-Point-Id"))
+	errC := wsServer.Errors()
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	wsClient := newWebsocketClient(t, nil)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := wsClient.Start(u.String())
+	require.Error(t, err)
+	httpErr, ok := err.(HttpConnectionError)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, httpErr.HttpCode)
+	select {
+	case err = <-errC:
+		assert.EqualError(t, err, "couldn't resolve client ID: header X-Charge-Point-Id not found")
+	case <-time.After(time.Second):
+		t.Fatal("expected resolver error")
+	}
+}
@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerServeListener(t *testing.T) {
+	message := []byte("Hello WebSocket!")
+	dir, err := os.MkdirTemp("", "ocpp-ws")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "ocpp.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	wsServer := newWebsocketServer(t, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go wsServer.Serve(listener)
+	defer wsServer.Stop()
+	// Address is only available for TCP listeners
+	assert.Nil(t, wsServer.Addr())
+	receivedC := make(chan []byte, 1)
+	wsClient := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	wsClient.AddOption(func(dialer *websocket.Dialer) {
+		dialer.NetDial = func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		}
+	})
+	// Any path is accepted, the final element is the client ID
+	u := url.URL{Scheme: "ws", Host: "localhost", Path: "/some/path/testws"}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	channel := <-connectedC
+	assert.Equal(t, "testws", channel.ID())
+	require.NoError(t, wsClient.Write(message))
+	assert.Equal(t, message, <-receivedC)
+}
+
+func TestServerServeAddHttpHandler(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	wsServer := newWebsocketServer(t, nil)
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go wsServer.Serve(listener)
+	defer wsServer.Stop()
+	time.Sleep(100 * time.Millisecond)
+	// Handlers added after serving take precedence over the websocket fallback
+	wsServer.AddHttpHandler("/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	resp, err := http.Get("http://" + listener.Addr().String() + "/health")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", string(body))
+	// All other paths are still upgraded
+	wsClient := newWebsocketClient(t, nil)
+	u := url.URL{Scheme: "ws", Host: listener.Addr().String(), Path: "/ocpp/testws"}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	channel := <-connectedC
+	assert.Equal(t, "testws", channel.ID())
+}
+
+func TestServerHTTPHandler(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	disconnectedC := make(chan Channel, 1)
+	wsServer.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	// Mount the websocket server next to another API
+	router := mux.NewRouter()
+	router.Handle("/ocpp/{id}", wsServer)
+	router.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	httpServer := httptest.NewServer(router)
+	defer httpServer.Close()
+	resp, err := http.Get(httpServer.URL + "/api/health")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "ok", string(body))
+	// Connect websocket client
+	wsClient := newWebsocketClient(t, nil)
+	u, err := url.Parse(httpServer.URL)
+	require.NoError(t, err)
+	u.Scheme = "ws"
+	u.Path = "/ocpp/testws"
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	channel := <-connectedC
+	assert.Equal(t, "testws", channel.ID())
+	// Stopping the websocket server closes open connections
+	wsServer.Stop()
+	select {
+	case ws := <-disconnectedC:
+		assert.Equal(t, "testws", ws.ID())
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed")
+	}
+}
@@ -0,0 +1,104 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/lorenzodonini/ocpp-go/internal/poll"
+)
+
+// SetDrainHandler sets a callback, which is invoked during a graceful shutdown (see Shutdown).
+//
+// The handler is invoked after the server stopped accepting new connections,
+// but before closing the open connections. Messages may still be exchanged from within the handler,
+// e.g. to complete pending requests. The handler should return once it is done,
+// or an error if the passed context is done before.
+func (server *Server) SetDrainHandler(handler func(ctx context.Context) error) {
+	server.drainHandler = handler
+}
+
+// Shutdown gracefully shuts down a running websocket server:
+//
+// - new connections are refused, while open connections are kept alive
+//
+// - running message handlers are allowed to complete
+//
+// - the drain handler is invoked, if set (see SetDrainHandler)
+//
+// - all open connections are closed with a CloseGoingAway code, after writing any queued outgoing messages
+//
+// Clients are hence expected to reconnect, possibly to a different server instance.
+//
+// If the passed context is done before the shutdown completed, all remaining connections are forcefully closed
+// and the context error is returned.
+// Once Shutdown returns, the previously called Start function will have returned as well.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.getLogger().Info("shutting down websocket server")
+	server.connMutex.Lock()
+	server.shuttingDown = true
+	server.connMutex.Unlock()
+	// Stop accepting new connections. Upgraded websocket connections are not affected.
+	err := server.httpServer.Shutdown(ctx)
+	if err != nil {
+		err = fmt.Errorf("shutdown failed: %w", err)
+	}
+	if err == nil {
+		err = poll.Until(ctx, func() bool {
+			return atomic.LoadInt32(&server.activeHandlers) == 0
+		})
+	}
+	if err == nil && server.drainHandler != nil {
+		err = server.drainHandler(ctx)
+	}
+	server.closeConnections(websocket.CloseError{Code: websocket.CloseGoingAway, Text: "server shutting down"})
+	if waitErr := poll.Until(ctx, server.hasNoConnections); waitErr != nil {
+		server.getLogger().Infof("graceful shutdown incomplete, forcefully closing remaining connections: %v", waitErr)
+		server.forceCloseConnections()
+		if err == nil {
+			err = waitErr
+		}
+	}
+	if server.errC != nil {
+		close(server.errC)
+		server.errC = nil
+	}
+	return err
+}
+
+func (server *Server) isShuttingDown() bool {
+	server.connMutex.RLock()
+	defer server.connMutex.RUnlock()
+	return server.shuttingDown
+}
+
+func (server *Server) hasNoConnections() bool {
+	server.connMutex.RLock()
+	defer server.connMutex.RUnlock()
+	return len(server.connections) == 0
+}
+
+// Signals all open connections to be closed with the given close error.
+func (server *Server) closeConnections(closeError websocket.CloseError) {
+	server.connMutex.RLock()
+	defer server.connMutex.RUnlock()
+	for _, ws := range server.connections {
+		select {
+		case ws.closeC <- closeError:
+		default:
+			// Connection is already being closed
+		}
+	}
+}
+
+// Closes the underlying network connection of all open connections.
+// Read routines will fail immediately, triggering the cleanup of each connection.
+func (server *Server) forceCloseConnections() {
+	server.connMutex.RLock()
+	defer server.connMutex.RUnlock()
+	for _, ws := range server.connections {
+		_ = ws.connection.Close()
+	}
+}
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerShutdown(t *testing.T) {
+	message := []byte("drained")
+	wsServer := newWebsocketServer(t, nil)
+	drainedC := make(chan struct{}, 1)
+	wsServer.SetDrainHandler(func(ctx context.Context) error {
+		// Connections are still open while draining
+		err := wsServer.Write(path.Base(testPath), message)
+		assert.NoError(t, err)
+		drainedC <- struct{}{}
+		return nil
+	})
+	receivedC := make(chan []byte, 1)
+	wsClient := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	disconnectedC := make(chan error, 1)
+	wsClient.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(200 * time.Millisecond)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := wsServer.Shutdown(ctx)
+	require.NoError(t, err)
+	<-drainedC
+	// Message queued during the drain is delivered before closing
+	assert.Equal(t, message, <-receivedC)
+	err = <-disconnectedC
+	closeErr, ok := err.(*websocket.CloseError)
+	require.True(t, ok)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	assert.True(t, wsServer.hasNoConnections())
+	// New connections are refused
+	newClient := newWebsocketClient(t, nil)
+	assert.Error(t, newClient.Start(u.String()))
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	wsServer.SetDrainHandler(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	disconnectedC := make(chan struct{}, 1)
+	wsServer.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- struct{}{}
+	})
+	wsClient := newWebsocketClient(t, nil)
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(200 * time.Millisecond)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := wsServer.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// Connection is closed nonetheless
+	select {
+	case <-disconnectedC:
+	case <-time.After(time.Second):
+		t.Fatal("connection wasn't closed")
+	}
+}
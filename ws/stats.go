@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnectionStats contains health statistics of a single websocket connection.
+type ConnectionStats struct {
+	// Time at which the connection was established.
+	ConnectedAt time.Time
+	// Time at which the last message was received. Zero if no message was received yet.
+	LastMessageReceived time.Time
+	// Time at which the last message was sent. Zero if no message was sent yet.
+	LastMessageSent time.Time
+	// Total size of all received messages, in bytes.
+	BytesReceived int64
+	// Total size of all sent messages, in bytes.
+	BytesSent int64
+	// Round-trip time of the last ping, which was answered by the remote peer.
+	// Zero if no ping was answered yet.
+	RoundTripTime time.Duration
+}
+
+// connectionStats tracks the statistics of a websocket connection. Access is thread-safe.
+type connectionStats struct {
+	connectedAt         time.Time
+	lastMessageReceived int64 // unix nanoseconds
+	lastMessageSent     int64 // unix nanoseconds
+	bytesReceived       int64
+	bytesSent           int64
+	pingSent            int64 // unix nanoseconds
+	roundTripTime       int64
+}
+
+func newConnectionStats() *connectionStats {
+	return &connectionStats{connectedAt: time.Now()}
+}
+
+func (s *connectionStats) received(size int) {
+	atomic.StoreInt64(&s.lastMessageReceived, time.Now().UnixNano())
+	atomic.AddInt64(&s.bytesReceived, int64(size))
+}
+
+func (s *connectionStats) sent(size int) {
+	atomic.StoreInt64(&s.lastMessageSent, time.Now().UnixNano())
+	atomic.AddInt64(&s.bytesSent, int64(size))
+}
+
+func (s *connectionStats) pinged() {
+	atomic.StoreInt64(&s.pingSent, time.Now().UnixNano())
+}
+
+func (s *connectionStats) ponged() {
+	pingSent := atomic.LoadInt64(&s.pingSent)
+	if pingSent == 0 {
+		// Unsolicited pong
+		return
+	}
+	atomic.StoreInt64(&s.roundTripTime, time.Now().UnixNano()-pingSent)
+}
+
+func (s *connectionStats) snapshot() ConnectionStats {
+	stats := ConnectionStats{
+		ConnectedAt:   s.connectedAt,
+		BytesReceived: atomic.LoadInt64(&s.bytesReceived),
+		BytesSent:     atomic.LoadInt64(&s.bytesSent),
+		RoundTripTime: time.Duration(atomic.LoadInt64(&s.roundTripTime)),
+	}
+	if t := atomic.LoadInt64(&s.lastMessageReceived); t != 0 {
+		stats.LastMessageReceived = time.Unix(0, t)
+	}
+	if t := atomic.LoadInt64(&s.lastMessageSent); t != 0 {
+		stats.LastMessageSent = time.Unix(0, t)
+	}
+	return stats
+}
+
+// Writes a ping message, recording the time it was sent for measuring the round-trip time.
+// Must only be invoked by the write routine of the websocket.
+func (ws *WebSocket) writePing() error {
+	ws.stats.pinged()
+	return ws.connection.WriteMessage(websocket.PingMessage, []byte{})
+}
@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerPing(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	config := NewServerTimeoutConfig()
+	config.PingPeriod = 50 * time.Millisecond
+	config.PingWait = 200 * time.Millisecond
+	wsServer.SetTimeoutConfig(config)
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	disconnectedC := make(chan Channel, 1)
+	wsServer.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	// Client never pings
+	wsClient := newWebsocketClient(t, nil)
+	clientConfig := NewClientTimeoutConfig()
+	clientConfig.PingPeriod = time.Minute
+	wsClient.SetTimeoutConfig(clientConfig)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	channel := <-connectedC
+	// Connection is kept alive by the server pings, beyond the PingWait
+	select {
+	case <-disconnectedC:
+		t.Fatal("connection was closed unexpectedly")
+	case <-time.After(500 * time.Millisecond):
+	}
+	assert.Greater(t, channel.(StatsChannel).Stats().RoundTripTime, time.Duration(0))
+}
+
+func TestConnectionStats(t *testing.T) {
+	wsServer := newWebsocketServer(t, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+	connectedC := make(chan Channel, 1)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go wsServer.Start(serverPort, serverPath)
+	defer wsServer.Stop()
+	time.Sleep(200 * time.Millisecond)
+	receivedC := make(chan []byte, 1)
+	wsClient := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	start := time.Now()
+	require.NoError(t, wsClient.Start(u.String()))
+	defer wsClient.Stop()
+	channel := <-connectedC
+	stats := channel.(StatsChannel).Stats()
+	assert.False(t, stats.ConnectedAt.Before(start))
+	assert.True(t, stats.LastMessageReceived.IsZero())
+	assert.True(t, stats.LastMessageSent.IsZero())
+	assert.Equal(t, int64(0), stats.BytesReceived)
+	assert.Equal(t, time.Duration(0), stats.RoundTripTime)
+	// Exchange messages
+	message := []byte("Hello WebSocket!")
+	require.NoError(t, wsClient.Write(message))
+	<-receivedC
+	stats = channel.(StatsChannel).Stats()
+	assert.Equal(t, int64(len(message)), stats.BytesReceived)
+	assert.Equal(t, int64(len(message)), stats.BytesSent)
+	assert.False(t, stats.LastMessageReceived.Before(stats.ConnectedAt))
+	assert.False(t, stats.LastMessageSent.Before(stats.LastMessageReceived))
+	clientStats := wsClient.webSocket.Stats()
+	assert.Equal(t, int64(len(message)), clientStats.BytesSent)
+	assert.Equal(t, int64(len(message)), clientStats.BytesReceived)
+}
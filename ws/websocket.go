@@ -10,17 +10,18 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/lorenzodonini/ocpp-go/logging"
+	"github.com/lorenzodonini/ocpp-go/metrics"
 )
 
 const (
@@ -52,9 +53,17 @@ const (
 // The internal verbose logger
 var log logging.Logger
 
+// Labels attached to the metrics reported by servers and clients respectively
+var (
+	serverLabels = metrics.Labels{metrics.LabelRole: metrics.RoleServer}
+	clientLabels = metrics.Labels{metrics.LabelRole: metrics.RoleClient}
+)
+
 // Sets a custom Logger implementation, allowing the package to log events.
 // By default, a VoidLogger is used, so no logs will be sent to any output.
 //
+// The logger is used by all servers and clients, which don't have a logger of their own.
+//
 // The function panics, if a nil logger is passed.
 func SetLogger(logger logging.Logger) {
 	if logger == nil {
@@ -71,6 +80,12 @@ func SetLogger(logger logging.Logger) {
 type ServerTimeoutConfig struct {
 	WriteWait time.Duration
 	PingWait  time.Duration
+	// Maximum size in bytes of a message received from a client. If 0, the size is unlimited.
+	// May be overridden per connection via SetReadLimitHandler.
+	MaxMessageSize int64
+	// Interval at which the server sends pings to clients. If 0, the server doesn't send pings,
+	// relying on clients to ping instead. Must be lower than PingWait, as pongs extend the read deadline.
+	PingPeriod time.Duration
 }
 
 // NewServerTimeoutConfig creates a default timeout configuration for a websocket endpoint.
@@ -85,6 +100,8 @@ func NewServerTimeoutConfig() ServerTimeoutConfig {
 //
 // To set a custom configuration, refer to the client's SetTimeoutConfig method.
 // If no configuration is passed, a default configuration is generated via the NewClientTimeoutConfig function.
+//
+// The RetryBackOff parameters are only used by the default reconnection strategy (see NewDefaultBackoff).
 type ClientTimeoutConfig struct {
 	WriteWait               time.Duration
 	HandshakeTimeout        time.Duration
@@ -93,6 +110,8 @@ type ClientTimeoutConfig struct {
 	RetryBackOffRepeatTimes int
 	RetryBackOffRandomRange int
 	RetryBackOffWaitMinimum time.Duration
+	// Maximum size in bytes of a message received from the server. If 0, the size is unlimited.
+	MaxMessageSize int64
 }
 
 // NewClientTimeoutConfig creates a default timeout configuration for a websocket endpoint.
@@ -111,24 +130,59 @@ func NewClientTimeoutConfig() ClientTimeoutConfig {
 }
 
 // Channel represents a bi-directional communication channel, which provides at least a unique ID.
+//
+// Additional information about a connection is exposed via optional interfaces,
+// e.g. SubProtocolChannel or StatsChannel, which are all implemented by WebSocket.
 type Channel interface {
 	ID() string
 	RemoteAddr() net.Addr
 	TLSConnectionState() *tls.ConnectionState
 }
 
+// SubProtocolChannel is implemented by channels, which expose the sub-protocol negotiated during the websocket handshake.
+type SubProtocolChannel interface {
+	SubProtocol() string
+}
+
+// IdentityChannel is implemented by channels, which expose the client identity verified via the TLS client certificate.
+type IdentityChannel interface {
+	ClientIdentity() *ClientIdentity
+}
+
+// TenantChannel is implemented by channels, which expose the tenant resolved for the client.
+type TenantChannel interface {
+	Tenant() string
+}
+
+// CompressionChannel is implemented by channels, which expose whether per-message compression was negotiated.
+type CompressionChannel interface {
+	CompressionNegotiated() bool
+}
+
+// StatsChannel is implemented by channels, which expose health statistics of the connection.
+type StatsChannel interface {
+	Stats() ConnectionStats
+}
+
 // WebSocket is a wrapper for a single websocket channel.
 // The connection itself is provided by the gorilla websocket package.
 //
 // Don't use a websocket directly, but refer to WsServer and WsClient.
 type WebSocket struct {
-	connection         *websocket.Conn
-	id                 string
-	outQueue           chan []byte
-	closeC             chan websocket.CloseError // used to gracefully close a websocket connection.
-	forceCloseC        chan error                // used by the readPump to notify a forcefully closed connection to the writePump.
-	pingMessage        chan []byte
-	tlsConnectionState *tls.ConnectionState
+	connection            *websocket.Conn
+	id                    string
+	outQueue              chan []byte
+	closeC                chan websocket.CloseError // used to gracefully close a websocket connection.
+	forceCloseC           chan error                // used by the readPump to notify a forcefully closed connection to the writePump.
+	pingMessage           chan []byte
+	tlsConnectionState    *tls.ConnectionState
+	subProtocol           string
+	identity              *ClientIdentity
+	tenant                string
+	compressionNegotiated bool
+	compressionThreshold  int
+	readLimit             int64
+	stats                 *connectionStats
 }
 
 // Retrieves the unique Identifier of the websocket (typically, the URL suffix).
@@ -146,6 +200,35 @@ func (websocket *WebSocket) TLSConnectionState() *tls.ConnectionState {
 	return websocket.tlsConnectionState
 }
 
+// Returns the sub-protocol that was negotiated during the websocket handshake.
+// If no sub-protocol was negotiated, an empty string is returned.
+func (websocket *WebSocket) SubProtocol() string {
+	return websocket.subProtocol
+}
+
+// Returns the identity of the client, which was verified via its TLS client certificate.
+// If client identity verification isn't enabled on the server (see SetClientIdentityFields), nil is returned.
+func (websocket *WebSocket) ClientIdentity() *ClientIdentity {
+	return websocket.identity
+}
+
+// Returns the tenant the client belongs to.
+// If no tenant resolver is set on the server (see SetTenantResolver), an empty string is returned.
+func (websocket *WebSocket) Tenant() string {
+	return websocket.tenant
+}
+
+// Returns true if per-message compression was negotiated during the websocket handshake.
+// See Server.EnableCompression and Client.EnableCompression.
+func (websocket *WebSocket) CompressionNegotiated() bool {
+	return websocket.compressionNegotiated
+}
+
+// Returns the current health statistics of the connection.
+func (websocket *WebSocket) Stats() ConnectionStats {
+	return websocket.stats.snapshot()
+}
+
 // ConnectionError is a websocket
 type HttpConnectionError struct {
 	Message    string
@@ -162,6 +245,21 @@ func (e HttpConnectionError) Error() string {
 
 type CheckClientHandler func(id string, r *http.Request) bool
 
+// DuplicateConnectionPolicy defines how a server treats an incoming connection,
+// if a connection with the same ID is already open.
+type DuplicateConnectionPolicy int
+
+const (
+	// The new connection is closed immediately with a ClosePolicyViolation code. The existing connection remains open.
+	RejectNewConnection DuplicateConnectionPolicy = iota
+	// The existing connection is closed with a ClosePolicyViolation code, and replaced by the new connection.
+	ReplaceExistingConnection
+)
+
+// DuplicateConnectionHandler decides how to treat a new connection, for which a connection with the same ID is already open.
+// The existing channel and the HTTP request of the new connection are passed to the handler.
+type DuplicateConnectionHandler func(existing Channel, r *http.Request) DuplicateConnectionPolicy
+
 // WsServer defines a websocket server, which passively listens for incoming connections on ws or wss protocol.
 // The offered API are of asynchronous nature, and each incoming connection/message is handled using callbacks.
 //
@@ -268,12 +366,25 @@ type Server struct {
 	basicAuthHandler    func(username string, password string) bool
 	tlsCertificatePath  string
 	tlsCertificateKey   string
+	certificates        certificateStore
 	timeoutConfig       ServerTimeoutConfig
 	upgrader            websocket.Upgrader
 	errC                chan error
 	connMutex           sync.RWMutex
 	addr                *net.TCPAddr
 	httpHandler         *mux.Router
+	metrics             metrics.Metrics
+	logger              logging.Logger
+	identityFields      []IdentityField
+	duplicatePolicy     DuplicateConnectionPolicy
+	duplicateHandler    DuplicateConnectionHandler
+	clientIDResolver    ClientIDResolver
+	tenantResolver      TenantResolver
+	compression         *CompressionConfig
+	readLimitHandler    func(id string, r *http.Request) int64
+	drainHandler        func(ctx context.Context) error
+	shuttingDown        bool
+	activeHandlers      int32
 }
 
 // Creates a new simple websocket server (the websockets are not secured).
@@ -284,6 +395,7 @@ func NewServer() *Server {
 		timeoutConfig: NewServerTimeoutConfig(),
 		upgrader:      websocket.Upgrader{Subprotocols: []string{}},
 		httpHandler:   router,
+		metrics:       &metrics.VoidMetrics{},
 	}
 }
 
@@ -312,6 +424,7 @@ func NewTLSServer(certificatePath string, certificateKey string, tlsConfig *tls.
 		timeoutConfig: NewServerTimeoutConfig(),
 		upgrader:      websocket.Upgrader{Subprotocols: []string{}},
 		httpHandler:   router,
+		metrics:       &metrics.VoidMetrics{},
 	}
 }
 
@@ -353,8 +466,85 @@ func (server *Server) SetCheckOriginHandler(handler func(r *http.Request) bool)
 	server.upgrader.CheckOrigin = handler
 }
 
+// Sets the Metrics implementation, which the server reports connection and message metrics to.
+// By default, a VoidMetrics is used.
+//
+// This function must be called before starting the server.
+func (server *Server) SetMetrics(m metrics.Metrics) {
+	server.metrics = m
+}
+
+// SetClientIdentityFields enables the verification of the client identity, as required by OCPP Security Profile 3.
+//
+// Once enabled, every client needs to present a verified TLS client certificate,
+// which matches the client ID (by default the final element of the URL path, see SetClientIDResolver) on at least one of the given fields.
+// Fields are checked in the given order. Clients that fail verification are rejected with a 401 Unauthorized,
+// and a ClientIdentityError is reported on the Errors channel.
+//
+// The verified identity is available via the ClientIdentity method of the respective Channel.
+//
+// Calling this function without any fields disables the verification.
+// The server needs to be created via NewTLSServer, with a tls.Config requiring and verifying client certificates:
+//
+//	server := ws.NewTLSServer(certPath, keyPath, &tls.Config{
+//		ClientCAs:  caPool,
+//		ClientAuth: tls.RequireAndVerifyClientCert,
+//	})
+//	server.SetClientIdentityFields(ws.IdentityCommonName, ws.IdentitySubjectAltName)
+func (server *Server) SetClientIdentityFields(fields ...IdentityField) {
+	server.identityFields = fields
+}
+
+// SetDuplicateConnectionPolicy sets how the server treats a new connection,
+// if a connection with the same ID is already open. By default, RejectNewConnection is used.
+//
+// Clients often reconnect before the server noticed that the previous connection broke.
+// With ReplaceExistingConnection, such clients are not locked out until the stale connection times out.
+// A replaced connection doesn't trigger the disconnected client handler, while the new client handler
+// is invoked for the new connection. Any state bound to the client ID (e.g. queued requests) is hence retained.
+// The ocppj server only cancels the request in flight on the replaced connection, as its response is lost.
+func (server *Server) SetDuplicateConnectionPolicy(policy DuplicateConnectionPolicy) {
+	server.duplicatePolicy = policy
+}
+
+// SetDuplicateConnectionHandler sets a handler, which decides how to treat every new connection,
+// for which a connection with the same ID is already open.
+// The handler takes precedence over the policy set via SetDuplicateConnectionPolicy.
+func (server *Server) SetDuplicateConnectionHandler(handler DuplicateConnectionHandler) {
+	server.duplicateHandler = handler
+}
+
+// Returns the policy to apply to a new connection, for which the passed connection already exists.
+func (server *Server) getDuplicateConnectionPolicy(existing *WebSocket, r *http.Request) DuplicateConnectionPolicy {
+	if server.duplicateHandler != nil {
+		return server.duplicateHandler(existing, r)
+	}
+	return server.duplicatePolicy
+}
+
+// Sets a custom Logger implementation for this server only.
+// Passing nil restores the package-level logger (see SetLogger).
+func (server *Server) SetLogger(logger logging.Logger) {
+	server.logger = logger
+}
+
+// Returns a logger, which attaches the given client ID to every log entry.
+func withClientID(logger logging.Logger, clientID string) logging.Logger {
+	if _, ok := logger.(*logging.VoidLogger); ok {
+		return logger
+	}
+	return logging.WithFields(logger, logging.Fields{logging.FieldClientID: clientID})
+}
+
+func (server *Server) getLogger() logging.Logger {
+	if server.logger != nil {
+		return server.logger
+	}
+	return log
+}
+
 func (server *Server) error(err error) {
-	log.Error(err)
+	server.getLogger().Error(err)
 	if server.errC != nil {
 		server.errC <- err
 	}
@@ -376,36 +566,78 @@ func (server *Server) AddHttpHandler(listenPath string, handler func(w http.Resp
 }
 
 func (server *Server) Start(port int, listenPath string) {
-	server.connMutex.Lock()
-	server.connections = make(map[string]*WebSocket)
-	server.connMutex.Unlock()
-
-	if server.httpServer == nil {
-		server.httpServer = &http.Server{}
-	}
-
 	addr := fmt.Sprintf(":%v", port)
-	server.httpServer.Addr = addr
-
 	server.AddHttpHandler(listenPath, func(w http.ResponseWriter, r *http.Request) {
 		server.wsHandler(w, r)
 	})
-	server.httpServer.Handler = server.httpHandler
 
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		server.error(fmt.Errorf("failed to listen: %w", err))
 		return
 	}
+	server.getLogger().Infof("listening on tcp network %v", addr)
+	server.serve(ln)
+}
 
-	server.addr = ln.Addr().(*net.TCPAddr)
+// Serve accepts incoming connections on a caller-provided listener, e.g. a unix socket
+// or a socket passed by the service manager. The function blocks until the server is stopped,
+// and closes the listener before returning.
+//
+// All requests, which don't match a handler added via AddHttpHandler, are upgraded to websocket connections.
+// The final element of the URL path is used as client ID.
+//
+// To stop a running server, call the Stop function.
+func (server *Server) Serve(listener net.Listener) {
+	// Used as fallback, so that handlers added later on still take precedence
+	server.httpHandler.NotFoundHandler = http.HandlerFunc(server.wsHandler)
+	server.getLogger().Infof("listening on %v network %v", listener.Addr().Network(), listener.Addr())
+	server.serve(listener)
+}
+
+// ServeHTTP upgrades an incoming HTTP request to a websocket connection.
+// The final element of the URL path is used as client ID.
+//
+// This allows to mount the server on an existing router, instead of calling Start or Serve:
+//
+//	router.Handle("/ocpp/{id}", server)
+//
+// The server doesn't need to be started in this case. Calling Stop closes all open connections.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.wsHandler(w, r)
+}
+
+func (server *Server) serve(ln net.Listener) {
+	server.connMutex.Lock()
+	server.connections = make(map[string]*WebSocket)
+	server.shuttingDown = false
+	server.connMutex.Unlock()
+
+	if server.httpServer == nil {
+		server.httpServer = &http.Server{}
+	}
+	if server.metrics == nil {
+		server.metrics = &metrics.VoidMetrics{}
+	}
+	server.httpServer.Addr = ln.Addr().String()
+	server.httpServer.Handler = server.httpHandler
+	if tcpAddr, ok := ln.Addr().(*net.TCPAddr); ok {
+		server.addr = tcpAddr
+	}
 
 	defer ln.Close()
 
-	log.Infof("listening on tcp network %v", addr)
-	server.httpServer.RegisterOnShutdown(server.stopConnections)
+	var err error
 	if server.tlsCertificatePath != "" && server.tlsCertificateKey != "" {
-		err = server.httpServer.ServeTLS(ln, server.tlsCertificatePath, server.tlsCertificateKey)
+		if err = server.ReloadCertificates(); err != nil {
+			server.error(err)
+			return
+		}
+		server.httpServer.TLSConfig = server.certificates.tlsConfig(server.httpServer.TLSConfig)
+		server.startCertificateWatcher()
+		defer server.stopCertificateWatcher()
+		// Certificates are served via the TLS config, allowing them to be reloaded at runtime
+		err = server.httpServer.ServeTLS(ln, "", "")
 	} else {
 		err = server.httpServer.Serve(ln)
 	}
@@ -416,11 +648,12 @@ func (server *Server) Start(port int, listenPath string) {
 }
 
 func (server *Server) Stop() {
-	log.Info("stopping websocket server")
+	server.getLogger().Info("stopping websocket server")
 	err := server.httpServer.Shutdown(context.TODO())
 	if err != nil {
 		server.error(fmt.Errorf("shutdown failed: %w", err))
 	}
+	server.stopConnections()
 
 	if server.errC != nil {
 		close(server.errC)
@@ -436,7 +669,7 @@ func (server *Server) StopConnection(id string, closeError websocket.CloseError)
 	if !ok {
 		return fmt.Errorf("couldn't stop websocket connection. No connection with id %s is open", id)
 	}
-	log.Debugf("sending stop signal for websocket %s", ws.ID())
+	withClientID(server.getLogger(), ws.ID()).Debugf("sending stop signal for websocket %s", ws.ID())
 	ws.closeC <- closeError
 	return nil
 }
@@ -444,6 +677,10 @@ func (server *Server) StopConnection(id string, closeError websocket.CloseError)
 func (server *Server) stopConnections() {
 	server.connMutex.RLock()
 	defer server.connMutex.RUnlock()
+	if server.shuttingDown {
+		// Connections are closed by the graceful shutdown routine
+		return
+	}
 	for _, conn := range server.connections {
 		conn.closeC <- websocket.CloseError{Code: websocket.CloseNormalClosure, Text: ""}
 	}
@@ -456,16 +693,26 @@ func (server *Server) Write(webSocketId string, data []byte) error {
 	if !ok {
 		return fmt.Errorf("couldn't write to websocket. No socket with id %v is open", webSocketId)
 	}
-	log.Debugf("queuing data for websocket %s", webSocketId)
+	withClientID(server.getLogger(), webSocketId).Debugf("queuing data for websocket %s", webSocketId)
 	ws.outQueue <- data
 	return nil
 }
 
 func (server *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
 	responseHeader := http.Header{}
-	url := r.URL
-	id := path.Base(url.Path)
-	log.Debugf("handling new connection for %s from %s", id, r.RemoteAddr)
+	if server.isShuttingDown() {
+		server.reject("shutting_down")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	id, tenant, err := server.resolveClient(r)
+	if err != nil {
+		server.reject("invalid_client_id")
+		server.error(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	withClientID(server.getLogger(), id).Debugf("handling new connection for %s from %s", id, r.RemoteAddr)
 	// Negotiate sub-protocol
 	clientSubprotocols := websocket.Subprotocols(r)
 	negotiatedSuprotocol := ""
@@ -494,6 +741,7 @@ out:
 			ok = server.basicAuthHandler(username, password)
 		}
 		if !ok {
+			server.reject("unauthorized")
 			server.error(fmt.Errorf("basic auth failed: credentials invalid"))
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -501,9 +749,23 @@ out:
 		}
 	}
 
+	// Handle client identity verification
+	var identity *ClientIdentity
+	if len(server.identityFields) > 0 {
+		var err error
+		identity, err = verifyClientIdentity(id, r.TLS, server.identityFields)
+		if err != nil {
+			server.reject("identity_mismatch")
+			server.error(err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	if server.checkClientHandler != nil {
 		ok := server.checkClientHandler(id, r)
 		if !ok {
+			server.reject("invalid_client")
 			server.error(fmt.Errorf("client validation: invalid client"))
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -513,11 +775,11 @@ out:
 	// Upgrade websocket
 	conn, err := server.upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
+		server.reject("upgrade_failed")
 		server.error(fmt.Errorf("upgrade failed: %w", err))
 		return
 	}
 
-	// The id of the charge point is the final path element
 	ws := WebSocket{
 		connection:         conn,
 		id:                 id,
@@ -526,10 +788,17 @@ out:
 		forceCloseC:        make(chan error, 1),
 		pingMessage:        make(chan []byte, 1),
 		tlsConnectionState: r.TLS,
+		subProtocol:        negotiatedSuprotocol,
+		identity:           identity,
+		tenant:             tenant,
+		stats:              newConnectionStats(),
 	}
-	log.Debugf("upgraded websocket connection for %s from %s", id, conn.RemoteAddr().String())
+	ws.setCompression(server.compression, server.upgrader.EnableCompression && offersCompression(r.Header))
+	ws.setReadLimit(server.getReadLimit(id, r))
+	withClientID(server.getLogger(), id).Debugf("upgraded websocket connection for %s from %s", id, conn.RemoteAddr().String())
 	// If unsupported subprotocol, terminate the connection immediately
 	if negotiatedSuprotocol == "" {
+		server.reject("unsupported_subprotocol")
 		server.error(fmt.Errorf("unsupported subprotocols %v for new client %v (%v)", clientSubprotocols, id, r.RemoteAddr))
 		_ = conn.WriteControl(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseProtocolError, "invalid or unsupported subprotocol"),
@@ -537,11 +806,27 @@ out:
 		_ = conn.Close()
 		return
 	}
-	// Check whether client exists
+	// Check whether client exists. The policy is determined outside the lock, as it may invoke a user handler.
+	policy := RejectNewConnection
+	server.connMutex.RLock()
+	existing, exists := server.connections[id]
+	server.connMutex.RUnlock()
+	if exists {
+		policy = server.getDuplicateConnectionPolicy(existing, r)
+	}
 	server.connMutex.Lock()
-	// There is already a connection with the same ID. Close the new one immediately with a PolicyViolation.
-	if _, exists := server.connections[id]; exists {
+	if current, exists := server.connections[id]; exists && policy == ReplaceExistingConnection && current == existing {
+		// Close the existing connection with a PolicyViolation, the new connection takes its place.
+		withClientID(server.getLogger(), id).Infof("replacing existing connection for %s", id)
+		select {
+		case current.closeC <- websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: "replaced by a new connection with the same ID"}:
+		default:
+			// Connection is already being closed
+		}
+	} else if exists {
+		// There is already a connection with the same ID. Close the new one immediately with a PolicyViolation.
 		server.connMutex.Unlock()
+		server.reject("duplicate")
 		server.error(fmt.Errorf("client %s already exists, closing duplicate client", id))
 		_ = conn.WriteControl(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "a connection with this ID already exists"),
@@ -550,8 +835,14 @@ out:
 		return
 	}
 	// Add new client
+	if server.connections == nil {
+		// Server is used as plain HTTP handler, without being started
+		server.connections = make(map[string]*WebSocket)
+	}
 	server.connections[ws.id] = &ws
 	server.connMutex.Unlock()
+	server.metrics.IncCounter(metrics.WsConnectionsTotal, serverLabels)
+	server.metrics.AddGauge(metrics.WsConnections, 1, serverLabels)
 	// Read and write routines are started in separate goroutines and function will return immediately
 	go server.writePump(&ws)
 	go server.readPump(&ws)
@@ -568,32 +859,48 @@ func (server *Server) getReadTimeout() time.Time {
 	return time.Now().Add(server.timeoutConfig.PingWait)
 }
 
+// Reports an incoming connection, which was refused for the given reason.
+func (server *Server) reject(reason string) {
+	server.metrics.IncCounter(metrics.WsConnectionsRejectedTotal, metrics.Labels{metrics.LabelRole: metrics.RoleServer, metrics.LabelReason: reason})
+}
+
 func (server *Server) readPump(ws *WebSocket) {
 	conn := ws.connection
 
 	conn.SetPingHandler(func(appData string) error {
-		log.Debugf("ping received from %s", ws.ID())
+		withClientID(server.getLogger(), ws.ID()).Debugf("ping received from %s", ws.ID())
 		ws.pingMessage <- []byte(appData)
 		err := conn.SetReadDeadline(server.getReadTimeout())
 		return err
 	})
+	conn.SetPongHandler(func(string) error {
+		withClientID(server.getLogger(), ws.ID()).Debugf("pong received from %s", ws.ID())
+		ws.stats.ponged()
+		return conn.SetReadDeadline(server.getReadTimeout())
+	})
 	_ = conn.SetReadDeadline(server.getReadTimeout())
 
 	for {
-		_, message, err := conn.ReadMessage()
+		message, err := ws.readMessage(server.timeoutConfig.WriteWait)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+			if isReadLimitError(err) {
+				server.metrics.IncCounter(metrics.WsMessagesTooBigTotal, serverLabels)
+				server.error(&MessageTooBigError{ID: ws.ID(), Limit: ws.readLimit})
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
 				server.error(fmt.Errorf("read failed unexpectedly for %s: %w", ws.ID(), err))
 			}
-			log.Debugf("handling read error for %s: %v", ws.ID(), err.Error())
+			withClientID(server.getLogger(), ws.ID()).Debugf("handling read error for %s: %v", ws.ID(), err.Error())
 			// Notify writePump of error. Force close will be handled there
 			ws.forceCloseC <- err
 			return
 		}
 
+		server.metrics.IncCounter(metrics.WsMessagesReceivedTotal, serverLabels)
 		if server.messageHandler != nil {
 			var channel Channel = ws
+			atomic.AddInt32(&server.activeHandlers, 1)
 			err = server.messageHandler(channel, message)
+			atomic.AddInt32(&server.activeHandlers, -1)
 			if err != nil {
 				server.error(fmt.Errorf("handling failed for %s: %w", ws.ID(), err))
 				continue
@@ -605,6 +912,12 @@ func (server *Server) readPump(ws *WebSocket) {
 
 func (server *Server) writePump(ws *WebSocket) {
 	conn := ws.connection
+	var pingC <-chan time.Time
+	if server.timeoutConfig.PingPeriod > 0 {
+		ticker := time.NewTicker(server.timeoutConfig.PingPeriod)
+		defer ticker.Stop()
+		pingC = ticker.C
+	}
 
 	for {
 		select {
@@ -617,14 +930,16 @@ func (server *Server) writePump(ws *WebSocket) {
 				return
 			}
 			// Send data
-			err := conn.WriteMessage(websocket.TextMessage, data)
+			err := ws.writeText(data)
 			if err != nil {
+				server.metrics.IncCounter(metrics.WsWriteErrorsTotal, serverLabels)
 				server.error(fmt.Errorf("write failed for %s: %w", ws.ID(), err))
 				// Invoking cleanup, as socket was forcefully closed
 				server.cleanupConnection(ws)
 				return
 			}
-			log.Debugf("written %d bytes to %s", len(data), ws.ID())
+			server.metrics.IncCounter(metrics.WsMessagesSentTotal, serverLabels)
+			withClientID(server.getLogger(), ws.ID()).Debugf("written %d bytes to %s", len(data), ws.ID())
 		case ping := <-ws.pingMessage:
 			_ = conn.SetWriteDeadline(time.Now().Add(server.timeoutConfig.WriteWait))
 			err := conn.WriteMessage(websocket.PongMessage, ping)
@@ -634,9 +949,25 @@ func (server *Server) writePump(ws *WebSocket) {
 				server.cleanupConnection(ws)
 				return
 			}
-			log.Debugf("pong sent to %s", ws.ID())
+			withClientID(server.getLogger(), ws.ID()).Debugf("pong sent to %s", ws.ID())
+		case <-pingC:
+			// Send periodic ping
+			_ = conn.SetWriteDeadline(time.Now().Add(server.timeoutConfig.WriteWait))
+			if err := ws.writePing(); err != nil {
+				server.error(fmt.Errorf("failed to send ping message to %s: %w", ws.ID(), err))
+				// Invoking cleanup, as socket was forcefully closed
+				server.cleanupConnection(ws)
+				return
+			}
+			withClientID(server.getLogger(), ws.ID()).Debugf("ping sent to %s", ws.ID())
 		case closeErr := <-ws.closeC:
-			log.Debugf("closing connection to %s", ws.ID())
+			withClientID(server.getLogger(), ws.ID()).Debugf("closing connection to %s", ws.ID())
+			// Flush messages, which were queued before the close signal
+			if err := server.flushQueue(ws); err != nil {
+				server.error(fmt.Errorf("write failed for %s: %w", ws.ID(), err))
+				server.cleanupConnection(ws)
+				return
+			}
 			// Closing connection gracefully
 			if err := conn.WriteControl(
 				websocket.CloseMessage,
@@ -651,7 +982,7 @@ func (server *Server) writePump(ws *WebSocket) {
 		case closed, ok := <-ws.forceCloseC:
 			if !ok || closed != nil {
 				// Connection was forcefully closed, invoke cleanup
-				log.Debugf("handling forced close signal for %s", ws.ID())
+				withClientID(server.getLogger(), ws.ID()).Debugf("handling forced close signal for %s", ws.ID())
 				server.cleanupConnection(ws)
 			}
 			return
@@ -659,6 +990,27 @@ func (server *Server) writePump(ws *WebSocket) {
 	}
 }
 
+// Writes all messages currently waiting in the output queue of a websocket, without blocking.
+func (server *Server) flushQueue(ws *WebSocket) error {
+	for {
+		select {
+		case data, ok := <-ws.outQueue:
+			if !ok {
+				return nil
+			}
+			_ = ws.connection.SetWriteDeadline(time.Now().Add(server.timeoutConfig.WriteWait))
+			if err := ws.writeText(data); err != nil {
+				server.metrics.IncCounter(metrics.WsWriteErrorsTotal, serverLabels)
+				return err
+			}
+			server.metrics.IncCounter(metrics.WsMessagesSentTotal, serverLabels)
+			withClientID(server.getLogger(), ws.ID()).Debugf("written %d bytes to %s", len(data), ws.ID())
+		default:
+			return nil
+		}
+	}
+}
+
 // Frees internal resources after a websocket connection was signaled to be closed.
 // From this moment onwards, no new messages may be sent.
 func (server *Server) cleanupConnection(ws *WebSocket) {
@@ -666,9 +1018,19 @@ func (server *Server) cleanupConnection(ws *WebSocket) {
 	server.connMutex.Lock()
 	close(ws.outQueue)
 	close(ws.closeC)
-	delete(server.connections, ws.id)
+	// A replaced connection must not remove the new connection with the same ID
+	replaced := server.connections[ws.id] != ws
+	if !replaced {
+		delete(server.connections, ws.id)
+	}
 	server.connMutex.Unlock()
-	log.Infof("closed connection to %s", ws.ID())
+	server.metrics.AddGauge(metrics.WsConnections, -1, serverLabels)
+	server.metrics.IncCounter(metrics.WsDisconnectionsTotal, serverLabels)
+	if replaced {
+		withClientID(server.getLogger(), ws.ID()).Infof("closed replaced connection to %s", ws.ID())
+		return
+	}
+	withClientID(server.getLogger(), ws.ID()).Infof("closed connection to %s", ws.ID())
 	if server.disconnectedHandler != nil {
 		server.disconnectedHandler(ws)
 	}
@@ -785,14 +1147,20 @@ type Client struct {
 	url            url.URL
 	messageHandler func(data []byte) error
 	dialOptions    []func(*websocket.Dialer)
+	tlsConfig      *tls.Config
 	header         http.Header
 	timeoutConfig  ClientTimeoutConfig
 	connected      bool
 	onDisconnected func(err error)
 	onReconnected  func()
+	onReconnecting func(attempt int, lastErr error)
+	backoff        BackoffStrategy
+	compression    *CompressionConfig
 	mutex          sync.Mutex
 	errC           chan error
 	reconnectC     chan struct{} // used for signaling, that a reconnection attempt should be interrupted
+	metrics        metrics.Metrics
+	logger         logging.Logger
 }
 
 // Creates a new simple websocket client (the channel is not secured).
@@ -808,6 +1176,7 @@ func NewClient() *Client {
 		dialOptions:   []func(*websocket.Dialer){},
 		timeoutConfig: NewClientTimeoutConfig(),
 		header:        http.Header{},
+		metrics:       &metrics.VoidMetrics{},
 	}
 }
 
@@ -831,13 +1200,29 @@ func NewClient() *Client {
 //
 //	InsecureSkipVerify: true
 func NewTLSClient(tlsConfig *tls.Config) *Client {
-	client := &Client{dialOptions: []func(*websocket.Dialer){}, timeoutConfig: NewClientTimeoutConfig(), header: http.Header{}}
-	client.dialOptions = append(client.dialOptions, func(dialer *websocket.Dialer) {
-		dialer.TLSClientConfig = tlsConfig
-	})
+	client := &Client{dialOptions: []func(*websocket.Dialer){}, timeoutConfig: NewClientTimeoutConfig(), header: http.Header{}, metrics: &metrics.VoidMetrics{}}
+	client.tlsConfig = tlsConfig
 	return client
 }
 
+// SetTLSConfig replaces the TLS configuration of the client, e.g. to swap the trusted root CAs
+// or the client certificate after a rotation.
+//
+// An open connection is not affected. The new configuration is used the next time the client connects,
+// which includes automatic reconnection attempts.
+// Options added via AddOption are applied afterwards, and may hence override the configuration.
+func (client *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.tlsConfig = tlsConfig
+}
+
+func (client *Client) getTLSConfig() *tls.Config {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.tlsConfig
+}
+
 func (client *Client) SetMessageHandler(handler func(data []byte) error) {
 	client.messageHandler = handler
 }
@@ -854,6 +1239,49 @@ func (client *Client) SetReconnectedHandler(handler func()) {
 	client.onReconnected = handler
 }
 
+// Sets a callback, which is invoked right before every automatic reconnection attempt.
+// The callback receives the attempt number (starting from 1) and the error, which caused the previous failure.
+func (client *Client) SetReconnectAttemptHandler(handler func(attempt int, lastErr error)) {
+	client.onReconnecting = handler
+}
+
+// Sets the strategy determining the delay before every automatic reconnection attempt,
+// and when to give up reconnecting.
+//
+// By default, or if nil is passed, the strategy returned by NewDefaultBackoff is used,
+// based on the RetryBackOff parameters of the timeout config.
+func (client *Client) SetBackoffStrategy(strategy BackoffStrategy) {
+	client.backoff = strategy
+}
+
+func (client *Client) getBackoffStrategy() BackoffStrategy {
+	if client.backoff != nil {
+		return client.backoff
+	}
+	return NewDefaultBackoff(client.timeoutConfig)
+}
+
+// Sets the Metrics implementation, which the client reports connection and message metrics to.
+// By default, a VoidMetrics is used.
+//
+// This function must be called before starting the client.
+func (client *Client) SetMetrics(m metrics.Metrics) {
+	client.metrics = m
+}
+
+// Sets a custom Logger implementation for this client only.
+// Passing nil restores the package-level logger (see SetLogger).
+func (client *Client) SetLogger(logger logging.Logger) {
+	client.logger = logger
+}
+
+func (client *Client) getLogger() logging.Logger {
+	if client.logger != nil {
+		return client.logger
+	}
+	return log
+}
+
 func (client *Client) AddOption(option interface{}) {
 	dialOption, ok := option.(func(*websocket.Dialer))
 	if ok {
@@ -909,28 +1337,30 @@ func (client *Client) writePump() {
 		select {
 		case data := <-client.webSocket.outQueue:
 			// Send data
-			log.Debugf("sending data")
+			client.getLogger().Debugf("sending data")
 			_ = conn.SetWriteDeadline(time.Now().Add(client.timeoutConfig.WriteWait))
-			err := conn.WriteMessage(websocket.TextMessage, data)
+			err := client.webSocket.writeText(data)
 			if err != nil {
+				client.metrics.IncCounter(metrics.WsWriteErrorsTotal, clientLabels)
 				client.error(fmt.Errorf("write failed: %w", err))
 				closure(err)
-				client.handleReconnection()
+				client.handleReconnection(err)
 				return
 			}
-			log.Debugf("written %d bytes", len(data))
+			client.metrics.IncCounter(metrics.WsMessagesSentTotal, clientLabels)
+			client.getLogger().Debugf("written %d bytes", len(data))
 		case <-ticker.C:
 			// Send periodic ping
 			_ = conn.SetWriteDeadline(time.Now().Add(client.timeoutConfig.WriteWait))
-			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+			if err := client.webSocket.writePing(); err != nil {
 				client.error(fmt.Errorf("failed to send ping message: %w", err))
 				closure(err)
-				client.handleReconnection()
+				client.handleReconnection(err)
 				return
 			}
-			log.Debugf("ping sent")
+			client.getLogger().Debugf("ping sent")
 		case closeErr := <-client.webSocket.closeC:
-			log.Debugf("closing connection")
+			client.getLogger().Debugf("closing connection")
 			// Closing connection gracefully
 			if err := conn.WriteControl(
 				websocket.CloseMessage,
@@ -944,11 +1374,11 @@ func (client *Client) writePump() {
 			closure(nil)
 			return
 		case closed, ok := <-client.webSocket.forceCloseC:
-			log.Debugf("handling forced close signal")
+			client.getLogger().Debugf("handling forced close signal")
 			// Read pump sent a forceClose signal (reading failed -> aborting the connection)
 			if !ok || closed != nil {
 				closure(closed)
-				client.handleReconnection()
+				client.handleReconnection(closed)
 				return
 			}
 		}
@@ -959,13 +1389,17 @@ func (client *Client) readPump() {
 	conn := client.webSocket.connection
 	_ = conn.SetReadDeadline(client.getReadTimeout())
 	conn.SetPongHandler(func(string) error {
-		log.Debugf("pong received")
+		client.getLogger().Debugf("pong received")
+		client.webSocket.stats.ponged()
 		return conn.SetReadDeadline(client.getReadTimeout())
 	})
 	for {
-		_, message, err := conn.ReadMessage()
+		message, err := client.webSocket.readMessage(client.timeoutConfig.WriteWait)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+			if isReadLimitError(err) {
+				client.metrics.IncCounter(metrics.WsMessagesTooBigTotal, clientLabels)
+				client.error(&MessageTooBigError{Limit: client.webSocket.readLimit})
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
 				client.error(fmt.Errorf("read failed: %w", err))
 			}
 			// Notify writePump of error. Forced close will be handled there
@@ -973,7 +1407,8 @@ func (client *Client) readPump() {
 			return
 		}
 
-		log.Debugf("received %v bytes", len(message))
+		client.metrics.IncCounter(metrics.WsMessagesReceivedTotal, clientLabels)
+		client.getLogger().Debugf("received %v bytes", len(message))
 		if client.messageHandler != nil {
 			err = client.messageHandler(message)
 			if err != nil {
@@ -994,13 +1429,19 @@ func (client *Client) cleanup() {
 	defer client.mutex.Unlock()
 	close(ws.outQueue)
 	close(ws.closeC)
+	client.metrics.AddGauge(metrics.WsConnections, -1, clientLabels)
+	client.metrics.IncCounter(metrics.WsDisconnectionsTotal, clientLabels)
 }
 
-func (client *Client) handleReconnection() {
-	log.Info("started automatic reconnection handler")
-	delay := client.timeoutConfig.RetryBackOffWaitMinimum + time.Duration(rand.Intn(client.timeoutConfig.RetryBackOffRandomRange+1))*time.Second
-	reconnectionAttempts := 1
-	for {
+func (client *Client) handleReconnection(lastErr error) {
+	client.getLogger().Info("started automatic reconnection handler")
+	backoff := client.getBackoffStrategy()
+	for reconnectionAttempts := 1; ; reconnectionAttempts++ {
+		delay, ok := backoff.NextDelay(reconnectionAttempts, lastErr)
+		if !ok {
+			client.error(fmt.Errorf("giving up reconnection after %d attempts: %w", reconnectionAttempts-1, lastErr))
+			return
+		}
 		// Wait before reconnecting
 		select {
 		case <-time.After(delay):
@@ -1008,24 +1449,23 @@ func (client *Client) handleReconnection() {
 			return
 		}
 
-		log.Info("reconnecting... attempt", reconnectionAttempts)
+		client.getLogger().Info("reconnecting... attempt", reconnectionAttempts)
+		if client.onReconnecting != nil {
+			client.onReconnecting(reconnectionAttempts, lastErr)
+		}
+		client.metrics.IncCounter(metrics.WsReconnectAttemptsTotal, clientLabels)
 		err := client.Start(client.url.String())
 		if err == nil {
 			// Re-connection was successful
-			log.Info("reconnected successfully to server")
+			client.getLogger().Info("reconnected successfully to server")
+			client.metrics.IncCounter(metrics.WsReconnectsTotal, clientLabels)
 			if client.onReconnected != nil {
 				client.onReconnected()
 			}
 			return
 		}
 		client.error(fmt.Errorf("reconnection failed: %w", err))
-
-		if reconnectionAttempts < client.timeoutConfig.RetryBackOffRepeatTimes {
-			// Re-connection failed, double the delay
-			delay *= 2
-			delay += time.Duration(rand.Intn(client.timeoutConfig.RetryBackOffRandomRange+1)) * time.Second
-		}
-		reconnectionAttempts += 1
+		lastErr = err
 	}
 }
 
@@ -1045,7 +1485,7 @@ func (client *Client) Write(data []byte) error {
 	if !client.IsConnected() {
 		return fmt.Errorf("client is currently not connected, cannot send data")
 	}
-	log.Debugf("queuing data for server")
+	client.getLogger().Debugf("queuing data for server")
 	client.webSocket.outQueue <- data
 	return nil
 }
@@ -1053,8 +1493,8 @@ func (client *Client) Write(data []byte) error {
 func (client *Client) StartWithRetries(urlStr string) {
 	err := client.Start(urlStr)
 	if err != nil {
-		log.Info("Connection error:", err)
-		client.handleReconnection()
+		client.getLogger().Info("Connection error:", err)
+		client.handleReconnection(err)
 	}
 }
 
@@ -1065,17 +1505,23 @@ func (client *Client) Start(urlStr string) error {
 		return err
 	}
 
+	if client.metrics == nil {
+		client.metrics = &metrics.VoidMetrics{}
+	}
+
 	dialer := websocket.Dialer{
-		ReadBufferSize:   1024,
-		WriteBufferSize:  1024,
-		HandshakeTimeout: client.timeoutConfig.HandshakeTimeout,
-		Subprotocols:     []string{},
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		HandshakeTimeout:  client.timeoutConfig.HandshakeTimeout,
+		Subprotocols:      []string{},
+		TLSClientConfig:   client.getTLSConfig(),
+		EnableCompression: client.compression != nil,
 	}
 	for _, option := range client.dialOptions {
 		option(&dialer)
 	}
 	// Connect
-	log.Info("connecting to server")
+	client.getLogger().Info("connecting to server")
 	ws, resp, err := dialer.Dial(urlStr, client.header)
 	if err != nil {
 		if resp != nil {
@@ -1101,10 +1547,16 @@ func (client *Client) Start(urlStr string) error {
 		closeC:             make(chan websocket.CloseError, 1),
 		forceCloseC:        make(chan error, 1),
 		tlsConnectionState: resp.TLS,
+		subProtocol:        ws.Subprotocol(),
+		stats:              newConnectionStats(),
 	}
-	log.Infof("connected to server as %s", id)
+	client.webSocket.setCompression(client.compression, offersCompression(resp.Header))
+	client.webSocket.setReadLimit(client.timeoutConfig.MaxMessageSize)
+	client.getLogger().Infof("connected to server as %s", id)
 	client.reconnectC = make(chan struct{})
 	client.setConnected(true)
+	client.metrics.IncCounter(metrics.WsConnectionsTotal, clientLabels)
+	client.metrics.AddGauge(metrics.WsConnections, 1, clientLabels)
 	// Start reader and write routine
 	go client.writePump()
 	go client.readPump()
@@ -1112,7 +1564,7 @@ func (client *Client) Start(urlStr string) error {
 }
 
 func (client *Client) Stop() {
-	log.Infof("closing connection to server")
+	client.getLogger().Infof("closing connection to server")
 	client.mutex.Lock()
 	if client.connected {
 		client.connected = false
@@ -1135,7 +1587,7 @@ func (client *Client) Stop() {
 }
 
 func (client *Client) error(err error) {
-	log.Error(err)
+	client.getLogger().Error(err)
 	if client.errC != nil {
 		client.errC <- err
 	}
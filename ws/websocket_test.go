@@ -17,6 +17,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -346,6 +347,108 @@ func TestClientDuplicateConnection(t *testing.T) {
 	wsServer.Stop()
 }
 
+func TestClientDuplicateConnectionReplace(t *testing.T) {
+	message := []byte("Hello WebSocket!")
+	wsServer := newWebsocketServer(t, nil)
+	wsServer.SetDuplicateConnectionPolicy(ReplaceExistingConnection)
+	connectedC := make(chan Channel, 2)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	wsServer.SetDisconnectedClientHandler(func(ws Channel) {
+		t.Errorf("unexpected disconnection of %v", ws.ID())
+	})
+	// Start server
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	// Connect client 1
+	wsClient1 := newWebsocketClient(t, nil)
+	disconnectC := make(chan error, 1)
+	wsClient1.SetDisconnectedHandler(func(err error) {
+		disconnectC <- err
+	})
+	err := wsClient1.Start(u.String())
+	require.NoError(t, err)
+	channel1 := <-connectedC
+	// Connect client 2, which replaces client 1
+	receivedC := make(chan []byte, 1)
+	wsClient2 := newWebsocketClient(t, func(data []byte) ([]byte, error) {
+		receivedC <- data
+		return nil, nil
+	})
+	err = wsClient2.Start(u.String())
+	require.NoError(t, err)
+	channel2 := <-connectedC
+	assert.Equal(t, channel1.ID(), channel2.ID())
+	assert.NotSame(t, channel1, channel2)
+	err = <-disconnectC
+	require.IsType(t, &websocket.CloseError{}, err)
+	wsErr, _ := err.(*websocket.CloseError)
+	assert.Equal(t, websocket.ClosePolicyViolation, wsErr.Code)
+	assert.Equal(t, "replaced by a new connection with the same ID", wsErr.Text)
+	// Messages are sent to the new connection
+	err = wsServer.Write(path.Base(testPath), message)
+	require.NoError(t, err)
+	assert.Equal(t, message, <-receivedC)
+	// Cleanup
+	wsServer.SetDisconnectedClientHandler(nil)
+	wsClient1.Stop()
+	wsClient2.Stop()
+	wsServer.Stop()
+}
+
+func TestClientDuplicateConnectionHandler(t *testing.T) {
+	wsServer := newWebsocketServer(t, nil)
+	handlerC := make(chan Channel, 1)
+	wsServer.SetDuplicateConnectionHandler(func(existing Channel, r *http.Request) DuplicateConnectionPolicy {
+		handlerC <- existing
+		if r.Header.Get("X-Replace") != "" {
+			return ReplaceExistingConnection
+		}
+		return RejectNewConnection
+	})
+	connectedC := make(chan Channel, 2)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	// Start server
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	wsClient1 := newWebsocketClient(t, nil)
+	err := wsClient1.Start(u.String())
+	require.NoError(t, err)
+	channel1 := <-connectedC
+	// Handler rejects the duplicate
+	disconnectC := make(chan error, 1)
+	wsClient2 := newWebsocketClient(t, nil)
+	wsClient2.SetDisconnectedHandler(func(err error) {
+		disconnectC <- err
+	})
+	err = wsClient2.Start(u.String())
+	require.NoError(t, err)
+	assert.Same(t, channel1, <-handlerC)
+	err = <-disconnectC
+	require.IsType(t, &websocket.CloseError{}, err)
+	assert.Equal(t, "a connection with this ID already exists", err.(*websocket.CloseError).Text)
+	// Handler accepts the duplicate
+	wsClient3 := newWebsocketClient(t, nil)
+	wsClient3.SetHeaderValue("X-Replace", "true")
+	err = wsClient3.Start(u.String())
+	require.NoError(t, err)
+	assert.Same(t, channel1, <-handlerC)
+	channel3 := <-connectedC
+	assert.NotSame(t, channel1, channel3)
+	// Cleanup
+	wsClient1.Stop()
+	wsClient2.Stop()
+	wsClient3.Stop()
+	wsServer.Stop()
+}
+
 func TestServerStopConnection(t *testing.T) {
 	triggerC := make(chan struct{}, 1)
 	disconnectedClientC := make(chan struct{}, 1)
@@ -1111,6 +1214,68 @@ func TestClientErrors(t *testing.T) {
 	close(finishC)
 }
 
+type recordingLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(line string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, line)
+}
+
+func (l *recordingLogger) contains(substr string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *recordingLogger) Debug(args ...interface{}) { l.record(fmt.Sprint(args...)) }
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.record(fmt.Sprintf(format, args...))
+}
+func (l *recordingLogger) Info(args ...interface{}) { l.record(fmt.Sprint(args...)) }
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.record(fmt.Sprintf(format, args...))
+}
+func (l *recordingLogger) Error(args ...interface{}) { l.record(fmt.Sprint(args...)) }
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.record(fmt.Sprintf(format, args...))
+}
+
+func TestInstanceLogger(t *testing.T) {
+	serverLogger := &recordingLogger{}
+	clientLogger := &recordingLogger{}
+	connectedC := make(chan bool, 1)
+	wsServer := newWebsocketServer(t, nil)
+	wsServer.SetLogger(serverLogger)
+	wsServer.SetNewClientHandler(func(ws Channel) {
+		connectedC <- true
+	})
+	wsClient := newWebsocketClient(t, nil)
+	wsClient.SetLogger(clientLogger)
+	go wsServer.Start(serverPort, serverPath)
+	time.Sleep(200 * time.Millisecond)
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	err := wsClient.Start(u.String())
+	require.NoError(t, err)
+	<-connectedC
+	wsClient.Stop()
+	wsServer.Stop()
+	// Each instance logs to its own logger only
+	assert.True(t, serverLogger.contains("listening on tcp network"))
+	assert.False(t, serverLogger.contains("connecting to server"))
+	assert.True(t, clientLogger.contains("connecting to server"))
+	assert.False(t, clientLogger.contains("listening on tcp network"))
+}
+
 // Utility functions
 
 func createCACertificate(certificateFilename string, keyFilename string) (*x509.Certificate, *ecdsa.PrivateKey, error) {